@@ -2,16 +2,31 @@ package main
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"github.com/cloud-drive/api-gateway/internal/clients"
 	"github.com/cloud-drive/api-gateway/internal/config"
 	"github.com/cloud-drive/api-gateway/internal/handlers"
+	"github.com/cloud-drive/api-gateway/internal/metrics"
 	"github.com/cloud-drive/api-gateway/internal/middleware"
+	"github.com/cloud-drive/api-gateway/internal/openapi"
+	"github.com/cloud-drive/api-gateway/internal/proxy"
+	"github.com/cloud-drive/api-gateway/internal/ratelimit"
+	sharedconfig "github.com/cloud-drive/shared/config"
+	sharedhealth "github.com/cloud-drive/shared/health"
+	"github.com/cloud-drive/shared/identity"
+	"github.com/cloud-drive/shared/interceptor"
+	"github.com/cloud-drive/shared/logging"
+	sharedmetrics "github.com/cloud-drive/shared/metrics"
+	"github.com/cloud-drive/shared/shutdown"
+	"github.com/cloud-drive/shared/tracing"
 	"github.com/gorilla/mux"
 	consulapi "github.com/hashicorp/consul/api"
-	"log"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"google.golang.org/grpc"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
@@ -20,15 +35,46 @@ import (
 )
 
 func main() {
-	// Load configuration
-	cfg := config.LoadConfig()
+	// Load configuration: defaults < config file < env < flags
+	reloader, err := config.NewReloader(os.Args[1:])
+	switch {
+	case errors.Is(err, flag.ErrHelp), errors.Is(err, sharedconfig.ErrPrinted):
+		// --help và --print-config đã in xong, không khởi động service
+		return
+	case err != nil:
+		fmt.Fprintf(os.Stderr, "Invalid configuration: %v\n", err)
+		os.Exit(1)
+	}
+	cfg := reloader.Current()
 
-	// Parse command-line flags (chỉ ghi đè nếu cung cấp)
-	flag.IntVar(&cfg.Port, "port", cfg.Port, "API Gateway port")
-	flag.Parse()
+	// Structured logger, level có thể reload
+	logger, logLevel, err := logging.New(os.Stdout, cfg.LogFormat, cfg.LogLevel)
+	if err != nil {
+		fatal("Failed to create logger", "error", err)
+	}
+	slog.SetDefault(logger)
+
+	// OpenTelemetry tracing, traceparent được chuyển tiếp tới user-service và file-service
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Config{
+		ServiceName:  "api-gateway",
+		Environment:  cfg.Environment,
+		Exporter:     cfg.TraceExporter,
+		OTLPEndpoint: cfg.TraceEndpoint,
+		OTLPInsecure: cfg.TraceInsecure,
+		SampleRatio:  cfg.TraceSampleRatio,
+	})
+	if err != nil {
+		fatal("Failed to set up tracing", "error", err)
+	}
 
 	// Log thông tin môi trường
-	log.Printf("Starting API Gateway in %s environment with host mode: %s", cfg.Environment, cfg.HostMode)
+	slog.Info("Starting API Gateway", "environment", cfg.Environment, "host_mode", cfg.HostMode)
+
+	// Prometheus registry: Go runtime, HTTP, gRPC client, auth và Consul metrics
+	registry := sharedmetrics.NewRegistry()
+	gatewayMetrics := metrics.New(registry)
+	grpcClientMetrics := sharedmetrics.NewGRPCClientMetrics(registry)
+	consulMetrics := sharedmetrics.NewConsulMetrics(registry)
 
 	// Create router
 	router := mux.NewRouter()
@@ -39,170 +85,302 @@ func main() {
 		fallbackURL = "user-service:9001"
 	}
 
-	userClient, err := clients.NewUserClient(cfg.ConsulURL, fallbackURL)
-	if err != nil {
-		log.Fatalf("Failed to create user service client: %v", err)
+	// Gateway tự xác thực với user service bằng token và/hoặc client certificate,
+	// người dùng của request được chuyển tiếp dưới dạng identity đã ký
+	identitySigner := identity.NewSigner(cfg.IdentitySecret, "api-gateway", identity.DefaultTTL)
+	userClientOpts := []grpc.DialOption{
+		grpc.WithChainUnaryInterceptor(
+			grpcClientMetrics.UnaryClientInterceptor(),
+			identitySigner.UnaryClientInterceptor(middleware.IdentityFromContext),
+		),
+		grpc.WithChainStreamInterceptor(
+			grpcClientMetrics.StreamClientInterceptor(),
+			identitySigner.StreamClientInterceptor(middleware.IdentityFromContext),
+		),
+		grpc.WithStatsHandler(otelgrpc.NewClientHandler()),
 	}
-	defer userClient.Close()
-
-	// Create service router
-	serviceRouter, err := handlers.NewServiceRouter(fallbackURL)
-	if err != nil {
-		log.Fatalf("Failed to create service router: %v", err)
+	if cfg.ServiceToken != "" {
+		userClientOpts = append(userClientOpts, grpc.WithPerRPCCredentials(interceptor.TokenCredentials(cfg.ServiceToken)))
 	}
-
-	// Health check endpoint
-	router.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("API Gateway is healthy"))
-	})
-
-	// Đăng ký các route xác thực
-	handlers.RegisterAuthRoutes(router, userClient, cfg)
-
-	// Middleware xác thực JWT
-	authMiddleware := middleware.AuthMiddleware(cfg)
-
-	// API endpoints for user service
-	userRouter := router.PathPrefix("/api/users").Subrouter()
-	// Áp dụng middleware xác thực cho tất cả các route user
-	userRouter.Use(authMiddleware)
-
-	// Get users - cần quyền admin
-	userRouter.HandleFunc("", func(w http.ResponseWriter, r *http.Request) {
-		// Kiểm tra role admin
-		claims, ok := r.Context().Value("claims").(*middleware.Claims)
-		if !ok || claims.Role != "admin" {
-			http.Error(w, "Forbidden - requires admin privileges", http.StatusForbidden)
-			return
-		}
-
-		log.Printf("Received request for /api/users")
-		ctx := r.Context()
-
-		log.Printf("Calling ListUsers with client: %v", userClient)
-		resp, err := userClient.ListUsers(ctx, 10, 0)
+	if cfg.ServiceTLSCert != "" {
+		creds, err := interceptor.ClientTLS(cfg.ServiceTLSCert, cfg.ServiceTLSKey, cfg.ServiceTLSCA, cfg.ServiceTLSName)
 		if err != nil {
-			log.Printf("Error calling ListUsers: %v", err)
-			http.Error(w, fmt.Sprintf("Failed to get users: %v", err), http.StatusInternalServerError)
-			return
-		}
-
-		log.Printf("Got response from ListUsers: %+v", resp)
-		w.Header().Set("Content-Type", "application/json")
-		if err := json.NewEncoder(w).Encode(resp); err != nil {
-			log.Printf("Error encoding response: %v", err)
-			http.Error(w, "Error encoding response", http.StatusInternalServerError)
-			return
-		}
-		log.Printf("Successfully responded to /api/users")
-	}).Methods("GET")
-
-	// Create user - chỉ admin mới được tạo người dùng (endpoint này khác với register)
-	userRouter.HandleFunc("", func(w http.ResponseWriter, r *http.Request) {
-		// Kiểm tra role admin
-		claims, ok := r.Context().Value("claims").(*middleware.Claims)
-		if !ok || claims.Role != "admin" {
-			http.Error(w, "Forbidden - requires admin privileges", http.StatusForbidden)
-			return
+			fatal("Failed to load user service TLS credentials", "error", err)
 		}
+		userClientOpts = append(userClientOpts, grpc.WithTransportCredentials(creds))
+	}
+	userClient, err := clients.NewUserClient(cfg.ConsulURL, fallbackURL, userClientOpts...)
+	if err != nil {
+		fatal("Failed to create user service client", "error", err)
+	}
 
-		// Implementation will be added later
-	}).Methods("POST")
-
-	// Get user by ID - người dùng chỉ xem được thông tin của chính mình, admin xem được tất cả
-	userRouter.HandleFunc("/{id}", func(w http.ResponseWriter, r *http.Request) {
-		vars := mux.Vars(r)
-		id := vars["id"]
-
-		// Chỉ cho phép xem thông tin của chính mình hoặc là admin
-		claims, ok := r.Context().Value("claims").(*middleware.Claims)
-		if !ok || (claims.UserID != id && claims.Role != "admin") {
-			http.Error(w, "Forbidden - you can only access your own information", http.StatusForbidden)
-			return
-		}
-
-		// Implementation will be added later
-	}).Methods("GET")
-
-	// Update user - người dùng chỉ cập nhật được thông tin của chính mình
-	userRouter.HandleFunc("/{id}", func(w http.ResponseWriter, r *http.Request) {
-		vars := mux.Vars(r)
-		id := vars["id"]
-
-		// Chỉ cho phép cập nhật thông tin của chính mình hoặc là admin
-		claims, ok := r.Context().Value("claims").(*middleware.Claims)
-		if !ok || (claims.UserID != id && claims.Role != "admin") {
-			http.Error(w, "Forbidden - you can only update your own information", http.StatusForbidden)
-			return
+	// File service client: cùng interceptor và client certificate, token riêng
+	fileFallbackURL := "localhost:9002"
+	if cfg.HostMode == "docker" {
+		fileFallbackURL = "file-service:9002"
+	}
+	fileClientOpts := []grpc.DialOption{
+		grpc.WithChainUnaryInterceptor(
+			grpcClientMetrics.UnaryClientInterceptor(),
+			identitySigner.UnaryClientInterceptor(middleware.IdentityFromContext),
+		),
+		grpc.WithChainStreamInterceptor(
+			grpcClientMetrics.StreamClientInterceptor(),
+			identitySigner.StreamClientInterceptor(middleware.IdentityFromContext),
+		),
+		grpc.WithStatsHandler(otelgrpc.NewClientHandler()),
+	}
+	if cfg.FileToken != "" {
+		fileClientOpts = append(fileClientOpts, grpc.WithPerRPCCredentials(interceptor.TokenCredentials(cfg.FileToken)))
+	}
+	if cfg.ServiceTLSCert != "" {
+		creds, err := interceptor.ClientTLS(cfg.ServiceTLSCert, cfg.ServiceTLSKey, cfg.ServiceTLSCA, cfg.FileTLSName)
+		if err != nil {
+			fatal("Failed to load file service TLS credentials", "error", err)
 		}
+		fileClientOpts = append(fileClientOpts, grpc.WithTransportCredentials(creds))
+	}
+	fileClient, err := clients.NewFileClient(cfg.ConsulURL, fileFallbackURL, cfg.MaxUploadSize, fileClientOpts...)
+	if err != nil {
+		fatal("Failed to create file service client", "error", err)
+	}
 
-		// Implementation will be added later
-	}).Methods("PUT")
-
-	// Delete user - chỉ admin mới được xóa người dùng
-	userRouter.HandleFunc("/{id}", func(w http.ResponseWriter, r *http.Request) {
-		// Kiểm tra role admin
-		claims, ok := r.Context().Value("claims").(*middleware.Claims)
-		if !ok || claims.Role != "admin" {
-			http.Error(w, "Forbidden - requires admin privileges", http.StatusForbidden)
-			return
-		}
+	// Reverse proxy tới các service HTTP theo bảng route trong cấu hình, upstream lấy từ Consul
+	consulConfig := consulapi.DefaultConfig()
+	consulConfig.Address = cfg.ConsulURL
+	consulClient, err := consulapi.NewClient(consulConfig)
+	if err != nil {
+		fatal("Failed to create Consul client", "error", err)
+	}
+	serviceRouter := handlers.NewServiceRouter(cfg.ProxyTable(),
+		proxy.NewConsulResolver(consulClient, cfg.ProxyCacheTTL), middleware.AuthMiddleware(cfg, userClient))
+
+	// Health check: gateway chỉ sẵn sàng khi user-service SERVING; file-service
+	// hoặc Consul lỗi chỉ làm trạng thái degraded
+	checker := sharedhealth.NewChecker(2 * time.Second)
+	checker.Add("user-service", true, sharedhealth.GRPCCheck(userClient.Conn(), "user.UserService"))
+	checker.Add("file-service", false, sharedhealth.GRPCCheck(fileClient.Conn(), "file.FileService"))
+	checker.Add("consul", false, sharedhealth.ConsulCheck(consulClient))
+
+	// OpenAPI spec: tài liệu, kiểm tra request và hợp đồng với các route
+	spec, err := openapi.Load()
+	if err != nil {
+		fatal("Failed to load OpenAPI spec", "error", err)
+	}
+	authHandler, err := registerRoutes(router, routeDeps{
+		cfg:           cfg,
+		spec:          spec,
+		checker:       checker,
+		registry:      registry,
+		metrics:       gatewayMetrics,
+		userClient:    userClient,
+		fileClient:    fileClient,
+		serviceRouter: serviceRouter,
+	})
+	if err != nil {
+		fatal("Failed to register routes", "error", err)
+	}
 
-		// Implementation will be added later
-	}).Methods("DELETE")
+	// Mọi route phải được mô tả trong spec (TestRoutesAreInSpec kiểm tra khi chạy test)
+	if missing := spec.MissingRoutes(router); len(missing) > 0 {
+		slog.Warn("Routes missing from the OpenAPI spec", "routes", missing)
+	}
 
-	// Legacy proxy routes
-	router.PathPrefix("/users").Handler(serviceRouter.Handler())
+	// Rate limit theo IP/user/route, rule có thể reload
+	rateLimitStore := ratelimit.NewMemoryStore(10 * time.Minute)
+	defer rateLimitStore.Close()
+	limiter := ratelimit.NewLimiter(rateLimitStore, cfg.RateLimitPolicies())
+
+	// Middleware chung cho mọi route: timeout theo route, tracing, request ID + access log,
+	// header bảo mật, CORS (preflight được trả lời trước rate limit), metrics theo route,
+	// rate limit, kiểm tra request theo OpenAPI spec
+	handler := spec.Validator()(router)
+	handler = middleware.RateLimit(limiter, cfg.TrustedProxyNets(), cfg, gatewayMetrics)(handler)
+	handler = middleware.Metrics(router, gatewayMetrics)(handler)
+	if len(cfg.CORSOrigins) > 0 {
+		// Client tus trên trình duyệt cần đọc được các header upload
+		exposedHeaders := []string{logging.RequestIDHeader, "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "Retry-After",
+			"Location", "Tus-Resumable", "Tus-Version", "Tus-Extension", "Tus-Max-Size", "Tus-Checksum-Algorithm",
+			"Upload-Offset", "Upload-Length", "Upload-Expires", "Upload-Metadata", "X-File-Id"}
+		handler = middleware.CORS(middleware.CORSOptions{
+			AllowedOrigins:   cfg.CORSOrigins,
+			AllowedMethods:   cfg.CORSMethods,
+			AllowedHeaders:   cfg.CORSHeaders,
+			ExposedHeaders:   exposedHeaders,
+			AllowCredentials: cfg.CORSCredentials,
+			MaxAge:           cfg.CORSMaxAge,
+		})(handler)
+	}
+	handler = middleware.SecurityHeaders(cfg.HSTSMaxAge, cfg.TrustedProxyNets())(handler)
+	handler = middleware.RequestLogger(logger)(handler)
+	handler = middleware.Tracing(router)(handler)
+	// Timeout riêng cho upload/download lớn thay cho timeout 15s của server
+	handler = middleware.RouteDeadlines(cfg.RouteDeadlines())(handler)
 
 	// Create HTTP server
 	srv := &http.Server{
 		Addr:         fmt.Sprintf(":%d", cfg.Port),
-		Handler:      router,
+		Handler:      handler,
 		ReadTimeout:  15 * time.Second,
 		WriteTimeout: 15 * time.Second,
 		IdleTimeout:  60 * time.Second,
 	}
 
-	// Register with Consul
-	go registerWithConsul(cfg)
+	// Reload các thiết lập runtime (log level, JWT expiration) khi nhận SIGHUP hoặc Consul KV thay đổi
+	reloadCtx, stopReload := context.WithCancel(context.Background())
+	defer stopReload()
+	reloader.Subscribe(func(old, next *config.Config) {
+		if old.LogLevel != next.LogLevel {
+			if err := logging.SetLevel(logLevel, next.LogLevel); err != nil {
+				slog.Error("Failed to change log level", "error", err)
+			} else {
+				slog.Info("Log level changed", "from", old.LogLevel, "to", next.LogLevel)
+			}
+		}
+		authHandler.ApplyConfig(next)
+		limiter.SetRules(next.RateLimitPolicies())
+		serviceRouter.SetRoutes(next.ProxyTable())
+	})
+	reloader.WatchSignals(reloadCtx, syscall.SIGHUP)
+	if cfg.ConsulKey != "" {
+		watchConsulConfig(reloadCtx, cfg, reloader)
+	}
+
+	// Register with Consul, keep-alive dừng khi bắt đầu shutdown
+	registration := consulRegistration(cfg)
+	keepAliveCtx, stopKeepAlive := context.WithCancel(context.Background())
+	keepAliveDone := make(chan struct{})
+	go func() {
+		defer close(keepAliveDone)
+		registerWithConsul(keepAliveCtx, consulClient, registration, consulMetrics)
+	}()
 
 	// Start server in a goroutine
 	go func() {
-		log.Printf("Starting API Gateway on port %d\n", cfg.Port)
+		slog.Info("API Gateway listening", "port", cfg.Port)
 		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("Failed to start server: %v", err)
+			fatal("Failed to start server", "error", err)
 		}
 	}()
 
+	// Thứ tự shutdown: báo not ready, rời Consul, chờ nginx và client cập nhật,
+	// drain request đang chạy (quá hạn thì đóng kết nối), đóng kết nối gRPC rồi flush trace
+	stopping := shutdown.New(cfg.ShutdownDelay, cfg.ShutdownTimeout)
+	stopping.Add(shutdown.PhaseNotReady, "health", func(ctx context.Context) error {
+		checker.SetShuttingDown()
+		return nil
+	})
+	stopping.Add(shutdown.PhaseDeregister, "consul", func(ctx context.Context) error {
+		stopKeepAlive()
+		select {
+		case <-keepAliveDone:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		return consulClient.Agent().ServiceDeregisterOpts(registration.ID, (&consulapi.QueryOptions{}).WithContext(ctx))
+	})
+	stopping.Add(shutdown.PhaseDrain, "http", shutdown.HTTPServer(srv))
+	stopping.Add(shutdown.PhaseClose, "user-service client", func(ctx context.Context) error {
+		userClient.Close()
+		return nil
+	})
+	stopping.Add(shutdown.PhaseClose, "file-service client", func(ctx context.Context) error {
+		fileClient.Close()
+		return nil
+	})
+	stopping.Add(shutdown.PhaseFlush, "tracing", shutdownTracing)
+
 	// Wait for interrupt signal
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
-	log.Println("Shutting down API Gateway...")
+	slog.Info("Shutting down API Gateway", "propagation_delay", cfg.ShutdownDelay, "drain_timeout", cfg.ShutdownTimeout)
+
+	if err := stopping.Run(context.Background()); err != nil {
+		slog.Warn("API Gateway stopped with errors", "error", err)
+		return
+	}
+	slog.Info("API Gateway stopped")
+}
+
+// routeDeps là những gì các route HTTP của gateway cần
+type routeDeps struct {
+	cfg           *config.Config
+	spec          *openapi.Spec
+	checker       *sharedhealth.Checker
+	registry      *prometheus.Registry
+	metrics       *metrics.Metrics
+	userClient    *clients.UserClient
+	fileClient    *clients.FileClient
+	serviceRouter *handlers.ServiceRouter
+}
+
+// registerRoutes đăng ký mọi route HTTP của gateway và trả về handler xác thực
+// để áp dụng cấu hình mới khi reload
+func registerRoutes(router *mux.Router, deps routeDeps) (*handlers.AuthHandler, error) {
+	router.Handle("/livez", sharedhealth.LivezHandler()).Methods("GET")
+	router.Handle("/readyz", deps.checker.ReadyzHandler()).Methods("GET")
+	// Chi tiết từng dependency cho vận hành (nginx chặn truy cập từ bên ngoài)
+	router.Handle("/health/details", deps.checker.DetailsHandler()).Methods("GET")
+	// Giữ /health cho các client cũ, tương đương /readyz
+	router.Handle("/health", deps.checker.ReadyzHandler()).Methods("GET")
+
+	// Prometheus metrics endpoint (nginx chặn truy cập từ bên ngoài)
+	router.Handle("/metrics", sharedmetrics.Handler(deps.registry)).Methods("GET")
+
+	// OpenAPI spec và trang tài liệu
+	router.Handle("/openapi.json", deps.spec.Handler()).Methods("GET")
+	router.Handle("/docs", openapi.DocsHandler("/openapi.json")).Methods("GET")
 
-	// Gracefully shutdown
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+	// Đăng ký các route xác thực
+	authHandler := handlers.RegisterAuthRoutes(router, deps.userClient, deps.cfg, deps.metrics)
+
+	// REST endpoints cho user-service, sinh từ HTTP annotation trong user.proto
+	userRoutes, err := handlers.RegisterUserRoutes(router, deps.userClient, deps.cfg)
+	if err != nil {
+		return nil, fmt.Errorf("register user-service routes: %w", err)
+	}
+	for _, route := range userRoutes {
+		slog.Debug("Registered transcoded route", "route", route.String())
+	}
 
-	if err := srv.Shutdown(ctx); err != nil {
-		log.Fatalf("Server shutdown failed: %v", err)
+	// Upload/download nội dung file và REST endpoints sinh từ file.proto
+	fileRoutes, err := handlers.RegisterFileRoutes(router, deps.fileClient, deps.userClient, deps.cfg)
+	if err != nil {
+		return nil, fmt.Errorf("register file-service routes: %w", err)
 	}
+	for _, route := range fileRoutes {
+		slog.Debug("Registered transcoded route", "route", route.String())
+	}
+
+	// Các route proxy (PROXY_ROUTES), đăng ký sau cùng để không che các route ở trên
+	deps.serviceRouter.Register(router)
+	return authHandler, nil
+}
 
-	log.Println("API Gateway stopped")
+// fatal logs at error level and exits
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
 }
 
-// registerWithConsul registers the service with Consul
-func registerWithConsul(cfg *config.Config) {
+// watchConsulConfig applies runtime overrides stored in Consul KV
+func watchConsulConfig(ctx context.Context, cfg *config.Config, reloader *sharedconfig.Reloader[config.Config]) {
 	consulConfig := consulapi.DefaultConfig()
 	consulConfig.Address = cfg.ConsulURL
 
 	client, err := consulapi.NewClient(consulConfig)
 	if err != nil {
-		log.Printf("Failed to create Consul client: %v", err)
+		slog.Error("Failed to create Consul client for config watch", "error", err)
 		return
 	}
 
+	slog.Info("Watching Consul for configuration overrides", "key", cfg.ConsulKey)
+	sharedconfig.WatchConsulKV(ctx, client, cfg.ConsulKey, reloader)
+}
+
+// consulRegistration describes this instance for Consul
+func consulRegistration(cfg *config.Config) *consulapi.AgentServiceRegistration {
 	hostname, err := os.Hostname()
 	if err != nil {
 		hostname = "unknown"
@@ -214,35 +392,52 @@ func registerWithConsul(cfg *config.Config) {
 		serviceAddress = "localhost"
 	}
 
-	registration := &consulapi.AgentServiceRegistration{
+	return &consulapi.AgentServiceRegistration{
 		ID:      fmt.Sprintf("api-gateway-%s-%d", hostname, cfg.Port),
 		Name:    "api-gateway",
 		Port:    cfg.Port,
 		Address: serviceAddress,
 		Check: &consulapi.AgentServiceCheck{
-			HTTP:                           fmt.Sprintf("http://%s:%d/health", serviceAddress, cfg.Port),
+			HTTP:                           fmt.Sprintf("http://%s:%d/readyz", serviceAddress, cfg.Port),
 			Interval:                       "10s",
 			Timeout:                        "1s",
 			DeregisterCriticalServiceAfter: "30s",
 		},
 	}
+}
 
+// registerWithConsul registers the service with Consul and re-registers it
+// periodically until ctx is done
+func registerWithConsul(ctx context.Context, client *consulapi.Client, registration *consulapi.AgentServiceRegistration, consulMetrics *sharedmetrics.ConsulMetrics) {
 	// Register service
 	for i := 0; i < 5; i++ {
 		err := client.Agent().ServiceRegister(registration)
+		consulMetrics.Observe(err)
 		if err == nil {
-			log.Printf("Registered service with Consul")
+			slog.Info("Registered service with Consul", "id", registration.ID)
 			break
 		}
-		log.Printf("Failed to register with Consul: %v, retrying...", err)
-		time.Sleep(time.Second * 2)
+		slog.Warn("Failed to register with Consul, retrying", "error", err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Second * 2):
+		}
 	}
 
 	// Re-register every 30 seconds as a keep-alive mechanism
 	ticker := time.NewTicker(30 * time.Second)
-	for range ticker.C {
-		if err := client.Agent().ServiceRegister(registration); err != nil {
-			log.Printf("Failed to re-register with Consul: %v", err)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		err := client.Agent().ServiceRegister(registration)
+		consulMetrics.Observe(err)
+		if err != nil {
+			slog.Warn("Failed to re-register with Consul", "error", err)
 		}
 	}
 }
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cloud-drive/api-gateway/internal/clients"
+	"github.com/cloud-drive/api-gateway/internal/config"
+	"github.com/cloud-drive/api-gateway/internal/handlers"
+	"github.com/cloud-drive/api-gateway/internal/metrics"
+	"github.com/cloud-drive/api-gateway/internal/middleware"
+	"github.com/cloud-drive/api-gateway/internal/openapi"
+	"github.com/cloud-drive/api-gateway/internal/proxy"
+	sharedhealth "github.com/cloud-drive/shared/health"
+	sharedmetrics "github.com/cloud-drive/shared/metrics"
+	"github.com/gorilla/mux"
+	consulapi "github.com/hashicorp/consul/api"
+)
+
+// unreachableConsul is a Consul address nothing listens on, so clients fall
+// back to their direct addresses without waiting
+const unreachableConsul = "127.0.0.1:1"
+
+// TestRoutesAreInSpec registers every route of the gateway the way main does
+// and fails for each one the OpenAPI spec does not describe
+func TestRoutesAreInSpec(t *testing.T) {
+	cfg, err := config.LoadConfig(nil)
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	cfg.ConsulURL = unreachableConsul
+
+	userClient, err := clients.NewUserClient(cfg.ConsulURL, "localhost:9001")
+	if err != nil {
+		t.Fatalf("create user client: %v", err)
+	}
+	defer userClient.Close()
+	fileClient, err := clients.NewFileClient(cfg.ConsulURL, "localhost:9002", cfg.MaxUploadSize)
+	if err != nil {
+		t.Fatalf("create file client: %v", err)
+	}
+	defer fileClient.Close()
+	consulConfig := consulapi.DefaultConfig()
+	consulConfig.Address = cfg.ConsulURL
+	consulClient, err := consulapi.NewClient(consulConfig)
+	if err != nil {
+		t.Fatalf("create Consul client: %v", err)
+	}
+	spec, err := openapi.Load()
+	if err != nil {
+		t.Fatalf("load spec: %v", err)
+	}
+
+	registry := sharedmetrics.NewRegistry()
+	router := mux.NewRouter()
+	_, err = registerRoutes(router, routeDeps{
+		cfg:        cfg,
+		spec:       spec,
+		checker:    sharedhealth.NewChecker(time.Second),
+		registry:   registry,
+		metrics:    metrics.New(registry),
+		userClient: userClient,
+		fileClient: fileClient,
+		serviceRouter: handlers.NewServiceRouter(cfg.ProxyTable(),
+			proxy.NewConsulResolver(consulClient, cfg.ProxyCacheTTL), middleware.AuthMiddleware(cfg, userClient)),
+	})
+	if err != nil {
+		t.Fatalf("register routes: %v", err)
+	}
+
+	for _, route := range spec.MissingRoutes(router) {
+		t.Errorf("route %s is not described in openapi.yaml", route)
+	}
+}
@@ -0,0 +1,141 @@
+package clients
+
+import (
+	"context"
+	"fmt"
+	"github.com/cloud-drive/proto-definitions/file"
+	consulapi "github.com/hashicorp/consul/api"
+	"google.golang.org/grpc"
+	"log/slog"
+	"time"
+)
+
+const (
+	// messageOverhead là phần dư trên kích thước nội dung cho các field khác của message
+	messageOverhead = 1 << 20
+	// maxMessageContent là nội dung lớn nhất trong một message, như ở file-service
+	maxMessageContent = 64 << 20
+)
+
+// FileClient is a client for the file service
+type FileClient struct {
+	client    file.FileServiceClient
+	conn      *grpc.ClientConn
+	serviceID string
+	// callOpts nâng giới hạn message cho upload, download và upload tus
+	callOpts []grpc.CallOption
+}
+
+// NewFileClient creates a new file service client. maxFileSize, capped at
+// maxMessageContent, bounds the content sent or received in one message;
+// extra dial options are appended to the defaults.
+func NewFileClient(consulURL string, fallbackURL string, maxFileSize int64, opts ...grpc.DialOption) (*FileClient, error) {
+	serviceID := "file-service"
+	target := fallbackURL
+
+	// Tìm service từ Consul, không được thì dùng fallbackURL
+	consulConfig := consulapi.DefaultConfig()
+	consulConfig.Address = consulURL
+	consulClient, err := consulapi.NewClient(consulConfig)
+	if err != nil {
+		slog.Warn("Failed to create Consul client, using direct URL", "error", err, "url", fallbackURL)
+	} else if serviceURL, err := discoverService(consulClient, serviceID); err != nil {
+		slog.Warn("Failed to discover file service, using direct URL", "error", err, "url", fallbackURL)
+	} else {
+		target = serviceURL
+	}
+
+	conn, err := grpc.Dial(target, dialOptions(opts)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial file service: %v", err)
+	}
+
+	limit := int(min(maxFileSize, maxMessageContent)) + messageOverhead
+	return &FileClient{
+		client:    file.NewFileServiceClient(conn),
+		conn:      conn,
+		serviceID: serviceID,
+		callOpts:  []grpc.CallOption{grpc.MaxCallSendMsgSize(limit), grpc.MaxCallRecvMsgSize(limit)},
+	}, nil
+}
+
+// Close closes the client connection
+func (c *FileClient) Close() {
+	if c.conn != nil {
+		c.conn.Close()
+	}
+}
+
+// Conn returns the underlying gRPC connection, used by the REST transcoder
+func (c *FileClient) Conn() grpc.ClientConnInterface {
+	return c.conn
+}
+
+// UploadFile gửi nội dung file tới file service
+func (c *FileClient) UploadFile(ctx context.Context, req *file.UploadFileRequest) (*file.FileResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, 60*time.Second)
+	defer cancel()
+	return c.client.UploadFile(ctx, req, c.callOpts...)
+}
+
+// DownloadFile lấy metadata và nội dung của file
+func (c *FileClient) DownloadFile(ctx context.Context, id string) (*file.DownloadFileResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, 60*time.Second)
+	defer cancel()
+	return c.client.DownloadFile(ctx, &file.DownloadFileRequest{Id: id}, c.callOpts...)
+}
+
+// GetFile lấy metadata của file
+func (c *FileClient) GetFile(ctx context.Context, id string) (*file.FileResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	return c.client.GetFile(ctx, &file.GetFileRequest{Id: id})
+}
+
+// GetFileVersion lấy thông tin một phiên bản của file
+func (c *FileClient) GetFileVersion(ctx context.Context, id string, version int32) (*file.FileVersionResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	return c.client.GetFileVersion(ctx, &file.GetFileVersionRequest{Id: id, Version: version})
+}
+
+// UploadFileStream mở stream upload theo chunk. Stream không có timeout riêng,
+// nó kết thúc cùng ctx của request (giới hạn bởi timeout theo route).
+func (c *FileClient) UploadFileStream(ctx context.Context) (file.FileService_UploadFileStreamClient, error) {
+	return c.client.UploadFileStream(ctx)
+}
+
+// DownloadFileStream mở stream tải nội dung theo chunk, kết thúc cùng ctx
+func (c *FileClient) DownloadFileStream(ctx context.Context, req *file.DownloadFileStreamRequest) (file.FileService_DownloadFileStreamClient, error) {
+	return c.client.DownloadFileStream(ctx, req)
+}
+
+// CreateUpload bắt đầu một upload có thể tiếp tục
+func (c *FileClient) CreateUpload(ctx context.Context, req *file.CreateUploadRequest) (*file.UploadResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, 60*time.Second)
+	defer cancel()
+	return c.client.CreateUpload(ctx, req)
+}
+
+// GetUpload lấy trạng thái và offset hiện tại của upload
+func (c *FileClient) GetUpload(ctx context.Context, id string) (*file.UploadResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	return c.client.GetUpload(ctx, &file.GetUploadRequest{Id: id})
+}
+
+// AppendUpload gửi một phần dữ liệu của upload. Phần cuối cùng còn lưu cả file
+// vào drive nên được cho tới 1 giờ, như route PATCH /api/uploads và giới hạn
+// của file-service cho AppendUpload.
+func (c *FileClient) AppendUpload(ctx context.Context, req *file.AppendUploadRequest) (*file.UploadResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Hour)
+	defer cancel()
+	return c.client.AppendUpload(ctx, req, c.callOpts...)
+}
+
+// DeleteUpload huỷ upload và xoá dữ liệu đã nhận
+func (c *FileClient) DeleteUpload(ctx context.Context, id string) (*file.DeleteUploadResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	return c.client.DeleteUpload(ctx, &file.DeleteUploadRequest{Id: id})
+}
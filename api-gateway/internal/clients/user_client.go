@@ -4,10 +4,11 @@ import (
 	"context"
 	"fmt"
 	"github.com/cloud-drive/proto-definitions/user"
+	"github.com/cloud-drive/shared/logging"
 	consulapi "github.com/hashicorp/consul/api"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
-	"log"
+	"log/slog"
 	"time"
 )
 
@@ -33,8 +34,9 @@ type CreateUserRequest struct {
 	Role      string `json:"role"`
 }
 
-// NewUserClient creates a new user service client
-func NewUserClient(consulURL string, fallbackURL string) (*UserClient, error) {
+// NewUserClient creates a new user service client. Extra dial options (for
+// example instrumentation interceptors) are appended to the defaults.
+func NewUserClient(consulURL string, fallbackURL string, opts ...grpc.DialOption) (*UserClient, error) {
 	serviceID := "user-service"
 
 	// Tạo Consul client
@@ -43,20 +45,20 @@ func NewUserClient(consulURL string, fallbackURL string) (*UserClient, error) {
 
 	consulClient, err := consulapi.NewClient(consulConfig)
 	if err != nil {
-		log.Printf("Failed to create Consul client: %v", err)
+		slog.Warn("Failed to create Consul client, using direct URL", "error", err, "url", fallbackURL)
 		// Nếu không thể kết nối Consul, sử dụng fallbackURL
-		return createDirectClient(serviceID, fallbackURL)
+		return createDirectClient(serviceID, fallbackURL, opts...)
 	}
 
 	// Tìm service từ Consul
 	serviceURL, err := discoverService(consulClient, serviceID)
 	if err != nil {
-		log.Printf("Failed to discover service: %v, using direct URL", err)
-		return createDirectClient(serviceID, fallbackURL)
+		slog.Warn("Failed to discover user service, using direct URL", "error", err, "url", fallbackURL)
+		return createDirectClient(serviceID, fallbackURL, opts...)
 	}
 
 	// Tạo kết nối gRPC tới service đã tìm thấy
-	conn, err := grpc.Dial(serviceURL, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	conn, err := grpc.Dial(serviceURL, dialOptions(opts)...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to dial user service: %v", err)
 	}
@@ -71,9 +73,20 @@ func NewUserClient(consulURL string, fallbackURL string) (*UserClient, error) {
 	}, nil
 }
 
+// dialOptions trả về các option chung khi kết nối tới user service và file service
+func dialOptions(extra []grpc.DialOption) []grpc.DialOption {
+	opts := []grpc.DialOption{
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		// Chuyển request ID sang service qua gRPC metadata, cả với RPC dạng stream
+		grpc.WithChainUnaryInterceptor(logging.UnaryClientInterceptor()),
+		grpc.WithChainStreamInterceptor(logging.StreamClientInterceptor()),
+	}
+	return append(opts, extra...)
+}
+
 // createDirectClient tạo kết nối trực tiếp khi không thể sử dụng Consul
-func createDirectClient(serviceID string, fallbackURL string) (*UserClient, error) {
-	conn, err := grpc.Dial(fallbackURL, grpc.WithTransportCredentials(insecure.NewCredentials()))
+func createDirectClient(serviceID string, fallbackURL string, opts ...grpc.DialOption) (*UserClient, error) {
+	conn, err := grpc.Dial(fallbackURL, dialOptions(opts)...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to dial user service directly: %v", err)
 	}
@@ -111,10 +124,13 @@ func (c *UserClient) Close() {
 	}
 }
 
+// Conn returns the underlying gRPC connection, used by the REST transcoder
+func (c *UserClient) Conn() grpc.ClientConnInterface {
+	return c.conn
+}
+
 // ListUsers lists users from the user service
 func (c *UserClient) ListUsers(ctx context.Context, limit int, offset int) (*UserClientResponse, error) {
-	log.Printf("Calling ListUsers with client: %v", c.client)
-
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
@@ -171,3 +187,10 @@ func (c *UserClient) Authenticate(ctx context.Context, email, password string) (
 		Password: password,
 	})
 }
+
+// VerifyAccessToken xác thực personal access token, dùng bởi AuthMiddleware
+func (c *UserClient) VerifyAccessToken(ctx context.Context, token string) (*user.VerifyAccessTokenResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	return c.client.VerifyAccessToken(ctx, &user.VerifyAccessTokenRequest{Token: token})
+}
@@ -1,80 +1,221 @@
 package config
 
 import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
 	"os"
-	"strconv"
+	"slices"
 	"time"
+
+	"github.com/cloud-drive/api-gateway/internal/deadline"
+	"github.com/cloud-drive/api-gateway/internal/proxy"
+	"github.com/cloud-drive/api-gateway/internal/ratelimit"
+	sharedconfig "github.com/cloud-drive/shared/config"
+	"github.com/cloud-drive/shared/utils"
+)
+
+// Default secrets are only acceptable outside production
+const (
+	defaultJWTSecret      = "default_jwt_secret_key"
+	defaultServiceToken   = "default_internal_token"
+	defaultIdentitySecret = "default_identity_secret"
 )
 
 // Config holds the application configuration
 type Config struct {
-	Environment   string
-	Port          int
-	ConsulURL     string
-	HostMode      string
-	LogLevel      string
-	JWTSecret     string
-	JWTExpiration time.Duration
+	Environment      string        `config:"environment" env:"APP_ENV" default:"development" validate:"oneof=development production"`
+	Port             int           `config:"port" env:"PORT,API_GATEWAY_PORT" flag:"port" usage:"API Gateway port" default:"8080" validate:"min=1,max=65535"`
+	ConsulURL        string        `config:"consul.url" env:"CONSUL_URL" flag:"consul-url" usage:"Consul agent address" validate:"required,hostport"`
+	ConsulKey        string        `config:"consul.config_key" env:"CONSUL_CONFIG_KEY" usage:"Consul KV key with runtime overrides (empty disables the watch)"`
+	HostMode         string        `config:"host_mode" env:"HOST_MODE" validate:"oneof=local docker"`
+	LogFormat        string        `config:"log.format" env:"LOG_FORMAT" usage:"Log output format (text, json)" default:"text" validate:"oneof=text json"`
+	LogLevel         string        `config:"log.level" env:"LOG_LEVEL" flag:"log-level" usage:"Log level (debug, info, warn, error)" default:"info" reload:"true" validate:"oneof=debug info warn error"`
+	TraceExporter    string        `config:"tracing.exporter" env:"TRACING_EXPORTER" usage:"Trace exporter (none, stdout, otlp)" default:"none" validate:"oneof=none stdout otlp"`
+	TraceEndpoint    string        `config:"tracing.otlp_endpoint" env:"TRACING_OTLP_ENDPOINT" default:"localhost:4317" validate:"hostport"`
+	TraceInsecure    bool          `config:"tracing.otlp_insecure" env:"TRACING_OTLP_INSECURE" default:"true"`
+	TraceSampleRatio float64       `config:"tracing.sample_ratio" env:"TRACING_SAMPLE_RATIO" default:"1" validate:"min=0,max=1"`
+	RateLimitEnabled bool          `config:"rate_limit.enabled" env:"RATE_LIMIT_ENABLED" default:"true" reload:"true"`
+	RateLimitRules   []string      `config:"rate_limit.rules" env:"RATE_LIMIT_RULES" default:"POST /api/auth/login ip 10/m 5,POST /api/auth/register ip 5/m 3,* /api ip 20/s 40,* /api user 20/s 40" reload:"true"`
+	TrustedProxies   []string      `config:"rate_limit.trusted_proxies" env:"TRUSTED_PROXIES" default:"127.0.0.0/8,::1/128,10.0.0.0/8,172.16.0.0/12,192.168.0.0/16"`
+	ProxyRoutes      []string      `config:"proxy.routes" env:"PROXY_ROUTES" usage:"Reverse proxy routes: <path-prefix> <service|url> [strip] [auth] [timeout=30s] [req.set:H=v] [req.del:H] [resp.set:H=v] [resp.del:H]" reload:"true"`
+	ProxyCacheTTL    time.Duration `config:"proxy.discovery_ttl" env:"PROXY_DISCOVERY_TTL" usage:"How long upstream instances from Consul are cached" default:"10s" validate:"min=1s"`
+	CORSOrigins      []string      `config:"cors.allowed_origins" env:"CORS_ALLOWED_ORIGINS" usage:"Browser origins allowed to call the API (empty disables CORS)"`
+	CORSMethods      []string      `config:"cors.allowed_methods" env:"CORS_ALLOWED_METHODS" default:"GET,HEAD,POST,PUT,PATCH,DELETE,OPTIONS"`
+	CORSHeaders      []string      `config:"cors.allowed_headers" env:"CORS_ALLOWED_HEADERS" default:"Authorization,Content-Type,X-CSRF-Token,X-Request-ID,Tus-Resumable,Upload-Length,Upload-Offset,Upload-Metadata,Upload-Checksum"`
+	CORSCredentials  bool          `config:"cors.allow_credentials" env:"CORS_ALLOW_CREDENTIALS" default:"false"`
+	CORSMaxAge       time.Duration `config:"cors.max_age" env:"CORS_MAX_AGE" default:"10m" validate:"max=24h"`
+	HSTSMaxAge       time.Duration `config:"security.hsts_max_age" env:"HSTS_MAX_AGE" usage:"Strict-Transport-Security max-age for HTTPS requests (0 disables)" default:"8760h"`
+	SessionMode      string        `config:"session.mode" env:"SESSION_MODE" usage:"How login returns the session (token, cookie)" default:"token" validate:"oneof=token cookie"`
+	SessionCookie    string        `config:"session.cookie_name" env:"SESSION_COOKIE_NAME" default:"session" validate:"required"`
+	SessionDomain    string        `config:"session.cookie_domain" env:"SESSION_COOKIE_DOMAIN"`
+	SessionSecure    bool          `config:"session.cookie_secure" env:"SESSION_COOKIE_SECURE" default:"true"`
+	SessionSameSite  string        `config:"session.same_site" env:"SESSION_SAME_SITE" default:"lax" validate:"oneof=lax strict none"`
+	JWTSecret        string        `config:"jwt.secret" env:"JWT_SECRET" default:"default_jwt_secret_key" secret:"true" validate:"required"`
+	JWTExpiration    time.Duration `config:"jwt.expiration" env:"JWT_EXPIRATION" default:"24h" reload:"true" validate:"min=1m,max=720h"`
+	ServiceToken     string        `config:"user_service.token" env:"USER_SERVICE_TOKEN" usage:"Token identifying the gateway to user-service (empty sends none)" default:"default_internal_token" secret:"true"`
+	IdentitySecret   string        `config:"user_service.identity_secret" env:"INTERNAL_IDENTITY_SECRET" usage:"Secret signing the end-user identity forwarded to services" default:"default_identity_secret" secret:"true" validate:"required"`
+	ServiceTLSCert   string        `config:"user_service.tls.cert_file" env:"USER_SERVICE_TLS_CERT_FILE" usage:"Client certificate for mTLS to user-service (empty uses plaintext)"`
+	ServiceTLSKey    string        `config:"user_service.tls.key_file" env:"USER_SERVICE_TLS_KEY_FILE"`
+	ServiceTLSCA     string        `config:"user_service.tls.ca_file" env:"USER_SERVICE_TLS_CA_FILE"`
+	ServiceTLSName   string        `config:"user_service.tls.server_name" env:"USER_SERVICE_TLS_SERVER_NAME" usage:"Name expected in the user-service certificate" default:"user-service"`
+	FileToken        string        `config:"file_service.token" env:"FILE_SERVICE_TOKEN" usage:"Token identifying the gateway to file-service (empty sends none)" default:"default_internal_token" secret:"true"`
+	FileTLSName      string        `config:"file_service.tls.server_name" env:"FILE_SERVICE_TLS_SERVER_NAME" usage:"Name expected in the file-service certificate, mTLS reuses the user_service.tls client certificate" default:"file-service"`
+	MaxUploadSize    int64         `config:"file_service.max_upload_size" env:"MAX_UPLOAD_SIZE" usage:"Largest file accepted by POST /api/files and /api/uploads in bytes" default:"10737418240" validate:"min=1,max=1099511627776"`
+	UploadChunkSize  int64         `config:"uploads.chunk_size" env:"UPLOAD_CHUNK_SIZE" usage:"Bytes of a resumable upload sent to file-service per call" default:"8388608" validate:"min=65536,max=67108864"`
+	RouteTimeouts    []string      `config:"http.route_timeouts" env:"HTTP_ROUTE_TIMEOUTS" usage:"Read/write timeouts for slow routes: <method|*> <path-prefix> <timeout>" default:"PATCH /api/uploads 1h,POST /api/files 10m,GET /api/files 10m"`
+	ShutdownDelay    time.Duration `config:"shutdown.propagation_delay" env:"SHUTDOWN_PROPAGATION_DELAY" usage:"How long to keep serving after deregistering from Consul before draining" default:"5s" validate:"max=1m"`
+	ShutdownTimeout  time.Duration `config:"shutdown.drain_timeout" env:"SHUTDOWN_DRAIN_TIMEOUT" usage:"Deadline for in-flight requests before connections are closed" default:"20s" validate:"min=1s,max=5m"`
+}
+
+// LoadConfig loads the application configuration from defaults, the optional
+// config file, environment variables and command-line flags, in that order
+func LoadConfig(args []string) (*Config, error) {
+	return load(args, nil)
 }
 
-// LoadConfig loads the application configuration from environment variables
-func LoadConfig() *Config {
-	// Đọc biến môi trường HOST_MODE
-	hostMode := getEnv("HOST_MODE", "")
+// NewReloader loads the initial configuration and returns a reloader that
+// re-reads the same sources on SIGHUP or when Consul overrides change
+func NewReloader(args []string) (*sharedconfig.Reloader[Config], error) {
+	return sharedconfig.NewReloader(func(overrides map[string]any) (*Config, error) {
+		return load(args, overrides)
+	})
+}
+
+func load(args []string, overrides map[string]any) (*Config, error) {
+	cfg := &Config{}
+	err := sharedconfig.Load(cfg, sharedconfig.Options{
+		Name:            "api-gateway",
+		Args:            args,
+		LegacyEnvPrefix: legacyEnvPrefix(),
+		Overrides:       overrides,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
 
+// ApplyDefaults fills the settings whose defaults depend on the host mode
+func (c *Config) ApplyDefaults() {
 	// Nếu HOST_MODE không được cung cấp, tự động phát hiện
-	if hostMode == "" {
-		// Kiểm tra các dấu hiệu của Docker container
-		if _, err := os.Stat("/.dockerenv"); err == nil {
-			// File /.dockerenv tồn tại -> đang trong Docker
-			hostMode = "docker"
-		} else {
-			// Mặc định là local
-			hostMode = "local"
+	if c.HostMode == "" {
+		c.HostMode = "local"
+		if utils.IsRunningInDocker() {
+			c.HostMode = "docker"
 		}
 	}
 
-	cfg := &Config{
-		Environment: getEnv("APP_ENV", "development"),
-		LogLevel:    getEnv("LOG_LEVEL", "info"),
-		HostMode:    hostMode,
+	// Trong Docker dùng tên service, trong local dùng IPv4 (127.0.0.1)
+	if c.ConsulURL == "" {
+		c.ConsulURL = "127.0.0.1:8500"
+		if c.HostMode == "docker" {
+			c.ConsulURL = "consul:8500"
+		}
 	}
+}
 
-	// Lấy cấu hình dựa vào môi trường
-	envPrefix := "DEV_"
-	if cfg.Environment == "production" {
-		envPrefix = "PROD_"
+// Validate rejects settings that are unsafe in production or for browsers,
+// incomplete mTLS settings and rate limit rules, proxy routes, proxy ranges
+// or route timeouts that cannot be parsed
+func (c *Config) Validate() error {
+	var errs sharedconfig.Errors
+	if c.Environment == "production" && c.JWTSecret == defaultJWTSecret {
+		errs = append(errs, errors.New("jwt.secret: the default secret must not be used in production"))
 	}
-
-	// Xác định URL Consul dựa trên chế độ host
-	if cfg.HostMode == "docker" {
-		// Trong Docker, sử dụng tên service
-		cfg.ConsulURL = getEnv("CONSUL_URL", "consul:8500")
-	} else {
-		// Trong local, sử dụng IPv4 (127.0.0.1)
-		cfg.ConsulURL = getEnv(envPrefix+"CONSUL_URL", "127.0.0.1:8500")
+	if c.Environment == "production" && c.ServiceToken == defaultServiceToken {
+		errs = append(errs, errors.New("user_service.token: the default token must not be used in production"))
+	}
+	if c.Environment == "production" && c.FileToken == defaultServiceToken {
+		errs = append(errs, errors.New("file_service.token: the default token must not be used in production"))
+	}
+	if c.Environment == "production" && c.IdentitySecret == defaultIdentitySecret {
+		errs = append(errs, errors.New("user_service.identity_secret: the default secret must not be used in production"))
+	}
+	if c.ServiceTLSCert != "" && (c.ServiceTLSKey == "" || c.ServiceTLSCA == "") {
+		errs = append(errs, errors.New("user_service.tls: key_file and ca_file are required with cert_file"))
+	}
+	if c.CORSCredentials && slices.Contains(c.CORSOrigins, "*") {
+		errs = append(errs, errors.New("cors.allowed_origins: \"*\" cannot be combined with cors.allow_credentials"))
+	}
+	if c.SessionSameSite == "none" && !c.SessionSecure {
+		errs = append(errs, errors.New("session.same_site: \"none\" requires session.cookie_secure"))
 	}
+	if _, err := ratelimit.ParseRules(c.RateLimitRules); err != nil {
+		errs = append(errs, fmt.Errorf("rate_limit.rules: %w", err))
+	}
+	if _, err := proxy.ParseRoutes(c.ProxyRoutes); err != nil {
+		errs = append(errs, fmt.Errorf("proxy.routes: %w", err))
+	}
+	if _, err := ratelimit.ParseCIDRs(c.TrustedProxies); err != nil {
+		errs = append(errs, fmt.Errorf("rate_limit.trusted_proxies: %w", err))
+	}
+	if _, err := deadline.ParseRules(c.RouteTimeouts); err != nil {
+		errs = append(errs, fmt.Errorf("http.route_timeouts: %w", err))
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
 
-	// Service port
-	portStr := getEnv("PORT", "")
-	if portStr == "" {
-		portStr = getEnv(envPrefix+"API_GATEWAY_PORT", "8080")
+// RateLimitPolicies returns the parsed rate limit rules, or nil when rate
+// limiting is disabled. The rules were checked by Validate.
+func (c *Config) RateLimitPolicies() []ratelimit.Rule {
+	if !c.RateLimitEnabled {
+		return nil
 	}
-	cfg.Port, _ = strconv.Atoi(portStr)
+	rules, _ := ratelimit.ParseRules(c.RateLimitRules)
+	return rules
+}
 
-	// JWT Configuration
-	cfg.JWTSecret = getEnv(envPrefix+"JWT_SECRET", "default_jwt_secret_key")
-	jwtExpirationStr := getEnv("JWT_EXPIRATION", "24h")
-	cfg.JWTExpiration, _ = time.ParseDuration(jwtExpirationStr)
+// ProxyTable returns the parsed reverse proxy routes, longest prefix first.
+// The routes were checked by Validate.
+func (c *Config) ProxyTable() []proxy.Route {
+	routes, _ := proxy.ParseRoutes(c.ProxyRoutes)
+	return routes
+}
 
-	return cfg
+// RouteDeadlines returns the parsed route timeouts, longest prefix first.
+// The rules were checked by Validate.
+func (c *Config) RouteDeadlines() []deadline.Rule {
+	rules, _ := deadline.ParseRules(c.RouteTimeouts)
+	return rules
+}
+
+// UploadChunk returns how many bytes of a resumable upload are sent to
+// file-service per call; a chunk never exceeds the upload size limit
+func (c *Config) UploadChunk() int64 {
+	return min(c.UploadChunkSize, c.MaxUploadSize)
+}
+
+// TrustedProxyNets returns the parsed trusted proxy ranges
+func (c *Config) TrustedProxyNets() []*net.IPNet {
+	nets, _ := ratelimit.ParseCIDRs(c.TrustedProxies)
+	return nets
+}
+
+// CookieSessions reports whether login should issue a session cookie
+func (c *Config) CookieSessions() bool {
+	return c.SessionMode == "cookie"
+}
+
+// SameSite returns the SameSite attribute for session cookies
+func (c *Config) SameSite() http.SameSite {
+	switch c.SessionSameSite {
+	case "strict":
+		return http.SameSiteStrictMode
+	case "none":
+		return http.SameSiteNoneMode
+	}
+	return http.SameSiteLaxMode
 }
 
-// getEnv returns the environment variable or the default value
-func getEnv(key, defaultValue string) string {
-	value := os.Getenv(key)
-	if value == "" {
-		return defaultValue
+// legacyEnvPrefix returns the deprecated DEV_/PROD_ prefix for APP_ENV
+func legacyEnvPrefix() string {
+	if os.Getenv("APP_ENV") == "production" {
+		return "PROD_"
 	}
-	return value
+	return "DEV_"
 }
@@ -0,0 +1,95 @@
+// Package deadline parses per-route overrides of the read and write timeouts
+// of the HTTP server, for routes such as uploads and downloads that
+// legitimately take longer than an API call.
+package deadline
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Rule gives requests matching Method and PathPrefix their own timeout
+type Rule struct {
+	// Method is an HTTP method or "*" for any
+	Method string
+	// PathPrefix matches the path itself and everything below it
+	PathPrefix string
+	// Timeout bounds both reading the request and writing the response
+	Timeout time.Duration
+	// spec is the original text, used in logs
+	spec string
+}
+
+// String returns the rule as written in the config
+func (r Rule) String() string {
+	return r.spec
+}
+
+// Matches reports whether the rule applies to a request
+func (r Rule) Matches(method, path string) bool {
+	if r.Method != "*" && !strings.EqualFold(r.Method, method) {
+		return false
+	}
+	if path == r.PathPrefix || (strings.HasSuffix(r.PathPrefix, "/") && strings.HasPrefix(path, r.PathPrefix)) {
+		return true
+	}
+	return strings.HasPrefix(path, r.PathPrefix+"/")
+}
+
+// ParseRule parses "<METHOD|*> <path-prefix> <timeout>", for example
+// "PATCH /api/uploads 1h"
+func ParseRule(spec string) (Rule, error) {
+	parts := strings.Fields(spec)
+	if len(parts) != 3 {
+		return Rule{}, fmt.Errorf("route timeout %q: expected \"<method> <path> <timeout>\"", spec)
+	}
+
+	rule := Rule{
+		Method:     strings.ToUpper(parts[0]),
+		PathPrefix: parts[1],
+		spec:       strings.Join(parts, " "),
+	}
+	if !strings.HasPrefix(rule.PathPrefix, "/") {
+		return Rule{}, fmt.Errorf("route timeout %q: path must start with /", spec)
+	}
+	timeout, err := time.ParseDuration(parts[2])
+	if err != nil || timeout <= 0 {
+		return Rule{}, fmt.Errorf("route timeout %q: invalid timeout %q", spec, parts[2])
+	}
+	rule.Timeout = timeout
+	return rule, nil
+}
+
+// ParseRules parses every rule, reports all invalid ones and returns the
+// rules longest prefix first, so the most specific rule matches first
+func ParseRules(specs []string) ([]Rule, error) {
+	rules := make([]Rule, 0, len(specs))
+	var errs []string
+	for _, spec := range specs {
+		rule, err := ParseRule(spec)
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		rules = append(rules, rule)
+	}
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	sort.SliceStable(rules, func(i, j int) bool {
+		return len(rules[i].PathPrefix) > len(rules[j].PathPrefix)
+	})
+	return rules, nil
+}
+
+// Find returns the first rule matching a request
+func Find(rules []Rule, method, path string) (Rule, bool) {
+	for _, rule := range rules {
+		if rule.Matches(method, path) {
+			return rule, true
+		}
+	}
+	return Rule{}, false
+}
@@ -4,10 +4,15 @@ import (
 	"encoding/json"
 	"github.com/cloud-drive/api-gateway/internal/clients"
 	"github.com/cloud-drive/api-gateway/internal/config"
+	"github.com/cloud-drive/api-gateway/internal/metrics"
 	"github.com/cloud-drive/api-gateway/internal/middleware"
+	"github.com/cloud-drive/api-gateway/internal/openapi"
 	"github.com/cloud-drive/proto-definitions/user"
 	"github.com/gorilla/mux"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	"net/http"
+	"sync/atomic"
 	"time"
 )
 
@@ -15,36 +20,42 @@ import (
 type AuthHandler struct {
 	userClient *clients.UserClient
 	cfg        *config.Config
+	metrics    *metrics.Metrics
+	// jwtExpiration có thể thay đổi khi reload cấu hình
+	jwtExpiration atomic.Int64
 }
 
+// Các kiểu request/response được sinh từ internal/openapi/openapi.yaml
+
 // LoginRequest là cấu trúc dữ liệu cho yêu cầu đăng nhập
-type LoginRequest struct {
-	Email    string `json:"email"`
-	Password string `json:"password"`
-}
+type LoginRequest = openapi.LoginRequest
 
 // RegisterRequest là cấu trúc dữ liệu cho yêu cầu đăng ký
-type RegisterRequest struct {
-	Email     string `json:"email"`
-	Password  string `json:"password"`
-	FirstName string `json:"first_name"`
-	LastName  string `json:"last_name"`
-}
+type RegisterRequest = openapi.RegisterRequest
 
-// AuthResponse là cấu trúc dữ liệu cho phản hồi xác thực
-type AuthResponse struct {
-	Token     string `json:"token"`
-	ExpiresIn int64  `json:"expires_in"`
-	UserID    string `json:"user_id"`
-	Role      string `json:"role"`
-}
+// AuthResponse là cấu trúc dữ liệu cho phản hồi xác thực.
+// Token bị bỏ trống ở chế độ cookie, JWT chỉ nằm trong cookie HttpOnly.
+type AuthResponse = openapi.AuthResponse
 
 // NewAuthHandler tạo một handler mới cho xác thực
-func NewAuthHandler(userClient *clients.UserClient, cfg *config.Config) *AuthHandler {
-	return &AuthHandler{
+func NewAuthHandler(userClient *clients.UserClient, cfg *config.Config, m *metrics.Metrics) *AuthHandler {
+	h := &AuthHandler{
 		userClient: userClient,
 		cfg:        cfg,
+		metrics:    m,
 	}
+	h.ApplyConfig(cfg)
+	return h
+}
+
+// ApplyConfig cập nhật các thiết lập có thể reload (thời hạn token)
+func (h *AuthHandler) ApplyConfig(cfg *config.Config) {
+	h.jwtExpiration.Store(int64(cfg.JWTExpiration))
+}
+
+// expiration trả về thời hạn token hiện tại
+func (h *AuthHandler) expiration() time.Duration {
+	return time.Duration(h.jwtExpiration.Load())
 }
 
 // Login xử lý đăng nhập người dùng
@@ -60,12 +71,20 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	userResp, err := h.userClient.Authenticate(ctx, req.Email, req.Password)
 	if err != nil {
+		switch status.Code(err) {
+		case codes.Unauthenticated, codes.NotFound:
+			h.metrics.LoginAttempts.WithLabelValues(metrics.OutcomeFailure).Inc()
+		default:
+			h.metrics.LoginAttempts.WithLabelValues(metrics.OutcomeError).Inc()
+		}
 		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
 		return
 	}
+	h.metrics.LoginAttempts.WithLabelValues(metrics.OutcomeSuccess).Inc()
 
 	// Tạo token JWT
-	token, err := middleware.GenerateToken(userResp.User.Id, userResp.User.Role, h.cfg.JWTSecret, h.cfg.JWTExpiration)
+	expiration := h.expiration()
+	token, err := middleware.GenerateToken(userResp.User.Id, userResp.User.Role, h.cfg.JWTSecret, expiration)
 	if err != nil {
 		http.Error(w, "Failed to generate token", http.StatusInternalServerError)
 		return
@@ -74,16 +93,65 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 	// Tạo response
 	resp := AuthResponse{
 		Token:     token,
-		ExpiresIn: int64(h.cfg.JWTExpiration / time.Second),
-		UserID:    userResp.User.Id,
+		ExpiresIn: int64(expiration / time.Second),
+		UserId:    userResp.User.Id,
 		Role:      userResp.User.Role,
 	}
+	if err := h.startSession(w, &resp, expiration); err != nil {
+		http.Error(w, "Failed to start session", http.StatusInternalServerError)
+		return
+	}
 
 	// Gửi response
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(resp)
 }
 
+// startSession đặt session cookie và CSRF cookie khi session.mode=cookie.
+// JWT được chuyển vào cookie HttpOnly và CSRF token được trả trong body để
+// client gửi lại qua header X-CSRF-Token.
+func (h *AuthHandler) startSession(w http.ResponseWriter, resp *AuthResponse, expiration time.Duration) error {
+	if !h.cfg.CookieSessions() {
+		return nil
+	}
+	csrfToken, err := middleware.NewCSRFToken(h.cfg.JWTSecret, resp.UserId)
+	if err != nil {
+		return err
+	}
+	http.SetCookie(w, h.cookie(h.cfg.SessionCookie, resp.Token, expiration, true))
+	http.SetCookie(w, h.cookie(middleware.CSRFCookieName, csrfToken, expiration, false))
+	resp.Token = ""
+	resp.CsrfToken = csrfToken
+	return nil
+}
+
+// cookie tạo cookie theo cấu hình session; maxAge < 0 để xoá cookie
+func (h *AuthHandler) cookie(name, value string, maxAge time.Duration, httpOnly bool) *http.Cookie {
+	c := &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		Domain:   h.cfg.SessionDomain,
+		HttpOnly: httpOnly,
+		Secure:   h.cfg.SessionSecure,
+		SameSite: h.cfg.SameSite(),
+		MaxAge:   int(maxAge / time.Second),
+	}
+	if maxAge < 0 {
+		c.MaxAge = -1
+	}
+	return c
+}
+
+// Logout xoá session cookie và CSRF cookie. Ở chế độ token client chỉ cần bỏ token.
+func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	if h.cfg.CookieSessions() {
+		http.SetCookie(w, h.cookie(h.cfg.SessionCookie, "", -1, true))
+		http.SetCookie(w, h.cookie(middleware.CSRFCookieName, "", -1, false))
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
 // Register xử lý đăng ký người dùng mới
 func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 	var req RegisterRequest
@@ -105,12 +173,21 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 
 	userResp, err := h.userClient.CreateUser(ctx, userReq)
 	if err != nil {
+		switch status.Code(err) {
+		case codes.AlreadyExists, codes.InvalidArgument:
+			h.metrics.Registrations.WithLabelValues(metrics.OutcomeFailure).Inc()
+		default:
+			h.metrics.Registrations.WithLabelValues(metrics.OutcomeError).Inc()
+		}
 		http.Error(w, "Failed to create user: "+err.Error(), http.StatusBadRequest)
 		return
 	}
 
+	h.metrics.Registrations.WithLabelValues(metrics.OutcomeSuccess).Inc()
+
 	// Tạo token JWT
-	token, err := middleware.GenerateToken(userResp.User.Id, "user", h.cfg.JWTSecret, h.cfg.JWTExpiration)
+	expiration := h.expiration()
+	token, err := middleware.GenerateToken(userResp.User.Id, "user", h.cfg.JWTSecret, expiration)
 	if err != nil {
 		http.Error(w, "Failed to generate token", http.StatusInternalServerError)
 		return
@@ -119,10 +196,14 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 	// Tạo response
 	resp := AuthResponse{
 		Token:     token,
-		ExpiresIn: int64(h.cfg.JWTExpiration / time.Second),
-		UserID:    userResp.User.Id,
+		ExpiresIn: int64(expiration / time.Second),
+		UserId:    userResp.User.Id,
 		Role:      "user",
 	}
+	if err := h.startSession(w, &resp, expiration); err != nil {
+		http.Error(w, "Failed to start session", http.StatusInternalServerError)
+		return
+	}
 
 	// Gửi response
 	w.Header().Set("Content-Type", "application/json")
@@ -130,9 +211,10 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(resp)
 }
 
-// RegisterAuthRoutes đăng ký các route cho xác thực
-func RegisterAuthRoutes(router *mux.Router, userClient *clients.UserClient, cfg *config.Config) {
-	handler := NewAuthHandler(userClient, cfg)
+// RegisterAuthRoutes đăng ký các route cho xác thực và trả về handler để
+// đăng ký nhận cấu hình mới khi reload
+func RegisterAuthRoutes(router *mux.Router, userClient *clients.UserClient, cfg *config.Config, m *metrics.Metrics) *AuthHandler {
+	handler := NewAuthHandler(userClient, cfg, m)
 
 	// Các route cho xác thực
 	authRouter := router.PathPrefix("/api/auth").Subrouter()
@@ -141,8 +223,15 @@ func RegisterAuthRoutes(router *mux.Router, userClient *clients.UserClient, cfg
 
 	// Endpoint kiểm tra token - yêu cầu xác thực
 	checkTokenRouter := authRouter.PathPrefix("/check-token").Subrouter()
-	checkTokenRouter.Use(middleware.AuthMiddleware(cfg))
+	checkTokenRouter.Use(middleware.AuthMiddleware(cfg, userClient))
 	checkTokenRouter.HandleFunc("", handler.CheckToken).Methods("GET")
+
+	// Đăng xuất - yêu cầu xác thực (và CSRF token ở chế độ cookie)
+	logoutRouter := authRouter.PathPrefix("/logout").Subrouter()
+	logoutRouter.Use(middleware.AuthMiddleware(cfg, userClient))
+	logoutRouter.HandleFunc("", handler.Logout).Methods("POST")
+
+	return handler
 }
 
 // CheckToken xác nhận token hiện tại có hợp lệ không và trả về thông tin người dùng từ token
@@ -155,16 +244,9 @@ func (h *AuthHandler) CheckToken(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Tạo response chứa thông tin về token
-	type TokenResponse struct {
-		Valid     bool      `json:"valid"`
-		UserID    string    `json:"user_id"`
-		Role      string    `json:"role"`
-		ExpiresAt time.Time `json:"expires_at"`
-	}
-
-	response := TokenResponse{
+	response := openapi.TokenResponse{
 		Valid:     true,
-		UserID:    claims.UserID,
+		UserId:    claims.UserID,
 		Role:      claims.Role,
 		ExpiresAt: time.Unix(claims.ExpiresAt, 0),
 	}
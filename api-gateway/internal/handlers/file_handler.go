@@ -0,0 +1,435 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/cloud-drive/api-gateway/internal/clients"
+	"github.com/cloud-drive/api-gateway/internal/config"
+	"github.com/cloud-drive/proto-definitions/file"
+	"github.com/gorilla/mux"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+const (
+	// multipartOverhead là phần dư cho header và các field khác của form upload
+	multipartOverhead = 64 << 10
+	// streamChunkSize là kích thước chunk khi stream nội dung sang file-service
+	streamChunkSize = 256 << 10
+)
+
+// castagnoli là bảng CRC-32C dùng cho checksum của từng chunk
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+var (
+	errFileTooLarge       = errors.New("file is larger than the upload limit")
+	errRangeInvalid       = errors.New("invalid range")
+	errRangeUnsatisfiable = errors.New("range not satisfiable")
+)
+
+// fileJSON giữ tên field snake_case giống các route được transcode
+var fileJSON = protojson.MarshalOptions{UseProtoNames: true}
+
+// FileHandler xử lý upload và download nội dung file qua các RPC streaming.
+// Các RPC còn lại của file-service được expose qua REST transcoding.
+type FileHandler struct {
+	fileClient    *clients.FileClient
+	maxUploadSize int64
+}
+
+// NewFileHandler tạo handler cho upload và download file
+func NewFileHandler(fileClient *clients.FileClient, cfg *config.Config) *FileHandler {
+	return &FileHandler{
+		fileClient:    fileClient,
+		maxUploadSize: cfg.MaxUploadSize,
+	}
+}
+
+// Upload nhận multipart form với field "file" rồi stream nội dung sang
+// file-service theo từng chunk, không giữ cả file trong bộ nhớ. Thư mục đích
+// chọn bằng "folder_id" hoặc path "folder", mặc định là thư mục gốc;
+// "on_conflict" quyết định cách xử lý khi trùng tên. Tên file lấy từ field
+// "name" nếu có, nếu không thì từ tên file trong form. Các field có thể đứng
+// trước hoặc sau "file".
+func (h *FileHandler) Upload(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, h.maxUploadSize+multipartOverhead)
+	reader, err := r.MultipartReader()
+	if err != nil {
+		http.Error(w, "Invalid request: expected multipart/form-data", http.StatusBadRequest)
+		return
+	}
+
+	// Huỷ ctx khi lỗi để file-service bỏ nội dung đã nhận
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	info := &file.UploadFileInfo{}
+	var stream file.FileService_UploadFileStreamClient
+	var filename string
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			writeUploadError(w, err)
+			return
+		}
+
+		switch part.FormName() {
+		case "file":
+			if stream != nil {
+				http.Error(w, "Invalid request: field \"file\" must appear once", http.StatusBadRequest)
+				return
+			}
+			if stream, err = h.fileClient.UploadFileStream(ctx); err != nil {
+				writeRPCError(w, r, "UploadFileStream", err)
+				return
+			}
+			if err := sendChunks(stream, part, h.maxUploadSize); err != nil {
+				writeStreamError(w, r, stream, err)
+				return
+			}
+			info.ContentType = part.Header.Get("Content-Type")
+			filename = part.FileName()
+		case "folder", "folder_id", "name", "on_conflict":
+			value, err := io.ReadAll(io.LimitReader(part, 4096))
+			if err != nil {
+				writeUploadError(w, err)
+				return
+			}
+			switch part.FormName() {
+			case "folder":
+				info.Folder = string(value)
+			case "folder_id":
+				info.FolderId = string(value)
+			case "name":
+				info.Name = string(value)
+			case "on_conflict":
+				info.OnConflict = string(value)
+			}
+		}
+		part.Close()
+	}
+	if stream == nil {
+		http.Error(w, "Invalid request: field \"file\" is required", http.StatusBadRequest)
+		return
+	}
+	if info.Name == "" {
+		info.Name = filename
+	}
+	// application/octet-stream không mang thông tin, để file-service tự nhận dạng
+	if info.ContentType == "application/octet-stream" {
+		info.ContentType = ""
+	}
+
+	// Thông tin file được gửi sau nội dung vì field có thể đứng sau "file"
+	err = stream.Send(&file.UploadFileStreamRequest{
+		Payload: &file.UploadFileStreamRequest_Info{Info: info},
+	})
+	if err != nil {
+		writeStreamError(w, r, stream, err)
+		return
+	}
+	resp, err := stream.CloseAndRecv()
+	if err != nil {
+		writeRPCError(w, r, "UploadFileStream", err)
+		return
+	}
+
+	data, err := fileJSON.Marshal(resp)
+	if err != nil {
+		http.Error(w, "Error encoding response", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/api/files/"+resp.File.Id)
+	w.WriteHeader(http.StatusCreated)
+	w.Write(data)
+}
+
+// Download stream nội dung file với Content-Type và tên file gốc, hoặc nội
+// dung của phiên bản {version} khi route có biến này. ETag là checksum
+// SHA-256 nên client có thể dùng If-None-Match để tránh tải lại. Range một
+// khoảng ("bytes=a-b", "bytes=a-", "bytes=-n") trả về 206 với phần tương ứng,
+// If-Range khác ETag hoặc Range nhiều khoảng trả về cả file.
+func (h *FileHandler) Download(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	var version int32
+	if v, ok := mux.Vars(r)["version"]; ok {
+		n, err := strconv.ParseInt(v, 10, 32)
+		if err != nil || n < 1 {
+			http.Error(w, "Invalid version", http.StatusBadRequest)
+			return
+		}
+		version = int32(n)
+	}
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	// Với Range cần biết kích thước file trước khi mở stream
+	var meta *file.File
+	if r.Header.Get("Range") != "" {
+		var err error
+		meta, err = h.fileMeta(ctx, w, r, id, version)
+		if err != nil {
+			return
+		}
+		if notModified(w, r, meta) {
+			return
+		}
+	}
+	start, length, partial, err := requestedRange(r, meta)
+	if errors.Is(err, errRangeUnsatisfiable) {
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", meta.Size))
+		http.Error(w, "Requested range not satisfiable", http.StatusRequestedRangeNotSatisfiable)
+		return
+	}
+
+	stream, err := h.fileClient.DownloadFileStream(ctx, &file.DownloadFileStreamRequest{
+		Id:      id,
+		Offset:  start,
+		Length:  length,
+		Version: version,
+	})
+	if err != nil {
+		writeRPCError(w, r, "DownloadFileStream", err)
+		return
+	}
+	first, err := stream.Recv()
+	if err != nil {
+		writeRPCError(w, r, "DownloadFileStream", err)
+		return
+	}
+	if meta == nil {
+		meta = first.GetFile()
+		if notModified(w, r, meta) {
+			return
+		}
+	}
+
+	contentType := meta.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Accept-Ranges", "bytes")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": meta.Name}))
+	if partial {
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, start+length-1, meta.Size))
+		w.Header().Set("Content-Length", strconv.FormatInt(length, 10))
+		w.WriteHeader(http.StatusPartialContent)
+	} else {
+		w.Header().Set("Content-Length", strconv.FormatInt(meta.Size, 10))
+		w.WriteHeader(http.StatusOK)
+	}
+
+	// Header đã gửi nên lỗi giữa chừng chỉ có thể báo bằng cách cắt kết nối,
+	// client thấy response thiếu thay vì một file hỏng
+	for {
+		msg, err := stream.Recv()
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			slog.ErrorContext(r.Context(), "File download stream failed", "id", id, "error", err)
+			panic(http.ErrAbortHandler)
+		}
+		chunk := msg.GetChunk()
+		if chunk == nil || crc32.Checksum(chunk.Data, castagnoli) != chunk.Crc32C {
+			slog.ErrorContext(r.Context(), "File download chunk failed its checksum", "id", id)
+			panic(http.ErrAbortHandler)
+		}
+		if _, err := w.Write(chunk.Data); err != nil {
+			// Client đã ngắt kết nối
+			return
+		}
+	}
+}
+
+// fileMeta lấy metadata của file với kích thước, checksum và Content-Type của
+// phiên bản version (0 là phiên bản hiện tại). Lỗi đã được ghi vào w.
+func (h *FileHandler) fileMeta(ctx context.Context, w http.ResponseWriter, r *http.Request, id string, version int32) (*file.File, error) {
+	resp, err := h.fileClient.GetFile(ctx, id)
+	if err != nil {
+		writeRPCError(w, r, "GetFile", err)
+		return nil, err
+	}
+	meta := resp.File
+	if version == 0 || version == meta.Version {
+		return meta, nil
+	}
+	v, err := h.fileClient.GetFileVersion(ctx, id, version)
+	if err != nil {
+		writeRPCError(w, r, "GetFileVersion", err)
+		return nil, err
+	}
+	meta.Version = v.Version.Version
+	meta.Size = v.Version.Size
+	meta.Checksum = v.Version.Checksum
+	meta.ContentType = v.Version.ContentType
+	return meta, nil
+}
+
+// sendChunks stream nội dung của r sang file-service theo từng chunk
+// streamChunkSize byte kèm CRC-32C. Trả về errFileTooLarge khi r dài hơn limit
+// và lỗi đọc body bọc trong errUploadBody.
+func sendChunks(stream file.FileService_UploadFileStreamClient, r io.Reader, limit int64) error {
+	buf := make([]byte, streamChunkSize)
+	var offset int64
+	for {
+		n, readErr := io.ReadFull(r, buf)
+		if n > 0 {
+			if offset+int64(n) > limit {
+				return errFileTooLarge
+			}
+			// Send serialise message trước khi trả về nên buf được dùng lại
+			err := stream.Send(&file.UploadFileStreamRequest{
+				Payload: &file.UploadFileStreamRequest_Chunk{Chunk: &file.FileChunk{
+					Offset: offset,
+					Data:   buf[:n],
+					Crc32C: crc32.Checksum(buf[:n], castagnoli),
+				}},
+			})
+			if err != nil {
+				return err
+			}
+			offset += int64(n)
+		}
+		if readErr == io.EOF || readErr == io.ErrUnexpectedEOF {
+			return nil
+		}
+		if readErr != nil {
+			return fmt.Errorf("%w: %w", errUploadBody, readErr)
+		}
+	}
+}
+
+// notModified đặt ETag và Cache-Control, trả 304 khi If-None-Match khớp
+func notModified(w http.ResponseWriter, r *http.Request, meta *file.File) bool {
+	etag := strconv.Quote(meta.Checksum)
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "private, no-cache")
+	if match := r.Header.Get("If-None-Match"); match != "" && (match == etag || match == "*") {
+		w.WriteHeader(http.StatusNotModified)
+		return true
+	}
+	return false
+}
+
+// requestedRange trả về khoảng cần gửi theo Range và If-Range. partial là
+// false khi gửi cả file (length 0 nghĩa là tới hết file); meta là nil khi
+// request không có Range.
+func requestedRange(r *http.Request, meta *file.File) (start, length int64, partial bool, err error) {
+	if meta == nil {
+		return 0, 0, false, nil
+	}
+	if ifRange := r.Header.Get("If-Range"); ifRange != "" && ifRange != strconv.Quote(meta.Checksum) {
+		return 0, 0, false, nil
+	}
+	start, length, err = parseRange(r.Header.Get("Range"), meta.Size)
+	switch {
+	case errors.Is(err, errRangeInvalid):
+		// Range không hợp lệ hoặc nhiều khoảng: trả cả file
+		return 0, 0, false, nil
+	case err != nil:
+		return 0, 0, false, err
+	}
+	return start, length, true, nil
+}
+
+// parseRange đọc Range một khoảng dạng "bytes=a-b", "bytes=a-" hoặc
+// "bytes=-n" của file size byte
+func parseRange(header string, size int64) (start, length int64, err error) {
+	spec, ok := strings.CutPrefix(header, "bytes=")
+	if !ok || strings.Contains(spec, ",") {
+		return 0, 0, errRangeInvalid
+	}
+	first, last, ok := strings.Cut(strings.TrimSpace(spec), "-")
+	if !ok {
+		return 0, 0, errRangeInvalid
+	}
+
+	// "-n": n byte cuối của file
+	if first == "" {
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || n < 0 {
+			return 0, 0, errRangeInvalid
+		}
+		if n == 0 || size == 0 {
+			return 0, 0, errRangeUnsatisfiable
+		}
+		n = min(n, size)
+		return size - n, n, nil
+	}
+
+	start, err = strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 {
+		return 0, 0, errRangeInvalid
+	}
+	end := size - 1
+	if last != "" {
+		e, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || e < start {
+			return 0, 0, errRangeInvalid
+		}
+		end = min(e, end)
+	}
+	if start >= size {
+		return 0, 0, errRangeUnsatisfiable
+	}
+	return start, end - start + 1, nil
+}
+
+// writeStreamError trả lỗi của upload theo stream: lỗi đọc body như
+// writeUploadError, lỗi của file-service như các route khác
+func writeStreamError(w http.ResponseWriter, r *http.Request, stream file.FileService_UploadFileStreamClient, err error) {
+	switch {
+	case errors.Is(err, errFileTooLarge):
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+	case errors.Is(err, errUploadBody):
+		writeUploadError(w, err)
+	case errors.Is(err, io.EOF):
+		// file-service đã đóng stream, lỗi thật nằm trong kết quả
+		_, err = stream.CloseAndRecv()
+		writeRPCError(w, r, "UploadFileStream", err)
+	default:
+		writeRPCError(w, r, "UploadFileStream", err)
+	}
+}
+
+// writeUploadError trả 413 khi body vượt giới hạn, 400 với lỗi đọc form khác
+func writeUploadError(w http.ResponseWriter, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	http.Error(w, "Invalid request: "+err.Error(), http.StatusBadRequest)
+}
+
+// writeRPCError chuyển lỗi gRPC sang HTTP status như các route được transcode
+func writeRPCError(w http.ResponseWriter, r *http.Request, method string, err error) {
+	st := status.Convert(err)
+	code := runtime.HTTPStatusFromCode(st.Code())
+	if code >= http.StatusInternalServerError {
+		slog.ErrorContext(r.Context(), "File service RPC failed", "method", method, "error", err)
+	}
+	switch st.Code() {
+	case codes.Internal, codes.Unknown, codes.DataLoss:
+		http.Error(w, "Internal server error", code)
+	default:
+		http.Error(w, st.Message(), code)
+	}
+}
@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/cloud-drive/api-gateway/internal/clients"
+	"github.com/cloud-drive/api-gateway/internal/config"
+	"github.com/cloud-drive/api-gateway/internal/middleware"
+	"github.com/cloud-drive/api-gateway/internal/transcoding"
+	"github.com/gorilla/mux"
+)
+
+// fileServiceAccess là bảng phân quyền cho các RPC của file-service được
+// expose qua REST. Người dùng chỉ thấy file và thư mục của chính mình hoặc
+// được chia sẻ với mình, file-service tự kiểm tra quyền theo identity nên mọi
+// user đã đăng nhập đều được gọi.
+var fileServiceAccess = map[string]transcoding.Access{
+	"ListFiles":      {},
+	"GetFile":        {},
+	"GetDownloadUrl": {},
+	"MoveFile":       {},
+	"RenameFile":     {},
+	"CopyFile":       {},
+	"DeleteFile":     {},
+	"CreateFolder":   {},
+	"GetFolder":      {},
+	"ListChildren":   {},
+	"MoveFolder":     {},
+	"RenameFolder":   {},
+	"CopyFolder":     {},
+	"DeleteFolder":   {},
+	"ResolvePath":    {},
+
+	// Phiên bản của file cũng chỉ chủ sở hữu thấy được
+	"ListFileVersions":   {},
+	"GetFileVersion":     {},
+	"RestoreFileVersion": {},
+
+	// Thùng rác là của người gọi, file-service tự kiểm tra chủ sở hữu từng mục
+	"ListTrash":        {},
+	"RestoreTrashItem": {},
+	"DeleteTrashItem":  {},
+	"EmptyTrash":       {},
+
+	// Chia sẻ do chủ sở hữu quản lý, file-service kiểm tra người gọi là chủ
+	// sở hữu hoặc người được chia sẻ
+	"CreateShare":      {},
+	"ListShares":       {},
+	"UpdateShare":      {},
+	"DeleteShare":      {},
+	"ListSharedWithMe": {},
+}
+
+// RegisterFileRoutes đăng ký route upload/download nội dung, upload tus dưới
+// /api/uploads và REST route cho các RPC có HTTP annotation trong file.proto.
+// Tất cả đều yêu cầu đăng nhập, trừ OPTIONS /api/uploads để client tus dò
+// khả năng của server.
+func RegisterFileRoutes(router *mux.Router, fileClient *clients.FileClient, userClient *clients.UserClient, cfg *config.Config) ([]transcoding.Route, error) {
+	auth := middleware.AuthMiddleware(cfg, userClient)
+	handler := NewFileHandler(fileClient, cfg)
+	router.Handle("/api/files", auth(http.HandlerFunc(handler.Upload))).Methods("POST")
+	router.Handle("/api/files/{id}/content", auth(http.HandlerFunc(handler.Download))).Methods("GET")
+	router.Handle("/api/files/{id}/versions/{version}/content", auth(http.HandlerFunc(handler.Download))).Methods("GET")
+
+	uploads := NewUploadHandler(fileClient, cfg)
+	tus := func(h http.HandlerFunc) http.Handler { return auth(uploads.RequireTus(h)) }
+	router.HandleFunc("/api/uploads", uploads.Options).Methods("OPTIONS")
+	router.Handle("/api/uploads", tus(uploads.Create)).Methods("POST")
+	router.Handle("/api/uploads/{id}", tus(uploads.Head)).Methods("HEAD")
+	router.Handle("/api/uploads/{id}", tus(uploads.Patch)).Methods("PATCH")
+	router.Handle("/api/uploads/{id}", tus(uploads.Delete)).Methods("DELETE")
+
+	return transcoding.Register(router, transcoding.Options{
+		Conn:    fileClient.Conn(),
+		Service: "file.FileService",
+		Access:  fileServiceAccess,
+		Auth:    auth,
+	})
+}
@@ -1,71 +1,172 @@
 package handlers
 
 import (
+	"context"
+	"errors"
+	"log/slog"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
 	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/cloud-drive/api-gateway/internal/middleware"
+	"github.com/cloud-drive/api-gateway/internal/proxy"
+	"github.com/cloud-drive/shared/logging"
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+// Header chứa danh tính người dùng được chuyển tiếp tới service phía sau ở
+// các route có auth. Header cùng tên từ client luôn bị xoá.
+const (
+	UserIDHeader   = "X-User-ID"
+	UserRoleHeader = "X-User-Role"
 )
 
-// ServiceRouter routes requests to appropriate microservices
+// upstreamKey là key context chứa upstream đã chọn cho request
+type upstreamKey struct{}
+
+// ServiceRouter routes requests to HTTP services according to the route table
+// from the configuration. Each route keeps one reverse proxy and all proxies
+// share a pooled transport, so connections to upstreams are reused.
 type ServiceRouter struct {
-	userServiceURL *url.URL
-	// Add more services as needed
+	resolver  proxy.Resolver
+	auth      func(http.Handler) http.Handler
+	transport http.RoundTripper
+	routes    atomic.Pointer[[]*serviceRoute]
+}
+
+// serviceRoute là một route cùng handler đã dựng sẵn
+type serviceRoute struct {
+	proxy.Route
+	handler http.Handler
 }
 
-// NewServiceRouter creates a new service router
-func NewServiceRouter(userServiceURL string) (*ServiceRouter, error) {
-	userURL, err := url.Parse(userServiceURL)
-	if err != nil {
-		return nil, err
+// NewServiceRouter creates a service router for the given routes. Upstreams
+// are resolved per request through the resolver; auth wraps routes that
+// require authentication.
+func NewServiceRouter(routes []proxy.Route, resolver proxy.Resolver, auth func(http.Handler) http.Handler) *ServiceRouter {
+	base := http.DefaultTransport.(*http.Transport).Clone()
+	base.MaxIdleConns = 100
+	base.MaxIdleConnsPerHost = 32
+	base.IdleConnTimeout = 90 * time.Second
+
+	sr := &ServiceRouter{
+		resolver:  resolver,
+		auth:      auth,
+		transport: otelhttp.NewTransport(base),
 	}
+	sr.SetRoutes(routes)
+	return sr
+}
 
-	return &ServiceRouter{
-		userServiceURL: userURL,
-	}, nil
+// SetRoutes thay bảng route, dùng khi reload cấu hình. Kết nối tới upstream
+// trong pool vẫn được giữ lại.
+func (sr *ServiceRouter) SetRoutes(routes []proxy.Route) {
+	table := make([]*serviceRoute, 0, len(routes))
+	for _, route := range routes {
+		var handler http.Handler = sr.newProxy(route)
+		if route.AuthRequired {
+			handler = sr.auth(handler)
+		}
+		table = append(table, &serviceRoute{Route: route, handler: handler})
+	}
+	sr.routes.Store(&table)
 }
 
-// Handler returns an http.Handler that routes requests to appropriate services
-func (sr *ServiceRouter) Handler() http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Extract the service name from the URL path
-		path := r.URL.Path
-		parts := strings.Split(path, "/")
+// Register gắn service router vào router, sau các route đã đăng ký trước đó
+func (sr *ServiceRouter) Register(router *mux.Router) {
+	router.MatcherFunc(func(r *http.Request, _ *mux.RouteMatch) bool {
+		return sr.match(r) != nil
+	}).Handler(sr).Name("proxy")
+}
 
-		if len(parts) < 2 {
-			http.Error(w, "Invalid path", http.StatusBadRequest)
-			return
+// match trả về route có prefix dài nhất khớp với request
+func (sr *ServiceRouter) match(r *http.Request) *serviceRoute {
+	for _, route := range *sr.routes.Load() {
+		if route.Matches(r.URL.Path) {
+			return route
 		}
+	}
+	return nil
+}
 
-		// The service name is the first part of the path after the initial slash
-		serviceName := parts[1]
+// ServeHTTP chọn upstream cho route khớp và chuyển tiếp request
+func (sr *ServiceRouter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	route := sr.match(r)
+	if route == nil {
+		http.Error(w, "Unknown service", http.StatusNotFound)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), route.Timeout)
+	defer cancel()
 
-		// Route to the appropriate service based on the service name
-		switch serviceName {
-		case "users":
-			sr.handleUserService(w, r)
-		// Add more services here
-		default:
-			http.Error(w, "Unknown service", http.StatusNotFound)
+	target, ok := route.StaticURL()
+	if !ok {
+		var err error
+		target, err = sr.resolver.Resolve(ctx, route.Service)
+		if err != nil {
+			slog.WarnContext(ctx, "No upstream for proxy route", "route", route.PathPrefix, "service", route.Service, "error", err)
+			http.Error(w, "Service unavailable", http.StatusServiceUnavailable)
+			return
 		}
-	})
+	}
+
+	ctx = context.WithValue(ctx, upstreamKey{}, target)
+	route.handler.ServeHTTP(w, r.WithContext(ctx))
 }
 
-// handleUserService proxies requests to the user service
-func (sr *ServiceRouter) handleUserService(w http.ResponseWriter, r *http.Request) {
-	// Create a reverse proxy
-	proxy := httputil.NewSingleHostReverseProxy(sr.userServiceURL)
+// newProxy dựng reverse proxy cho route
+func (sr *ServiceRouter) newProxy(route proxy.Route) *httputil.ReverseProxy {
+	return &httputil.ReverseProxy{
+		Transport: sr.transport,
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			target := pr.In.Context().Value(upstreamKey{}).(*url.URL)
 
-	// Update the request URL
-	r.URL.Host = sr.userServiceURL.Host
-	r.URL.Scheme = sr.userServiceURL.Scheme
+			// Bỏ prefix của route khỏi path
+			if route.StripPrefix && route.PathPrefix != "/" {
+				pr.Out.URL.Path = strings.TrimPrefix(pr.Out.URL.Path, route.PathPrefix)
+				pr.Out.URL.RawPath = strings.TrimPrefix(pr.Out.URL.RawPath, route.PathPrefix)
+				if pr.Out.URL.Path == "" {
+					pr.Out.URL.Path = "/"
+				}
+			}
+			pr.SetURL(target)
 
-	// Remove the "/users" prefix from the path
-	r.URL.Path = strings.TrimPrefix(r.URL.Path, "/users")
-	if r.URL.Path == "" {
-		r.URL.Path = "/"
-	}
+			// Giữ chuỗi X-Forwarded-For từ nginx và thêm địa chỉ của client
+			pr.Out.Header["X-Forwarded-For"] = pr.In.Header["X-Forwarded-For"]
+			pr.SetXForwarded()
 
-	// Proxy the request
-	proxy.ServeHTTP(w, r)
+			pr.Out.Header.Del(UserIDHeader)
+			pr.Out.Header.Del(UserRoleHeader)
+			if claims, ok := pr.In.Context().Value("claims").(*middleware.Claims); ok {
+				pr.Out.Header.Set(UserIDHeader, claims.UserID)
+				pr.Out.Header.Set(UserRoleHeader, claims.Role)
+			}
+			if id := logging.RequestIDFromContext(pr.In.Context()); id != "" {
+				pr.Out.Header.Set(logging.RequestIDHeader, id)
+			}
+
+			for _, h := range route.RequestHeaders {
+				h.Apply(pr.Out.Header)
+			}
+		},
+		ModifyResponse: func(resp *http.Response) error {
+			for _, h := range route.ResponseHeaders {
+				h.Apply(resp.Header)
+			}
+			return nil
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			status := http.StatusBadGateway
+			if errors.Is(err, context.DeadlineExceeded) {
+				status = http.StatusGatewayTimeout
+			}
+			slog.ErrorContext(r.Context(), "Proxy request failed", "route", route.PathPrefix, "service", route.Service, "error", err)
+			http.Error(w, http.StatusText(status), status)
+		},
+	}
 }
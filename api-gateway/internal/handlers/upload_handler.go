@@ -0,0 +1,354 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cloud-drive/api-gateway/internal/clients"
+	"github.com/cloud-drive/api-gateway/internal/config"
+	"github.com/cloud-drive/proto-definitions/file"
+	"github.com/gorilla/mux"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// tusVersion là phiên bản giao thức tus được hỗ trợ
+	tusVersion = "1.0.0"
+	// tusExtensions là các extension của tus được hỗ trợ
+	tusExtensions = "creation,termination,checksum,expiration"
+	// tusChecksumAlgorithms là các thuật toán dùng được trong Upload-Checksum
+	tusChecksumAlgorithms = "md5,sha1,sha256"
+	// offsetOctetStream là Content-Type bắt buộc của PATCH
+	offsetOctetStream = "application/offset+octet-stream"
+	// statusChecksumMismatch là status tus trả khi checksum không khớp
+	statusChecksumMismatch = 460
+)
+
+// UploadHandler cài đặt giao thức tus 1.0 cho upload có thể tiếp tục dưới
+// /api/uploads. Dữ liệu được chuyển sang file-service theo từng phần, file-service
+// lưu trạng thái trên đĩa và tạo file trong drive khi nhận đủ dữ liệu.
+type UploadHandler struct {
+	fileClient *clients.FileClient
+	maxSize    int64
+	chunkSize  int64
+}
+
+// NewUploadHandler tạo handler cho upload tus
+func NewUploadHandler(fileClient *clients.FileClient, cfg *config.Config) *UploadHandler {
+	return &UploadHandler{
+		fileClient: fileClient,
+		maxSize:    cfg.MaxUploadSize,
+		chunkSize:  cfg.UploadChunk(),
+	}
+}
+
+// Options trả về phiên bản, extension và giới hạn kích thước mà server hỗ trợ
+func (h *UploadHandler) Options(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Tus-Resumable", tusVersion)
+	w.Header().Set("Tus-Version", tusVersion)
+	w.Header().Set("Tus-Extension", tusExtensions)
+	w.Header().Set("Tus-Max-Size", strconv.FormatInt(h.maxSize, 10))
+	w.Header().Set("Tus-Checksum-Algorithm", tusChecksumAlgorithms)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RequireTus từ chối request không gửi Tus-Resumable đúng phiên bản và thêm
+// header Tus-Resumable vào mọi response
+func (h *UploadHandler) RequireTus(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Tus-Resumable", tusVersion)
+		if r.Header.Get("Tus-Resumable") != tusVersion {
+			w.Header().Set("Tus-Version", tusVersion)
+			http.Error(w, "Unsupported Tus-Resumable version", http.StatusPreconditionFailed)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Create tạo upload mới từ Upload-Length và Upload-Metadata. Các key metadata
+// được dùng: "filename" (hoặc "name"), "filetype" (hoặc "type"), "folder",
+// "folder_id" và "on_conflict"; metadata được trả lại nguyên vẹn ở HEAD.
+func (h *UploadHandler) Create(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Upload-Defer-Length") != "" {
+		http.Error(w, "Upload-Defer-Length is not supported", http.StatusBadRequest)
+		return
+	}
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		http.Error(w, "Invalid request: Upload-Length is required", http.StatusBadRequest)
+		return
+	}
+	if length > h.maxSize {
+		http.Error(w, fmt.Sprintf("File is larger than %d bytes", h.maxSize), http.StatusRequestEntityTooLarge)
+		return
+	}
+	rawMetadata := r.Header.Get("Upload-Metadata")
+	metadata, err := parseUploadMetadata(rawMetadata)
+	if err != nil {
+		http.Error(w, "Invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	req := &file.CreateUploadRequest{
+		Length:      length,
+		Name:        firstOf(metadata, "filename", "name"),
+		Folder:      metadata["folder"],
+		FolderId:    metadata["folder_id"],
+		ContentType: firstOf(metadata, "filetype", "type"),
+		OnConflict:  metadata["on_conflict"],
+		Metadata:    rawMetadata,
+	}
+	// application/octet-stream không mang thông tin, để file-service tự nhận dạng
+	if req.ContentType == "application/octet-stream" {
+		req.ContentType = ""
+	}
+
+	resp, err := h.fileClient.CreateUpload(r.Context(), req)
+	if err != nil {
+		writeTusError(w, r, "CreateUpload", err)
+		return
+	}
+
+	setUploadHeaders(w, resp)
+	w.Header().Set("Location", "/api/uploads/"+resp.Upload.Id)
+	w.WriteHeader(http.StatusCreated)
+}
+
+// Head trả về offset hiện tại để client biết cần gửi tiếp từ đâu
+func (h *UploadHandler) Head(w http.ResponseWriter, r *http.Request) {
+	resp, err := h.fileClient.GetUpload(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		writeTusError(w, r, "GetUpload", err)
+		return
+	}
+
+	setUploadHeaders(w, resp)
+	w.Header().Set("Upload-Length", strconv.FormatInt(resp.Upload.Length, 10))
+	if resp.Upload.Metadata != "" {
+		w.Header().Set("Upload-Metadata", resp.Upload.Metadata)
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+}
+
+// Patch ghi dữ liệu tại Upload-Offset. Body được gửi sang file-service theo
+// từng phần chunkSize byte, nên nếu kết nối bị ngắt thì các phần đã gửi vẫn
+// được giữ. Khi có Upload-Checksum, cả body được kiểm tra trước khi ghi nên
+// body không được lớn hơn một phần.
+func (h *UploadHandler) Patch(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Content-Type") != offsetOctetStream {
+		http.Error(w, "Content-Type must be "+offsetOctetStream, http.StatusUnsupportedMediaType)
+		return
+	}
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		http.Error(w, "Invalid request: Upload-Offset is required", http.StatusBadRequest)
+		return
+	}
+	var checksum hash.Hash
+	var expected []byte
+	if header := r.Header.Get("Upload-Checksum"); header != "" {
+		if checksum, expected, err = parseUploadChecksum(header); err != nil {
+			http.Error(w, "Invalid request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	id := mux.Vars(r)["id"]
+	current, err := h.fileClient.GetUpload(r.Context(), id)
+	if err != nil {
+		writeTusError(w, r, "GetUpload", err)
+		return
+	}
+	if current.Upload.Offset != offset {
+		http.Error(w, "Upload-Offset does not match the upload offset", http.StatusConflict)
+		return
+	}
+	remaining := current.Upload.Length - offset
+
+	var resp *file.UploadResponse
+	if checksum != nil {
+		resp, err = h.appendVerified(r, id, offset, remaining, checksum, expected)
+	} else {
+		resp, err = h.appendChunks(r, id, offset, remaining)
+	}
+	if err != nil {
+		writeTusError(w, r, "AppendUpload", err)
+		return
+	}
+
+	setUploadHeaders(w, resp)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Delete huỷ upload (extension termination)
+func (h *UploadHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	if _, err := h.fileClient.DeleteUpload(r.Context(), mux.Vars(r)["id"]); err != nil {
+		writeTusError(w, r, "DeleteUpload", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// appendChunks streams the body to file-service chunkSize bytes at a time.
+// Data read before a broken connection is still appended, and a request
+// without data is sent once so a failed commit can be retried.
+func (h *UploadHandler) appendChunks(r *http.Request, id string, offset, remaining int64) (*file.UploadResponse, error) {
+	body := io.LimitReader(r.Body, remaining+1)
+	buf := make([]byte, min(h.chunkSize, remaining+1))
+	var resp *file.UploadResponse
+	for first := true; ; first = false {
+		n, readErr := io.ReadFull(body, buf)
+		if int64(n) > remaining {
+			return nil, errUploadTooLarge
+		}
+		if n > 0 || first {
+			var err error
+			resp, err = h.fileClient.AppendUpload(r.Context(), &file.AppendUploadRequest{
+				Id:      id,
+				Offset:  offset,
+				Content: buf[:n],
+			})
+			if err != nil {
+				return nil, err
+			}
+			offset += int64(n)
+			remaining -= int64(n)
+		}
+		switch {
+		case readErr == io.EOF || readErr == io.ErrUnexpectedEOF:
+			return resp, nil
+		case readErr != nil:
+			return nil, fmt.Errorf("%w: %v", errUploadBody, readErr)
+		}
+	}
+}
+
+// appendVerified reads the whole body, checks it against the checksum and
+// appends it in one call
+func (h *UploadHandler) appendVerified(r *http.Request, id string, offset, remaining int64, checksum hash.Hash, expected []byte) (*file.UploadResponse, error) {
+	limit := min(h.chunkSize, remaining)
+	content, err := io.ReadAll(io.LimitReader(r.Body, limit+1))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errUploadBody, err)
+	}
+	if int64(len(content)) > limit {
+		return nil, errUploadTooLarge
+	}
+	checksum.Write(content)
+	if !bytes.Equal(checksum.Sum(nil), expected) {
+		return nil, errChecksumMismatch
+	}
+	return h.fileClient.AppendUpload(r.Context(), &file.AppendUploadRequest{
+		Id:      id,
+		Offset:  offset,
+		Content: content,
+	})
+}
+
+var (
+	errUploadTooLarge   = errors.New("request body exceeds the upload length or chunk size")
+	errUploadBody       = errors.New("failed to read request body")
+	errChecksumMismatch = errors.New("checksum mismatch")
+)
+
+// setUploadHeaders thêm offset, thời điểm hết hạn và ID file (khi upload đã
+// được lưu vào drive) vào response
+func setUploadHeaders(w http.ResponseWriter, resp *file.UploadResponse) {
+	upload := resp.Upload
+	w.Header().Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	if expires, err := time.Parse(time.RFC3339, upload.ExpiresAt); err == nil {
+		w.Header().Set("Upload-Expires", expires.UTC().Format(http.TimeFormat))
+	}
+	if upload.FileId != "" {
+		w.Header().Set("X-File-Id", upload.FileId)
+	}
+}
+
+// parseUploadMetadata đọc Upload-Metadata dạng "key base64value,key2 base64value2"
+func parseUploadMetadata(header string) (map[string]string, error) {
+	metadata := make(map[string]string)
+	if strings.TrimSpace(header) == "" {
+		return metadata, nil
+	}
+	for _, pair := range strings.Split(header, ",") {
+		key, encoded, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		if key == "" {
+			return nil, errors.New("Upload-Metadata contains an empty key")
+		}
+		value, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+		if err != nil {
+			return nil, fmt.Errorf("Upload-Metadata value of %q is not valid base64", key)
+		}
+		metadata[key] = string(value)
+	}
+	return metadata, nil
+}
+
+// parseUploadChecksum đọc Upload-Checksum dạng "<algorithm> <base64 digest>"
+func parseUploadChecksum(header string) (hash.Hash, []byte, error) {
+	algorithm, encoded, ok := strings.Cut(header, " ")
+	if !ok {
+		return nil, nil, errors.New("Upload-Checksum must be \"<algorithm> <base64 digest>\"")
+	}
+	expected, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, nil, errors.New("Upload-Checksum digest is not valid base64")
+	}
+	switch algorithm {
+	case "md5":
+		return md5.New(), expected, nil
+	case "sha1":
+		return sha1.New(), expected, nil
+	case "sha256":
+		return sha256.New(), expected, nil
+	}
+	return nil, nil, fmt.Errorf("unsupported checksum algorithm %q", algorithm)
+}
+
+// firstOf trả về giá trị đầu tiên khác rỗng trong các key
+func firstOf(values map[string]string, keys ...string) string {
+	for _, key := range keys {
+		if v := values[key]; v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// writeTusError chuyển lỗi sang status của tus: offset lệch là 409, upload
+// đang được request khác dùng là 423, còn lại như các route file khác
+func writeTusError(w http.ResponseWriter, r *http.Request, method string, err error) {
+	switch {
+	case errors.Is(err, errUploadTooLarge):
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	case errors.Is(err, errUploadBody):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case errors.Is(err, errChecksumMismatch):
+		http.Error(w, err.Error(), statusChecksumMismatch)
+		return
+	}
+	switch status.Code(err) {
+	case codes.FailedPrecondition:
+		http.Error(w, status.Convert(err).Message(), http.StatusConflict)
+	case codes.Aborted:
+		http.Error(w, status.Convert(err).Message(), http.StatusLocked)
+	default:
+		writeRPCError(w, r, method, err)
+	}
+}
@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"github.com/cloud-drive/api-gateway/internal/clients"
+	"github.com/cloud-drive/api-gateway/internal/config"
+	"github.com/cloud-drive/api-gateway/internal/middleware"
+	"github.com/cloud-drive/api-gateway/internal/transcoding"
+	"github.com/gorilla/mux"
+)
+
+// userServiceAccess là bảng phân quyền cho các RPC của user-service được
+// expose qua REST. RPC có HTTP annotation nhưng không có trong bảng chỉ
+// admin mới gọi được.
+var userServiceAccess = map[string]transcoding.Access{
+	// Chỉ admin mới được liệt kê, tạo (khác với register) và xóa người dùng
+	"ListUsers":  transcoding.AdminOnly,
+	"CreateUser": transcoding.AdminOnly,
+	"DeleteUser": transcoding.AdminOnly,
+	// Người dùng chỉ xem và cập nhật được thông tin của chính mình, admin được tất cả
+	"GetUser":    {Roles: []string{"admin"}, OwnerField: "id"},
+	"UpdateUser": {Roles: []string{"admin"}, OwnerField: "id"},
+	// Personal access token luôn thuộc về người gọi, user-service tự kiểm tra khi thu hồi
+	"CreateAccessToken": {},
+	"ListAccessTokens":  {},
+	"RevokeAccessToken": {},
+	// Người dùng xem hạn mức của chính mình, chỉ admin được đổi hạn mức
+	"GetStorageUsage": {},
+	"SetStorageLimit": transcoding.AdminOnly,
+}
+
+// RegisterUserRoutes đăng ký REST route cho các RPC có HTTP annotation trong
+// user.proto, với AuthMiddleware và phân quyền đặt trước mỗi route
+func RegisterUserRoutes(router *mux.Router, userClient *clients.UserClient, cfg *config.Config) ([]transcoding.Route, error) {
+	return transcoding.Register(router, transcoding.Options{
+		Conn:    userClient.Conn(),
+		Service: "user.UserService",
+		Access:  userServiceAccess,
+		Auth:    middleware.AuthMiddleware(cfg, userClient),
+	})
+}
@@ -0,0 +1,56 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Outcomes recorded by the auth counters
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+	OutcomeError   = "error"
+	OutcomeLockout = "lockout"
+)
+
+// Metrics holds the gateway specific Prometheus collectors
+type Metrics struct {
+	HTTPRequests  *prometheus.CounterVec
+	HTTPDuration  *prometheus.HistogramVec
+	HTTPInFlight  prometheus.Gauge
+	LoginAttempts *prometheus.CounterVec
+	Registrations *prometheus.CounterVec
+	RateLimited   *prometheus.CounterVec
+}
+
+// New creates the gateway metrics and registers them on reg
+func New(reg prometheus.Registerer) *Metrics {
+	m := &Metrics{
+		HTTPRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_requests_total",
+			Help: "Number of HTTP requests handled, by route, method and status code.",
+		}, []string{"route", "method", "code"}),
+		HTTPDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "http_request_duration_seconds",
+			Help:    "Duration of HTTP requests, by route and method.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"route", "method"}),
+		HTTPInFlight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "http_requests_in_flight",
+			Help: "Number of HTTP requests currently being served.",
+		}),
+		LoginAttempts: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "auth_login_attempts_total",
+			Help: "Login attempts by outcome (success, failure, error, lockout).",
+		}, []string{"outcome"}),
+		Registrations: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "auth_registrations_total",
+			Help: "Account registrations by outcome (success, failure, error).",
+		}, []string{"outcome"}),
+		RateLimited: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_rate_limited_total",
+			Help: "Requests rejected by the rate limiter, by rule.",
+		}, []string{"rule"}),
+	}
+	reg.MustRegister(m.HTTPRequests, m.HTTPDuration, m.HTTPInFlight, m.LoginAttempts, m.Registrations, m.RateLimited)
+	return m
+}
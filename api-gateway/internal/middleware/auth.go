@@ -4,40 +4,72 @@ import (
 	"context"
 	"errors"
 	"github.com/cloud-drive/api-gateway/internal/config"
+	"github.com/cloud-drive/proto-definitions/user"
+	"github.com/cloud-drive/shared/identity"
 	"github.com/dgrijalva/jwt-go"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"log/slog"
 	"net/http"
+	"slices"
 	"strings"
 	"time"
 )
 
+// AccessTokenPrefix mở đầu mọi personal access token do user-service cấp
+const AccessTokenPrefix = "cdp_"
+
+// ScopeWrite là scope cần có để personal access token gửi request thay đổi dữ liệu
+const ScopeWrite = "write"
+
+// AccessTokenVerifier xác thực personal access token, do clients.UserClient cài đặt
+type AccessTokenVerifier interface {
+	VerifyAccessToken(ctx context.Context, token string) (*user.VerifyAccessTokenResponse, error)
+}
+
 // Claims là cấu trúc dữ liệu cho JWT claims
 type Claims struct {
 	UserID string `json:"user_id"`
 	Role   string `json:"role"`
+	// Scopes và AccessTokenID chỉ có khi request dùng personal access token
+	Scopes        []string `json:"-"`
+	AccessTokenID string   `json:"-"`
 	jwt.StandardClaims
 }
 
-// AuthMiddleware tạo middleware xác thực JWT
-func AuthMiddleware(cfg *config.Config) func(next http.Handler) http.Handler {
+// AuthMiddleware tạo middleware xác thực JWT. Bearer token bắt đầu bằng
+// AccessTokenPrefix là personal access token và được xác thực qua tokens;
+// tokens nil thì không chấp nhận personal access token.
+func AuthMiddleware(cfg *config.Config, tokens AccessTokenVerifier) func(next http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			// Lấy token từ Authorization header
-			authHeader := r.Header.Get("Authorization")
-			if authHeader == "" {
-				http.Error(w, "Authorization header is required", http.StatusUnauthorized)
+			// Lấy token từ Authorization header, hoặc từ session cookie khi bật chế độ cookie
+			tokenString, fromCookie, err := requestToken(r, cfg)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusUnauthorized)
 				return
 			}
 
-			// Kiểm tra định dạng "Bearer <token>"
-			bearerToken := strings.Split(authHeader, " ")
-			if len(bearerToken) != 2 || strings.ToLower(bearerToken[0]) != "bearer" {
-				http.Error(w, "Invalid token format", http.StatusUnauthorized)
+			// Personal access token chỉ đi qua header, không qua cookie
+			if !fromCookie && strings.HasPrefix(tokenString, AccessTokenPrefix) {
+				claims, code, err := verifyAccessToken(r.Context(), tokens, tokenString)
+				if err != nil {
+					http.Error(w, err.Error(), code)
+					return
+				}
+				// Rate limit theo user chỉ áp dụng được khi đã biết user của token
+				if !applyUserLimit(w, r, claims.UserID) {
+					return
+				}
+				// Token chỉ có scope read không được thay đổi dữ liệu
+				if !isSafeMethod(r.Method) && !slices.Contains(claims.Scopes, ScopeWrite) {
+					http.Error(w, "Access token lacks the write scope", http.StatusForbidden)
+					return
+				}
+				next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), "claims", claims)))
 				return
 			}
 
-			// Trích xuất token
-			tokenString := bearerToken[1]
-
 			// Xác thực token
 			claims, err := validateToken(tokenString, cfg.JWTSecret)
 			if err != nil {
@@ -45,6 +77,12 @@ func AuthMiddleware(cfg *config.Config) func(next http.Handler) http.Handler {
 				return
 			}
 
+			// Trình duyệt tự gửi cookie nên request thay đổi dữ liệu phải kèm CSRF token
+			if fromCookie && !isSafeMethod(r.Method) && !validCSRF(r, cfg.JWTSecret, claims.UserID) {
+				http.Error(w, "Invalid or missing CSRF token", http.StatusForbidden)
+				return
+			}
+
 			// Thêm claims vào context để các handler có thể sử dụng
 			ctx := context.WithValue(r.Context(), "claims", claims)
 
@@ -54,6 +92,73 @@ func AuthMiddleware(cfg *config.Config) func(next http.Handler) http.Handler {
 	}
 }
 
+// requestToken lấy JWT từ header "Authorization: Bearer <token>". Khi
+// session.mode=cookie và không có header, token được đọc từ session cookie.
+func requestToken(r *http.Request, cfg *config.Config) (token string, fromCookie bool, err error) {
+	authHeader := r.Header.Get("Authorization")
+	if authHeader == "" {
+		if cfg.CookieSessions() {
+			if cookie, err := r.Cookie(cfg.SessionCookie); err == nil && cookie.Value != "" {
+				return cookie.Value, true, nil
+			}
+		}
+		return "", false, errors.New("Authorization header is required")
+	}
+
+	// Kiểm tra định dạng "Bearer <token>"
+	bearerToken := strings.Split(authHeader, " ")
+	if len(bearerToken) != 2 || strings.ToLower(bearerToken[0]) != "bearer" {
+		return "", false, errors.New("Invalid token format")
+	}
+	return bearerToken[1], false, nil
+}
+
+// verifyAccessToken xác thực personal access token qua user-service và trả
+// về claims tương ứng, hoặc HTTP status cùng lỗi để trả cho client
+func verifyAccessToken(ctx context.Context, tokens AccessTokenVerifier, token string) (*Claims, int, error) {
+	if tokens == nil {
+		return nil, http.StatusUnauthorized, errors.New("Invalid or expired token")
+	}
+	resp, err := tokens.VerifyAccessToken(ctx, token)
+	if err != nil {
+		if status.Code(err) == codes.Unauthenticated {
+			return nil, http.StatusUnauthorized, errors.New("Invalid or expired token")
+		}
+		slog.ErrorContext(ctx, "Failed to verify access token", "error", err)
+		return nil, http.StatusServiceUnavailable, errors.New("Authentication service unavailable")
+	}
+	return &Claims{
+		UserID:        resp.User.Id,
+		Role:          resp.User.Role,
+		Scopes:        resp.AccessToken.Scopes,
+		AccessTokenID: resp.AccessToken.Id,
+	}, 0, nil
+}
+
+// peekClaims đọc claims từ JWT của request (Bearer token hoặc session cookie,
+// giống AuthMiddleware) nếu có và hợp lệ, không trả lỗi. Dùng cho các
+// middleware chạy trước AuthMiddleware (ví dụ rate limit theo user).
+func peekClaims(r *http.Request, cfg *config.Config) *Claims {
+	token, _, err := requestToken(r, cfg)
+	if err != nil {
+		return nil
+	}
+	claims, err := validateToken(token, cfg.JWTSecret)
+	if err != nil {
+		return nil
+	}
+	return claims
+}
+
+// bearerToken trả về token trong header "Authorization: Bearer <token>"
+func bearerToken(r *http.Request) (string, bool) {
+	parts := strings.Split(r.Header.Get("Authorization"), " ")
+	if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" {
+		return "", false
+	}
+	return parts[1], true
+}
+
 // validateToken xác thực JWT token và trả về claims
 func validateToken(tokenString string, secretKey string) (*Claims, error) {
 	// Phân tích token
@@ -106,6 +211,16 @@ func GetUserIDFromContext(ctx context.Context) (string, error) {
 	return claims.UserID, nil
 }
 
+// IdentityFromContext trả về người dùng trong JWT claims để chuyển tiếp tới
+// các service phía sau; request chưa đăng nhập không có identity
+func IdentityFromContext(ctx context.Context) (identity.Identity, bool) {
+	claims, ok := ctx.Value("claims").(*Claims)
+	if !ok || claims.UserID == "" {
+		return identity.Identity{}, false
+	}
+	return identity.Identity{UserID: claims.UserID, Role: claims.Role}, true
+}
+
 // RequireRole middleware đảm bảo người dùng có role cụ thể
 func RequireRole(role string) func(next http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
@@ -0,0 +1,219 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/cloud-drive/proto-definitions/user"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	writeToken = AccessTokenPrefix + "write"
+	readToken  = AccessTokenPrefix + "read"
+)
+
+// fakeTokens verifies the personal access tokens it was given
+type fakeTokens struct {
+	mu     sync.Mutex
+	tokens map[string]*user.VerifyAccessTokenResponse
+	err    error
+	calls  int
+}
+
+func newFakeTokens() *fakeTokens {
+	return &fakeTokens{tokens: map[string]*user.VerifyAccessTokenResponse{
+		writeToken: {
+			AccessToken: &user.AccessToken{Id: "token-write", Scopes: []string{"read", "write"}},
+			User:        &user.User{Id: "user-1", Role: "user"},
+		},
+		readToken: {
+			AccessToken: &user.AccessToken{Id: "token-read", Scopes: []string{"read"}},
+			User:        &user.User{Id: "user-1", Role: "user"},
+		},
+	}}
+}
+
+func (f *fakeTokens) VerifyAccessToken(ctx context.Context, token string) (*user.VerifyAccessTokenResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls++
+	if f.err != nil {
+		return nil, f.err
+	}
+	resp, ok := f.tokens[token]
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "invalid access token")
+	}
+	return resp, nil
+}
+
+// claimsHandler records the claims of the requests that reach it
+type claimsHandler struct {
+	mu     sync.Mutex
+	claims []*Claims
+}
+
+func (h *claimsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	claims, _ := r.Context().Value("claims").(*Claims)
+	h.mu.Lock()
+	h.claims = append(h.claims, claims)
+	h.mu.Unlock()
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *claimsHandler) last() *Claims {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.claims) == 0 {
+		return nil
+	}
+	return h.claims[len(h.claims)-1]
+}
+
+// newAuthenticated returns next behind RateLimit and AuthMiddleware as
+// routed by the gateway, with the rate limit rules in specs
+func newAuthenticated(t *testing.T, store *frozenStore, tokens AccessTokenVerifier, next http.Handler, specs ...string) http.Handler {
+	t.Helper()
+	cfg := testConfig("token")
+	h, _ := newRateLimited(t, store, cfg, AuthMiddleware(cfg, tokens)(next), specs...)
+	return h
+}
+
+func TestAccessTokenCountsOnceAgainstUserBucket(t *testing.T) {
+	store := newFrozenStore()
+	next := &claimsHandler{}
+	cfg := testConfig("token")
+	// AuthMiddleware twice, as on a route whose group is also authenticated
+	auth := AuthMiddleware(cfg, newFakeTokens())
+	h, _ := newRateLimited(t, store, cfg, auth(auth(next)), "* /api ip 10/m 10", "* /api user 3/m 3")
+
+	rec := serve(h, "GET", "/api/files", bearer(writeToken))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("request with a token = %d, want 200", rec.Code)
+	}
+	if got := store.taken("|user:user-1"); got != 1 {
+		t.Fatalf("%d tokens taken from the user bucket, want 1", got)
+	}
+	if got := store.taken("|ip:"); got != 1 {
+		t.Fatalf("%d tokens taken from the ip bucket, want 1", got)
+	}
+	// The user rule is the more restrictive one
+	assertHeaders(t, rec, map[string]string{"RateLimit-Limit": "3", "RateLimit-Remaining": "2"})
+	if claims := next.last(); claims == nil || claims.UserID != "user-1" || claims.AccessTokenID != "token-write" {
+		t.Fatalf("claims = %+v, want those of the token", claims)
+	}
+}
+
+func TestAccessTokenSharesUserBucketWithSession(t *testing.T) {
+	store := newFrozenStore()
+	h := newAuthenticated(t, store, newFakeTokens(), &claimsHandler{}, "* /api user 2/m 2")
+
+	for i := 0; i < 2; i++ {
+		if rec := serve(h, "GET", "/api/files", bearer(writeToken)); rec.Code != http.StatusOK {
+			t.Fatalf("request %d with a token = %d, want 200", i+1, rec.Code)
+		}
+	}
+	rec := serve(h, "GET", "/api/files", bearer(writeToken))
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("token request over the user limit = %d, want 429", rec.Code)
+	}
+	assertHeaders(t, rec, map[string]string{"RateLimit-Limit": "2", "RateLimit-Remaining": "0", "Retry-After": "30"})
+
+	if rec := serve(h, "GET", "/api/files", bearer(jwtFor(t, "user-1"))); rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("session request of the same user = %d, want 429", rec.Code)
+	}
+	if rec := serve(h, "GET", "/api/files", bearer(jwtFor(t, "user-2"))); rec.Code != http.StatusOK {
+		t.Fatalf("session request of another user = %d, want 200", rec.Code)
+	}
+}
+
+func TestAccessTokenKeepsLessRestrictiveHeaders(t *testing.T) {
+	h := newAuthenticated(t, newFrozenStore(), newFakeTokens(), &claimsHandler{}, "* /api ip 3/m 3", "* /api user 10/m 10")
+
+	rec := serve(h, "GET", "/api/files", bearer(writeToken))
+	assertHeaders(t, rec, map[string]string{"RateLimit-Limit": "3", "RateLimit-Remaining": "2"})
+}
+
+func TestInvalidAccessTokenNeverReachesUserBucket(t *testing.T) {
+	store := newFrozenStore()
+	tokens := newFakeTokens()
+	next := &claimsHandler{}
+	h := newAuthenticated(t, store, tokens, next, "* /api ip 10/m 10", "* /api user 1/m 1")
+
+	for i := 0; i < 3; i++ {
+		rec := serve(h, "GET", "/api/files", bearer(AccessTokenPrefix+"forged"))
+		if rec.Code != http.StatusUnauthorized {
+			t.Fatalf("request %d with an invalid token = %d, want 401", i+1, rec.Code)
+		}
+	}
+	for _, keys := range store.keys {
+		for _, key := range keys {
+			if strings.HasPrefix(key, "* /api user") {
+				t.Fatalf("invalid token counted against user rule bucket %q", key)
+			}
+		}
+	}
+	if got := store.taken("|ip:"); got != 3 {
+		t.Errorf("%d tokens taken from the ip bucket, want 3", got)
+	}
+	if next.last() != nil {
+		t.Error("request with an invalid token reached the handler")
+	}
+
+	// A valid token afterwards still has its whole user bucket
+	if rec := serve(h, "GET", "/api/files", bearer(writeToken)); rec.Code != http.StatusOK {
+		t.Fatalf("request with a valid token = %d, want 200", rec.Code)
+	}
+}
+
+func TestAccessTokenVerificationFailure(t *testing.T) {
+	tokens := newFakeTokens()
+	tokens.err = status.Error(codes.Unavailable, "user service down")
+	h := newAuthenticated(t, newFrozenStore(), tokens, &claimsHandler{}, "* /api user 5/m 5")
+	if rec := serve(h, "GET", "/api/files", bearer(writeToken)); rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("request while verification fails = %d, want 503", rec.Code)
+	}
+
+	h = newAuthenticated(t, newFrozenStore(), nil, &claimsHandler{}, "* /api user 5/m 5")
+	if rec := serve(h, "GET", "/api/files", bearer(writeToken)); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("token without a verifier = %d, want 401", rec.Code)
+	}
+}
+
+func TestReadScopedAccessToken(t *testing.T) {
+	h := newAuthenticated(t, newFrozenStore(), newFakeTokens(), &claimsHandler{}, "* /api ip 100/m 100")
+
+	for _, method := range []string{"GET", "HEAD", "OPTIONS"} {
+		if rec := serve(h, method, "/api/files", bearer(readToken)); rec.Code != http.StatusOK {
+			t.Errorf("%s with a read token = %d, want 200", method, rec.Code)
+		}
+	}
+	for _, method := range []string{"POST", "PUT", "PATCH", "DELETE"} {
+		rec := serve(h, method, "/api/files", bearer(readToken))
+		if rec.Code != http.StatusForbidden || !strings.Contains(rec.Body.String(), "write scope") {
+			t.Errorf("%s with a read token = %d %q, want 403 for the missing write scope", method, rec.Code, rec.Body.String())
+		}
+		if rec := serve(h, method, "/api/files", bearer(writeToken)); rec.Code != http.StatusOK {
+			t.Errorf("%s with a write token = %d, want 200", method, rec.Code)
+		}
+	}
+}
+
+func TestAccessTokenInSessionCookieIsNotVerified(t *testing.T) {
+	tokens := newFakeTokens()
+	cfg := testConfig("cookie")
+	h := AuthMiddleware(cfg, tokens)(&claimsHandler{})
+
+	rec := serve(h, "GET", "/api/files", http.Header{"Cookie": {"session=" + writeToken}})
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("access token in the session cookie = %d, want 401", rec.Code)
+	}
+	if tokens.calls != 0 {
+		t.Fatalf("access token in the session cookie was verified %d times", tokens.calls)
+	}
+}
@@ -0,0 +1,128 @@
+package middleware
+
+import (
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+)
+
+// corsOptions returns options allowing origins, with credentials off
+func corsOptions(origins ...string) CORSOptions {
+	return CORSOptions{
+		AllowedOrigins: origins,
+		AllowedMethods: []string{"GET", "POST", "DELETE"},
+		AllowedHeaders: []string{"Authorization", "Content-Type", CSRFHeaderName},
+		ExposedHeaders: []string{"X-Request-ID"},
+		MaxAge:         10 * time.Minute,
+	}
+}
+
+func TestCORSAllowedOrigin(t *testing.T) {
+	next := &okHandler{}
+	h := CORS(corsOptions("https://app.example.com", "https://*.example.org"))(next)
+
+	for _, origin := range []string{"https://app.example.com", "https://APP.example.com", "https://eu.example.org", "https://a.b.example.org"} {
+		rec := serve(h, "GET", "/api/files", http.Header{"Origin": {origin}})
+		assertHeaders(t, rec, map[string]string{
+			"Access-Control-Allow-Origin":   origin,
+			"Access-Control-Expose-Headers": "X-Request-ID",
+		})
+		if got := rec.Header().Values("Vary"); !slices.Contains(got, "Origin") {
+			t.Errorf("Vary = %v, want Origin", got)
+		}
+	}
+	if next.count() != 4 {
+		t.Fatalf("handler called %d times, want 4", next.count())
+	}
+}
+
+func TestCORSDisallowedOrigin(t *testing.T) {
+	next := &okHandler{}
+	opts := corsOptions("https://app.example.com", "https://*.example.org")
+	opts.AllowCredentials = true
+	h := CORS(opts)(next)
+
+	for _, origin := range []string{
+		"https://evil.com",
+		"http://app.example.com",
+		"https://app.example.com.evil.com",
+		"https://example.org",
+		"https://evilexample.org",
+		"http://eu.example.org",
+		"null",
+	} {
+		for _, method := range []string{"GET", "OPTIONS"} {
+			header := http.Header{"Origin": {origin}, "Access-Control-Request-Method": {"DELETE"}}
+			rec := serve(h, method, "/api/files", header)
+			for _, name := range []string{"Access-Control-Allow-Origin", "Access-Control-Allow-Credentials", "Access-Control-Allow-Methods"} {
+				if got := rec.Header().Get(name); got != "" {
+					t.Errorf("%s from %s got %s %q, want none", method, origin, name, got)
+				}
+			}
+		}
+	}
+	// The request goes on; the browser withholds the response
+	if next.count() != 14 {
+		t.Fatalf("handler called %d times, want 14", next.count())
+	}
+}
+
+func TestCORSPreflight(t *testing.T) {
+	next := &okHandler{}
+	h := CORS(corsOptions("https://app.example.com"))(next)
+
+	header := http.Header{"Origin": {"https://app.example.com"}, "Access-Control-Request-Method": {"DELETE"}}
+	rec := serve(h, "OPTIONS", "/api/files/1", header)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("preflight = %d, want 204", rec.Code)
+	}
+	assertHeaders(t, rec, map[string]string{
+		"Access-Control-Allow-Origin":  "https://app.example.com",
+		"Access-Control-Allow-Methods": "GET, POST, DELETE",
+		"Access-Control-Allow-Headers": "Authorization, Content-Type, X-CSRF-Token",
+		"Access-Control-Max-Age":       "600",
+	})
+	if next.count() != 0 {
+		t.Fatal("preflight reached the handler")
+	}
+
+	// OPTIONS without Access-Control-Request-Method is not a preflight
+	rec = serve(h, "OPTIONS", "/api/files/1", http.Header{"Origin": {"https://app.example.com"}})
+	if rec.Code != http.StatusOK || next.count() != 1 {
+		t.Fatalf("plain OPTIONS = %d, want it passed to the handler", rec.Code)
+	}
+}
+
+func TestCORSWildcardOrigin(t *testing.T) {
+	h := CORS(corsOptions("*"))(&okHandler{})
+	rec := serve(h, "GET", "/api/files", http.Header{"Origin": {"https://any.example.net"}})
+	assertHeaders(t, rec, map[string]string{"Access-Control-Allow-Origin": "*", "Access-Control-Allow-Credentials": ""})
+
+	// Browsers reject credentials with "*", so the origin is echoed instead
+	opts := corsOptions("https://app.example.com", "*")
+	opts.AllowCredentials = true
+	h = CORS(opts)(&okHandler{})
+	for _, origin := range []string{"https://app.example.com", "https://any.example.net"} {
+		for _, method := range []string{"GET", "OPTIONS"} {
+			header := http.Header{"Origin": {origin}, "Access-Control-Request-Method": {"POST"}}
+			rec := serve(h, method, "/api/files", header)
+			assertHeaders(t, rec, map[string]string{
+				"Access-Control-Allow-Origin":      origin,
+				"Access-Control-Allow-Credentials": "true",
+			})
+		}
+	}
+}
+
+func TestCORSWithoutOrigin(t *testing.T) {
+	next := &okHandler{}
+	h := CORS(corsOptions("*"))(next)
+	rec := serve(h, "OPTIONS", "/api/files", http.Header{"Access-Control-Request-Method": {"POST"}})
+	if rec.Code != http.StatusOK || next.count() != 1 {
+		t.Fatalf("request without Origin = %d, want it passed to the handler", rec.Code)
+	}
+	if len(rec.Header()) != 0 {
+		t.Fatalf("request without Origin got headers %v, want none", rec.Header())
+	}
+}
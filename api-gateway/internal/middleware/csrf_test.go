@@ -0,0 +1,105 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// csrfToken returns a CSRF token of userID signed with testSecret
+func csrfToken(t *testing.T, userID string) string {
+	t.Helper()
+	token, err := NewCSRFToken(testSecret, userID)
+	if err != nil {
+		t.Fatalf("NewCSRFToken: %v", err)
+	}
+	return token
+}
+
+// csrfRequest returns a POST request carrying the CSRF cookie and header when
+// they are not empty
+func csrfRequest(cookie, header string) *http.Request {
+	r := httptest.NewRequest("POST", "/api/files", nil)
+	if cookie != "" {
+		r.AddCookie(&http.Cookie{Name: CSRFCookieName, Value: cookie})
+	}
+	if header != "" {
+		r.Header.Set(CSRFHeaderName, header)
+	}
+	return r
+}
+
+func TestValidCSRF(t *testing.T) {
+	alice := csrfToken(t, "alice")
+	otherAlice := csrfToken(t, "alice")
+	bob := csrfToken(t, "bob")
+	otherSecret, err := NewCSRFToken("another-secret", "alice")
+	if err != nil {
+		t.Fatalf("NewCSRFToken: %v", err)
+	}
+
+	for _, tc := range []struct {
+		name           string
+		cookie, header string
+		want           bool
+	}{
+		{"cookie and header", alice, alice, true},
+		{"missing header", alice, "", false},
+		{"missing cookie", "", alice, false},
+		{"mismatched cookie", otherAlice, alice, false},
+		{"token of another user", bob, bob, false},
+		{"token signed with another secret", otherSecret, otherSecret, false},
+		{"unsigned token", "nonce", "nonce", false},
+		{"empty signature", "nonce.", "nonce.", false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := validCSRF(csrfRequest(tc.cookie, tc.header), testSecret, "alice"); got != tc.want {
+				t.Fatalf("validCSRF = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestAuthMiddlewareChecksCSRFOfCookieSessions(t *testing.T) {
+	h := AuthMiddleware(testConfig("cookie"), nil)(&okHandler{})
+	session := jwtFor(t, "alice")
+	aliceCSRF := csrfToken(t, "alice")
+	bobCSRF := csrfToken(t, "bob")
+
+	cookies := func(csrf string) http.Header {
+		header := http.Header{"Cookie": {"session=" + session}}
+		if csrf != "" {
+			header.Add("Cookie", CSRFCookieName+"="+csrf)
+		}
+		return header
+	}
+	withHeader := func(header http.Header, csrf string) http.Header {
+		header.Set(CSRFHeaderName, csrf)
+		return header
+	}
+
+	for _, tc := range []struct {
+		name   string
+		method string
+		header http.Header
+		want   int
+	}{
+		{"GET without token", "GET", cookies(""), http.StatusOK},
+		{"HEAD without token", "HEAD", cookies(""), http.StatusOK},
+		{"OPTIONS without token", "OPTIONS", cookies(""), http.StatusOK},
+		{"POST without token", "POST", cookies(""), http.StatusForbidden},
+		{"POST without header", "POST", cookies(aliceCSRF), http.StatusForbidden},
+		{"POST with token", "POST", withHeader(cookies(aliceCSRF), aliceCSRF), http.StatusOK},
+		{"PUT with token", "PUT", withHeader(cookies(aliceCSRF), aliceCSRF), http.StatusOK},
+		{"DELETE without token", "DELETE", cookies(""), http.StatusForbidden},
+		{"PATCH with mismatched cookie", "PATCH", withHeader(cookies(csrfToken(t, "alice")), aliceCSRF), http.StatusForbidden},
+		{"POST with token of another user", "POST", withHeader(cookies(bobCSRF), bobCSRF), http.StatusForbidden},
+		{"POST with bearer token", "POST", bearer(session), http.StatusOK},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if rec := serve(h, tc.method, "/api/files", tc.header); rec.Code != tc.want {
+				t.Fatalf("%s = %d %q, want %d", tc.method, rec.Code, rec.Body.String(), tc.want)
+			}
+		})
+	}
+}
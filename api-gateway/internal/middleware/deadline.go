@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/cloud-drive/api-gateway/internal/deadline"
+)
+
+// RouteDeadlines thay read/write timeout mặc định của server bằng timeout
+// riêng cho các request khớp rule, ví dụ upload và download file lớn. Request
+// không khớp rule nào giữ timeout của server.
+func RouteDeadlines(rules []deadline.Rule) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rule, ok := deadline.Find(rules, r.Method, r.URL.Path)
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			until := time.Now().Add(rule.Timeout)
+			rc := http.NewResponseController(w)
+			err := errors.Join(rc.SetReadDeadline(until), rc.SetWriteDeadline(until))
+			if err != nil {
+				slog.WarnContext(r.Context(), "Failed to extend request deadline", "rule", rule.String(), "error", err)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/cloud-drive/api-gateway/internal/metrics"
+	"github.com/gorilla/mux"
+)
+
+// unmatchedRoute là nhãn cho các request không khớp route nào (404/405)
+const unmatchedRoute = "unmatched"
+
+// routeTemplate trả về path template của route khớp với request, ví dụ
+// "/api/users/{id}", tên route với route không có path (ví dụ "proxy"), hoặc unmatchedRoute
+func routeTemplate(router *mux.Router, r *http.Request) string {
+	var match mux.RouteMatch
+	if router.Match(r, &match) && match.Route != nil {
+		if tpl, err := match.Route.GetPathTemplate(); err == nil {
+			return tpl
+		}
+		if name := match.Route.GetName(); name != "" {
+			return name
+		}
+	}
+	return unmatchedRoute
+}
+
+// Metrics ghi lại số request, status code và latency theo route template.
+// Route được xác định trước khi gọi handler để cả các request 404 cũng được đếm
+// mà không làm bùng nổ số nhãn.
+func Metrics(router *mux.Router, m *metrics.Metrics) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			route := routeTemplate(router, r)
+
+			m.HTTPInFlight.Inc()
+			defer m.HTTPInFlight.Dec()
+
+			start := time.Now()
+			rec := &statusRecorder{ResponseWriter: w}
+			next.ServeHTTP(rec, r)
+			if rec.status == 0 {
+				rec.status = http.StatusOK
+			}
+
+			m.HTTPDuration.WithLabelValues(route, r.Method).Observe(time.Since(start).Seconds())
+			m.HTTPRequests.WithLabelValues(route, r.Method, strconv.Itoa(rec.status)).Inc()
+		})
+	}
+}
@@ -0,0 +1,176 @@
+package middleware
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cloud-drive/api-gateway/internal/config"
+	"github.com/cloud-drive/api-gateway/internal/metrics"
+	"github.com/cloud-drive/api-gateway/internal/ratelimit"
+)
+
+// loginPath là route đăng nhập, request bị chặn ở đây được tính là lockout
+const loginPath = "/api/auth/login"
+
+// RateLimit giới hạn số request theo IP, user và route dựa trên các rule của
+// limiter. Header RateLimit-Limit/Remaining/Reset được trả về cho mọi request
+// khớp rule, kèm Retry-After khi bị từ chối (429). Nếu store lỗi thì request
+// vẫn được cho qua để không làm sập gateway. User được lấy từ JWT trong header
+// hoặc session cookie như AuthMiddleware. Personal access token chỉ được
+// xác thực ở AuthMiddleware, nên với request dùng token này các rule theo
+// user được AuthMiddleware áp dụng sau khi biết user.
+func RateLimit(limiter *ratelimit.Limiter, trustedProxies []*net.IPNet, cfg *config.Config, m *metrics.Metrics) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			caller := ratelimit.Caller{IP: ClientIP(r, trustedProxies)}
+			keys := []ratelimit.KeyBy{ratelimit.KeyIP, ratelimit.KeyUser, ratelimit.KeyRoute}
+			deferUser := false
+			if token, ok := bearerToken(r); ok && strings.HasPrefix(token, AccessTokenPrefix) {
+				keys, deferUser = []ratelimit.KeyBy{ratelimit.KeyIP, ratelimit.KeyRoute}, true
+			} else if claims := peekClaims(r, cfg); claims != nil {
+				caller.UserID = claims.UserID
+			}
+
+			decision, err := limiter.AllowKeyedBy(r.Context(), r.Method, r.URL.Path, caller, keys...)
+			if err != nil {
+				slog.ErrorContext(r.Context(), "Rate limit store failed, allowing request", "error", err)
+				next.ServeHTTP(w, r)
+				return
+			}
+			if !writeDecision(w, r, decision, caller, m) {
+				return
+			}
+
+			if deferUser {
+				limit := &userLimit{limiter: limiter, caller: caller, metrics: m, remaining: -1}
+				if decision.Matched {
+					limit.remaining = decision.Result.Remaining
+				}
+				r = r.WithContext(context.WithValue(r.Context(), userLimitKey{}, limit))
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// userLimitKey là key trong context của userLimit
+type userLimitKey struct{}
+
+// userLimit là các rule theo user RateLimit để lại cho AuthMiddleware
+type userLimit struct {
+	limiter *ratelimit.Limiter
+	caller  ratelimit.Caller
+	metrics *metrics.Metrics
+	// remaining là RateLimit-Remaining đã đặt theo các rule khác, -1 nếu
+	// không rule nào khớp
+	remaining int
+	// applied được đặt khi rule đã được áp dụng, để không tính request hai lần
+	applied bool
+}
+
+// applyUserLimit áp dụng các rule theo user RateLimit để lại cho request của
+// userID. Trả về false nếu request bị từ chối và response đã được ghi.
+func applyUserLimit(w http.ResponseWriter, r *http.Request, userID string) bool {
+	limit, ok := r.Context().Value(userLimitKey{}).(*userLimit)
+	if !ok || limit.applied {
+		return true
+	}
+	limit.applied = true
+	caller := limit.caller
+	caller.UserID = userID
+	decision, err := limit.limiter.AllowKeyedBy(r.Context(), r.Method, r.URL.Path, caller, ratelimit.KeyUser)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Rate limit store failed, allowing request", "error", err)
+		return true
+	}
+	// Header chỉ được thay khi rule theo user chặt hơn các rule đã áp dụng
+	if decision.Allowed && limit.remaining >= 0 && decision.Result.Remaining >= limit.remaining {
+		return true
+	}
+	return writeDecision(w, r, decision, caller, limit.metrics)
+}
+
+// writeDecision đặt header rate limit theo decision và trả 429 nếu request bị
+// từ chối. Trả về false khi đó.
+func writeDecision(w http.ResponseWriter, r *http.Request, decision ratelimit.Decision, caller ratelimit.Caller, m *metrics.Metrics) bool {
+	if !decision.Matched {
+		return true
+	}
+
+	res := decision.Result
+	w.Header().Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+	w.Header().Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+	w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(res.Reset)))
+
+	if !decision.Allowed {
+		m.RateLimited.WithLabelValues(decision.Rule.String()).Inc()
+		if r.URL.Path == loginPath {
+			m.LoginAttempts.WithLabelValues(metrics.OutcomeLockout).Inc()
+		}
+		slog.WarnContext(r.Context(), "Rate limit exceeded", "rule", decision.Rule.String(), "ip", caller.IP, "user_id", caller.UserID)
+
+		w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(res.RetryAfter)))
+		http.Error(w, "Too many requests", http.StatusTooManyRequests)
+		return false
+	}
+	return true
+}
+
+// ceilSeconds làm tròn lên số giây, tối thiểu 1 cho giá trị dương
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// ClientIP trả về IP của client. X-Forwarded-For chỉ được tin khi request đến
+// từ một proxy tin cậy (nginx); khi đó duyệt từ phải sang trái và lấy địa chỉ
+// đầu tiên không thuộc proxy tin cậy.
+func ClientIP(r *http.Request, trustedProxies []*net.IPNet) string {
+	remote, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		remote = r.RemoteAddr
+	}
+	if !isTrusted(remote, trustedProxies) {
+		return remote
+	}
+
+	forwarded := r.Header.Values("X-Forwarded-For")
+	hops := make([]string, 0)
+	for _, header := range forwarded {
+		for _, hop := range strings.Split(header, ",") {
+			if hop = strings.TrimSpace(hop); hop != "" {
+				hops = append(hops, hop)
+			}
+		}
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		if net.ParseIP(hops[i]) == nil {
+			// Giá trị giả mạo hoặc sai định dạng: dừng lại ở proxy cuối cùng tin cậy
+			break
+		}
+		if !isTrusted(hops[i], trustedProxies) {
+			return hops[i]
+		}
+		remote = hops[i]
+	}
+	return remote
+}
+
+// isTrusted kiểm tra ip có thuộc dải proxy tin cậy không
+func isTrusted(ip string, trustedProxies []*net.IPNet) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, n := range trustedProxies {
+		if n.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,340 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cloud-drive/api-gateway/internal/config"
+	"github.com/cloud-drive/api-gateway/internal/metrics"
+	"github.com/cloud-drive/api-gateway/internal/ratelimit"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+const testSecret = "test-jwt-secret"
+
+// frozenStore is a ratelimit.Store whose clock never moves, so buckets never
+// refill and every header value is exact. It applies the same all-or-nothing
+// rule as ratelimit.MemoryStore.
+type frozenStore struct {
+	mu sync.Mutex
+	// used is the number of tokens taken from each bucket
+	used map[string]int
+	// keys lists the buckets of every Take in order
+	keys [][]string
+	err  error
+}
+
+func newFrozenStore() *frozenStore {
+	return &frozenStore{used: make(map[string]int)}
+}
+
+func (s *frozenStore) Take(_ context.Context, buckets []ratelimit.Bucket) ([]ratelimit.Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return nil, s.err
+	}
+
+	needed := make(map[string]int)
+	keys := make([]string, 0, len(buckets))
+	for _, b := range buckets {
+		needed[b.Key]++
+		keys = append(keys, b.Key)
+	}
+	s.keys = append(s.keys, keys)
+	allowed := true
+	for _, b := range buckets {
+		if s.used[b.Key]+needed[b.Key] > b.Burst {
+			allowed = false
+		}
+	}
+	if allowed {
+		for key, n := range needed {
+			s.used[key] += n
+		}
+	}
+
+	results := make([]ratelimit.Result, len(buckets))
+	for i, b := range buckets {
+		remaining := b.Burst - s.used[b.Key]
+		res := ratelimit.Result{
+			Allowed:   allowed || remaining >= needed[b.Key],
+			Limit:     b.Burst,
+			Remaining: remaining,
+			Reset:     seconds(float64(b.Burst-remaining) / b.Rate),
+		}
+		if !res.Allowed {
+			res.RetryAfter = seconds(float64(needed[b.Key]-remaining) / b.Rate)
+		}
+		results[i] = res
+	}
+	return results, nil
+}
+
+// lastKeys returns the bucket keys of the last Take
+func (s *frozenStore) lastKeys() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.keys) == 0 {
+		return nil
+	}
+	return s.keys[len(s.keys)-1]
+}
+
+// taken returns the tokens taken from the buckets whose key contains part
+func (s *frozenStore) taken(part string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for key, used := range s.used {
+		if strings.Contains(key, part) {
+			n += used
+		}
+	}
+	return n
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(math.Round(s * float64(time.Second)))
+}
+
+// testConfig returns the settings the middleware reads
+func testConfig(sessionMode string) *config.Config {
+	return &config.Config{JWTSecret: testSecret, SessionMode: sessionMode, SessionCookie: "session"}
+}
+
+// okHandler counts the requests that reach it
+type okHandler struct {
+	mu    sync.Mutex
+	calls int
+}
+
+func (h *okHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mu.Lock()
+	h.calls++
+	h.mu.Unlock()
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *okHandler) count() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.calls
+}
+
+// newRateLimited returns next behind RateLimit with the rules in specs
+func newRateLimited(t *testing.T, store ratelimit.Store, cfg *config.Config, next http.Handler, specs ...string) (http.Handler, *metrics.Metrics) {
+	t.Helper()
+	rules, err := ratelimit.ParseRules(specs)
+	if err != nil {
+		t.Fatalf("ParseRules: %v", err)
+	}
+	m := metrics.New(prometheus.NewRegistry())
+	trusted, err := ratelimit.ParseCIDRs([]string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatalf("ParseCIDRs: %v", err)
+	}
+	return RateLimit(ratelimit.NewLimiter(store, rules), trusted, cfg, m)(next), m
+}
+
+// serve sends a request from remote through h
+func serve(h http.Handler, method, path string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	req.RemoteAddr = "203.0.113.7:40000"
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func bearer(token string) http.Header {
+	return http.Header{"Authorization": {"Bearer " + token}}
+}
+
+// jwtFor returns a valid session JWT of userID
+func jwtFor(t *testing.T, userID string) string {
+	t.Helper()
+	token, err := GenerateToken(userID, "user", testSecret, time.Hour)
+	if err != nil {
+		t.Fatalf("GenerateToken: %v", err)
+	}
+	return token
+}
+
+// counterValue returns the value of a counter
+func counterValue(t *testing.T, c prometheus.Counter) float64 {
+	t.Helper()
+	var m dto.Metric
+	if err := c.Write(&m); err != nil {
+		t.Fatalf("read counter: %v", err)
+	}
+	return m.GetCounter().GetValue()
+}
+
+// assertHeaders checks headers of a response; an empty value means none
+func assertHeaders(t *testing.T, rec *httptest.ResponseRecorder, want map[string]string) {
+	t.Helper()
+	for name, value := range want {
+		if got := rec.Header().Get(name); got != value {
+			t.Errorf("%s = %q, want %q", name, got, value)
+		}
+	}
+}
+
+func TestRateLimitHeaders(t *testing.T) {
+	next := &okHandler{}
+	h, m := newRateLimited(t, newFrozenStore(), testConfig("token"), next, "* /api ip 2/m 2")
+
+	rec := serve(h, "GET", "/api/files", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("first request = %d, want 200", rec.Code)
+	}
+	// One token used at one per 30s
+	assertHeaders(t, rec, map[string]string{"RateLimit-Limit": "2", "RateLimit-Remaining": "1", "RateLimit-Reset": "30", "Retry-After": ""})
+
+	rec = serve(h, "GET", "/api/files", nil)
+	assertHeaders(t, rec, map[string]string{"RateLimit-Limit": "2", "RateLimit-Remaining": "0", "RateLimit-Reset": "60", "Retry-After": ""})
+
+	rec = serve(h, "GET", "/api/files", nil)
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("request over the limit = %d, want 429", rec.Code)
+	}
+	assertHeaders(t, rec, map[string]string{"RateLimit-Limit": "2", "RateLimit-Remaining": "0", "RateLimit-Reset": "60", "Retry-After": "30"})
+	if next.count() != 2 {
+		t.Errorf("%d requests reached the handler, want 2", next.count())
+	}
+	if got := counterValue(t, m.RateLimited.WithLabelValues("* /api ip 2/m 2")); got != 1 {
+		t.Errorf("rate limited counter = %v, want 1", got)
+	}
+}
+
+func TestRateLimitHeadersOfMostRestrictiveRule(t *testing.T) {
+	h, _ := newRateLimited(t, newFrozenStore(), testConfig("token"), &okHandler{}, "* /api ip 10/m 10", "* /api/files ip 3/m 3")
+
+	rec := serve(h, "GET", "/api/files", nil)
+	assertHeaders(t, rec, map[string]string{"RateLimit-Limit": "3", "RateLimit-Remaining": "2"})
+	rec = serve(h, "GET", "/api/folders", nil)
+	assertHeaders(t, rec, map[string]string{"RateLimit-Limit": "10", "RateLimit-Remaining": "8"})
+}
+
+func TestRateLimitCountsLoginLockouts(t *testing.T) {
+	h, m := newRateLimited(t, newFrozenStore(), testConfig("token"), &okHandler{}, "POST /api/auth/login ip 1/m 1")
+
+	for i := 0; i < 3; i++ {
+		serve(h, "POST", loginPath, nil)
+	}
+	if got := counterValue(t, m.LoginAttempts.WithLabelValues(metrics.OutcomeLockout)); got != 2 {
+		t.Errorf("login lockouts = %v, want 2", got)
+	}
+}
+
+func TestRateLimitWithoutMatchingRule(t *testing.T) {
+	next := &okHandler{}
+	h, _ := newRateLimited(t, newFrozenStore(), testConfig("token"), next, "* /api ip 1/m 1")
+
+	for i := 0; i < 3; i++ {
+		rec := serve(h, "GET", "/health", nil)
+		if rec.Code != http.StatusOK || rec.Header().Get("RateLimit-Limit") != "" {
+			t.Fatalf("request without a rule = %d with limit %q, want 200 without headers", rec.Code, rec.Header().Get("RateLimit-Limit"))
+		}
+	}
+}
+
+func TestRateLimitStoreFailureAllowsRequest(t *testing.T) {
+	store := newFrozenStore()
+	store.err = errors.New("store unavailable")
+	next := &okHandler{}
+	h, _ := newRateLimited(t, store, testConfig("token"), next, "* /api ip 1/m 1")
+
+	for i := 0; i < 3; i++ {
+		if rec := serve(h, "GET", "/api/files", nil); rec.Code != http.StatusOK {
+			t.Fatalf("request with a failing store = %d, want 200", rec.Code)
+		}
+	}
+}
+
+func TestRateLimitUserKey(t *testing.T) {
+	token := jwtFor(t, "user-1")
+	session := http.Header{"Cookie": {"session=" + token}}
+	for _, tc := range []struct {
+		name        string
+		sessionMode string
+		header      http.Header
+		want        string
+	}{
+		{"bearer JWT", "token", bearer(token), "|user:user-1"},
+		{"invalid JWT", "token", bearer(token + "x"), "|ip:203.0.113.7"},
+		{"no credentials", "token", nil, "|ip:203.0.113.7"},
+		{"session cookie", "cookie", session, "|user:user-1"},
+		{"session cookie in token mode", "token", session, "|ip:203.0.113.7"},
+		{"header before session cookie", "cookie", http.Header{"Cookie": {"session=" + jwtFor(t, "user-2")}, "Authorization": {"Bearer " + token}}, "|user:user-1"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			store := newFrozenStore()
+			h, _ := newRateLimited(t, store, testConfig(tc.sessionMode), &okHandler{}, "* /api user 5/m 5")
+
+			serve(h, "GET", "/api/files", tc.header)
+			if keys := store.lastKeys(); len(keys) != 1 || !strings.HasSuffix(keys[0], tc.want) {
+				t.Fatalf("bucket keys = %v, want one ending in %q", keys, tc.want)
+			}
+		})
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	trusted, err := ratelimit.ParseCIDRs([]string{"10.0.0.0/8", "127.0.0.1"})
+	if err != nil {
+		t.Fatalf("ParseCIDRs: %v", err)
+	}
+	for _, tc := range []struct {
+		name      string
+		remote    string
+		forwarded []string
+		want      string
+	}{
+		{"no proxy", "203.0.113.7:40000", nil, "203.0.113.7"},
+		{"untrusted remote ignores the header", "203.0.113.7:40000", []string{"198.51.100.1"}, "203.0.113.7"},
+		{"trusted remote without header", "10.0.0.1:40000", nil, "10.0.0.1"},
+		{"one proxy", "10.0.0.1:40000", []string{"198.51.100.1"}, "198.51.100.1"},
+		{"proxy chain", "10.0.0.1:40000", []string{"198.51.100.1, 10.0.0.2"}, "198.51.100.1"},
+		{"spoofed hop left of the client", "10.0.0.1:40000", []string{"6.6.6.6, 198.51.100.1, 10.0.0.2"}, "198.51.100.1"},
+		{"malformed hop stops at the last trusted proxy", "10.0.0.1:40000", []string{"198.51.100.1, not-an-ip, 10.0.0.2"}, "10.0.0.2"},
+		{"malformed last hop", "10.0.0.1:40000", []string{"198.51.100.1, 1.2.3.4:80"}, "10.0.0.1"},
+		{"all trusted", "10.0.0.1:40000", []string{"10.0.0.3, 10.0.0.2"}, "10.0.0.3"},
+		{"several headers", "127.0.0.1:40000", []string{"6.6.6.6", "198.51.100.1", "10.0.0.2"}, "198.51.100.1"},
+		{"empty hops", "10.0.0.1:40000", []string{" , 198.51.100.1 ,, "}, "198.51.100.1"},
+		{"remote without port", "203.0.113.7", nil, "203.0.113.7"},
+		{"IPv6 remote", "[2001:db8::1]:443", []string{"198.51.100.1"}, "2001:db8::1"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/api/files", nil)
+			req.RemoteAddr = tc.remote
+			for _, value := range tc.forwarded {
+				req.Header.Add("X-Forwarded-For", value)
+			}
+			if got := ClientIP(req, trusted); got != tc.want {
+				t.Fatalf("ClientIP = %s, want %s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestClientIPWithoutTrustedProxies(t *testing.T) {
+	req := httptest.NewRequest("GET", "/api/files", nil)
+	req.RemoteAddr = "10.0.0.1:40000"
+	req.Header.Set("X-Forwarded-For", "198.51.100.1")
+	if got := ClientIP(req, []*net.IPNet{}); got != "10.0.0.1" {
+		t.Fatalf("ClientIP = %s, want the remote address", got)
+	}
+}
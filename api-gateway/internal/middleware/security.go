@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// DefaultContentSecurityPolicy chặn mọi tài nguyên; gateway chủ yếu trả JSON.
+// Handler trả về HTML có thể đặt lại header Content-Security-Policy trước khi ghi.
+const DefaultContentSecurityPolicy = "default-src 'none'; frame-ancestors 'none'; base-uri 'none'"
+
+// SecurityHeaders thêm các header bảo mật chuẩn cho mọi response. HSTS chỉ
+// được gửi khi request đi qua HTTPS (trực tiếp hoặc qua proxy tin cậy báo
+// X-Forwarded-Proto: https) và hstsMaxAge > 0.
+func SecurityHeaders(hstsMaxAge time.Duration, trustedProxies []*net.IPNet) func(next http.Handler) http.Handler {
+	hsts := "max-age=" + strconv.Itoa(int(hstsMaxAge/time.Second)) + "; includeSubDomains"
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			h := w.Header()
+			h.Set("X-Content-Type-Options", "nosniff")
+			h.Set("X-Frame-Options", "DENY")
+			h.Set("Referrer-Policy", "no-referrer")
+			h.Set("Cross-Origin-Opener-Policy", "same-origin")
+			h.Set("Content-Security-Policy", DefaultContentSecurityPolicy)
+			if hstsMaxAge > 0 && isHTTPS(r, trustedProxies) {
+				h.Set("Strict-Transport-Security", hsts)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// isHTTPS cho biết request gốc của client có dùng TLS không
+func isHTTPS(r *http.Request, trustedProxies []*net.IPNet) bool {
+	if r.TLS != nil {
+		return true
+	}
+	remote, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		remote = r.RemoteAddr
+	}
+	return isTrusted(remote, trustedProxies) && r.Header.Get("X-Forwarded-Proto") == "https"
+}
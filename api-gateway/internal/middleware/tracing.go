@@ -0,0 +1,21 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+// Tracing tạo server span cho mỗi request, tiếp nối trace từ header
+// traceparent (W3C) nếu client hoặc nginx gửi lên. Span được đặt tên theo
+// route template để không tạo ra quá nhiều tên span khác nhau.
+func Tracing(router *mux.Router) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return otelhttp.NewHandler(next, "api-gateway",
+			otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+				return r.Method + " " + routeTemplate(router, r)
+			}),
+		)
+	}
+}
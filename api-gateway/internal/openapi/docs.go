@@ -0,0 +1,50 @@
+package openapi
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"html/template"
+	"net/http"
+)
+
+// swaggerUIBase is the pinned Swagger UI distribution loaded by the docs page
+const swaggerUIBase = "https://unpkg.com/swagger-ui-dist@5.17.14"
+
+var docsPage = template.Must(template.New("docs").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <title>Cloud Drive API</title>
+  <link rel="stylesheet" href="{{.Base}}/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="{{.Base}}/swagger-ui-bundle.js"></script>
+  <script nonce="{{.Nonce}}">
+    window.ui = SwaggerUIBundle({ url: "{{.SpecURL}}", dom_id: "#swagger-ui" });
+  </script>
+</body>
+</html>
+`))
+
+// DocsHandler serves a Swagger UI page for the spec at specURL. The page
+// replaces the default API Content-Security-Policy with one that allows the
+// Swagger UI assets and a per-request nonce for the inline init script.
+func DocsHandler(specURL string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b := make([]byte, 16)
+		if _, err := rand.Read(b); err != nil {
+			http.Error(w, "Failed to render docs", http.StatusInternalServerError)
+			return
+		}
+		nonce := base64.RawURLEncoding.EncodeToString(b)
+
+		w.Header().Set("Content-Security-Policy", "default-src 'none'; "+
+			"script-src "+swaggerUIBase+"/ 'nonce-"+nonce+"'; "+
+			"style-src "+swaggerUIBase+"/ 'unsafe-inline'; "+
+			"img-src 'self' data:; connect-src 'self'; "+
+			"frame-ancestors 'none'; base-uri 'none'")
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		docsPage.Execute(w, struct{ Base, Nonce, SpecURL string }{swaggerUIBase, nonce, specURL})
+	})
+}
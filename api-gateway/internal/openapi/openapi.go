@@ -0,0 +1,190 @@
+// Package openapi embeds the gateway's OpenAPI contract, serves it with a
+// docs page and validates incoming requests against it.
+package openapi
+
+//go:generate go run github.com/oapi-codegen/oapi-codegen/v2/cmd/oapi-codegen@v2.5.0 -config oapi-codegen.yaml openapi.yaml
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+	"github.com/gorilla/mux"
+)
+
+//go:embed openapi.yaml
+var specYAML []byte
+
+// Spec is the parsed OpenAPI document of the gateway
+type Spec struct {
+	doc    *openapi3.T
+	json   []byte
+	router routers.Router
+}
+
+// Load parses and validates the embedded OpenAPI document
+func Load() (*Spec, error) {
+	loader := openapi3.NewLoader()
+	doc, err := loader.LoadFromData(specYAML)
+	if err != nil {
+		return nil, fmt.Errorf("parse openapi.yaml: %w", err)
+	}
+	if err := doc.Validate(context.Background()); err != nil {
+		return nil, fmt.Errorf("invalid openapi.yaml: %w", err)
+	}
+
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("encode openapi spec: %w", err)
+	}
+
+	// Authentication is checked by AuthMiddleware. kin-openapi reads the whole
+	// request body into memory to check security requirements, so they are
+	// dropped from the document the validator routes with.
+	doc.Security = nil
+	for _, path := range doc.Paths.Map() {
+		for _, op := range path.Operations() {
+			op.Security = nil
+		}
+	}
+
+	router, err := gorillamux.NewRouter(doc)
+	if err != nil {
+		return nil, fmt.Errorf("build openapi router: %w", err)
+	}
+
+	return &Spec{doc: doc, json: data, router: router}, nil
+}
+
+// Handler serves the spec as JSON at /openapi.json
+func (s *Spec) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(s.json)
+	})
+}
+
+// Validator rejects requests whose parameters or body do not match the spec
+// with 400. Requests to paths the spec does not describe are passed through;
+// authentication is left to AuthMiddleware. Multipart bodies are streamed by
+// their handlers and may not fit in memory, so only their parameters are
+// checked here.
+func (s *Spec) Validator() func(next http.Handler) http.Handler {
+	opts := &openapi3filter.Options{
+		AuthenticationFunc: openapi3filter.NoopAuthenticationFunc,
+		MultiError:         true,
+	}
+	streamOpts := *opts
+	streamOpts.ExcludeRequestBody = true
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			route, pathParams, err := s.router.FindRoute(r)
+			if err != nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			input := &openapi3filter.RequestValidationInput{
+				Request:    r,
+				PathParams: pathParams,
+				Route:      route,
+				Options:    opts,
+			}
+			if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/") {
+				input.Options = &streamOpts
+			}
+			err = openapi3filter.ValidateRequest(r.Context(), input)
+			if err != nil {
+				http.Error(w, "Invalid request: "+strings.Join(describe(err), "; "), http.StatusBadRequest)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// describe turns validation errors into short messages without echoing the
+// submitted values (the body may contain passwords)
+func describe(err error) []string {
+	var multi openapi3.MultiError
+	if errors.As(err, &multi) {
+		var msgs []string
+		for _, e := range multi {
+			msgs = append(msgs, describe(e)...)
+		}
+		return msgs
+	}
+
+	var schemaErr *openapi3.SchemaError
+	if errors.As(err, &schemaErr) {
+		return []string{"/" + strings.Join(schemaErr.JSONPointer(), "/") + ": " + schemaErr.Reason}
+	}
+
+	var reqErr *openapi3filter.RequestError
+	if errors.As(err, &reqErr) {
+		if reqErr.Err != nil {
+			msgs := describe(reqErr.Err)
+			if reqErr.Parameter != nil {
+				for i := range msgs {
+					msgs[i] = fmt.Sprintf("parameter %q %s", reqErr.Parameter.Name, msgs[i])
+				}
+			}
+			return msgs
+		}
+		return []string{reqErr.Reason}
+	}
+
+	return []string{err.Error()}
+}
+
+// muxVarPattern strips custom patterns from mux path variables ("{id:[0-9]+}")
+var muxVarPattern = regexp.MustCompile(`\{([^}:]+):[^}]*\}`)
+
+// MissingRoutes returns the "METHOD /path" of every route registered on the
+// router that the spec does not describe. Prefix routes without a fixed path
+// (such as reverse proxies) are not part of the contract and are skipped.
+func (s *Spec) MissingRoutes(router *mux.Router) []string {
+	var missing []string
+	router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		if route.GetHandler() == nil {
+			return nil
+		}
+		tpl, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		if re, err := route.GetPathRegexp(); err != nil || !strings.HasSuffix(re, "$") {
+			return nil
+		}
+
+		path := s.doc.Paths.Value(muxVarPattern.ReplaceAllString(tpl, "{$1}"))
+		methods, err := route.GetMethods()
+		if err != nil {
+			// Route nhận mọi method: chỉ cần path có trong spec
+			if path == nil {
+				missing = append(missing, "* "+tpl)
+			}
+			return nil
+		}
+		for _, method := range methods {
+			if path == nil || path.GetOperation(method) == nil {
+				missing = append(missing, method+" "+tpl)
+			}
+		}
+		return nil
+	})
+	sort.Strings(missing)
+	return missing
+}
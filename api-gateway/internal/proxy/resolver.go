@@ -0,0 +1,99 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	consulapi "github.com/hashicorp/consul/api"
+)
+
+// ErrNoUpstream is returned when a service has no healthy instance
+var ErrNoUpstream = errors.New("no healthy upstream")
+
+// Resolver trả về một upstream cho service
+type Resolver interface {
+	Resolve(ctx context.Context, service string) (*url.URL, error)
+}
+
+// ConsulResolver tìm instance healthy của service trong Consul. Kết quả được
+// cache trong ttl; khi Consul lỗi, danh sách cũ tiếp tục được dùng. Các
+// instance được chọn lần lượt (round-robin).
+type ConsulResolver struct {
+	client *consulapi.Client
+	ttl    time.Duration
+
+	mu    sync.Mutex
+	cache map[string]*instances
+}
+
+type instances struct {
+	urls    []*url.URL
+	fetched time.Time
+	next    atomic.Uint64
+}
+
+// NewConsulResolver tạo resolver với thời gian cache ttl
+func NewConsulResolver(client *consulapi.Client, ttl time.Duration) *ConsulResolver {
+	return &ConsulResolver{
+		client: client,
+		ttl:    ttl,
+		cache:  make(map[string]*instances),
+	}
+}
+
+// Resolve trả về URL của một instance healthy. Service đăng ký với meta
+// "scheme=https" được gọi bằng HTTPS, mặc định là HTTP.
+func (c *ConsulResolver) Resolve(ctx context.Context, service string) (*url.URL, error) {
+	list, err := c.instances(ctx, service)
+	if err != nil {
+		return nil, err
+	}
+	if len(list.urls) == 0 {
+		return nil, fmt.Errorf("%w for service %s", ErrNoUpstream, service)
+	}
+	i := list.next.Add(1) - 1
+	return list.urls[i%uint64(len(list.urls))], nil
+}
+
+func (c *ConsulResolver) instances(ctx context.Context, service string) (*instances, error) {
+	c.mu.Lock()
+	cached := c.cache[service]
+	c.mu.Unlock()
+	if cached != nil && time.Since(cached.fetched) < c.ttl {
+		return cached, nil
+	}
+
+	entries, _, err := c.client.Health().Service(service, "", true, (&consulapi.QueryOptions{}).WithContext(ctx))
+	if err != nil {
+		if cached != nil {
+			return cached, nil
+		}
+		return nil, fmt.Errorf("discover service %s: %w", service, err)
+	}
+
+	fresh := &instances{fetched: time.Now()}
+	for _, entry := range entries {
+		scheme := "http"
+		if entry.Service.Meta["scheme"] == "https" {
+			scheme = "https"
+		}
+		addr := entry.Service.Address
+		if addr == "" {
+			addr = entry.Node.Address
+		}
+		fresh.urls = append(fresh.urls, &url.URL{Scheme: scheme, Host: fmt.Sprintf("%s:%d", addr, entry.Service.Port)})
+	}
+	if cached != nil {
+		fresh.next.Store(cached.next.Load())
+	}
+
+	c.mu.Lock()
+	c.cache[service] = fresh
+	c.mu.Unlock()
+	return fresh, nil
+}
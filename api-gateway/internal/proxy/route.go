@@ -0,0 +1,186 @@
+// Package proxy holds the config-driven route table of the gateway's reverse
+// proxy and the service discovery used to resolve upstreams.
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultTimeout applies to routes without a timeout= option
+const DefaultTimeout = 30 * time.Second
+
+// Route maps a path prefix to an upstream service
+type Route struct {
+	// PathPrefix được so khớp theo từng segment: "/files" khớp "/files" và "/files/x", không khớp "/filesx"
+	PathPrefix string
+	// Service là tên service trong Consul, hoặc URL tĩnh (http://host:port)
+	Service string
+	// StripPrefix bỏ PathPrefix khỏi path trước khi chuyển tiếp
+	StripPrefix bool
+	// AuthRequired yêu cầu JWT hợp lệ; user ID và role được chuyển tiếp qua header
+	AuthRequired bool
+	Timeout      time.Duration
+	// RequestHeaders và ResponseHeaders là các header cần đặt hoặc xoá
+	RequestHeaders  []HeaderRewrite
+	ResponseHeaders []HeaderRewrite
+
+	spec string
+}
+
+// HeaderRewrite đặt hoặc xoá một header
+type HeaderRewrite struct {
+	Name  string
+	Value string
+	// Remove xoá header thay vì đặt giá trị
+	Remove bool
+}
+
+// Apply áp dụng thay đổi lên header
+func (h HeaderRewrite) Apply(header http.Header) {
+	if h.Remove {
+		header.Del(h.Name)
+		return
+	}
+	header.Set(h.Name, h.Value)
+}
+
+// Matches cho biết path có thuộc route không
+func (r Route) Matches(path string) bool {
+	if r.PathPrefix == "/" {
+		return true
+	}
+	return path == r.PathPrefix || strings.HasPrefix(path, r.PathPrefix+"/")
+}
+
+// StaticURL trả về URL của upstream khi Service là URL tĩnh
+func (r Route) StaticURL() (*url.URL, bool) {
+	u, err := url.Parse(r.Service)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, false
+	}
+	return u, true
+}
+
+// String trả về rule gốc
+func (r Route) String() string {
+	return r.spec
+}
+
+// ParseRoute parses a route in the form
+//
+//	<path-prefix> <service|http(s)://host:port> [strip] [auth] [timeout=<duration>]
+//	    [req.set:<Name>=<value>] [req.del:<Name>] [resp.set:<Name>=<value>] [resp.del:<Name>]
+//
+// for example "/files file-service-http strip auth timeout=2m req.del:Cookie".
+func ParseRoute(spec string) (Route, error) {
+	fields := strings.Fields(spec)
+	if len(fields) < 2 {
+		return Route{}, fmt.Errorf("route %q: expected \"<path-prefix> <service> [options]\"", spec)
+	}
+
+	route := Route{
+		PathPrefix: strings.TrimSuffix(fields[0], "/"),
+		Service:    fields[1],
+		Timeout:    DefaultTimeout,
+		spec:       strings.Join(fields, " "),
+	}
+	if !strings.HasPrefix(fields[0], "/") {
+		return Route{}, fmt.Errorf("route %q: path prefix must start with /", spec)
+	}
+	if route.PathPrefix == "" {
+		route.PathPrefix = "/"
+	}
+	if strings.Contains(route.Service, "://") {
+		if _, ok := route.StaticURL(); !ok {
+			return Route{}, fmt.Errorf("route %q: invalid upstream URL %q", spec, route.Service)
+		}
+	}
+
+	for _, opt := range fields[2:] {
+		key, value, hasValue := strings.Cut(opt, "=")
+		switch {
+		case opt == "strip":
+			route.StripPrefix = true
+		case opt == "auth":
+			route.AuthRequired = true
+		case key == "timeout" && hasValue:
+			d, err := time.ParseDuration(value)
+			if err != nil || d <= 0 {
+				return Route{}, fmt.Errorf("route %q: invalid timeout %q", spec, value)
+			}
+			route.Timeout = d
+		default:
+			target, rewrite, err := parseHeaderRewrite(opt)
+			if err != nil {
+				return Route{}, fmt.Errorf("route %q: %w", spec, err)
+			}
+			if target == "req" {
+				route.RequestHeaders = append(route.RequestHeaders, rewrite)
+			} else {
+				route.ResponseHeaders = append(route.ResponseHeaders, rewrite)
+			}
+		}
+	}
+	return route, nil
+}
+
+// parseHeaderRewrite parses "req.set:Name=value", "req.del:Name" and the resp.* forms
+func parseHeaderRewrite(opt string) (string, HeaderRewrite, error) {
+	action, arg, ok := strings.Cut(opt, ":")
+	if !ok || arg == "" {
+		return "", HeaderRewrite{}, fmt.Errorf("unknown option %q", opt)
+	}
+	target, op, _ := strings.Cut(action, ".")
+	if target != "req" && target != "resp" {
+		return "", HeaderRewrite{}, fmt.Errorf("unknown option %q", opt)
+	}
+
+	switch op {
+	case "set":
+		name, value, ok := strings.Cut(arg, "=")
+		if !ok || name == "" {
+			return "", HeaderRewrite{}, fmt.Errorf("option %q: expected %s.set:<Name>=<value>", opt, target)
+		}
+		return target, HeaderRewrite{Name: http.CanonicalHeaderKey(name), Value: value}, nil
+	case "del":
+		return target, HeaderRewrite{Name: http.CanonicalHeaderKey(arg), Remove: true}, nil
+	}
+	return "", HeaderRewrite{}, fmt.Errorf("unknown option %q", opt)
+}
+
+// ParseRoutes parses every route, reporting all invalid entries at once.
+// Routes are returned longest prefix first so the most specific route wins.
+func ParseRoutes(specs []string) ([]Route, error) {
+	routes := make([]Route, 0, len(specs))
+	var errs []string
+	seen := make(map[string]bool)
+	for _, spec := range specs {
+		if strings.TrimSpace(spec) == "" {
+			continue
+		}
+		route, err := ParseRoute(spec)
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		if seen[route.PathPrefix] {
+			errs = append(errs, fmt.Sprintf("route %q: duplicate path prefix %s", spec, route.PathPrefix))
+			continue
+		}
+		seen[route.PathPrefix] = true
+		routes = append(routes, route)
+	}
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+
+	sort.SliceStable(routes, func(i, j int) bool {
+		return len(routes[i].PathPrefix) > len(routes[j].PathPrefix)
+	})
+	return routes, nil
+}
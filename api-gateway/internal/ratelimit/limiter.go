@@ -0,0 +1,107 @@
+package ratelimit
+
+import (
+	"context"
+	"slices"
+	"sync/atomic"
+)
+
+// Caller identifies who is making a request
+type Caller struct {
+	IP     string
+	UserID string
+}
+
+// Decision is the combined result of every rule matching a request
+type Decision struct {
+	Allowed bool
+	// Result is from the denying rule, or the most restrictive rule when allowed
+	Result Result
+	// Rule is the rule Result belongs to
+	Rule Rule
+	// Matched is false when no rule applies to the request
+	Matched bool
+}
+
+// Limiter evaluates the configured rules against a Store. Rules can be
+// replaced at runtime with SetRules.
+type Limiter struct {
+	store Store
+	rules atomic.Pointer[[]Rule]
+}
+
+// NewLimiter creates a limiter with the initial rules
+func NewLimiter(store Store, rules []Rule) *Limiter {
+	l := &Limiter{store: store}
+	l.SetRules(rules)
+	return l
+}
+
+// SetRules atomically replaces the rules; nil disables limiting
+func (l *Limiter) SetRules(rules []Rule) {
+	l.rules.Store(&rules)
+}
+
+// Allow consumes a token from the bucket of every rule that matches the
+// request. The request is denied, and no token is consumed, if any of them
+// is empty.
+func (l *Limiter) Allow(ctx context.Context, method, path string, caller Caller) (Decision, error) {
+	return l.allow(ctx, method, path, caller, func(Rule) bool { return true })
+}
+
+// AllowKeyedBy is Allow for the rules counting requests by one of keys only,
+// so the rules of a request can be applied in steps as its caller becomes
+// known. Tokens consumed by an earlier step are kept when a later one denies
+// the request.
+func (l *Limiter) AllowKeyedBy(ctx context.Context, method, path string, caller Caller, keys ...KeyBy) (Decision, error) {
+	return l.allow(ctx, method, path, caller, func(rule Rule) bool { return slices.Contains(keys, rule.KeyBy) })
+}
+
+// allow applies the rules matching the request that include accepts
+func (l *Limiter) allow(ctx context.Context, method, path string, caller Caller, include func(Rule) bool) (Decision, error) {
+	var d Decision
+	d.Allowed = true
+
+	var rules []Rule
+	var buckets []Bucket
+	for _, rule := range *l.rules.Load() {
+		if rule.Matches(method, path) && include(rule) {
+			rules = append(rules, rule)
+			buckets = append(buckets, Bucket{Key: bucketKey(rule, caller), Rate: rule.Rate, Burst: rule.Burst})
+		}
+	}
+	if len(rules) == 0 {
+		return d, nil
+	}
+
+	// Token chỉ bị trừ khi mọi rule đều cho phép, nên request bị một rule
+	// từ chối không làm cạn bucket của các rule khác
+	results, err := l.store.Take(ctx, buckets)
+	if err != nil {
+		return d, err
+	}
+	for i, res := range results {
+		// Giữ lại kết quả của rule từ chối, hoặc rule còn ít token nhất
+		switch {
+		case !res.Allowed && d.Allowed:
+			d.Allowed, d.Result, d.Rule = false, res, rules[i]
+		case d.Allowed && (!d.Matched || res.Remaining < d.Result.Remaining):
+			d.Result, d.Rule = res, rules[i]
+		}
+		d.Matched = true
+	}
+	return d, nil
+}
+
+// bucketKey namespaces the bucket by rule and caller
+func bucketKey(rule Rule, caller Caller) string {
+	switch rule.KeyBy {
+	case KeyRoute:
+		return rule.spec
+	case KeyUser:
+		if caller.UserID != "" {
+			return rule.spec + "|user:" + caller.UserID
+		}
+	}
+	return rule.spec + "|ip:" + caller.IP
+}
@@ -0,0 +1,260 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock is a clock that only moves when advanced
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// newTestLimiter returns a limiter over a store driven by clock
+func newTestLimiter(t *testing.T, clock *fakeClock, specs ...string) *Limiter {
+	t.Helper()
+	rules, err := ParseRules(specs)
+	if err != nil {
+		t.Fatalf("ParseRules: %v", err)
+	}
+	store := newMemoryStore(time.Hour, clock.Now)
+	t.Cleanup(store.Close)
+	return NewLimiter(store, rules)
+}
+
+// allow calls Allow and fails the test on a store error
+func allow(t *testing.T, l *Limiter, method, path string, caller Caller) Decision {
+	t.Helper()
+	d, err := l.Allow(context.Background(), method, path, caller)
+	if err != nil {
+		t.Fatalf("Allow: %v", err)
+	}
+	return d
+}
+
+// assertDuration checks a duration computed in floating point up to a
+// nanosecond rounding error
+func assertDuration(t *testing.T, name string, got, want time.Duration) {
+	t.Helper()
+	if diff := got - want; diff < -time.Microsecond || diff > time.Microsecond {
+		t.Errorf("%s = %v, want %v", name, got, want)
+	}
+}
+
+var alice = Caller{IP: "203.0.113.7"}
+
+func TestDeniedRequestConsumesNoTokens(t *testing.T) {
+	l := newTestLimiter(t, newFakeClock(), "* /api ip 10/m 10", "* /api/files ip 1/m 1")
+
+	if d := allow(t, l, "GET", "/api/files", alice); !d.Allowed {
+		t.Fatal("first request denied")
+	}
+	for i := 0; i < 3; i++ {
+		d := allow(t, l, "GET", "/api/files", alice)
+		if d.Allowed {
+			t.Fatalf("request %d over the /api/files limit allowed", i+2)
+		}
+		if d.Rule.String() != "* /api/files ip 1/m 1" {
+			t.Errorf("denied by %q, want the /api/files rule", d.Rule)
+		}
+	}
+
+	// Only the allowed request and this one come out of the /api bucket
+	d := allow(t, l, "GET", "/api/folders", alice)
+	if !d.Allowed || d.Result.Remaining != 8 {
+		t.Fatalf("/api bucket after denied requests: allowed %v, %d remaining, want 8", d.Allowed, d.Result.Remaining)
+	}
+}
+
+func TestBucketListedTwiceNeedsTwoTokens(t *testing.T) {
+	l := newTestLimiter(t, newFakeClock(), "* /api ip 3/m 3", "* /api ip 3/m 3")
+
+	d := allow(t, l, "GET", "/api/files", alice)
+	if !d.Allowed || d.Result.Remaining != 1 {
+		t.Fatalf("first request: allowed %v, %d remaining, want allowed with 1", d.Allowed, d.Result.Remaining)
+	}
+	d = allow(t, l, "GET", "/api/files", alice)
+	if d.Allowed {
+		t.Fatal("request allowed with one token left for two listings of the bucket")
+	}
+	if d.Result.Remaining != 1 {
+		t.Errorf("%d tokens remaining after the denied request, want 1", d.Result.Remaining)
+	}
+	// One more token at 3/m takes 20s
+	assertDuration(t, "RetryAfter", d.Result.RetryAfter, 20*time.Second)
+}
+
+func TestRefillIsCappedAtBurst(t *testing.T) {
+	clock := newFakeClock()
+	l := newTestLimiter(t, clock, "* /api ip 60/m 5")
+
+	for i := 0; i < 5; i++ {
+		if d := allow(t, l, "GET", "/api/files", alice); !d.Allowed {
+			t.Fatalf("request %d within the burst denied", i+1)
+		}
+	}
+	if d := allow(t, l, "GET", "/api/files", alice); d.Allowed {
+		t.Fatal("request over the burst allowed")
+	}
+
+	clock.Advance(time.Hour)
+	for i := 0; i < 5; i++ {
+		d := allow(t, l, "GET", "/api/files", alice)
+		if !d.Allowed {
+			t.Fatalf("request %d after an hour idle denied", i+1)
+		}
+		if want := 4 - i; d.Result.Remaining != want {
+			t.Fatalf("request %d after an hour idle: %d remaining, want %d", i+1, d.Result.Remaining, want)
+		}
+	}
+	if d := allow(t, l, "GET", "/api/files", alice); d.Allowed {
+		t.Fatal("bucket refilled beyond its burst")
+	}
+}
+
+func TestResultTimes(t *testing.T) {
+	clock := newFakeClock()
+	l := newTestLimiter(t, clock, "* /api ip 2/m 2")
+
+	allow(t, l, "GET", "/api/files", alice)
+	d := allow(t, l, "GET", "/api/files", alice)
+	if !d.Allowed || d.Result.Limit != 2 || d.Result.Remaining != 0 {
+		t.Fatalf("second request = %+v, want allowed with limit 2 and none remaining", d.Result)
+	}
+	if d.Result.RetryAfter != 0 {
+		t.Errorf("RetryAfter of an allowed request = %v, want 0", d.Result.RetryAfter)
+	}
+	// Two tokens at one per 30s
+	assertDuration(t, "Reset", d.Result.Reset, time.Minute)
+
+	d = allow(t, l, "GET", "/api/files", alice)
+	if d.Allowed {
+		t.Fatal("request over the limit allowed")
+	}
+	assertDuration(t, "RetryAfter", d.Result.RetryAfter, 30*time.Second)
+	assertDuration(t, "Reset", d.Result.Reset, time.Minute)
+
+	clock.Advance(10 * time.Second)
+	d = allow(t, l, "GET", "/api/files", alice)
+	if d.Allowed {
+		t.Fatal("request allowed before a token was refilled")
+	}
+	assertDuration(t, "RetryAfter", d.Result.RetryAfter, 20*time.Second)
+	assertDuration(t, "Reset", d.Result.Reset, 50*time.Second)
+
+	clock.Advance(20 * time.Second)
+	if d := allow(t, l, "GET", "/api/files", alice); !d.Allowed {
+		t.Fatal("request denied after a token was refilled")
+	}
+}
+
+func TestBucketsAreKeyedByRule(t *testing.T) {
+	l := newTestLimiter(t, newFakeClock(), "* /api ip 1/m 1", "* /api/files user 1/m 1", "* /api/folders route 1/m 1")
+	bob := Caller{IP: alice.IP, UserID: "bob"}
+	carol := Caller{IP: "198.51.100.1", UserID: "carol"}
+
+	if d := allow(t, l, "GET", "/api/files", bob); !d.Allowed {
+		t.Fatal("first request of bob denied")
+	}
+	// Same IP as bob: the ip bucket is shared
+	if d := allow(t, l, "GET", "/api/files", Caller{IP: alice.IP, UserID: "dave"}); d.Allowed {
+		t.Fatal("second request from the same IP allowed")
+	}
+	// The user bucket of carol and the route bucket are still full
+	if d := allow(t, l, "GET", "/api/files", carol); !d.Allowed {
+		t.Fatal("first request of carol denied")
+	}
+	if d := allow(t, l, "GET", "/api/folders", Caller{IP: "198.51.100.2"}); !d.Allowed {
+		t.Fatal("first request to the route denied")
+	}
+	if d := allow(t, l, "GET", "/api/folders", Caller{IP: "198.51.100.3"}); d.Allowed || d.Rule.KeyBy != KeyRoute {
+		t.Fatalf("second request to the route from another IP = %+v, want denied by the route rule", d)
+	}
+}
+
+func TestAllowWithoutMatchingRule(t *testing.T) {
+	l := newTestLimiter(t, newFakeClock(), "* /api ip 1/m 1")
+
+	for i := 0; i < 3; i++ {
+		if d := allow(t, l, "GET", "/health", alice); !d.Allowed || d.Matched {
+			t.Fatalf("request without a rule = %+v, want allowed and unmatched", d)
+		}
+	}
+}
+
+func TestAllowKeyedBy(t *testing.T) {
+	l := newTestLimiter(t, newFakeClock(), "* /api ip 5/m 5", "* /api user 1/m 1")
+	bob := Caller{IP: alice.IP, UserID: "bob"}
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		d, err := l.AllowKeyedBy(ctx, "GET", "/api/files", bob, KeyIP, KeyRoute)
+		if err != nil {
+			t.Fatalf("AllowKeyedBy: %v", err)
+		}
+		if !d.Allowed || d.Rule.KeyBy != KeyIP {
+			t.Fatalf("request %d without the user rules = %+v, want allowed by the ip rule", i+1, d)
+		}
+	}
+	d, err := l.AllowKeyedBy(ctx, "GET", "/api/files", bob, KeyUser)
+	if err != nil {
+		t.Fatalf("AllowKeyedBy: %v", err)
+	}
+	if !d.Allowed || d.Rule.KeyBy != KeyUser {
+		t.Fatalf("user rules = %+v, want allowed by the user rule", d)
+	}
+	if d := allow(t, l, "GET", "/api/files", bob); d.Allowed || d.Rule.KeyBy != KeyUser {
+		t.Fatalf("all rules = %+v, want denied by the user rule", d)
+	}
+}
+
+func TestIdleBucketsAreSwept(t *testing.T) {
+	clock := newFakeClock()
+	store := newMemoryStore(10*time.Millisecond, clock.Now)
+	defer store.Close()
+	ctx := context.Background()
+
+	if _, err := store.Take(ctx, []Bucket{{Key: "idle", Rate: 1, Burst: 1}}); err != nil {
+		t.Fatalf("Take: %v", err)
+	}
+	clock.Advance(time.Minute)
+	if _, err := store.Take(ctx, []Bucket{{Key: "active", Rate: 1, Burst: 1}}); err != nil {
+		t.Fatalf("Take: %v", err)
+	}
+
+	has := func(key string) bool {
+		store.mu.Lock()
+		defer store.mu.Unlock()
+		_, ok := store.buckets[key]
+		return ok
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for has("idle") {
+		if time.Now().After(deadline) {
+			t.Fatal("idle bucket was not swept")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if !has("active") {
+		t.Fatal("bucket used within the idle TTL was swept")
+	}
+}
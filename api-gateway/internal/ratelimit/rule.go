@@ -0,0 +1,148 @@
+package ratelimit
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// KeyBy selects what a rule counts requests against
+type KeyBy string
+
+const (
+	// KeyIP gives every client IP its own bucket
+	KeyIP KeyBy = "ip"
+	// KeyUser gives every authenticated user its own bucket; anonymous
+	// requests fall back to their client IP
+	KeyUser KeyBy = "user"
+	// KeyRoute shares a single bucket between all callers of the route
+	KeyRoute KeyBy = "route"
+)
+
+// Rule is a token bucket policy for requests matching Method and PathPrefix
+type Rule struct {
+	// Method is an HTTP method or "*" for any
+	Method string
+	// PathPrefix matches the path itself and everything below it
+	PathPrefix string
+	KeyBy      KeyBy
+	// Rate is the refill rate in tokens per second
+	Rate float64
+	// Burst is the bucket capacity
+	Burst int
+	// spec is the original text, used as bucket namespace and in logs
+	spec string
+}
+
+// String returns the rule as written in the config
+func (r Rule) String() string {
+	return r.spec
+}
+
+// Matches reports whether the rule applies to a request
+func (r Rule) Matches(method, path string) bool {
+	if r.Method != "*" && !strings.EqualFold(r.Method, method) {
+		return false
+	}
+	if path == r.PathPrefix || (strings.HasSuffix(r.PathPrefix, "/") && strings.HasPrefix(path, r.PathPrefix)) {
+		return true
+	}
+	return strings.HasPrefix(path, r.PathPrefix+"/")
+}
+
+// ParseRule parses "<METHOD|*> <path-prefix> <ip|user|route> <count>/<s|m|h> [burst]",
+// for example "POST /api/auth/login ip 10/m 5". Burst defaults to count.
+func ParseRule(spec string) (Rule, error) {
+	parts := strings.Fields(spec)
+	if len(parts) != 4 && len(parts) != 5 {
+		return Rule{}, fmt.Errorf("rate limit rule %q: expected \"<method> <path> <ip|user|route> <count>/<s|m|h> [burst]\"", spec)
+	}
+
+	rule := Rule{
+		Method:     strings.ToUpper(parts[0]),
+		PathPrefix: parts[1],
+		KeyBy:      KeyBy(parts[2]),
+		spec:       strings.Join(parts, " "),
+	}
+	if !strings.HasPrefix(rule.PathPrefix, "/") {
+		return Rule{}, fmt.Errorf("rate limit rule %q: path must start with /", spec)
+	}
+	switch rule.KeyBy {
+	case KeyIP, KeyUser, KeyRoute:
+	default:
+		return Rule{}, fmt.Errorf("rate limit rule %q: unknown key %q", spec, parts[2])
+	}
+
+	countStr, unit, ok := strings.Cut(parts[3], "/")
+	count, err := strconv.Atoi(countStr)
+	if !ok || err != nil || count <= 0 {
+		return Rule{}, fmt.Errorf("rate limit rule %q: invalid rate %q", spec, parts[3])
+	}
+	var window time.Duration
+	switch unit {
+	case "s":
+		window = time.Second
+	case "m":
+		window = time.Minute
+	case "h":
+		window = time.Hour
+	default:
+		return Rule{}, fmt.Errorf("rate limit rule %q: unknown rate unit %q", spec, unit)
+	}
+	rule.Rate = float64(count) / window.Seconds()
+	rule.Burst = count
+
+	if len(parts) == 5 {
+		burst, err := strconv.Atoi(parts[4])
+		if err != nil || burst <= 0 {
+			return Rule{}, fmt.Errorf("rate limit rule %q: invalid burst %q", spec, parts[4])
+		}
+		rule.Burst = burst
+	}
+	return rule, nil
+}
+
+// ParseRules parses every rule and reports all invalid ones
+func ParseRules(specs []string) ([]Rule, error) {
+	rules := make([]Rule, 0, len(specs))
+	var errs []string
+	for _, spec := range specs {
+		rule, err := ParseRule(spec)
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		rules = append(rules, rule)
+	}
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return rules, nil
+}
+
+// ParseCIDRs parses trusted proxy ranges; plain IPs are treated as single hosts
+func ParseCIDRs(values []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(values))
+	for _, v := range values {
+		if !strings.Contains(v, "/") {
+			ip := net.ParseIP(v)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid IP %q", v)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q", v)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
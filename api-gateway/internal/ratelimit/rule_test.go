@@ -0,0 +1,82 @@
+package ratelimit
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseRule(t *testing.T) {
+	rule, err := ParseRule("post  /api/auth/login ip 10/m 5")
+	if err != nil {
+		t.Fatalf("ParseRule: %v", err)
+	}
+	if rule.Method != "POST" || rule.PathPrefix != "/api/auth/login" || rule.KeyBy != KeyIP || rule.Burst != 5 {
+		t.Errorf("ParseRule = %+v", rule)
+	}
+	if want := 10.0 / 60; rule.Rate != want {
+		t.Errorf("Rate = %v, want %v", rule.Rate, want)
+	}
+	if want := "post /api/auth/login ip 10/m 5"; rule.String() != want {
+		t.Errorf("String = %q, want %q", rule.String(), want)
+	}
+
+	rule, err = ParseRule("* /api user 20/s")
+	if err != nil {
+		t.Fatalf("ParseRule: %v", err)
+	}
+	if rule.Rate != 20 || rule.Burst != 20 {
+		t.Errorf("rule without burst = rate %v burst %d, want 20 and 20", rule.Rate, rule.Burst)
+	}
+}
+
+func TestParseRuleErrors(t *testing.T) {
+	for _, tc := range []struct {
+		spec, want string
+	}{
+		{"", "expected"},
+		{"GET /api ip", "expected"},
+		{"GET /api ip 1/s 2 3", "expected"},
+		{"GET api ip 1/s", "path must start with /"},
+		{"GET /api host 1/s", `unknown key "host"`},
+		{"GET /api ip 10", "invalid rate"},
+		{"GET /api ip x/s", "invalid rate"},
+		{"GET /api ip 0/s", "invalid rate"},
+		{"GET /api ip -1/s", "invalid rate"},
+		{"GET /api ip 1/d", `unknown rate unit "d"`},
+		{"GET /api ip 1/s 0", "invalid burst"},
+		{"GET /api ip 1/s x", "invalid burst"},
+	} {
+		_, err := ParseRule(tc.spec)
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("ParseRule(%q) = %v, want an error containing %q", tc.spec, err, tc.want)
+		}
+	}
+}
+
+func TestParseRulesReportsEveryInvalidRule(t *testing.T) {
+	_, err := ParseRules([]string{"GET /api ip 1/s", "GET /api host 1/s", "GET /api ip 1/d"})
+	if err == nil || !strings.Contains(err.Error(), "host") || !strings.Contains(err.Error(), `"d"`) {
+		t.Fatalf("ParseRules = %v, want both invalid rules reported", err)
+	}
+}
+
+func TestRuleMatches(t *testing.T) {
+	rule, err := ParseRule("GET /api/files ip 1/s")
+	if err != nil {
+		t.Fatalf("ParseRule: %v", err)
+	}
+	for _, tc := range []struct {
+		method, path string
+		want         bool
+	}{
+		{"GET", "/api/files", true},
+		{"get", "/api/files/123", true},
+		{"GET", "/api/filesystem", false},
+		{"POST", "/api/files", false},
+		{"GET", "/api", false},
+	} {
+		if got := rule.Matches(tc.method, tc.path); got != tc.want {
+			t.Errorf("Matches(%s, %s) = %v, want %v", tc.method, tc.path, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// Bucket identifies a token bucket and how it refills
+type Bucket struct {
+	Key string
+	// Rate is the refill rate in tokens per second
+	Rate float64
+	// Burst is the bucket capacity
+	Burst int
+}
+
+// Result is the state of a bucket after a Take
+type Result struct {
+	// Allowed reports whether the bucket had a token for the request
+	Allowed bool
+	// Limit is the bucket capacity
+	Limit int
+	// Remaining is the number of whole tokens left
+	Remaining int
+	// RetryAfter is how long until the next token, zero if allowed
+	RetryAfter time.Duration
+	// Reset is how long until the bucket is full again
+	Reset time.Duration
+}
+
+// Store keeps token buckets. The in-memory store limits each gateway
+// instance separately; a distributed implementation (for example Redis with
+// a Lua script doing the same refill math) makes the limits global across
+// instances.
+type Store interface {
+	// Take refills the buckets and consumes one token from each of them if
+	// every one has a token available, otherwise none. Results are in the
+	// order of buckets.
+	Take(ctx context.Context, buckets []Bucket) ([]Result, error)
+}
+
+// bucket is a single token bucket
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// MemoryStore is a process-local Store. Idle buckets are swept periodically.
+type MemoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	now     func() time.Time
+	stop    chan struct{}
+	once    sync.Once
+}
+
+// NewMemoryStore creates an in-memory store that removes buckets idle for
+// longer than idleTTL
+func NewMemoryStore(idleTTL time.Duration) *MemoryStore {
+	return newMemoryStore(idleTTL, time.Now)
+}
+
+// newMemoryStore is NewMemoryStore with the clock used for refills and sweeps
+func newMemoryStore(idleTTL time.Duration, now func() time.Time) *MemoryStore {
+	s := &MemoryStore{
+		buckets: make(map[string]*bucket),
+		now:     now,
+		stop:    make(chan struct{}),
+	}
+	go s.sweep(idleTTL)
+	return s
+}
+
+// Take implements Store
+func (s *MemoryStore) Take(_ context.Context, buckets []Bucket) ([]Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	states := make([]*bucket, len(buckets))
+	// A bucket listed more than once needs a token for each time
+	needed := make(map[*bucket]float64, len(buckets))
+	for i, spec := range buckets {
+		b, ok := s.buckets[spec.Key]
+		if !ok {
+			b = &bucket{tokens: float64(spec.Burst), last: now}
+			s.buckets[spec.Key] = b
+		}
+		refill(b, now, spec.Rate, spec.Burst)
+		states[i] = b
+		needed[b]++
+	}
+
+	allowed := true
+	for b, n := range needed {
+		if b.tokens < n {
+			allowed = false
+		}
+	}
+	if allowed {
+		for b, n := range needed {
+			b.tokens -= n
+		}
+	}
+
+	results := make([]Result, len(buckets))
+	for i, spec := range buckets {
+		b := states[i]
+		res := Result{Limit: spec.Burst, Allowed: allowed || b.tokens >= needed[b]}
+		if !res.Allowed {
+			res.RetryAfter = secondsToDuration((needed[b] - b.tokens) / spec.Rate)
+		}
+		res.Remaining = int(math.Floor(b.tokens))
+		res.Reset = secondsToDuration((float64(spec.Burst) - b.tokens) / spec.Rate)
+		results[i] = res
+	}
+	return results, nil
+}
+
+// refill adds the tokens earned since b was last refilled, up to burst
+func refill(b *bucket, now time.Time, rate float64, burst int) {
+	elapsed := now.Sub(b.last).Seconds()
+	if elapsed > 0 {
+		b.tokens = math.Min(float64(burst), b.tokens+elapsed*rate)
+		b.last = now
+	}
+}
+
+func secondsToDuration(s float64) time.Duration {
+	return time.Duration(math.Ceil(s * float64(time.Second)))
+}
+
+// sweep removes idle buckets until Close is called
+func (s *MemoryStore) sweep(idleTTL time.Duration) {
+	ticker := time.NewTicker(idleTTL)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			cutoff := s.now().Add(-idleTTL)
+			s.mu.Lock()
+			for key, b := range s.buckets {
+				if b.last.Before(cutoff) {
+					delete(s.buckets, key)
+				}
+			}
+			s.mu.Unlock()
+		}
+	}
+}
+
+// Close stops the sweeper
+func (s *MemoryStore) Close() {
+	s.once.Do(func() { close(s.stop) })
+}
@@ -0,0 +1,239 @@
+package transcoding
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/utilities"
+	"google.golang.org/genproto/googleapis/api/annotations"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+// maxBodySize giới hạn kích thước JSON body của request
+const maxBodySize = 1 << 20
+
+var (
+	unmarshalOptions = protojson.UnmarshalOptions{DiscardUnknown: true}
+	// Giữ tên field snake_case như trong proto để khớp với các API hiện có
+	marshalOptions = protojson.MarshalOptions{UseProtoNames: true}
+)
+
+// binding nối một HTTP rule với một method gRPC
+type binding struct {
+	conn         grpc.ClientConnInterface
+	fullMethod   string
+	verb         string
+	path         string
+	pathFields   []string
+	body         string
+	responseBody protoreflect.FieldDescriptor
+	input        protoreflect.MessageType
+	output       protoreflect.MessageType
+	access       Access
+	queryFilter  *utilities.DoubleArray
+}
+
+func newBinding(conn grpc.ClientConnInterface, md protoreflect.MethodDescriptor, rule *annotations.HttpRule, access Access) (*binding, error) {
+	verb, pattern := httpPattern(rule)
+	if verb == "" {
+		return nil, errors.New("unsupported http rule")
+	}
+	path, fields, err := muxTemplate(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	input, err := protoregistry.GlobalTypes.FindMessageByName(md.Input().FullName())
+	if err != nil {
+		return nil, fmt.Errorf("input type: %w", err)
+	}
+	output, err := protoregistry.GlobalTypes.FindMessageByName(md.Output().FullName())
+	if err != nil {
+		return nil, fmt.Errorf("output type: %w", err)
+	}
+
+	b := &binding{
+		conn:       conn,
+		fullMethod: "/" + string(md.Parent().FullName()) + "/" + string(md.Name()),
+		verb:       verb,
+		path:       path,
+		pathFields: fields,
+		body:       rule.GetBody(),
+		input:      input,
+		output:     output,
+		access:     access,
+	}
+
+	if b.body != "" && b.body != "*" {
+		fd := md.Input().Fields().ByName(protoreflect.Name(b.body))
+		if fd == nil || fd.Message() == nil {
+			return nil, fmt.Errorf("body field %q is not a message field", b.body)
+		}
+	}
+	if name := rule.GetResponseBody(); name != "" {
+		b.responseBody = md.Output().Fields().ByName(protoreflect.Name(name))
+		if b.responseBody == nil {
+			return nil, fmt.Errorf("response_body field %q not found", name)
+		}
+	}
+
+	// Field đã lấy từ path hoặc body không được ghi đè bằng query parameter
+	seqs := make([][]string, 0, len(fields)+1)
+	for _, f := range fields {
+		seqs = append(seqs, strings.Split(f, "."))
+	}
+	if b.body != "" && b.body != "*" {
+		seqs = append(seqs, []string{b.body})
+	}
+	b.queryFilter = utilities.NewDoubleArray(seqs)
+
+	return b, nil
+}
+
+// httpPattern trả về HTTP method và path template của rule
+func httpPattern(rule *annotations.HttpRule) (string, string) {
+	switch p := rule.GetPattern().(type) {
+	case *annotations.HttpRule_Get:
+		return http.MethodGet, p.Get
+	case *annotations.HttpRule_Post:
+		return http.MethodPost, p.Post
+	case *annotations.HttpRule_Put:
+		return http.MethodPut, p.Put
+	case *annotations.HttpRule_Patch:
+		return http.MethodPatch, p.Patch
+	case *annotations.HttpRule_Delete:
+		return http.MethodDelete, p.Delete
+	case *annotations.HttpRule_Custom:
+		return strings.ToUpper(p.Custom.GetKind()), p.Custom.GetPath()
+	}
+	return "", ""
+}
+
+// muxTemplate chuyển path template của google.api.http sang template của mux.
+// Hỗ trợ "{field}", "{field=*}" (một segment) và "{field=**}" (phần còn lại của path).
+func muxTemplate(pattern string) (string, []string, error) {
+	if !strings.HasPrefix(pattern, "/") {
+		return "", nil, fmt.Errorf("path template %q must start with /", pattern)
+	}
+
+	var fields []string
+	segments := strings.Split(pattern[1:], "/")
+	for i, seg := range segments {
+		if !strings.HasPrefix(seg, "{") {
+			if strings.ContainsAny(seg, "{}*:") {
+				return "", nil, fmt.Errorf("unsupported path template %q", pattern)
+			}
+			continue
+		}
+		if !strings.HasSuffix(seg, "}") {
+			return "", nil, fmt.Errorf("unsupported path template %q", pattern)
+		}
+
+		field, sub, _ := strings.Cut(seg[1:len(seg)-1], "=")
+		switch sub {
+		case "", "*":
+			segments[i] = "{" + field + "}"
+		case "**":
+			if i != len(segments)-1 {
+				return "", nil, fmt.Errorf("** must be the last segment in %q", pattern)
+			}
+			segments[i] = "{" + field + ":.+}"
+		default:
+			return "", nil, fmt.Errorf("unsupported path template %q", pattern)
+		}
+		fields = append(fields, field)
+	}
+	return "/" + strings.Join(segments, "/"), fields, nil
+}
+
+// ServeHTTP giải mã request, kiểm tra quyền, gọi RPC và trả kết quả dạng JSON
+func (b *binding) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	in := b.input.New().Interface()
+	if err := b.decode(r, in); err != nil {
+		http.Error(w, "Invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if !b.access.allowed(r, in) {
+		http.Error(w, "Forbidden - insufficient permissions", http.StatusForbidden)
+		return
+	}
+
+	out := b.output.New().Interface()
+	if err := b.conn.Invoke(ctx, b.fullMethod, in, out); err != nil {
+		st := status.Convert(err)
+		code := runtime.HTTPStatusFromCode(st.Code())
+		if code >= http.StatusInternalServerError {
+			slog.ErrorContext(ctx, "Transcoded RPC failed", "method", b.fullMethod, "error", err)
+		}
+		switch st.Code() {
+		case codes.Internal, codes.Unknown, codes.DataLoss:
+			http.Error(w, "Internal server error", code)
+		default:
+			http.Error(w, st.Message(), code)
+		}
+		return
+	}
+
+	var resp proto.Message = out
+	if b.responseBody != nil {
+		resp = out.ProtoReflect().Get(b.responseBody).Message().Interface()
+	}
+	data, err := marshalOptions.Marshal(resp)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to encode response", "method", b.fullMethod, "error", err)
+		http.Error(w, "Error encoding response", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+// decode điền request message từ body, path và query theo thứ tự ưu tiên của
+// grpc-gateway: path variable ghi đè body, query chỉ dùng khi không có body "*"
+func (b *binding) decode(r *http.Request, in proto.Message) error {
+	if b.body != "" {
+		data, err := io.ReadAll(http.MaxBytesReader(nil, r.Body, maxBodySize))
+		if err != nil {
+			return fmt.Errorf("read body: %w", err)
+		}
+		if len(data) > 0 {
+			target := in
+			if b.body != "*" {
+				fd := in.ProtoReflect().Descriptor().Fields().ByName(protoreflect.Name(b.body))
+				target = in.ProtoReflect().Mutable(fd).Message().Interface()
+			}
+			if err := unmarshalOptions.Unmarshal(data, target); err != nil {
+				return fmt.Errorf("decode body: %w", err)
+			}
+		}
+	}
+
+	vars := mux.Vars(r)
+	for _, field := range b.pathFields {
+		if err := runtime.PopulateFieldFromPath(in, field, vars[field]); err != nil {
+			return fmt.Errorf("path parameter %s: %w", field, err)
+		}
+	}
+
+	if b.body != "*" {
+		if err := runtime.PopulateQueryParameters(in, r.URL.Query(), b.queryFilter); err != nil {
+			return fmt.Errorf("query: %w", err)
+		}
+	}
+	return nil
+}
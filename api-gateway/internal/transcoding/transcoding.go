@@ -0,0 +1,142 @@
+// Package transcoding exposes gRPC methods annotated with google.api.http as
+// REST routes, in the style of grpc-gateway. Routes are built at startup from
+// the descriptors registered by the generated proto package, so a new RPC
+// with an HTTP annotation becomes an endpoint without a hand-written handler.
+package transcoding
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/cloud-drive/api-gateway/internal/middleware"
+	"github.com/gorilla/mux"
+	"google.golang.org/genproto/googleapis/api/annotations"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+// Access mô tả ai được gọi một RPC qua REST
+type Access struct {
+	// Public cho phép gọi không cần đăng nhập
+	Public bool
+	// Roles là các role được phép gọi; rỗng nghĩa là mọi user đã đăng nhập.
+	// Role "admin" luôn được phép.
+	Roles []string
+	// OwnerField là field của request chứa user ID; user có ID trùng được
+	// phép gọi dù không có role trong Roles
+	OwnerField string
+}
+
+// AdminOnly áp dụng cho RPC có HTTP annotation nhưng chưa có trong bảng quyền
+var AdminOnly = Access{Roles: []string{"admin"}}
+
+// Options cấu hình cho Register
+type Options struct {
+	// Conn là kết nối gRPC tới service
+	Conn grpc.ClientConnInterface
+	// Service là tên đầy đủ của service trong proto, ví dụ "user.UserService"
+	Service string
+	// Access là bảng quyền theo tên method; method không có trong bảng dùng AdminOnly
+	Access map[string]Access
+	// Auth là middleware xác thực đặt trước các route không public
+	Auth func(http.Handler) http.Handler
+}
+
+// Route mô tả một REST route đã được đăng ký
+type Route struct {
+	Method string
+	Path   string
+	RPC    string
+}
+
+// String trả về dạng "GET /api/users/{id} -> user.UserService/GetUser"
+func (r Route) String() string {
+	return r.Method + " " + r.Path + " -> " + r.RPC
+}
+
+// Register đăng ký route cho mọi method có HTTP annotation của service
+func Register(router *mux.Router, opts Options) ([]Route, error) {
+	desc, err := protoregistry.GlobalFiles.FindDescriptorByName(protoreflect.FullName(opts.Service))
+	if err != nil {
+		return nil, fmt.Errorf("find service %s: %w", opts.Service, err)
+	}
+	service, ok := desc.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a service", opts.Service)
+	}
+
+	var routes []Route
+	methods := service.Methods()
+	for i := 0; i < methods.Len(); i++ {
+		md := methods.Get(i)
+		rule, ok := proto.GetExtension(md.Options(), annotations.E_Http).(*annotations.HttpRule)
+		if !ok || rule == nil || rule.GetPattern() == nil {
+			continue
+		}
+
+		access, ok := opts.Access[string(md.Name())]
+		if !ok {
+			access = AdminOnly
+		}
+
+		for _, r := range append([]*annotations.HttpRule{rule}, rule.GetAdditionalBindings()...) {
+			b, err := newBinding(opts.Conn, md, r, access)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", md.FullName(), err)
+			}
+
+			var handler http.Handler = b
+			if !access.Public {
+				handler = opts.Auth(handler)
+			}
+			router.Handle(b.path, handler).Methods(b.verb)
+			routes = append(routes, Route{Method: b.verb, Path: b.path, RPC: opts.Service + "/" + string(md.Name())})
+		}
+	}
+	return routes, nil
+}
+
+// allowed kiểm tra quyền của user trong context với request đã được giải mã
+func (a Access) allowed(r *http.Request, in proto.Message) bool {
+	if a.Public {
+		return true
+	}
+	claims, ok := r.Context().Value("claims").(*middleware.Claims)
+	if !ok {
+		return false
+	}
+	if claims.Role == "admin" || len(a.Roles) == 0 || slices.Contains(a.Roles, claims.Role) {
+		return true
+	}
+	if a.OwnerField != "" {
+		owner, ok := fieldString(in.ProtoReflect(), a.OwnerField)
+		return ok && owner != "" && owner == claims.UserID
+	}
+	return false
+}
+
+// fieldString đọc giá trị string của field theo đường dẫn "a.b.c"
+func fieldString(msg protoreflect.Message, path string) (string, bool) {
+	names := strings.Split(path, ".")
+	for i, name := range names {
+		fd := msg.Descriptor().Fields().ByName(protoreflect.Name(name))
+		if fd == nil {
+			return "", false
+		}
+		if i == len(names)-1 {
+			if fd.Kind() != protoreflect.StringKind || fd.IsList() {
+				return "", false
+			}
+			return msg.Get(fd).String(), true
+		}
+		if fd.Message() == nil || fd.IsList() || fd.IsMap() {
+			return "", false
+		}
+		msg = msg.Get(fd).Message()
+	}
+	return "", false
+}
@@ -0,0 +1,617 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/cloud-drive/file-service/internal/config"
+	"github.com/cloud-drive/file-service/internal/directory"
+	"github.com/cloud-drive/file-service/internal/metrics"
+	"github.com/cloud-drive/file-service/internal/quota"
+	"github.com/cloud-drive/file-service/internal/repository"
+	"github.com/cloud-drive/file-service/internal/service"
+	"github.com/cloud-drive/file-service/internal/storage"
+	"github.com/cloud-drive/file-service/internal/uploads"
+	"github.com/cloud-drive/proto-definitions/file"
+	"github.com/cloud-drive/proto-definitions/user"
+	sharedconfig "github.com/cloud-drive/shared/config"
+	sharedhealth "github.com/cloud-drive/shared/health"
+	"github.com/cloud-drive/shared/identity"
+	"github.com/cloud-drive/shared/interceptor"
+	"github.com/cloud-drive/shared/logging"
+	sharedmetrics "github.com/cloud-drive/shared/metrics"
+	"github.com/cloud-drive/shared/shutdown"
+	"github.com/cloud-drive/shared/tracing"
+	consulapi "github.com/hashicorp/consul/api"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// messageOverhead is the room left above the content for the other fields of
+// an upload or download message
+const messageOverhead = 1 << 20
+
+// uploadSweepInterval is how often expired resumable uploads are deleted
+const uploadSweepInterval = 10 * time.Minute
+
+func main() {
+	// Load configuration: defaults < config file < env < flags
+	reloader, err := config.NewReloader(os.Args[1:])
+	switch {
+	case errors.Is(err, flag.ErrHelp), errors.Is(err, sharedconfig.ErrPrinted):
+		// --help và --print-config đã in xong, không khởi động service
+		return
+	case err != nil:
+		fmt.Fprintf(os.Stderr, "Invalid configuration: %v\n", err)
+		os.Exit(1)
+	}
+	cfg := reloader.Current()
+
+	// Structured logger, level có thể reload
+	logger, logLevel, err := logging.New(os.Stdout, cfg.LogFormat, cfg.LogLevel)
+	if err != nil {
+		fatal("Failed to create logger", "error", err)
+	}
+	slog.SetDefault(logger)
+
+	// OpenTelemetry tracing, tiếp nối trace từ traceparent do gateway gửi sang
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Config{
+		ServiceName:  "file-service",
+		Environment:  cfg.Environment,
+		Exporter:     cfg.TraceExporter,
+		OTLPEndpoint: cfg.TraceEndpoint,
+		OTLPInsecure: cfg.TraceInsecure,
+		SampleRatio:  cfg.TraceSampleRatio,
+	})
+	if err != nil {
+		fatal("Failed to set up tracing", "error", err)
+	}
+
+	// Log thông tin môi trường
+	slog.Info("Starting File Service", "environment", cfg.Environment, "host_mode", cfg.HostMode, "caller_auth", cfg.GRPCAuthMode, "storage_backend", cfg.StorageBackend, "storage_dir", cfg.StorageDir, "upload_dir", cfg.UploadDir, "blob_gc_grace", cfg.BlobGCGrace, "quota", cfg.QuotaEnabled)
+
+	// Xác định địa chỉ lắng nghe - Quan trọng: sử dụng 0.0.0.0 để các container khác có thể kết nối
+	listenAddr := "0.0.0.0"
+	if cfg.HostMode == "local" && cfg.Environment == "development" {
+		// Khi debug local, có thể dùng localhost hoặc 0.0.0.0
+		listenAddr = "0.0.0.0" // Vẫn dùng 0.0.0.0 để các service Docker khác kết nối được
+	}
+
+	// Set up listener
+	lis, err := net.Listen("tcp", fmt.Sprintf("%s:%d", listenAddr, cfg.Port))
+	if err != nil {
+		fatal("Failed to listen", "error", err)
+	}
+
+	// Prometheus registry: Go runtime, gRPC, repository, storage và Consul metrics
+	registry := sharedmetrics.NewRegistry()
+	serviceMetrics := metrics.New(registry)
+	grpcMetrics := sharedmetrics.NewGRPCServerMetrics(registry)
+	grpcClientMetrics := sharedmetrics.NewGRPCClientMetrics(registry)
+	consulMetrics := sharedmetrics.NewConsulMetrics(registry)
+
+	// Interceptor chain: access log, metrics, recovery, xác thực service gọi tới,
+	// phân quyền theo người dùng do gateway chuyển tiếp, giới hạn deadline và
+	// validate request. Health check không cần credentials để Consul kiểm tra được.
+	// UploadFile/DownloadFile mang cả file trong một message nên giới hạn message
+	// phải đủ cho file tới MaxMessageContent; file lớn hơn đi qua RPC streaming
+	msgLimit := int(min(cfg.MaxFileSize, service.MaxMessageContent)) + messageOverhead
+	serverOpts := []grpc.ServerOption{
+		grpc.StatsHandler(otelgrpc.NewServerHandler()),
+		grpc.MaxRecvMsgSize(msgLimit),
+		grpc.MaxSendMsgSize(msgLimit),
+	}
+	if cfg.GRPCAuthMode == interceptor.AuthMTLS {
+		creds, err := interceptor.ServerTLS(cfg.GRPCTLSCert, cfg.GRPCTLSKey, cfg.GRPCTLSClientCA)
+		if err != nil {
+			fatal("Failed to load gRPC TLS credentials", "error", err)
+		}
+		serverOpts = append(serverOpts, grpc.Creds(creds))
+	}
+	serverOpts = append(serverOpts, interceptor.Options{
+		Logger:  logger,
+		Metrics: grpcMetrics,
+		Auth: interceptor.CallerAuth{
+			Mode:    cfg.GRPCAuthMode,
+			Tokens:  cfg.CallerTokens(),
+			Allowed: cfg.GRPCCallers,
+			Public:  []string{interceptor.HealthServicePrefix},
+		},
+		Authorization: interceptor.Authorization{
+			Verifier: identity.NewVerifier(cfg.IdentitySecret),
+			Rules:    service.AuthorizationRules(),
+			Public: []string{
+				interceptor.HealthServicePrefix,
+				"/grpc.reflection.v1.ServerReflection/",
+				"/grpc.reflection.v1alpha.ServerReflection/",
+			},
+		},
+		Deadlines:  cfg.Deadlines(),
+		Validators: service.Validators(),
+	}.ServerOptions()...)
+	server := grpc.NewServer(serverOpts...)
+
+	// Create repository và nơi lưu nội dung file (local disk hoặc S3); nội dung
+	// được lưu theo SHA-256 nên các file giống nhau, kể cả của người dùng khác,
+	// dùng chung blob
+	fileRepo := repository.NewInstrumentedFileRepository(repository.NewInMemoryFileRepository(), serviceMetrics)
+	backend, err := newBlobStore(cfg)
+	if err != nil {
+		fatal("Failed to open storage", "backend", cfg.StorageBackend, "error", err)
+	}
+	blobs, err := storage.NewContentStore(context.Background(), storage.NewInstrumentedBlobStore(backend, serviceMetrics), serviceMetrics)
+	if err != nil {
+		fatal("Failed to load storage", "backend", cfg.StorageBackend, "error", err)
+	}
+
+	// Trạng thái và dữ liệu của upload có thể tiếp tục được lưu trên đĩa để
+	// không mất khi restart
+	uploadStore, err := uploads.NewStore(cfg.UploadDir)
+	if err != nil {
+		fatal("Failed to open upload directory", "dir", cfg.UploadDir, "error", err)
+	}
+
+	consulClient, err := newConsulClient(cfg)
+	if err != nil {
+		fatal("Failed to create Consul client", "error", err)
+	}
+
+	// Hạn mức lưu trữ nằm trên tài khoản người dùng ở user-service, người được
+	// chia sẻ cũng được tìm ở đó; file-service tự xác thực bằng token và/hoặc
+	// client certificate riêng
+	var userConn *grpc.ClientConn
+	var users user.UserServiceClient
+	if cfg.QuotaEnabled || cfg.SharingEnabled {
+		userConn, err = dialUserService(cfg, consulClient, grpcClientMetrics)
+		if err != nil {
+			fatal("Failed to create user service client", "error", err)
+		}
+		users = user.NewUserServiceClient(userConn)
+	}
+
+	// Mỗi tính năng chỉ dùng user-service khi được bật
+	var quotaUsers, sharingUsers user.UserServiceClient
+	if cfg.QuotaEnabled {
+		quotaUsers = users
+	}
+	if cfg.SharingEnabled {
+		sharingUsers = users
+	}
+	quotas := quota.New(quotaUsers, serviceMetrics)
+
+	// Create and register file service
+	fileService := service.NewFileService(fileRepo, blobs, uploadStore, quotas, directory.New(sharingUsers), serviceMetrics, cfg.MaxFileSize, cfg.UploadExpiry, cfg.PresignExpiry, cfg.TrashRetention)
+	file.RegisterFileServiceServer(server, fileService)
+
+	// Số tham chiếu của blob được lưu cùng blob nhưng metadata file có thể đã
+	// mất (repository in-memory), nên được tính lại từ metadata trước khi nhận
+	// request để blob không còn file nào dùng được dọn sau thời gian chờ
+	corrected, err := fileService.ReconcileBlobs(context.Background())
+	if err != nil {
+		fatal("Failed to reconcile blob references", "error", err)
+	}
+	if corrected > 0 {
+		slog.Info("Reconciled blob references", "corrected_blobs", corrected)
+	}
+
+	// Hạn mức đã giữ cho các upload tus chưa xong của lần chạy trước vẫn được
+	// tính khi đối soát dung lượng
+	restored, err := fileService.RestoreReservations(context.Background())
+	if err != nil {
+		fatal("Failed to restore upload reservations", "error", err)
+	}
+	if restored > 0 {
+		slog.Info("Restored upload reservations", "uploads", restored)
+	}
+
+	// Xoá định kỳ các upload đã hết hạn, các phiên bản cũ và mục trong thùng rác
+	// ngoài thời hạn giữ, các blob không còn file nào tham chiếu, đối soát dung
+	// lượng đã dùng với user-service
+	sweepCtx, stopSweep := context.WithCancel(context.Background())
+	defer stopSweep()
+	go sweepUploads(sweepCtx, fileService)
+	go pruneVersions(sweepCtx, fileService, cfg.VersionPrune, cfg.VersionKeep, cfg.VersionMaxAge)
+	if cfg.TrashRetention > 0 {
+		go purgeTrash(sweepCtx, fileService, cfg.TrashPurge)
+	}
+	go collectBlobs(sweepCtx, blobs, cfg.BlobGCInterval, cfg.BlobGCGrace)
+	if cfg.QuotaEnabled {
+		go reconcileQuota(sweepCtx, fileService, cfg.QuotaReconcile)
+	}
+
+	// Health checks: repository và storage quyết định trạng thái SERVING, Consul chỉ làm trạng thái degraded
+	checker := sharedhealth.NewChecker(2 * time.Second)
+	checker.Add("repository", true, fileRepo.Ping)
+	checker.Add("storage", true, blobs.Ping)
+	checker.Add("uploads", true, uploadStore.Ping)
+	checker.Add("consul", false, sharedhealth.ConsulCheck(consulClient))
+
+	// Register health service, trạng thái được cập nhật theo kết quả health check
+	healthServer := health.NewServer()
+	healthServer.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+	healthpb.RegisterHealthServer(server, healthServer)
+	healthCtx, stopHealth := context.WithCancel(context.Background())
+	defer stopHealth()
+	go checker.Watch(healthCtx, healthServer, 5*time.Second, "", "file.FileService")
+
+	// Register reflection service
+	reflection.Register(server)
+
+	// Reload các thiết lập runtime (log level) khi nhận SIGHUP hoặc Consul KV thay đổi
+	reloadCtx, stopReload := context.WithCancel(context.Background())
+	defer stopReload()
+	reloader.Subscribe(func(old, next *config.Config) {
+		if old.LogLevel != next.LogLevel {
+			if err := logging.SetLevel(logLevel, next.LogLevel); err != nil {
+				slog.Error("Failed to change log level", "error", err)
+			} else {
+				slog.Info("Log level changed", "from", old.LogLevel, "to", next.LogLevel)
+			}
+		}
+	})
+	reloader.WatchSignals(reloadCtx, syscall.SIGHUP)
+	if cfg.ConsulKey != "" {
+		watchConsulConfig(reloadCtx, cfg, reloader)
+	}
+
+	// Metrics và health endpoint trên port HTTP riêng, không đi qua gRPC
+	metricsServer := newMetricsServer(listenAddr, cfg.MetricsPort, registry, checker)
+	go func() {
+		slog.Info("Metrics server listening", "address", metricsServer.Addr)
+		if err := metricsServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			slog.Error("Metrics server failed", "error", err)
+		}
+	}()
+
+	// Register service with Consul, keep-alive dừng khi bắt đầu shutdown
+	registration := consulRegistration(cfg)
+	keepAliveCtx, stopKeepAlive := context.WithCancel(context.Background())
+	keepAliveDone := make(chan struct{})
+	go func() {
+		defer close(keepAliveDone)
+		registerWithConsul(keepAliveCtx, consulClient, registration, consulMetrics)
+	}()
+
+	// Start gRPC server
+	go func() {
+		slog.Info("File Service listening", "address", listenAddr, "port", cfg.Port)
+		if err := server.Serve(lis); err != nil {
+			fatal("Failed to serve", "error", err)
+		}
+	}()
+
+	// Thứ tự shutdown: báo not ready, rời Consul, chờ client cập nhật, drain RPC
+	// đang chạy (stream quá hạn bị huỷ), dừng dọn upload và blob, đóng repository rồi flush trace
+	stopping := shutdown.New(cfg.ShutdownDelay, cfg.ShutdownTimeout)
+	stopping.Add(shutdown.PhaseNotReady, "health", func(ctx context.Context) error {
+		checker.SetShuttingDown()
+		stopHealth()
+		healthServer.Shutdown()
+		return nil
+	})
+	stopping.Add(shutdown.PhaseDeregister, "consul", func(ctx context.Context) error {
+		stopKeepAlive()
+		select {
+		case <-keepAliveDone:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		return consulClient.Agent().ServiceDeregisterOpts(registration.ID, (&consulapi.QueryOptions{}).WithContext(ctx))
+	})
+	stopping.Add(shutdown.PhaseDrain, "grpc", shutdown.GRPCServer(server))
+	stopping.Add(shutdown.PhaseClose, "uploads", func(ctx context.Context) error {
+		stopSweep()
+		return nil
+	})
+	stopping.Add(shutdown.PhaseClose, "repository", func(ctx context.Context) error {
+		return fileRepo.Close()
+	})
+	if userConn != nil {
+		stopping.Add(shutdown.PhaseClose, "user-service", func(ctx context.Context) error {
+			return userConn.Close()
+		})
+	}
+	stopping.Add(shutdown.PhaseClose, "metrics", shutdown.HTTPServer(metricsServer))
+	stopping.Add(shutdown.PhaseFlush, "tracing", shutdownTracing)
+
+	// Wait for interrupt signal
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+	slog.Info("Shutting down File Service", "propagation_delay", cfg.ShutdownDelay, "drain_timeout", cfg.ShutdownTimeout)
+
+	if err := stopping.Run(context.Background()); err != nil {
+		slog.Warn("File Service stopped with errors", "error", err)
+		return
+	}
+	slog.Info("File Service stopped")
+}
+
+// fatal logs at error level and exits
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
+// newBlobStore opens the storage backend selected by storage.backend
+func newBlobStore(cfg *config.Config) (storage.BlobStore, error) {
+	if cfg.StorageBackend != "s3" {
+		return storage.NewLocalStore(cfg.StorageDir)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	return storage.NewS3Store(ctx, storage.S3Options{
+		Endpoint:       cfg.S3Endpoint,
+		PublicEndpoint: cfg.S3PublicEndpoint,
+		Region:         cfg.S3Region,
+		Bucket:         cfg.S3Bucket,
+		AccessKey:      cfg.S3AccessKey,
+		SecretKey:      cfg.S3SecretKey,
+		UseTLS:         cfg.S3UseTLS,
+		PartSize:       uint64(cfg.S3PartSize),
+	})
+}
+
+// collectBlobs removes blobs that have been unreferenced for longer than
+// grace, once at startup and then every interval until ctx is done
+func collectBlobs(ctx context.Context, blobs *storage.ContentStore, interval, grace time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	now := time.Now()
+	for {
+		collected, err := blobs.Collect(ctx, now.Add(-grace))
+		if err != nil && ctx.Err() == nil {
+			slog.Warn("Failed to collect unreferenced blobs", "error", err)
+		}
+		if collected.Blobs > 0 {
+			slog.Info("Collected unreferenced blobs", "count", collected.Blobs, "bytes", collected.Bytes)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case now = <-ticker.C:
+		}
+	}
+}
+
+// pruneVersions deletes the file versions outside the retention, once at
+// startup and then every interval until ctx is done
+func pruneVersions(ctx context.Context, fileService *service.FileService, interval time.Duration, keep int, maxAge time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		pruned, err := fileService.PruneVersions(ctx, keep, maxAge)
+		if err != nil && ctx.Err() == nil {
+			slog.Warn("Failed to prune file versions", "error", err)
+		}
+		if pruned > 0 {
+			slog.Info("Pruned file versions", "count", pruned)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// purgeTrash deletes the trash items past the retention for good, once at
+// startup and then every interval until ctx is done
+func purgeTrash(ctx context.Context, fileService *service.FileService, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		purged, err := fileService.PurgeTrash(ctx)
+		if err != nil && ctx.Err() == nil {
+			slog.Warn("Failed to purge trash", "error", err)
+		}
+		if purged > 0 {
+			slog.Info("Purged trash", "items", purged)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// reconcileQuota sends user-service the storage usage computed from the
+// stored files, once at startup and then every interval until ctx is done
+func reconcileQuota(ctx context.Context, fileService *service.FileService, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		corrected, err := fileService.ReconcileQuota(ctx)
+		if err != nil && ctx.Err() == nil {
+			slog.Warn("Failed to reconcile storage usage", "error", err)
+		}
+		if corrected > 0 {
+			slog.Info("Reconciled storage usage", "corrected_users", corrected)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// dialUserService connects to a healthy user-service instance registered in
+// Consul, or to user_service.address when Consul does not know one
+func dialUserService(cfg *config.Config, consulClient *consulapi.Client, clientMetrics *sharedmetrics.GRPCClientMetrics) (*grpc.ClientConn, error) {
+	target := cfg.UserServiceAddr
+	entries, _, err := consulClient.Health().Service("user-service", "", true, nil)
+	switch {
+	case err != nil:
+		slog.Warn("Failed to discover user service, using configured address", "error", err, "address", target)
+	case len(entries) == 0:
+		slog.Warn("No healthy user service in Consul, using configured address", "address", target)
+	default:
+		target = fmt.Sprintf("%s:%d", entries[0].Service.Address, entries[0].Service.Port)
+	}
+
+	opts := []grpc.DialOption{
+		grpc.WithChainUnaryInterceptor(logging.UnaryClientInterceptor(), clientMetrics.UnaryClientInterceptor()),
+		grpc.WithChainStreamInterceptor(logging.StreamClientInterceptor(), clientMetrics.StreamClientInterceptor()),
+		grpc.WithStatsHandler(otelgrpc.NewClientHandler()),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	}
+	if cfg.UserServiceToken != "" {
+		opts = append(opts, grpc.WithPerRPCCredentials(interceptor.TokenCredentials(cfg.UserServiceToken)))
+	}
+	if cfg.UserTLSCert != "" {
+		creds, err := interceptor.ClientTLS(cfg.UserTLSCert, cfg.UserTLSKey, cfg.UserTLSCA, cfg.UserTLSName)
+		if err != nil {
+			return nil, fmt.Errorf("load user service TLS credentials: %w", err)
+		}
+		opts = append(opts, grpc.WithTransportCredentials(creds))
+	}
+	return grpc.Dial(target, opts...)
+}
+
+// sweepUploads deletes expired uploads every uploadSweepInterval until ctx is done
+func sweepUploads(ctx context.Context, fileService *service.FileService) {
+	ticker := time.NewTicker(uploadSweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			deleted, err := fileService.ExpireUploads(ctx, now)
+			if err != nil {
+				slog.Warn("Failed to delete expired uploads", "error", err)
+			}
+			if deleted > 0 {
+				slog.Info("Deleted expired uploads", "count", deleted)
+			}
+		}
+	}
+}
+
+// newConsulClient creates a Consul client, using IPv4 for localhost
+func newConsulClient(cfg *config.Config) (*consulapi.Client, error) {
+	consulConfig := consulapi.DefaultConfig()
+	consulConfig.Address = strings.Replace(cfg.ConsulURL, "localhost", "127.0.0.1", 1)
+	return consulapi.NewClient(consulConfig)
+}
+
+// watchConsulConfig applies runtime overrides stored in Consul KV
+func watchConsulConfig(ctx context.Context, cfg *config.Config, reloader *sharedconfig.Reloader[config.Config]) {
+	client, err := newConsulClient(cfg)
+	if err != nil {
+		slog.Error("Failed to create Consul client for config watch", "error", err)
+		return
+	}
+
+	slog.Info("Watching Consul for configuration overrides", "key", cfg.ConsulKey)
+	sharedconfig.WatchConsulKV(ctx, client, cfg.ConsulKey, reloader)
+}
+
+// newMetricsServer serves the Prometheus registry on /metrics together with
+// the /livez, /readyz and /health/details probes
+func newMetricsServer(listenAddr string, port int, registry *prometheus.Registry, checker *sharedhealth.Checker) *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", sharedmetrics.Handler(registry))
+	mux.Handle("/livez", sharedhealth.LivezHandler())
+	mux.Handle("/readyz", checker.ReadyzHandler())
+	mux.Handle("/health/details", checker.DetailsHandler())
+
+	return &http.Server{
+		Addr:              fmt.Sprintf("%s:%d", listenAddr, port),
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+}
+
+// consulRegistration describes this instance for Consul
+func consulRegistration(cfg *config.Config) *consulapi.AgentServiceRegistration {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+
+	// Xác định địa chỉ đăng ký với Consul
+	serviceAddress := hostname
+	if cfg.HostMode == "local" {
+		// Khi chạy debug local, đăng ký với Consul bằng localhost
+		serviceAddress = "localhost"
+	}
+
+	return &consulapi.AgentServiceRegistration{
+		ID:      fmt.Sprintf("file-service-%s-%d", hostname, cfg.Port),
+		Name:    "file-service",
+		Port:    cfg.Port,
+		Address: serviceAddress,
+		Check: &consulapi.AgentServiceCheck{
+			GRPC:                           fmt.Sprintf("%s:%d", serviceAddress, cfg.Port),
+			Interval:                       "10s",
+			Timeout:                        "1s",
+			DeregisterCriticalServiceAfter: "30s",
+		},
+	}
+}
+
+// registerWithConsul registers the service with Consul and re-registers it
+// periodically until ctx is done
+func registerWithConsul(ctx context.Context, client *consulapi.Client, registration *consulapi.AgentServiceRegistration, consulMetrics *sharedmetrics.ConsulMetrics) {
+	// Initial registration
+	retryRegister(ctx, client, registration, 5, consulMetrics)
+
+	// Re-register every 30 seconds as a keep-alive mechanism
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		err := client.Agent().ServiceRegister(registration)
+		consulMetrics.Observe(err)
+		if err != nil {
+			slog.Warn("Failed to re-register with Consul", "error", err)
+		}
+	}
+}
+
+// retryRegister tries to register with Consul with retries
+func retryRegister(ctx context.Context, client *consulapi.Client, registration *consulapi.AgentServiceRegistration, retries int, consulMetrics *sharedmetrics.ConsulMetrics) {
+	for i := 0; i < retries; i++ {
+		if ctx.Err() != nil {
+			return
+		}
+		err := client.Agent().ServiceRegister(registration)
+		consulMetrics.Observe(err)
+		if err == nil {
+			slog.Info("Registered service with Consul", "id", registration.ID)
+			return
+		}
+		slog.Warn("Failed to register with Consul, retrying", "error", err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Second * 2):
+		}
+	}
+	slog.Error("Could not register with Consul", "retries", retries)
+}
@@ -0,0 +1,212 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	sharedconfig "github.com/cloud-drive/shared/config"
+	"github.com/cloud-drive/shared/interceptor"
+	"github.com/cloud-drive/shared/utils"
+)
+
+// Default secrets are only acceptable outside production
+const (
+	defaultCallerToken      = "default_internal_token"
+	defaultUserServiceToken = "default_file_service_token"
+	defaultIdentitySecret   = "default_identity_secret"
+)
+
+// Config holds the application configuration
+type Config struct {
+	Environment      string        `config:"environment" env:"APP_ENV" default:"development" validate:"oneof=development production"`
+	HostMode         string        `config:"host_mode" env:"HOST_MODE" validate:"oneof=local docker"`
+	Port             int           `config:"port" env:"PORT" flag:"port" usage:"File service gRPC port" default:"9002" validate:"min=1,max=65535"`
+	MetricsPort      int           `config:"metrics.port" env:"METRICS_PORT" flag:"metrics-port" usage:"Port for the Prometheus /metrics endpoint" default:"9102" validate:"min=1,max=65535"`
+	ConsulURL        string        `config:"consul.url" env:"CONSUL_URL" flag:"consul-url" usage:"Consul agent address" validate:"required,hostport"`
+	ConsulKey        string        `config:"consul.config_key" env:"CONSUL_CONFIG_KEY" usage:"Consul KV key with runtime overrides (empty disables the watch)"`
+	LogFormat        string        `config:"log.format" env:"LOG_FORMAT" usage:"Log output format (text, json)" default:"text" validate:"oneof=text json"`
+	LogLevel         string        `config:"log.level" env:"LOG_LEVEL" flag:"log-level" usage:"Log level (debug, info, warn, error)" default:"info" reload:"true" validate:"oneof=debug info warn error"`
+	TraceExporter    string        `config:"tracing.exporter" env:"TRACING_EXPORTER" usage:"Trace exporter (none, stdout, otlp)" default:"none" validate:"oneof=none stdout otlp"`
+	TraceEndpoint    string        `config:"tracing.otlp_endpoint" env:"TRACING_OTLP_ENDPOINT" default:"localhost:4317" validate:"hostport"`
+	TraceInsecure    bool          `config:"tracing.otlp_insecure" env:"TRACING_OTLP_INSECURE" default:"true"`
+	TraceSampleRatio float64       `config:"tracing.sample_ratio" env:"TRACING_SAMPLE_RATIO" default:"1" validate:"min=0,max=1"`
+	StorageBackend   string        `config:"storage.backend" env:"STORAGE_BACKEND" usage:"Where file content is stored (local, s3)" default:"local" validate:"oneof=local s3"`
+	StorageDir       string        `config:"storage.dir" env:"STORAGE_DIR" flag:"storage-dir" usage:"Directory holding file content with the local backend" default:"data/files" validate:"required"`
+	S3Endpoint       string        `config:"storage.s3.endpoint" env:"S3_ENDPOINT" usage:"host:port of the S3-compatible API, required with the s3 backend" validate:"hostport"`
+	S3PublicEndpoint string        `config:"storage.s3.public_endpoint" env:"S3_PUBLIC_ENDPOINT" usage:"host:port download URLs point to (defaults to the endpoint)" validate:"hostport"`
+	S3Region         string        `config:"storage.s3.region" env:"S3_REGION" default:"us-east-1"`
+	S3Bucket         string        `config:"storage.s3.bucket" env:"S3_BUCKET" usage:"Bucket holding file content, required with the s3 backend"`
+	S3AccessKey      string        `config:"storage.s3.access_key" env:"S3_ACCESS_KEY" usage:"Static access key (empty uses AWS_* variables, the AWS credentials file or the instance role)"`
+	S3SecretKey      string        `config:"storage.s3.secret_key" env:"S3_SECRET_KEY" secret:"true"`
+	S3UseTLS         bool          `config:"storage.s3.use_tls" env:"S3_USE_TLS" default:"true"`
+	S3PartSize       int64         `config:"storage.s3.part_size" env:"S3_PART_SIZE" usage:"Size of multipart upload parts in bytes; at most 10000 parts per file" default:"16777216" validate:"min=5242880,max=5368709120"`
+	PresignExpiry    time.Duration `config:"storage.presign_expiry" env:"PRESIGN_EXPIRY" usage:"How long a download URL stays valid" default:"15m" validate:"min=1m,max=168h"`
+	MaxFileSize      int64         `config:"storage.max_file_size" env:"MAX_FILE_SIZE" usage:"Largest accepted file in bytes" default:"10737418240" validate:"min=1,max=1099511627776"`
+	BlobGCInterval   time.Duration `config:"storage.gc_interval" env:"BLOB_GC_INTERVAL" usage:"How often unreferenced blobs are collected" default:"10m" validate:"min=1m,max=24h"`
+	BlobGCGrace      time.Duration `config:"storage.gc_grace" env:"BLOB_GC_GRACE" usage:"How long a blob is kept after its last reference was released" default:"1h" validate:"min=1m,max=720h"`
+	VersionKeep      int           `config:"versions.keep" env:"VERSION_RETENTION_COUNT" usage:"Earlier versions kept per file (0 keeps all)" default:"10" validate:"min=0"`
+	VersionMaxAge    time.Duration `config:"versions.max_age" env:"VERSION_RETENTION_AGE" usage:"How long an earlier version is kept after it was replaced (0 keeps it forever)" default:"720h" validate:"min=0s"`
+	VersionPrune     time.Duration `config:"versions.prune_interval" env:"VERSION_PRUNE_INTERVAL" usage:"How often versions outside the retention are deleted" default:"1h" validate:"min=1m,max=24h"`
+	TrashRetention   time.Duration `config:"trash.retention" env:"TRASH_RETENTION" usage:"How long deleted files and folders stay in the trash (0 keeps them until the trash is emptied)" default:"720h" validate:"min=0s"`
+	TrashPurge       time.Duration `config:"trash.purge_interval" env:"TRASH_PURGE_INTERVAL" usage:"How often trash items past the retention are deleted" default:"1h" validate:"min=1m,max=24h"`
+	QuotaEnabled     bool          `config:"quota.enabled" env:"QUOTA_ENABLED" usage:"Charge stored files to the storage quota of their owner in user-service" default:"true"`
+	QuotaReconcile   time.Duration `config:"quota.reconcile_interval" env:"QUOTA_RECONCILE_INTERVAL" usage:"How often user-service is sent the usage computed from the stored files" default:"1h" validate:"min=1m,max=168h"`
+	SharingEnabled   bool          `config:"sharing.enabled" env:"SHARING_ENABLED" usage:"Allow sharing files and folders with users looked up in user-service" default:"true"`
+	UserServiceAddr  string        `config:"user_service.address" env:"USER_SERVICE_ADDR" usage:"user-service address used when Consul does not know it" validate:"hostport"`
+	UserServiceToken string        `config:"user_service.token" env:"USER_SERVICE_TOKEN" usage:"Token identifying file-service to user-service (empty sends none)" default:"default_file_service_token" secret:"true"`
+	UserTLSCert      string        `config:"user_service.tls.cert_file" env:"USER_SERVICE_TLS_CERT_FILE" usage:"Client certificate for mTLS to user-service (empty uses plaintext)"`
+	UserTLSKey       string        `config:"user_service.tls.key_file" env:"USER_SERVICE_TLS_KEY_FILE"`
+	UserTLSCA        string        `config:"user_service.tls.ca_file" env:"USER_SERVICE_TLS_CA_FILE"`
+	UserTLSName      string        `config:"user_service.tls.server_name" env:"USER_SERVICE_TLS_SERVER_NAME" usage:"Name expected in the user-service certificate" default:"user-service"`
+	UploadDir        string        `config:"uploads.dir" env:"UPLOAD_DIR" usage:"Directory holding the state and data of resumable uploads" default:"data/uploads" validate:"required"`
+	UploadExpiry     time.Duration `config:"uploads.expiry" env:"UPLOAD_EXPIRY" usage:"How long a resumable upload is kept after it was created" default:"24h" validate:"min=1m,max=720h"`
+	ShutdownDelay    time.Duration `config:"shutdown.propagation_delay" env:"SHUTDOWN_PROPAGATION_DELAY" usage:"How long to keep serving after deregistering from Consul before draining" default:"5s" validate:"max=1m"`
+	ShutdownTimeout  time.Duration `config:"shutdown.drain_timeout" env:"SHUTDOWN_DRAIN_TIMEOUT" usage:"Deadline for in-flight RPCs and streams before they are cancelled" default:"20s" validate:"min=1s,max=5m"`
+	GRPCMaxDeadline  time.Duration `config:"grpc.max_deadline" env:"GRPC_MAX_DEADLINE" usage:"Longest a unary RPC may run, shorter caller deadlines are kept (0 disables)" default:"30s"`
+	GRPCMaxStream    time.Duration `config:"grpc.max_stream_deadline" env:"GRPC_MAX_STREAM_DEADLINE" usage:"Longest a streaming RPC may run (0 disables)" default:"0s"`
+	GRPCMethodLimits []string      `config:"grpc.method_deadlines" env:"GRPC_METHOD_DEADLINES" usage:"Per-method deadline caps: /package.Service/Method=<duration>"`
+	GRPCAuthMode     string        `config:"grpc.auth.mode" env:"GRPC_AUTH_MODE" usage:"How calling services are authenticated (none, token, mtls)" default:"token" validate:"oneof=none token mtls"`
+	GRPCCallerTokens []string      `config:"grpc.auth.tokens" env:"GRPC_AUTH_TOKENS" usage:"Accepted service tokens: <identity>=<token>" default:"api-gateway=default_internal_token" secret:"true"`
+	GRPCCallers      []string      `config:"grpc.auth.allowed_callers" env:"GRPC_ALLOWED_CALLERS" usage:"Service identities allowed to call (token identity or certificate common name)" default:"api-gateway"`
+	IdentitySecret   string        `config:"grpc.auth.identity_secret" env:"INTERNAL_IDENTITY_SECRET" usage:"Secret verifying the end-user identity signed by the gateway" default:"default_identity_secret" secret:"true" validate:"required"`
+	GRPCTLSCert      string        `config:"grpc.tls.cert_file" env:"GRPC_TLS_CERT_FILE"`
+	GRPCTLSKey       string        `config:"grpc.tls.key_file" env:"GRPC_TLS_KEY_FILE"`
+	GRPCTLSClientCA  string        `config:"grpc.tls.client_ca_file" env:"GRPC_TLS_CLIENT_CA_FILE" usage:"CA that signs client certificates, required for mtls"`
+}
+
+// LoadConfig loads the application configuration from defaults, the optional
+// config file, environment variables and command-line flags, in that order
+func LoadConfig(args []string) (*Config, error) {
+	return load(args, nil)
+}
+
+// NewReloader loads the initial configuration and returns a reloader that
+// re-reads the same sources on SIGHUP or when Consul overrides change
+func NewReloader(args []string) (*sharedconfig.Reloader[Config], error) {
+	return sharedconfig.NewReloader(func(overrides map[string]any) (*Config, error) {
+		return load(args, overrides)
+	})
+}
+
+func load(args []string, overrides map[string]any) (*Config, error) {
+	cfg := &Config{}
+	err := sharedconfig.Load(cfg, sharedconfig.Options{
+		Name:            "file-service",
+		Args:            args,
+		LegacyEnvPrefix: legacyEnvPrefix(),
+		Overrides:       overrides,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// ApplyDefaults fills the settings whose defaults depend on the host mode
+func (c *Config) ApplyDefaults() {
+	// Nếu HOST_MODE không được cung cấp, tự động phát hiện
+	if c.HostMode == "" {
+		c.HostMode = "local"
+		if utils.IsRunningInDocker() {
+			c.HostMode = "docker"
+		}
+	}
+
+	// Trong Docker dùng tên service, khi debug local dùng IPv4
+	if c.ConsulURL == "" {
+		c.ConsulURL = "127.0.0.1:8500"
+		if c.HostMode == "docker" {
+			c.ConsulURL = "consul:8500"
+		}
+	}
+	if c.UserServiceAddr == "" {
+		c.UserServiceAddr = "localhost:9001"
+		if c.HostMode == "docker" {
+			c.UserServiceAddr = "user-service:9001"
+		}
+	}
+}
+
+// Validate rejects the default service tokens and identity secret in
+// production, incomplete caller authentication settings and incomplete S3
+// and user-service TLS settings
+func (c *Config) Validate() error {
+	var errs sharedconfig.Errors
+	if c.Environment == "production" && c.GRPCAuthMode == interceptor.AuthNone {
+		errs = append(errs, errors.New("grpc.auth.mode: caller authentication must be enabled in production"))
+	}
+	if c.Environment == "production" && c.IdentitySecret == defaultIdentitySecret {
+		errs = append(errs, errors.New("grpc.auth.identity_secret: the default secret must not be used in production"))
+	}
+	tokens, err := interceptor.ParseCallerTokens(c.GRPCCallerTokens)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("grpc.auth.tokens: %w", err))
+	}
+	if c.GRPCAuthMode == interceptor.AuthToken && len(c.GRPCCallerTokens) == 0 {
+		errs = append(errs, errors.New("grpc.auth.tokens: at least one token is required in token mode"))
+	}
+	if _, ok := tokens[defaultCallerToken]; ok && c.Environment == "production" {
+		errs = append(errs, errors.New("grpc.auth.tokens: the default token must not be used in production"))
+	}
+	if c.GRPCAuthMode == interceptor.AuthMTLS && (c.GRPCTLSCert == "" || c.GRPCTLSKey == "" || c.GRPCTLSClientCA == "") {
+		errs = append(errs, errors.New("grpc.tls: cert_file, key_file and client_ca_file are required in mtls mode"))
+	}
+	if c.Environment == "production" && (c.QuotaEnabled || c.SharingEnabled) && c.UserServiceToken == defaultUserServiceToken {
+		errs = append(errs, errors.New("user_service.token: the default token must not be used in production"))
+	}
+	if c.UserTLSCert != "" && (c.UserTLSKey == "" || c.UserTLSCA == "") {
+		errs = append(errs, errors.New("user_service.tls: key_file and ca_file are required with cert_file"))
+	}
+	if c.StorageBackend == "s3" && (c.S3Endpoint == "" || c.S3Bucket == "") {
+		errs = append(errs, errors.New("storage.s3: endpoint and bucket are required with the s3 backend"))
+	}
+	if (c.S3AccessKey == "") != (c.S3SecretKey == "") {
+		errs = append(errs, errors.New("storage.s3: access_key and secret_key must be set together"))
+	}
+	if c.StorageBackend == "s3" && c.S3PartSize*10000 < c.MaxFileSize {
+		errs = append(errs, fmt.Errorf("storage.s3.part_size: 10000 parts of %d bytes cannot hold a file of storage.max_file_size", c.S3PartSize))
+	}
+	if _, err := interceptor.ParseMethodDeadlines(c.GRPCMethodLimits); err != nil {
+		errs = append(errs, fmt.Errorf("grpc.method_deadlines: %w", err))
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// CallerTokens returns the accepted service tokens mapped to their identity.
+// The tokens were checked by Validate.
+func (c *Config) CallerTokens() map[string]string {
+	tokens, _ := interceptor.ParseCallerTokens(c.GRPCCallerTokens)
+	return tokens
+}
+
+// defaultMethodDeadlines caps the unary methods whose work grows with the
+// size of a file, unless grpc.method_deadlines sets them: the last
+// AppendUpload of a resumable upload stores the whole file in the drive
+var defaultMethodDeadlines = map[string]time.Duration{
+	"/file.FileService/AppendUpload": time.Hour,
+}
+
+// Deadlines returns the RPC deadline caps. The method overrides were checked
+// by Validate.
+func (c *Config) Deadlines() interceptor.Deadlines {
+	methods, _ := interceptor.ParseMethodDeadlines(c.GRPCMethodLimits)
+	for method, limit := range defaultMethodDeadlines {
+		if _, ok := methods[method]; !ok {
+			methods[method] = limit
+		}
+	}
+	return interceptor.Deadlines{Unary: c.GRPCMaxDeadline, Stream: c.GRPCMaxStream, Methods: methods}
+}
+
+// legacyEnvPrefix returns the deprecated DEV_/PROD_ prefix for APP_ENV
+func legacyEnvPrefix() string {
+	if os.Getenv("APP_ENV") == "production" {
+		return "PROD_"
+	}
+	return "DEV_"
+}
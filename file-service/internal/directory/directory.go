@@ -0,0 +1,48 @@
+// Package directory looks up the users files and folders are shared with in
+// user-service
+package directory
+
+import (
+	"context"
+
+	"github.com/cloud-drive/proto-definitions/user"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Directory finds users in user-service. A Directory without a client finds
+// nobody, for running file-service on its own with sharing disabled.
+type Directory struct {
+	users user.UserServiceClient
+}
+
+// New returns a Directory using users; nil disables sharing
+func New(users user.UserServiceClient) *Directory {
+	return &Directory{users: users}
+}
+
+// Enabled reports whether users can be looked up
+func (d *Directory) Enabled() bool {
+	return d.users != nil
+}
+
+// UserByEmail returns the user with an email. It fails with NOT_FOUND when
+// there is none, with UNIMPLEMENTED when sharing is disabled and with
+// UNAVAILABLE when user-service cannot be asked.
+func (d *Directory) UserByEmail(ctx context.Context, email string) (*user.User, error) {
+	if d.users == nil {
+		return nil, status.Errorf(codes.Unimplemented, "sharing is disabled")
+	}
+	resp, err := d.users.GetUserByEmail(ctx, &user.GetUserByEmailRequest{Email: email})
+	if err == nil {
+		return resp.User, nil
+	}
+	st := status.Convert(err)
+	if st.Code() == codes.NotFound {
+		return nil, status.Errorf(codes.NotFound, "no user with email %s", email)
+	}
+	if ctx.Err() != nil {
+		return nil, status.FromContextError(ctx.Err()).Err()
+	}
+	return nil, status.Errorf(codes.Unavailable, "failed to look up user: %s", st.Message())
+}
@@ -0,0 +1,117 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Metrics holds the file-service specific Prometheus collectors
+type Metrics struct {
+	RepositoryDuration *prometheus.HistogramVec
+	RepositoryErrors   *prometheus.CounterVec
+	StorageDuration    *prometheus.HistogramVec
+	StorageErrors      *prometheus.CounterVec
+	TransferredBytes   *prometheus.CounterVec
+	StoredBlobs        prometheus.Gauge
+	StoredBytes        prometheus.Gauge
+	ReferencedBytes    prometheus.Gauge
+	DedupRatio         prometheus.Gauge
+	DedupHits          prometheus.Counter
+	CollectedBlobs     prometheus.Counter
+	CollectedBytes     prometheus.Counter
+	QuotaRejections    prometheus.Counter
+	QuotaErrors        *prometheus.CounterVec
+	VersionsCreated    prometheus.Counter
+	VersionsPruned     prometheus.Counter
+	PrunedBytes        prometheus.Counter
+	TrashPurged        prometheus.Counter
+	TrashPurgedBytes   prometheus.Counter
+}
+
+// New creates the file-service metrics and registers them on reg
+func New(reg prometheus.Registerer) *Metrics {
+	m := &Metrics{
+		RepositoryDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "file_repository_operation_seconds",
+			Help:    "Duration of file repository operations.",
+			Buckets: []float64{.0005, .001, .005, .01, .025, .05, .1, .25, .5, 1},
+		}, []string{"operation"}),
+		RepositoryErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "file_repository_errors_total",
+			Help: "File repository operations that returned an error, by operation and error.",
+		}, []string{"operation", "error"}),
+		StorageDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "file_storage_operation_seconds",
+			Help:    "Duration of blob store operations.",
+			Buckets: []float64{.001, .005, .01, .05, .1, .25, .5, 1, 2.5, 5, 10},
+		}, []string{"operation"}),
+		StorageErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "file_storage_errors_total",
+			Help: "Blob store operations that returned an error, by operation.",
+		}, []string{"operation"}),
+		TransferredBytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "file_transferred_bytes_total",
+			Help: "File content received and sent, by direction (upload, download).",
+		}, []string{"direction"}),
+		StoredBlobs: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "file_storage_blobs",
+			Help: "Blobs in the blob store, including unreferenced blobs not yet collected.",
+		}),
+		StoredBytes: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "file_storage_stored_bytes",
+			Help: "Bytes in the blob store, each blob counted once.",
+		}),
+		ReferencedBytes: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "file_storage_referenced_bytes",
+			Help: "Bytes of file content, each blob counted once per file referring to it.",
+		}),
+		DedupRatio: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "file_storage_dedup_ratio",
+			Help: "Referenced bytes per stored byte.",
+		}),
+		DedupHits: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "file_storage_dedup_hits_total",
+			Help: "Stored content that was already in the blob store and only gained a reference.",
+		}),
+		CollectedBlobs: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "file_storage_collected_blobs_total",
+			Help: "Unreferenced blobs removed by the garbage collector.",
+		}),
+		CollectedBytes: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "file_storage_collected_bytes_total",
+			Help: "Bytes of unreferenced blobs removed by the garbage collector.",
+		}),
+		QuotaRejections: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "file_quota_rejections_total",
+			Help: "Files not stored because they would exceed the storage quota of their owner.",
+		}),
+		QuotaErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "file_quota_errors_total",
+			Help: "Calls to the user-service quota that failed, by operation (reserve, release, reconcile).",
+		}, []string{"operation"}),
+		VersionsCreated: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "file_versions_created_total",
+			Help: "File versions added by overwrites and restores.",
+		}),
+		VersionsPruned: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "file_versions_pruned_total",
+			Help: "Earlier file versions deleted by the retention.",
+		}),
+		PrunedBytes: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "file_versions_pruned_bytes_total",
+			Help: "Bytes of earlier file versions deleted by the retention.",
+		}),
+		TrashPurged: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "file_trash_purged_items_total",
+			Help: "Trashed files and folders deleted for good by the retention.",
+		}),
+		TrashPurgedBytes: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "file_trash_purged_bytes_total",
+			Help: "Bytes of trashed files deleted for good by the retention.",
+		}),
+	}
+	reg.MustRegister(m.RepositoryDuration, m.RepositoryErrors, m.StorageDuration, m.StorageErrors, m.TransferredBytes,
+		m.StoredBlobs, m.StoredBytes, m.ReferencedBytes, m.DedupRatio, m.DedupHits, m.CollectedBlobs, m.CollectedBytes,
+		m.QuotaRejections, m.QuotaErrors, m.VersionsCreated, m.VersionsPruned, m.PrunedBytes,
+		m.TrashPurged, m.TrashPurgedBytes)
+	return m
+}
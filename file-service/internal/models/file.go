@@ -0,0 +1,69 @@
+package models
+
+import (
+	"path"
+	"time"
+)
+
+// File represents a file stored in a user's drive
+type File struct {
+	ID          string    `json:"id"`
+	OwnerID     string    `json:"owner_id"`
+	FolderID    string    `json:"folder_id"` // RootFolderID for the root
+	Name        string    `json:"name"`
+	Folder      string    `json:"folder"` // materialized path of the folder, "/" for the root
+	Size        int64     `json:"size"`
+	ContentType string    `json:"content_type"`
+	Checksum    string    `json:"checksum"` // SHA-256 of the content, hex encoded
+	BlobKey     string    `json:"-"`        // key of the content in the blob store, equal to Checksum
+	Version     int       `json:"version"`  // number of the current version, counting from 1
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+
+	// Versions holds every version of a file removed from the repository,
+	// the current one included, so their content can be released with it
+	Versions []*FileVersion `json:"-"`
+}
+
+// FileVersion is one content of a file. The content fields of a file always
+// equal those of its latest version; versions never change once stored.
+type FileVersion struct {
+	FileID      string    `json:"file_id"`
+	OwnerID     string    `json:"owner_id"`
+	Version     int       `json:"version"`
+	Size        int64     `json:"size"`
+	ContentType string    `json:"content_type"`
+	Checksum    string    `json:"checksum"`
+	BlobKey     string    `json:"-"`
+	CreatedAt   time.Time `json:"created_at"`
+	ReplacedAt  time.Time `json:"replaced_at"` // zero while the version is current
+}
+
+// Path returns the absolute path of the file
+func (f *File) Path() string {
+	return path.Join(f.Folder, f.Name)
+}
+
+// CurrentVersion returns the current content of the file as a version
+// created at at
+func (f *File) CurrentVersion(at time.Time) *FileVersion {
+	return &FileVersion{
+		FileID:      f.ID,
+		OwnerID:     f.OwnerID,
+		Version:     f.Version,
+		Size:        f.Size,
+		ContentType: f.ContentType,
+		Checksum:    f.Checksum,
+		BlobKey:     f.BlobKey,
+		CreatedAt:   at,
+	}
+}
+
+// SetContent makes v the content of the file
+func (f *File) SetContent(v *FileVersion) {
+	f.Version = v.Version
+	f.Size = v.Size
+	f.ContentType = v.ContentType
+	f.Checksum = v.Checksum
+	f.BlobKey = v.BlobKey
+}
@@ -0,0 +1,55 @@
+package models
+
+import (
+	"path"
+	"strings"
+	"time"
+)
+
+// RootFolderID identifies the root folder of every user. The root is not
+// stored; entries directly under it have it as their parent.
+const RootFolderID = "root"
+
+// Folder represents a folder in a user's drive
+type Folder struct {
+	ID        string    `json:"id"`
+	OwnerID   string    `json:"owner_id"`
+	ParentID  string    `json:"parent_id"`
+	Name      string    `json:"name"`
+	Path      string    `json:"path"` // materialized absolute path, kept up to date on moves
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// RootFolder returns the root folder of an owner
+func RootFolder(ownerID string) *Folder {
+	return &Folder{ID: RootFolderID, OwnerID: ownerID, Path: "/"}
+}
+
+// IsRoot reports whether the folder is a root folder
+func (f *Folder) IsRoot() bool {
+	return f.ID == RootFolderID
+}
+
+// Contains reports whether p is the folder itself or lies below it
+func (f *Folder) Contains(p string) bool {
+	return p == f.Path || f.IsRoot() || strings.HasPrefix(p, f.Path+"/")
+}
+
+// ChildPath returns the path of an entry named name in the folder
+func (f *Folder) ChildPath(name string) string {
+	return path.Join(f.Path, name)
+}
+
+// ConflictPolicy decides what happens when an entry is placed in a folder
+// that already has an entry with the same name
+type ConflictPolicy string
+
+const (
+	// ConflictFail rejects the operation
+	ConflictFail ConflictPolicy = "fail"
+	// ConflictRename picks a free name such as "report (1).pdf"
+	ConflictRename ConflictPolicy = "rename"
+	// ConflictOverwrite replaces an existing entry of the same kind
+	ConflictOverwrite ConflictPolicy = "overwrite"
+)
@@ -0,0 +1,59 @@
+package models
+
+import "time"
+
+// Role is the access a user has to a file or folder
+type Role string
+
+const (
+	// RoleViewer reads entries and their content
+	RoleViewer Role = "viewer"
+	// RoleCommenter reads entries like a viewer; comments are not stored yet,
+	// so it grants nothing more for now
+	RoleCommenter Role = "commenter"
+	// RoleEditor also changes, deletes and adds entries
+	RoleEditor Role = "editor"
+	// RoleOwner is the role of the owner of an entry and cannot be shared;
+	// only owners manage shares
+	RoleOwner Role = "owner"
+)
+
+// roleRanks orders the roles, each including the access of the ones below
+var roleRanks = map[Role]int{
+	RoleViewer:    1,
+	RoleCommenter: 2,
+	RoleEditor:    3,
+	RoleOwner:     4,
+}
+
+// Includes reports whether r grants the access of required
+func (r Role) Includes(required Role) bool {
+	return roleRanks[r] > 0 && roleRanks[r] >= roleRanks[required]
+}
+
+// Shareable reports whether r can be given to another user
+func (r Role) Shareable() bool {
+	return r == RoleViewer || r == RoleCommenter || r == RoleEditor
+}
+
+// Share gives a user a role on a file or folder of another user. A share on
+// a folder applies to everything below it.
+type Share struct {
+	ID        string    `json:"id"`
+	OwnerID   string    `json:"owner_id"`
+	EntryID   string    `json:"entry_id"` // ID of the shared file or folder
+	IsFolder  bool      `json:"is_folder"`
+	UserID    string    `json:"user_id"`
+	Email     string    `json:"email"` // email of the user when the entry was shared
+	Role      Role      `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// SharedItem is a shared entry with the share that gives access to it;
+// exactly one of Folder and File is set
+type SharedItem struct {
+	Share  *Share
+	Folder *Folder
+	File   *File
+}
@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+// TrashItem is a file or folder deleted by its owner. It keeps the entry with
+// everything that was below it, versions included, until it is restored or
+// deleted for good.
+type TrashItem struct {
+	ID        string    `json:"id"` // ID of the deleted file or folder
+	OwnerID   string    `json:"owner_id"`
+	Name      string    `json:"name"`
+	IsFolder  bool      `json:"is_folder"`
+	ParentID  string    `json:"parent_id"` // folder the entry was deleted from
+	Path      string    `json:"path"`      // absolute path of the entry when it was deleted
+	Size      int64     `json:"size"`      // size of all versions of the files in the entry
+	DeletedAt time.Time `json:"deleted_at"`
+
+	// Folders holds a deleted folder and the folders below it, parents first
+	Folders []*Folder `json:"-"`
+	// Files holds the deleted files with their Versions set
+	Files []*File `json:"-"`
+}
+
+// Versions returns every version of the files in the item
+func (t *TrashItem) Versions() []*FileVersion {
+	var versions []*FileVersion
+	for _, f := range t.Files {
+		versions = append(versions, f.Versions...)
+	}
+	return versions
+}
@@ -0,0 +1,87 @@
+// Package quota charges the bytes of stored files to the storage quota of
+// their owner, which user-service keeps on the user account. Every file
+// counts with its full size, also when its content is shared with other
+// files.
+package quota
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/cloud-drive/file-service/internal/metrics"
+	"github.com/cloud-drive/proto-definitions/user"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Quota reserves and releases storage in user-service. A Quota without a
+// client accepts everything, for running file-service on its own.
+type Quota struct {
+	users   user.UserServiceClient
+	metrics *metrics.Metrics
+}
+
+// New returns a Quota using users; nil disables quota enforcement
+func New(users user.UserServiceClient, m *metrics.Metrics) *Quota {
+	return &Quota{users: users, metrics: m}
+}
+
+// Enabled reports whether quotas are enforced
+func (q *Quota) Enabled() bool {
+	return q.users != nil
+}
+
+// Reserve charges bytes to the quota of a user. It fails with
+// RESOURCE_EXHAUSTED when the quota would be exceeded and with UNAVAILABLE
+// when user-service cannot be asked, so nothing is stored unaccounted.
+func (q *Quota) Reserve(ctx context.Context, userID string, bytes int64) error {
+	if q.users == nil || bytes == 0 {
+		return nil
+	}
+	_, err := q.users.ReserveStorage(ctx, &user.StorageRequest{UserId: userID, Bytes: bytes})
+	if err == nil {
+		return nil
+	}
+	st := status.Convert(err)
+	switch st.Code() {
+	case codes.ResourceExhausted:
+		q.metrics.QuotaRejections.Inc()
+		return st.Err()
+	case codes.NotFound:
+		return status.Errorf(codes.FailedPrecondition, "user account not found")
+	}
+	q.metrics.QuotaErrors.WithLabelValues("reserve").Inc()
+	if ctx.Err() != nil {
+		return status.FromContextError(ctx.Err()).Err()
+	}
+	return status.Errorf(codes.Unavailable, "failed to reserve storage: %s", st.Message())
+}
+
+// Release gives bytes back to the quota of a user. The files are already
+// gone, so a failure is logged rather than returned; the next reconciliation
+// corrects the usage.
+func (q *Quota) Release(ctx context.Context, userID string, bytes int64) {
+	if q.users == nil || bytes == 0 {
+		return
+	}
+	// The release belongs to a change that already happened
+	ctx = context.WithoutCancel(ctx)
+	if _, err := q.users.ReleaseStorage(ctx, &user.StorageRequest{UserId: userID, Bytes: bytes}); err != nil {
+		q.metrics.QuotaErrors.WithLabelValues("release").Inc()
+		slog.WarnContext(ctx, "Failed to release storage quota", "user_id", userID, "bytes", bytes, "error", err)
+	}
+}
+
+// Reconcile sends the bytes stored per user to user-service, which replaces
+// its usage with them, and returns the number of users corrected
+func (q *Quota) Reconcile(ctx context.Context, used map[string]int64) (int, error) {
+	if q.users == nil {
+		return 0, nil
+	}
+	resp, err := q.users.ReconcileStorageUsage(ctx, &user.ReconcileStorageUsageRequest{UsedBytes: used})
+	if err != nil {
+		q.metrics.QuotaErrors.WithLabelValues("reconcile").Inc()
+		return 0, err
+	}
+	return int(resp.Corrected), nil
+}
@@ -0,0 +1,223 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/cloud-drive/file-service/internal/models"
+)
+
+var (
+	// ErrFileNotFound is returned when a file is not found
+	ErrFileNotFound = errors.New("file not found")
+	// ErrNameExists is returned when the folder already has an entry with the same name
+	ErrNameExists = errors.New("name already exists in folder")
+)
+
+// FileRepository defines the interface for file and folder metadata access.
+// Methods that place an entry in a folder resolve name conflicts with the
+// given policy atomically and return the files removed by an overwrite, with
+// all their versions, whose blob references and quota the caller releases.
+type FileRepository interface {
+	FolderRepository
+	VersionRepository
+	TrashRepository
+	ShareRepository
+
+	// Create stores a new file in file.FolderID. With ConflictOverwrite an
+	// existing file of the same name keeps its ID and gets the content of
+	// file as a new version instead. The stored file is written back to file.
+	Create(ctx context.Context, file *models.File, policy models.ConflictPolicy) error
+	GetByID(ctx context.Context, id string) (*models.File, error)
+	// List returns the files of an owner directly in the folder at path, sorted by name
+	List(ctx context.Context, ownerID, folder string, limit, offset int) ([]*models.File, error)
+	// MoveFile moves a file to folderID under name. An entry it overwrites
+	// is moved to the trash.
+	MoveFile(ctx context.Context, id, folderID, name string, policy models.ConflictPolicy, now time.Time) (*models.File, error)
+	// UsageByOwner returns the total size of the file versions of each
+	// owner, including the files in the trash
+	UsageByOwner(ctx context.Context) (map[string]int64, error)
+	// BlobReferences returns how many file versions refer to each blob,
+	// including the versions of files in the trash
+	BlobReferences(ctx context.Context) (map[string]int64, error)
+	// Ping checks that the underlying storage is reachable
+	Ping(ctx context.Context) error
+	// Close releases the storage connections during shutdown
+	Close() error
+}
+
+// InMemoryFileRepository is an in-memory implementation of FileRepository
+type InMemoryFileRepository struct {
+	files    map[string]*models.File
+	folders  map[string]*models.Folder
+	versions map[string][]*models.FileVersion // by file ID, oldest first
+	trash    map[string]*models.TrashItem     // by ID of the deleted entry
+	shares   map[string]*models.Share
+	mu       sync.RWMutex
+}
+
+// NewInMemoryFileRepository creates a new in-memory file repository
+func NewInMemoryFileRepository() *InMemoryFileRepository {
+	return &InMemoryFileRepository{
+		files:    make(map[string]*models.File),
+		folders:  make(map[string]*models.Folder),
+		versions: make(map[string][]*models.FileVersion),
+		trash:    make(map[string]*models.TrashItem),
+		shares:   make(map[string]*models.Share),
+	}
+}
+
+// Create stores a new file or a new version of the file it overwrites
+func (r *InMemoryFileRepository) Create(ctx context.Context, file *models.File, policy models.ConflictPolicy) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	parent, err := r.folder(file.OwnerID, file.FolderID)
+	if err != nil {
+		return err
+	}
+	if policy == models.ConflictOverwrite {
+		if _, existing := r.entryNamed(parent, file.Name); existing != nil {
+			r.addVersion(existing, file.CurrentVersion(file.UpdatedAt), file.UpdatedAt)
+			*file = *existing
+			return nil
+		}
+	}
+	name, err := r.place(parent, file.Name, file.ID, false, "", policy, file.CreatedAt)
+	if err != nil {
+		return err
+	}
+	file.Name = name
+	file.Folder = parent.Path
+	r.insert(file)
+	return nil
+}
+
+// GetByID returns a file by ID
+func (r *InMemoryFileRepository) GetByID(ctx context.Context, id string) (*models.File, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	file, ok := r.files[id]
+	if !ok {
+		return nil, ErrFileNotFound
+	}
+	copied := *file
+	return &copied, nil
+}
+
+// List returns the files of an owner in a folder
+func (r *InMemoryFileRepository) List(ctx context.Context, ownerID, folder string, limit, offset int) ([]*models.File, error) {
+	r.mu.RLock()
+	files := make([]*models.File, 0)
+	for _, file := range r.files {
+		if file.OwnerID == ownerID && file.Folder == folder {
+			copied := *file
+			files = append(files, &copied)
+		}
+	}
+	r.mu.RUnlock()
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Name < files[j].Name
+	})
+	return paginate(files, limit, offset), nil
+}
+
+// MoveFile moves or renames a file
+func (r *InMemoryFileRepository) MoveFile(ctx context.Context, id, folderID, name string, policy models.ConflictPolicy, now time.Time) (*models.File, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	file, ok := r.files[id]
+	if !ok {
+		return nil, ErrFileNotFound
+	}
+	parent, err := r.folder(file.OwnerID, folderID)
+	if err != nil {
+		return nil, err
+	}
+	name, err = r.place(parent, name, file.ID, false, "", policy, now)
+	if err != nil {
+		return nil, err
+	}
+	file.FolderID = parent.ID
+	file.Folder = parent.Path
+	file.Name = name
+	file.UpdatedAt = now
+	copied := *file
+	return &copied, nil
+}
+
+// UsageByOwner sums the version sizes per owner
+func (r *InMemoryFileRepository) UsageByOwner(ctx context.Context) (map[string]int64, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	usage := make(map[string]int64)
+	for _, versions := range r.versions {
+		for _, v := range versions {
+			usage[v.OwnerID] += v.Size
+		}
+	}
+	for _, item := range r.trash {
+		usage[item.OwnerID] += item.Size
+	}
+	return usage, nil
+}
+
+// BlobReferences counts the versions referring to each blob
+func (r *InMemoryFileRepository) BlobReferences(ctx context.Context) (map[string]int64, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	refs := make(map[string]int64)
+	for _, versions := range r.versions {
+		for _, v := range versions {
+			refs[v.BlobKey]++
+		}
+	}
+	for _, item := range r.trash {
+		for _, v := range item.Versions() {
+			refs[v.BlobKey]++
+		}
+	}
+	return refs, nil
+}
+
+// Ping always succeeds for the in-memory repository
+func (r *InMemoryFileRepository) Ping(ctx context.Context) error {
+	return nil
+}
+
+// Close is a no-op for the in-memory repository
+func (r *InMemoryFileRepository) Close() error {
+	return nil
+}
+
+// insert stores a new file as its first version. The caller holds the write
+// lock.
+func (r *InMemoryFileRepository) insert(file *models.File) {
+	file.Version = 1
+	stored := *file
+	r.files[file.ID] = &stored
+	r.versions[file.ID] = []*models.FileVersion{stored.CurrentVersion(file.CreatedAt)}
+}
+
+// remove deletes a stored file with its versions and returns it with
+// Versions set, so it can be released or kept in the trash. The caller holds the write lock.
+func (r *InMemoryFileRepository) remove(file *models.File) *models.File {
+	delete(r.files, file.ID)
+	file.Versions = r.versions[file.ID]
+	delete(r.versions, file.ID)
+	return file
+}
+
+// paginate returns the page of items starting at offset
+func paginate[T any](items []T, limit, offset int) []T {
+	if offset >= len(items) {
+		return []T{}
+	}
+	end := offset + limit
+	if end > len(items) {
+		end = len(items)
+	}
+	return items[offset:end]
+}
@@ -0,0 +1,385 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cloud-drive/file-service/internal/models"
+)
+
+var (
+	// ErrFolderNotFound is returned when a folder is not found
+	ErrFolderNotFound = errors.New("folder not found")
+	// ErrPathNotFound is returned when no folder or file exists at a path
+	ErrPathNotFound = errors.New("path not found")
+	// ErrInvalidMove is returned when a folder would end up inside itself or
+	// an overwrite would remove the entry being moved or copied
+	ErrInvalidMove = errors.New("a folder cannot be placed inside itself")
+)
+
+// FolderRepository defines the interface for folder metadata access. Folder
+// and file paths are materialized, so moving or renaming a folder rewrites
+// the paths below it in the same operation.
+type FolderRepository interface {
+	// CreateFolder stores a new folder in folder.ParentID. The stored name and
+	// path are written back to folder.
+	CreateFolder(ctx context.Context, folder *models.Folder, policy models.ConflictPolicy) error
+	// GetFolder returns a stored folder; the root folder is not stored
+	GetFolder(ctx context.Context, id string) (*models.Folder, error)
+	// ResolvePath returns the folder or the file of an owner at an absolute path
+	ResolvePath(ctx context.Context, ownerID, p string) (*models.Folder, *models.File, error)
+	// ListChildren returns the folders and then the files directly in a
+	// folder, each sorted by name, paginated over the combined list
+	ListChildren(ctx context.Context, ownerID, folderID string, limit, offset int) ([]*models.Folder, []*models.File, error)
+	// MoveFolder moves a folder with everything below it to parentID under
+	// name. An entry it overwrites is moved to the trash.
+	MoveFolder(ctx context.Context, id, parentID, name string, policy models.ConflictPolicy, now time.Time) (*models.Folder, error)
+	// Subtree returns a folder and all folders below it ordered parents
+	// first, and the files below it
+	Subtree(ctx context.Context, id string) ([]*models.Folder, []*models.File, error)
+	// InsertTree stores a copy of the folder sourceID. folders[0] is the copy
+	// of the source and is placed in its ParentID; the other folders must
+	// follow their parent. Paths are computed from the parent links. The copy
+	// may belong to another owner than the source. An entry the copy
+	// overwrites is moved to the trash at now.
+	InsertTree(ctx context.Context, sourceID string, folders []*models.Folder, files []*models.File, policy models.ConflictPolicy, now time.Time) error
+}
+
+// CreateFolder stores a new folder
+func (r *InMemoryFileRepository) CreateFolder(ctx context.Context, folder *models.Folder, policy models.ConflictPolicy) error {
+	// Một thư mục rỗng không bao giờ thay thế thư mục đang có
+	if policy == models.ConflictOverwrite {
+		policy = models.ConflictFail
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	parent, err := r.folder(folder.OwnerID, folder.ParentID)
+	if err != nil {
+		return err
+	}
+	name, err := r.place(parent, folder.Name, folder.ID, true, "", policy, folder.CreatedAt)
+	if err != nil {
+		return err
+	}
+	folder.Name = name
+	folder.Path = parent.ChildPath(name)
+	stored := *folder
+	r.folders[folder.ID] = &stored
+	return nil
+}
+
+// GetFolder returns a folder by ID
+func (r *InMemoryFileRepository) GetFolder(ctx context.Context, id string) (*models.Folder, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	folder, ok := r.folders[id]
+	if !ok {
+		return nil, ErrFolderNotFound
+	}
+	copied := *folder
+	return &copied, nil
+}
+
+// ResolvePath returns the entry at a path
+func (r *InMemoryFileRepository) ResolvePath(ctx context.Context, ownerID, p string) (*models.Folder, *models.File, error) {
+	if p == "/" {
+		return models.RootFolder(ownerID), nil, nil
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, folder := range r.folders {
+		if folder.OwnerID == ownerID && folder.Path == p {
+			copied := *folder
+			return &copied, nil, nil
+		}
+	}
+	dir, name := path.Split(p)
+	dir = path.Clean(dir)
+	for _, file := range r.files {
+		if file.OwnerID == ownerID && file.Folder == dir && file.Name == name {
+			copied := *file
+			return nil, &copied, nil
+		}
+	}
+	return nil, nil, ErrPathNotFound
+}
+
+// ListChildren returns the entries directly in a folder
+func (r *InMemoryFileRepository) ListChildren(ctx context.Context, ownerID, folderID string, limit, offset int) ([]*models.Folder, []*models.File, error) {
+	r.mu.RLock()
+	if _, err := r.folder(ownerID, folderID); err != nil {
+		r.mu.RUnlock()
+		return nil, nil, err
+	}
+	folders := make([]*models.Folder, 0)
+	for _, folder := range r.folders {
+		if folder.OwnerID == ownerID && folder.ParentID == folderID {
+			copied := *folder
+			folders = append(folders, &copied)
+		}
+	}
+	files := make([]*models.File, 0)
+	for _, file := range r.files {
+		if file.OwnerID == ownerID && file.FolderID == folderID {
+			copied := *file
+			files = append(files, &copied)
+		}
+	}
+	r.mu.RUnlock()
+
+	sort.Slice(folders, func(i, j int) bool {
+		return folders[i].Name < folders[j].Name
+	})
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Name < files[j].Name
+	})
+
+	// Phân trang trên danh sách gộp: thư mục trước, file sau
+	pagedFolders := paginate(folders, limit, offset)
+	fileOffset := max(offset-len(folders), 0)
+	fileLimit := limit - len(pagedFolders)
+	return pagedFolders, paginate(files, fileLimit, fileOffset), nil
+}
+
+// MoveFolder moves or renames a folder
+func (r *InMemoryFileRepository) MoveFolder(ctx context.Context, id, parentID, name string, policy models.ConflictPolicy, now time.Time) (*models.Folder, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	folder, ok := r.folders[id]
+	if !ok {
+		return nil, ErrFolderNotFound
+	}
+	parent, err := r.folder(folder.OwnerID, parentID)
+	if err != nil {
+		return nil, err
+	}
+	if folder.Contains(parent.Path) {
+		return nil, ErrInvalidMove
+	}
+	name, err = r.place(parent, name, folder.ID, true, folder.Path, policy, now)
+	if err != nil {
+		return nil, err
+	}
+
+	r.repath(folder.OwnerID, folder.Path, parent.ChildPath(name))
+	folder.ParentID = parent.ID
+	folder.Name = name
+	folder.UpdatedAt = now
+	copied := *folder
+	return &copied, nil
+}
+
+// Subtree returns a folder and everything below it
+func (r *InMemoryFileRepository) Subtree(ctx context.Context, id string) ([]*models.Folder, []*models.File, error) {
+	r.mu.RLock()
+	root, ok := r.folders[id]
+	if !ok {
+		r.mu.RUnlock()
+		return nil, nil, ErrFolderNotFound
+	}
+	var folders []*models.Folder
+	for _, folder := range r.folders {
+		if folder.OwnerID == root.OwnerID && root.Contains(folder.Path) {
+			copied := *folder
+			folders = append(folders, &copied)
+		}
+	}
+	var files []*models.File
+	for _, file := range r.files {
+		if file.OwnerID == root.OwnerID && root.Contains(file.Folder) {
+			copied := *file
+			files = append(files, &copied)
+		}
+	}
+	r.mu.RUnlock()
+
+	// Path của thư mục cha luôn là prefix nên đứng trước thư mục con
+	sort.Slice(folders, func(i, j int) bool {
+		return folders[i].Path < folders[j].Path
+	})
+	return folders, files, nil
+}
+
+// InsertTree stores a copied folder tree
+func (r *InMemoryFileRepository) InsertTree(ctx context.Context, sourceID string, folders []*models.Folder, files []*models.File, policy models.ConflictPolicy, now time.Time) error {
+	if len(folders) == 0 {
+		return errors.New("tree has no root folder")
+	}
+	root := folders[0]
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	source, ok := r.folders[sourceID]
+	if !ok {
+		return ErrFolderNotFound
+	}
+	parent, err := r.folder(root.OwnerID, root.ParentID)
+	if err != nil {
+		return err
+	}
+	// Bản sao sang ổ đĩa của người khác không thể nằm bên trong thư mục nguồn
+	sourcePath := ""
+	if source.OwnerID == parent.OwnerID {
+		if source.Contains(parent.Path) {
+			return ErrInvalidMove
+		}
+		sourcePath = source.Path
+	}
+	name, err := r.place(parent, root.Name, root.ID, true, sourcePath, policy, now)
+	if err != nil {
+		return err
+	}
+
+	root.Name = name
+	root.Path = parent.ChildPath(name)
+	paths := map[string]string{root.ID: root.Path}
+	for _, folder := range folders[1:] {
+		parentPath, ok := paths[folder.ParentID]
+		if !ok {
+			return fmt.Errorf("folder %s comes before its parent", folder.ID)
+		}
+		folder.Path = path.Join(parentPath, folder.Name)
+		paths[folder.ID] = folder.Path
+	}
+	for _, file := range files {
+		folderPath, ok := paths[file.FolderID]
+		if !ok {
+			return fmt.Errorf("file %s is outside the tree", file.ID)
+		}
+		file.Folder = folderPath
+	}
+
+	for _, folder := range folders {
+		stored := *folder
+		r.folders[folder.ID] = &stored
+	}
+	for _, file := range files {
+		r.insert(file)
+	}
+	return nil
+}
+
+// folder returns the folder id of an owner, including the root folder. The
+// caller holds the lock.
+func (r *InMemoryFileRepository) folder(ownerID, id string) (*models.Folder, error) {
+	if id == models.RootFolderID {
+		return models.RootFolder(ownerID), nil
+	}
+	folder, ok := r.folders[id]
+	if !ok || folder.OwnerID != ownerID {
+		return nil, ErrFolderNotFound
+	}
+	return folder, nil
+}
+
+// place resolves the name of an entry selfID placed in parent. source is the
+// path of the entry being moved or copied, which an overwrite must not
+// replace. An entry replaced by an overwrite is moved to the trash at now.
+// The caller holds the write lock.
+func (r *InMemoryFileRepository) place(parent *models.Folder, name, selfID string, isFolder bool, source string, policy models.ConflictPolicy, now time.Time) (string, error) {
+	existingFolder, existingFile := r.entryNamed(parent, name)
+	switch {
+	case existingFolder == nil && existingFile == nil:
+		return name, nil
+	case existingFolder != nil && existingFolder.ID == selfID, existingFile != nil && existingFile.ID == selfID:
+		return name, nil
+	}
+
+	switch policy {
+	case models.ConflictRename:
+		return r.freeName(parent, name, isFolder), nil
+	case models.ConflictOverwrite:
+		if isFolder && existingFolder != nil {
+			if source != "" && existingFolder.Contains(source) {
+				return "", ErrInvalidMove
+			}
+			r.trashFolder(existingFolder, now)
+			return name, nil
+		}
+		if !isFolder && existingFile != nil {
+			r.trashFile(existingFile, now)
+			return name, nil
+		}
+	}
+	return "", ErrNameExists
+}
+
+// entryNamed returns the folder or the file named name in parent. The caller
+// holds the lock.
+func (r *InMemoryFileRepository) entryNamed(parent *models.Folder, name string) (*models.Folder, *models.File) {
+	for _, folder := range r.folders {
+		if folder.OwnerID == parent.OwnerID && folder.ParentID == parent.ID && folder.Name == name {
+			return folder, nil
+		}
+	}
+	for _, file := range r.files {
+		if file.OwnerID == parent.OwnerID && file.FolderID == parent.ID && file.Name == name {
+			return nil, file
+		}
+	}
+	return nil, nil
+}
+
+// freeName returns the first of "name (1)", "name (2)", ... that is free in
+// parent. File extensions are kept: "report (1).pdf". The caller holds the lock.
+func (r *InMemoryFileRepository) freeName(parent *models.Folder, name string, isFolder bool) string {
+	base, ext := name, ""
+	if !isFolder {
+		if e := path.Ext(name); e != name {
+			base, ext = strings.TrimSuffix(name, e), e
+		}
+	}
+	for i := 1; ; i++ {
+		candidate := fmt.Sprintf("%s (%d)%s", base, i, ext)
+		if folder, file := r.entryNamed(parent, candidate); folder == nil && file == nil {
+			return candidate
+		}
+	}
+}
+
+// repath rewrites the materialized paths at or below from to start with to.
+// The caller holds the write lock.
+func (r *InMemoryFileRepository) repath(ownerID, from, to string) {
+	below := func(p string) bool {
+		return p == from || strings.HasPrefix(p, from+"/")
+	}
+	for _, folder := range r.folders {
+		if folder.OwnerID == ownerID && below(folder.Path) {
+			folder.Path = to + folder.Path[len(from):]
+		}
+	}
+	for _, file := range r.files {
+		if file.OwnerID == ownerID && below(file.Folder) {
+			file.Folder = to + file.Folder[len(from):]
+		}
+	}
+}
+
+// removeSubtree deletes a folder with everything below it and returns the
+// deleted folders, parents first, and files. The caller holds the write lock.
+func (r *InMemoryFileRepository) removeSubtree(root *models.Folder) ([]*models.Folder, []*models.File) {
+	var files []*models.File
+	for _, file := range r.files {
+		if file.OwnerID == root.OwnerID && root.Contains(file.Folder) {
+			files = append(files, r.remove(file))
+		}
+	}
+	var folders []*models.Folder
+	for id, folder := range r.folders {
+		if folder.OwnerID == root.OwnerID && root.Contains(folder.Path) {
+			folders = append(folders, folder)
+			delete(r.folders, id)
+		}
+	}
+	sort.Slice(folders, func(i, j int) bool {
+		return folders[i].Path < folders[j].Path
+	})
+	return folders, files
+}
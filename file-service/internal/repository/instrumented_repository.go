@@ -0,0 +1,332 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/cloud-drive/file-service/internal/metrics"
+	"github.com/cloud-drive/file-service/internal/models"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// InstrumentedFileRepository records a trace span, latency and errors for
+// every call to the wrapped repository
+type InstrumentedFileRepository struct {
+	next    FileRepository
+	metrics *metrics.Metrics
+	tracer  trace.Tracer
+}
+
+// NewInstrumentedFileRepository wraps next with tracing and Prometheus instrumentation
+func NewInstrumentedFileRepository(next FileRepository, m *metrics.Metrics) *InstrumentedFileRepository {
+	return &InstrumentedFileRepository{
+		next:    next,
+		metrics: m,
+		tracer:  otel.Tracer("github.com/cloud-drive/file-service/internal/repository"),
+	}
+}
+
+// begin starts a span for operation and returns the function that ends it
+// and records the metrics
+func (r *InstrumentedFileRepository) begin(ctx context.Context, operation string) (context.Context, func(error)) {
+	ctx, span := r.tracer.Start(ctx, "FileRepository."+operation,
+		trace.WithSpanKind(trace.SpanKindInternal),
+		trace.WithAttributes(attribute.String("db.operation", operation)),
+	)
+	start := time.Now()
+	return ctx, func(err error) {
+		r.observe(operation, start, err)
+		if err != nil && errorReason(err) == "internal" {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}
+}
+
+// observe records the duration and outcome of an operation started at start
+func (r *InstrumentedFileRepository) observe(operation string, start time.Time, err error) {
+	r.metrics.RepositoryDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+	if err == nil {
+		return
+	}
+	r.metrics.RepositoryErrors.WithLabelValues(operation, errorReason(err)).Inc()
+}
+
+// errorReason classifies err for the error metric. Expected outcomes such as
+// a missing entry are not recorded as span errors.
+func errorReason(err error) string {
+	switch {
+	case errors.Is(err, ErrFileNotFound), errors.Is(err, ErrFolderNotFound), errors.Is(err, ErrPathNotFound), errors.Is(err, ErrVersionNotFound),
+		errors.Is(err, ErrTrashItemNotFound), errors.Is(err, ErrShareNotFound):
+		return "not_found"
+	case errors.Is(err, ErrNameExists):
+		return "exists"
+	case errors.Is(err, ErrInvalidMove):
+		return "invalid_move"
+	}
+	return "internal"
+}
+
+// Create stores a new file
+func (r *InstrumentedFileRepository) Create(ctx context.Context, file *models.File, policy models.ConflictPolicy) error {
+	ctx, end := r.begin(ctx, "create")
+	err := r.next.Create(ctx, file, policy)
+	end(err)
+	return err
+}
+
+// GetByID returns a file by ID
+func (r *InstrumentedFileRepository) GetByID(ctx context.Context, id string) (*models.File, error) {
+	ctx, end := r.begin(ctx, "get_by_id")
+	file, err := r.next.GetByID(ctx, id)
+	end(err)
+	return file, err
+}
+
+// List returns the files of an owner in a folder
+func (r *InstrumentedFileRepository) List(ctx context.Context, ownerID, folder string, limit, offset int) ([]*models.File, error) {
+	ctx, end := r.begin(ctx, "list")
+	files, err := r.next.List(ctx, ownerID, folder, limit, offset)
+	end(err)
+	return files, err
+}
+
+// MoveFile moves or renames a file
+func (r *InstrumentedFileRepository) MoveFile(ctx context.Context, id, folderID, name string, policy models.ConflictPolicy, now time.Time) (*models.File, error) {
+	ctx, end := r.begin(ctx, "move_file")
+	file, err := r.next.MoveFile(ctx, id, folderID, name, policy, now)
+	end(err)
+	return file, err
+}
+
+// UsageByOwner returns the total version size per owner
+func (r *InstrumentedFileRepository) UsageByOwner(ctx context.Context) (map[string]int64, error) {
+	ctx, end := r.begin(ctx, "usage_by_owner")
+	usage, err := r.next.UsageByOwner(ctx)
+	end(err)
+	return usage, err
+}
+
+// BlobReferences returns the number of versions referring to each blob
+func (r *InstrumentedFileRepository) BlobReferences(ctx context.Context) (map[string]int64, error) {
+	ctx, end := r.begin(ctx, "blob_references")
+	refs, err := r.next.BlobReferences(ctx)
+	end(err)
+	return refs, err
+}
+
+// ListVersions returns the versions of a file
+func (r *InstrumentedFileRepository) ListVersions(ctx context.Context, fileID string) ([]*models.FileVersion, error) {
+	ctx, end := r.begin(ctx, "list_versions")
+	versions, err := r.next.ListVersions(ctx, fileID)
+	end(err)
+	return versions, err
+}
+
+// GetVersion returns one version of a file
+func (r *InstrumentedFileRepository) GetVersion(ctx context.Context, fileID string, version int) (*models.FileVersion, error) {
+	ctx, end := r.begin(ctx, "get_version")
+	v, err := r.next.GetVersion(ctx, fileID, version)
+	end(err)
+	return v, err
+}
+
+// RestoreVersion adds the content of an older version as a new version
+func (r *InstrumentedFileRepository) RestoreVersion(ctx context.Context, fileID string, version int, now time.Time) (*models.File, error) {
+	ctx, end := r.begin(ctx, "restore_version")
+	file, err := r.next.RestoreVersion(ctx, fileID, version, now)
+	end(err)
+	return file, err
+}
+
+// PruneVersions deletes the versions outside the retention
+func (r *InstrumentedFileRepository) PruneVersions(ctx context.Context, keep int, replacedBefore time.Time) ([]*models.FileVersion, error) {
+	ctx, end := r.begin(ctx, "prune_versions")
+	pruned, err := r.next.PruneVersions(ctx, keep, replacedBefore)
+	end(err)
+	return pruned, err
+}
+
+// CreateFolder stores a new folder
+func (r *InstrumentedFileRepository) CreateFolder(ctx context.Context, folder *models.Folder, policy models.ConflictPolicy) error {
+	ctx, end := r.begin(ctx, "create_folder")
+	err := r.next.CreateFolder(ctx, folder, policy)
+	end(err)
+	return err
+}
+
+// GetFolder returns a folder by ID
+func (r *InstrumentedFileRepository) GetFolder(ctx context.Context, id string) (*models.Folder, error) {
+	ctx, end := r.begin(ctx, "get_folder")
+	folder, err := r.next.GetFolder(ctx, id)
+	end(err)
+	return folder, err
+}
+
+// ResolvePath returns the entry at a path
+func (r *InstrumentedFileRepository) ResolvePath(ctx context.Context, ownerID, p string) (*models.Folder, *models.File, error) {
+	ctx, end := r.begin(ctx, "resolve_path")
+	folder, file, err := r.next.ResolvePath(ctx, ownerID, p)
+	end(err)
+	return folder, file, err
+}
+
+// ListChildren returns the entries directly in a folder
+func (r *InstrumentedFileRepository) ListChildren(ctx context.Context, ownerID, folderID string, limit, offset int) ([]*models.Folder, []*models.File, error) {
+	ctx, end := r.begin(ctx, "list_children")
+	folders, files, err := r.next.ListChildren(ctx, ownerID, folderID, limit, offset)
+	end(err)
+	return folders, files, err
+}
+
+// MoveFolder moves or renames a folder
+func (r *InstrumentedFileRepository) MoveFolder(ctx context.Context, id, parentID, name string, policy models.ConflictPolicy, now time.Time) (*models.Folder, error) {
+	ctx, end := r.begin(ctx, "move_folder")
+	folder, err := r.next.MoveFolder(ctx, id, parentID, name, policy, now)
+	end(err)
+	return folder, err
+}
+
+// TrashFile moves a file to the trash
+func (r *InstrumentedFileRepository) TrashFile(ctx context.Context, id string, now time.Time) (*models.TrashItem, error) {
+	ctx, end := r.begin(ctx, "trash_file")
+	item, err := r.next.TrashFile(ctx, id, now)
+	end(err)
+	return item, err
+}
+
+// TrashFolder moves a folder to the trash
+func (r *InstrumentedFileRepository) TrashFolder(ctx context.Context, id string, now time.Time) (*models.TrashItem, error) {
+	ctx, end := r.begin(ctx, "trash_folder")
+	item, err := r.next.TrashFolder(ctx, id, now)
+	end(err)
+	return item, err
+}
+
+// ListTrash returns the trash items of an owner
+func (r *InstrumentedFileRepository) ListTrash(ctx context.Context, ownerID string, limit, offset int) ([]*models.TrashItem, error) {
+	ctx, end := r.begin(ctx, "list_trash")
+	items, err := r.next.ListTrash(ctx, ownerID, limit, offset)
+	end(err)
+	return items, err
+}
+
+// GetTrashItem returns a trash item by ID
+func (r *InstrumentedFileRepository) GetTrashItem(ctx context.Context, id string) (*models.TrashItem, error) {
+	ctx, end := r.begin(ctx, "get_trash_item")
+	item, err := r.next.GetTrashItem(ctx, id)
+	end(err)
+	return item, err
+}
+
+// RestoreTrashItem puts a trash item back in the drive
+func (r *InstrumentedFileRepository) RestoreTrashItem(ctx context.Context, id, folderID string, policy models.ConflictPolicy, now time.Time) (*models.Folder, *models.File, error) {
+	ctx, end := r.begin(ctx, "restore_trash_item")
+	folder, file, err := r.next.RestoreTrashItem(ctx, id, folderID, policy, now)
+	end(err)
+	return folder, file, err
+}
+
+// DeleteTrashItem deletes a trash item for good
+func (r *InstrumentedFileRepository) DeleteTrashItem(ctx context.Context, id string) (*models.TrashItem, error) {
+	ctx, end := r.begin(ctx, "delete_trash_item")
+	item, err := r.next.DeleteTrashItem(ctx, id)
+	end(err)
+	return item, err
+}
+
+// EmptyTrash deletes the trash items of an owner for good
+func (r *InstrumentedFileRepository) EmptyTrash(ctx context.Context, ownerID string) ([]*models.TrashItem, error) {
+	ctx, end := r.begin(ctx, "empty_trash")
+	items, err := r.next.EmptyTrash(ctx, ownerID)
+	end(err)
+	return items, err
+}
+
+// PurgeTrash deletes the trash items past the retention for good
+func (r *InstrumentedFileRepository) PurgeTrash(ctx context.Context, deletedBefore time.Time) ([]*models.TrashItem, error) {
+	ctx, end := r.begin(ctx, "purge_trash")
+	items, err := r.next.PurgeTrash(ctx, deletedBefore)
+	end(err)
+	return items, err
+}
+
+// PutShare stores a share or updates the role of an existing one
+func (r *InstrumentedFileRepository) PutShare(ctx context.Context, share *models.Share) error {
+	ctx, end := r.begin(ctx, "put_share")
+	err := r.next.PutShare(ctx, share)
+	end(err)
+	return err
+}
+
+// GetShare returns a share by ID
+func (r *InstrumentedFileRepository) GetShare(ctx context.Context, id string) (*models.Share, error) {
+	ctx, end := r.begin(ctx, "get_share")
+	share, err := r.next.GetShare(ctx, id)
+	end(err)
+	return share, err
+}
+
+// ListShares returns the shares of an entry
+func (r *InstrumentedFileRepository) ListShares(ctx context.Context, entryID string) ([]*models.Share, error) {
+	ctx, end := r.begin(ctx, "list_shares")
+	shares, err := r.next.ListShares(ctx, entryID)
+	end(err)
+	return shares, err
+}
+
+// DeleteShare deletes a share
+func (r *InstrumentedFileRepository) DeleteShare(ctx context.Context, id string) error {
+	ctx, end := r.begin(ctx, "delete_share")
+	err := r.next.DeleteShare(ctx, id)
+	end(err)
+	return err
+}
+
+// SharedWith returns the entries shared with a user
+func (r *InstrumentedFileRepository) SharedWith(ctx context.Context, userID string, limit, offset int) ([]*models.SharedItem, error) {
+	ctx, end := r.begin(ctx, "shared_with")
+	items, err := r.next.SharedWith(ctx, userID, limit, offset)
+	end(err)
+	return items, err
+}
+
+// Role returns the role of a user on an entry
+func (r *InstrumentedFileRepository) Role(ctx context.Context, userID, ownerID, entryID, p string) (models.Role, error) {
+	ctx, end := r.begin(ctx, "role")
+	role, err := r.next.Role(ctx, userID, ownerID, entryID, p)
+	end(err)
+	return role, err
+}
+
+// Subtree returns a folder and everything below it
+func (r *InstrumentedFileRepository) Subtree(ctx context.Context, id string) ([]*models.Folder, []*models.File, error) {
+	ctx, end := r.begin(ctx, "subtree")
+	folders, files, err := r.next.Subtree(ctx, id)
+	end(err)
+	return folders, files, err
+}
+
+// InsertTree stores a copied folder tree
+func (r *InstrumentedFileRepository) InsertTree(ctx context.Context, sourceID string, folders []*models.Folder, files []*models.File, policy models.ConflictPolicy, now time.Time) error {
+	ctx, end := r.begin(ctx, "insert_tree")
+	err := r.next.InsertTree(ctx, sourceID, folders, files, policy, now)
+	end(err)
+	return err
+}
+
+// Ping checks the wrapped repository. Health probes are not recorded so they
+// do not drown real traffic in metrics and traces.
+func (r *InstrumentedFileRepository) Ping(ctx context.Context) error {
+	return r.next.Ping(ctx)
+}
+
+// Close closes the wrapped repository
+func (r *InstrumentedFileRepository) Close() error {
+	return r.next.Close()
+}
@@ -0,0 +1,178 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"sort"
+
+	"github.com/cloud-drive/file-service/internal/models"
+)
+
+// ErrShareNotFound is returned when a share is not found
+var ErrShareNotFound = errors.New("share not found")
+
+// ShareRepository defines the interface for shares. A share belongs to its
+// entry: it stays while the entry is in the trash, applying again once the
+// entry is restored, and is dropped when the entry is deleted for good.
+type ShareRepository interface {
+	// PutShare stores a share of a stored entry. A share of the same entry
+	// with the same user gets the role of share instead, keeping its ID. The
+	// stored share is written back to share.
+	PutShare(ctx context.Context, share *models.Share) error
+	GetShare(ctx context.Context, id string) (*models.Share, error)
+	// ListShares returns the shares of an entry, oldest first
+	ListShares(ctx context.Context, entryID string) ([]*models.Share, error)
+	DeleteShare(ctx context.Context, id string) error
+	// SharedWith returns the entries shared with a user that are not in the
+	// trash, most recently shared first
+	SharedWith(ctx context.Context, userID string, limit, offset int) ([]*models.SharedItem, error)
+	// Role returns the highest role a user has on the entry entryID of
+	// ownerID at path p through a share of the entry itself or of a folder
+	// above it, or "" when it is not shared with them
+	Role(ctx context.Context, userID, ownerID, entryID, p string) (models.Role, error)
+}
+
+// PutShare stores a share or updates the role of an existing one
+func (r *InMemoryFileRepository) PutShare(ctx context.Context, share *models.Share) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if share.IsFolder {
+		if _, ok := r.folders[share.EntryID]; !ok {
+			return ErrFolderNotFound
+		}
+	} else if _, ok := r.files[share.EntryID]; !ok {
+		return ErrFileNotFound
+	}
+
+	for _, existing := range r.shares {
+		if existing.EntryID == share.EntryID && existing.UserID == share.UserID {
+			existing.Role = share.Role
+			existing.UpdatedAt = share.UpdatedAt
+			*share = *existing
+			return nil
+		}
+	}
+	stored := *share
+	r.shares[share.ID] = &stored
+	return nil
+}
+
+// GetShare returns a share by ID
+func (r *InMemoryFileRepository) GetShare(ctx context.Context, id string) (*models.Share, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	share, ok := r.shares[id]
+	if !ok {
+		return nil, ErrShareNotFound
+	}
+	copied := *share
+	return &copied, nil
+}
+
+// ListShares returns the shares of an entry
+func (r *InMemoryFileRepository) ListShares(ctx context.Context, entryID string) ([]*models.Share, error) {
+	r.mu.RLock()
+	shares := make([]*models.Share, 0)
+	for _, share := range r.shares {
+		if share.EntryID == entryID {
+			copied := *share
+			shares = append(shares, &copied)
+		}
+	}
+	r.mu.RUnlock()
+	sort.Slice(shares, func(i, j int) bool {
+		if !shares[i].CreatedAt.Equal(shares[j].CreatedAt) {
+			return shares[i].CreatedAt.Before(shares[j].CreatedAt)
+		}
+		return shares[i].ID < shares[j].ID
+	})
+	return shares, nil
+}
+
+// DeleteShare deletes a share
+func (r *InMemoryFileRepository) DeleteShare(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.shares[id]; !ok {
+		return ErrShareNotFound
+	}
+	delete(r.shares, id)
+	return nil
+}
+
+// SharedWith returns the entries shared with a user
+func (r *InMemoryFileRepository) SharedWith(ctx context.Context, userID string, limit, offset int) ([]*models.SharedItem, error) {
+	r.mu.RLock()
+	items := make([]*models.SharedItem, 0)
+	for _, share := range r.shares {
+		if share.UserID != userID {
+			continue
+		}
+		copied := *share
+		item := &models.SharedItem{Share: &copied}
+		if folder, ok := r.folders[share.EntryID]; ok {
+			stored := *folder
+			item.Folder = &stored
+		} else if file, ok := r.files[share.EntryID]; ok {
+			stored := *file
+			item.File = &stored
+		} else {
+			// Mục đang nằm trong thùng rác
+			continue
+		}
+		items = append(items, item)
+	}
+	r.mu.RUnlock()
+	sort.Slice(items, func(i, j int) bool {
+		if !items[i].Share.CreatedAt.Equal(items[j].Share.CreatedAt) {
+			return items[i].Share.CreatedAt.After(items[j].Share.CreatedAt)
+		}
+		return items[i].Share.ID < items[j].Share.ID
+	})
+	return paginate(items, limit, offset), nil
+}
+
+// Role returns the role of a user on an entry from its shares and the shares
+// of the folders above it
+func (r *InMemoryFileRepository) Role(ctx context.Context, userID, ownerID, entryID, p string) (models.Role, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var role models.Role
+	for _, share := range r.shares {
+		if share.UserID != userID || share.OwnerID != ownerID || role.Includes(share.Role) {
+			continue
+		}
+		if share.EntryID == entryID {
+			role = share.Role
+			continue
+		}
+		if !share.IsFolder {
+			continue
+		}
+		// Thư mục trong thùng rác không còn chia sẻ những gì bên dưới nó
+		if folder, ok := r.folders[share.EntryID]; ok && folder.Contains(p) {
+			role = share.Role
+		}
+	}
+	return role, nil
+}
+
+// dropShares deletes the shares of entries deleted for good. The caller
+// holds the write lock.
+func (r *InMemoryFileRepository) dropShares(folders []*models.Folder, files []*models.File) {
+	if len(r.shares) == 0 {
+		return
+	}
+	deleted := make(map[string]bool, len(folders)+len(files))
+	for _, folder := range folders {
+		deleted[folder.ID] = true
+	}
+	for _, file := range files {
+		deleted[file.ID] = true
+	}
+	for id, share := range r.shares {
+		if deleted[share.EntryID] {
+			delete(r.shares, id)
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/cloud-drive/file-service/internal/models"
+)
+
+// testTime is the time entries are created at in tests
+var testTime = time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// createFolder stores a folder of owner named name in parentID
+func createFolder(t *testing.T, r *InMemoryFileRepository, owner, id, parentID, name string) *models.Folder {
+	t.Helper()
+	folder := &models.Folder{ID: id, OwnerID: owner, ParentID: parentID, Name: name, CreatedAt: testTime, UpdatedAt: testTime}
+	if err := r.CreateFolder(context.Background(), folder, models.ConflictFail); err != nil {
+		t.Fatalf("CreateFolder %s: %v", name, err)
+	}
+	return folder
+}
+
+// createFile stores a file of owner named name in folderID with content of
+// size bytes whose blob key is key
+func createFile(t *testing.T, r *InMemoryFileRepository, owner, id, folderID, name, key string, size int64, policy models.ConflictPolicy, at time.Time) *models.File {
+	t.Helper()
+	f := &models.File{
+		ID:        id,
+		OwnerID:   owner,
+		FolderID:  folderID,
+		Name:      name,
+		Size:      size,
+		Checksum:  key,
+		BlobKey:   key,
+		CreatedAt: at,
+		UpdatedAt: at,
+	}
+	if err := r.Create(context.Background(), f, policy); err != nil {
+		t.Fatalf("Create %s: %v", name, err)
+	}
+	return f
+}
+
+// newShareTestRepository stores the drive of alice:
+//
+//	/docs/reports/q1.pdf
+//	/docs-old/q0.pdf
+//	/photos
+func newShareTestRepository(t *testing.T) *InMemoryFileRepository {
+	t.Helper()
+	r := NewInMemoryFileRepository()
+	createFolder(t, r, "alice", "docs", models.RootFolderID, "docs")
+	createFolder(t, r, "alice", "reports", "docs", "reports")
+	createFolder(t, r, "alice", "docs-old", models.RootFolderID, "docs-old")
+	createFolder(t, r, "alice", "photos", models.RootFolderID, "photos")
+	createFile(t, r, "alice", "q1", "reports", "q1.pdf", "blob-q1", 10, models.ConflictFail, testTime)
+	createFile(t, r, "alice", "q0", "docs-old", "q0.pdf", "blob-q0", 10, models.ConflictFail, testTime)
+	return r
+}
+
+// share returns a share by alice with bob
+func share(id, entryID string, isFolder bool, role models.Role) *models.Share {
+	return &models.Share{
+		ID:        id,
+		OwnerID:   "alice",
+		EntryID:   entryID,
+		IsFolder:  isFolder,
+		UserID:    "bob",
+		Role:      role,
+		CreatedAt: testTime,
+		UpdatedAt: testTime,
+	}
+}
+
+func TestRole(t *testing.T) {
+	fromMallory := share("s", "docs", true, models.RoleEditor)
+	fromMallory.OwnerID = "mallory"
+	withCarol := share("s", "docs", true, models.RoleEditor)
+	withCarol.UserID = "carol"
+
+	for _, tc := range []struct {
+		name   string
+		shares []*models.Share
+		// entryID at path p is the entry asked about
+		entryID, p string
+		want       models.Role
+	}{
+		{"not shared", nil, "q1", "/docs/reports/q1.pdf", ""},
+		{"viewer on the file", []*models.Share{share("s", "q1", false, models.RoleViewer)}, "q1", "/docs/reports/q1.pdf", models.RoleViewer},
+		{"commenter on the file", []*models.Share{share("s", "q1", false, models.RoleCommenter)}, "q1", "/docs/reports/q1.pdf", models.RoleCommenter},
+		{"editor on the file", []*models.Share{share("s", "q1", false, models.RoleEditor)}, "q1", "/docs/reports/q1.pdf", models.RoleEditor},
+		{"viewer on an ancestor folder", []*models.Share{share("s", "docs", true, models.RoleViewer)}, "q1", "/docs/reports/q1.pdf", models.RoleViewer},
+		{"commenter on the parent folder", []*models.Share{share("s", "reports", true, models.RoleCommenter)}, "q1", "/docs/reports/q1.pdf", models.RoleCommenter},
+		{"editor on an ancestor folder", []*models.Share{share("s", "docs", true, models.RoleEditor)}, "q1", "/docs/reports/q1.pdf", models.RoleEditor},
+		{"editor on the folder itself", []*models.Share{share("s", "docs", true, models.RoleEditor)}, "docs", "/docs", models.RoleEditor},
+		{"share of a subfolder", []*models.Share{share("s", "reports", true, models.RoleEditor)}, "docs", "/docs", ""},
+		{"share of a sibling folder", []*models.Share{share("s", "photos", true, models.RoleEditor)}, "q1", "/docs/reports/q1.pdf", ""},
+		{"share of a folder with the same prefix", []*models.Share{share("s", "docs", true, models.RoleEditor)}, "q0", "/docs-old/q0.pdf", ""},
+		{"share of another file", []*models.Share{share("s", "q0", false, models.RoleEditor)}, "q1", "/docs/reports/q1.pdf", ""},
+		{"share by another owner", []*models.Share{fromMallory}, "q1", "/docs/reports/q1.pdf", ""},
+		{"share with another user", []*models.Share{withCarol}, "q1", "/docs/reports/q1.pdf", ""},
+		{"folder role above file role", []*models.Share{
+			share("s1", "q1", false, models.RoleViewer),
+			share("s2", "docs", true, models.RoleEditor),
+		}, "q1", "/docs/reports/q1.pdf", models.RoleEditor},
+		{"file role above folder role", []*models.Share{
+			share("s1", "q1", false, models.RoleEditor),
+			share("s2", "docs", true, models.RoleViewer),
+		}, "q1", "/docs/reports/q1.pdf", models.RoleEditor},
+		{"highest of nested folders", []*models.Share{
+			share("s1", "docs", true, models.RoleViewer),
+			share("s2", "reports", true, models.RoleCommenter),
+		}, "q1", "/docs/reports/q1.pdf", models.RoleCommenter},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := newShareTestRepository(t)
+			for _, s := range tc.shares {
+				if err := r.PutShare(context.Background(), s); err != nil {
+					t.Fatalf("PutShare: %v", err)
+				}
+			}
+			got, err := r.Role(context.Background(), "bob", "alice", tc.entryID, tc.p)
+			if err != nil {
+				t.Fatalf("Role: %v", err)
+			}
+			if got != tc.want {
+				t.Fatalf("Role = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestPutShareReplacesRole(t *testing.T) {
+	r := newShareTestRepository(t)
+	ctx := context.Background()
+	if err := r.PutShare(ctx, share("s1", "docs", true, models.RoleEditor)); err != nil {
+		t.Fatalf("PutShare: %v", err)
+	}
+	again := share("s2", "docs", true, models.RoleViewer)
+	if err := r.PutShare(ctx, again); err != nil {
+		t.Fatalf("PutShare: %v", err)
+	}
+	if again.ID != "s1" {
+		t.Errorf("share of the same entry and user stored as %s, want s1", again.ID)
+	}
+	if role, _ := r.Role(ctx, "bob", "alice", "q1", "/docs/reports/q1.pdf"); role != models.RoleViewer {
+		t.Fatalf("Role after sharing again = %q, want the new role viewer", role)
+	}
+	if err := r.PutShare(ctx, share("s3", "missing", true, models.RoleViewer)); !errors.Is(err, ErrFolderNotFound) {
+		t.Fatalf("PutShare of a missing folder = %v, want ErrFolderNotFound", err)
+	}
+}
+
+func TestSharedEntriesInTrash(t *testing.T) {
+	r := newShareTestRepository(t)
+	ctx := context.Background()
+	for _, s := range []*models.Share{
+		share("s1", "docs", true, models.RoleEditor),
+		share("s2", "q0", false, models.RoleViewer),
+	} {
+		if err := r.PutShare(ctx, s); err != nil {
+			t.Fatalf("PutShare: %v", err)
+		}
+	}
+	sharedIDs := func() []string {
+		t.Helper()
+		items, err := r.SharedWith(ctx, "bob", 10, 0)
+		if err != nil {
+			t.Fatalf("SharedWith: %v", err)
+		}
+		ids := make([]string, 0, len(items))
+		for _, item := range items {
+			ids = append(ids, item.Share.EntryID)
+		}
+		return ids
+	}
+
+	if got := sharedIDs(); len(got) != 2 {
+		t.Fatalf("SharedWith = %v, want docs and q0", got)
+	}
+
+	if _, err := r.TrashFolder(ctx, "docs", testTime); err != nil {
+		t.Fatalf("TrashFolder: %v", err)
+	}
+	if got := sharedIDs(); len(got) != 1 || got[0] != "q0" {
+		t.Fatalf("SharedWith with docs in the trash = %v, want only q0", got)
+	}
+	if role, _ := r.Role(ctx, "bob", "alice", "q1", "/docs/reports/q1.pdf"); role != "" {
+		t.Fatalf("Role below a folder in the trash = %q, want none", role)
+	}
+
+	// The share applies again once the folder is restored
+	if _, _, err := r.RestoreTrashItem(ctx, "docs", "", models.ConflictFail, testTime); err != nil {
+		t.Fatalf("RestoreTrashItem: %v", err)
+	}
+	if got := sharedIDs(); len(got) != 2 {
+		t.Fatalf("SharedWith after the restore = %v, want docs and q0", got)
+	}
+	if role, _ := r.Role(ctx, "bob", "alice", "q1", "/docs/reports/q1.pdf"); role != models.RoleEditor {
+		t.Fatalf("Role after the restore = %q, want editor", role)
+	}
+
+	// Deleting for good drops the share
+	if _, err := r.TrashFile(ctx, "q0", testTime); err != nil {
+		t.Fatalf("TrashFile: %v", err)
+	}
+	if _, err := r.DeleteTrashItem(ctx, "q0"); err != nil {
+		t.Fatalf("DeleteTrashItem: %v", err)
+	}
+	if _, err := r.GetShare(ctx, "s2"); !errors.Is(err, ErrShareNotFound) {
+		t.Fatalf("GetShare of an entry deleted for good = %v, want ErrShareNotFound", err)
+	}
+	if got := sharedIDs(); len(got) != 1 || got[0] != "docs" {
+		t.Fatalf("SharedWith after deleting q0 = %v, want only docs", got)
+	}
+}
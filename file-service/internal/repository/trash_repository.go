@@ -0,0 +1,234 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/cloud-drive/file-service/internal/models"
+)
+
+// ErrTrashItemNotFound is returned when the trash has no entry with an ID
+var ErrTrashItemNotFound = errors.New("trash item not found")
+
+// TrashRepository defines the interface for the trash. Deleting a file or a
+// folder, or replacing it with an overwrite, takes it out of the drive with
+// everything below it and keeps it as one trash item, under the ID of the
+// entry, until it is restored or deleted for good. Items deleted for good are returned with the versions of their
+// files, whose blob references and quota the caller releases; the shares of
+// their entries are dropped.
+type TrashRepository interface {
+	// TrashFile moves a file with its versions to the trash
+	TrashFile(ctx context.Context, id string, now time.Time) (*models.TrashItem, error)
+	// TrashFolder moves a folder with everything below it to the trash
+	TrashFolder(ctx context.Context, id string, now time.Time) (*models.TrashItem, error)
+	// ListTrash returns the trash items of an owner, most recently deleted first
+	ListTrash(ctx context.Context, ownerID string, limit, offset int) ([]*models.TrashItem, error)
+	GetTrashItem(ctx context.Context, id string) (*models.TrashItem, error)
+	// RestoreTrashItem puts an item back in folderID, resolving a name
+	// conflict with policy, and returns the restored folder or file. An
+	// empty folderID restores to the folder the item was deleted from, or to
+	// the root folder when that folder no longer exists. An entry it
+	// overwrites is moved to the trash at now.
+	RestoreTrashItem(ctx context.Context, id, folderID string, policy models.ConflictPolicy, now time.Time) (*models.Folder, *models.File, error)
+	// DeleteTrashItem deletes an item for good and returns it
+	DeleteTrashItem(ctx context.Context, id string) (*models.TrashItem, error)
+	// EmptyTrash deletes all items of an owner for good and returns them
+	EmptyTrash(ctx context.Context, ownerID string) ([]*models.TrashItem, error)
+	// PurgeTrash deletes the items of all owners deleted before
+	// deletedBefore for good and returns them
+	PurgeTrash(ctx context.Context, deletedBefore time.Time) ([]*models.TrashItem, error)
+}
+
+// TrashFile moves a file to the trash
+func (r *InMemoryFileRepository) TrashFile(ctx context.Context, id string, now time.Time) (*models.TrashItem, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	file, ok := r.files[id]
+	if !ok {
+		return nil, ErrFileNotFound
+	}
+	return r.trashFile(file, now), nil
+}
+
+// TrashFolder moves a folder to the trash
+func (r *InMemoryFileRepository) TrashFolder(ctx context.Context, id string, now time.Time) (*models.TrashItem, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	folder, ok := r.folders[id]
+	if !ok {
+		return nil, ErrFolderNotFound
+	}
+	return r.trashFolder(folder, now), nil
+}
+
+// ListTrash returns the trash items of an owner
+func (r *InMemoryFileRepository) ListTrash(ctx context.Context, ownerID string, limit, offset int) ([]*models.TrashItem, error) {
+	r.mu.RLock()
+	items := make([]*models.TrashItem, 0)
+	for _, item := range r.trash {
+		if item.OwnerID == ownerID {
+			copied := *item
+			items = append(items, &copied)
+		}
+	}
+	r.mu.RUnlock()
+	sort.Slice(items, func(i, j int) bool {
+		if !items[i].DeletedAt.Equal(items[j].DeletedAt) {
+			return items[i].DeletedAt.After(items[j].DeletedAt)
+		}
+		return items[i].ID < items[j].ID
+	})
+	return paginate(items, limit, offset), nil
+}
+
+// GetTrashItem returns a trash item by ID
+func (r *InMemoryFileRepository) GetTrashItem(ctx context.Context, id string) (*models.TrashItem, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	item, ok := r.trash[id]
+	if !ok {
+		return nil, ErrTrashItemNotFound
+	}
+	copied := *item
+	return &copied, nil
+}
+
+// RestoreTrashItem puts a trash item back in the drive
+func (r *InMemoryFileRepository) RestoreTrashItem(ctx context.Context, id, folderID string, policy models.ConflictPolicy, now time.Time) (*models.Folder, *models.File, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	item, ok := r.trash[id]
+	if !ok {
+		return nil, nil, ErrTrashItemNotFound
+	}
+	if folderID == "" {
+		folderID = item.ParentID
+		if _, err := r.folder(item.OwnerID, folderID); err != nil {
+			folderID = models.RootFolderID
+		}
+	}
+	parent, err := r.folder(item.OwnerID, folderID)
+	if err != nil {
+		return nil, nil, err
+	}
+	name, err := r.place(parent, item.Name, item.ID, item.IsFolder, "", policy, now)
+	if err != nil {
+		return nil, nil, err
+	}
+	delete(r.trash, id)
+
+	// Path của mọi thứ bên trong được tính lại theo vị trí mới như khi chuyển thư mục
+	from, to := item.Path, parent.ChildPath(name)
+	for _, folder := range item.Folders {
+		folder.Path = to + folder.Path[len(from):]
+		r.folders[folder.ID] = folder
+	}
+	for _, file := range item.Files {
+		if item.IsFolder {
+			file.Folder = to + file.Folder[len(from):]
+		} else {
+			file.FolderID = parent.ID
+			file.Folder = parent.Path
+			file.Name = name
+		}
+		r.versions[file.ID] = file.Versions
+		file.Versions = nil
+		r.files[file.ID] = file
+	}
+
+	if item.IsFolder {
+		folder := item.Folders[0]
+		folder.ParentID = parent.ID
+		folder.Name = name
+		copied := *folder
+		return &copied, nil, nil
+	}
+	copied := *item.Files[0]
+	return nil, &copied, nil
+}
+
+// DeleteTrashItem deletes a trash item for good
+func (r *InMemoryFileRepository) DeleteTrashItem(ctx context.Context, id string) (*models.TrashItem, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	item, ok := r.trash[id]
+	if !ok {
+		return nil, ErrTrashItemNotFound
+	}
+	delete(r.trash, id)
+	r.dropShares(item.Folders, item.Files)
+	return item, nil
+}
+
+// EmptyTrash deletes the trash items of an owner for good
+func (r *InMemoryFileRepository) EmptyTrash(ctx context.Context, ownerID string) ([]*models.TrashItem, error) {
+	return r.deleteTrash(func(item *models.TrashItem) bool {
+		return item.OwnerID == ownerID
+	}), nil
+}
+
+// PurgeTrash deletes the trash items past the retention for good
+func (r *InMemoryFileRepository) PurgeTrash(ctx context.Context, deletedBefore time.Time) ([]*models.TrashItem, error) {
+	return r.deleteTrash(func(item *models.TrashItem) bool {
+		return item.DeletedAt.Before(deletedBefore)
+	}), nil
+}
+
+// trashFile moves a file to the trash at now and returns a copy of its trash
+// item. The caller holds the write lock.
+func (r *InMemoryFileRepository) trashFile(file *models.File, now time.Time) *models.TrashItem {
+	return r.addTrash(&models.TrashItem{
+		ID:        file.ID,
+		OwnerID:   file.OwnerID,
+		Name:      file.Name,
+		ParentID:  file.FolderID,
+		Path:      file.Path(),
+		DeletedAt: now,
+		Files:     []*models.File{r.remove(file)},
+	})
+}
+
+// trashFolder moves a folder with everything below it to the trash at now
+// and returns a copy of its trash item. The caller holds the write lock.
+func (r *InMemoryFileRepository) trashFolder(folder *models.Folder, now time.Time) *models.TrashItem {
+	folders, files := r.removeSubtree(folder)
+	return r.addTrash(&models.TrashItem{
+		ID:        folder.ID,
+		OwnerID:   folder.OwnerID,
+		Name:      folder.Name,
+		IsFolder:  true,
+		ParentID:  folder.ParentID,
+		Path:      folder.Path,
+		DeletedAt: now,
+		Folders:   folders,
+		Files:     files,
+	})
+}
+
+// addTrash stores a new trash item and returns a copy of it. The caller
+// holds the write lock.
+func (r *InMemoryFileRepository) addTrash(item *models.TrashItem) *models.TrashItem {
+	for _, v := range item.Versions() {
+		item.Size += v.Size
+	}
+	r.trash[item.ID] = item
+	copied := *item
+	return &copied
+}
+
+// deleteTrash deletes and returns the trash items matching match
+func (r *InMemoryFileRepository) deleteTrash(match func(*models.TrashItem) bool) []*models.TrashItem {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var deleted []*models.TrashItem
+	for id, item := range r.trash {
+		if match(item) {
+			deleted = append(deleted, item)
+			delete(r.trash, id)
+			r.dropShares(item.Folders, item.Files)
+		}
+	}
+	return deleted
+}
@@ -0,0 +1,216 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/cloud-drive/file-service/internal/models"
+)
+
+// versionNumbers returns the numbers and blob keys of the versions of a file,
+// newest first
+func versionNumbers(t *testing.T, r *InMemoryFileRepository, fileID string) ([]int, []string) {
+	t.Helper()
+	versions, err := r.ListVersions(context.Background(), fileID)
+	if err != nil {
+		t.Fatalf("ListVersions: %v", err)
+	}
+	var numbers []int
+	var keys []string
+	for _, v := range versions {
+		numbers = append(numbers, v.Version)
+		keys = append(keys, v.BlobKey)
+	}
+	return numbers, keys
+}
+
+// assertUsage checks the usage of alice including the trash
+func assertUsage(t *testing.T, r *InMemoryFileRepository, want int64) {
+	t.Helper()
+	usage, err := r.UsageByOwner(context.Background())
+	if err != nil {
+		t.Fatalf("UsageByOwner: %v", err)
+	}
+	if usage["alice"] != want {
+		t.Errorf("usage of alice = %d, want %d", usage["alice"], want)
+	}
+}
+
+func TestOverwriteMovesFileWithVersionsToTrash(t *testing.T) {
+	r := NewInMemoryFileRepository()
+	ctx := context.Background()
+	createFolder(t, r, "alice", "a", models.RootFolderID, "a")
+	createFolder(t, r, "alice", "b", models.RootFolderID, "b")
+	createFile(t, r, "alice", "report", "a", "report.txt", "report-v1", 10, models.ConflictFail, testTime)
+	updated := createFile(t, r, "alice", "ignored", "a", "report.txt", "report-v2", 20, models.ConflictOverwrite, testTime.Add(time.Minute))
+	if updated.ID != "report" || updated.Version != 2 {
+		t.Fatalf("overwritten file = %s version %d, want report version 2", updated.ID, updated.Version)
+	}
+	createFile(t, r, "alice", "other", "b", "report.txt", "other-v1", 5, models.ConflictFail, testTime)
+
+	// Moving other over report takes report with both versions out of the drive
+	deletedAt := testTime.Add(2 * time.Minute)
+	moved, err := r.MoveFile(ctx, "other", "a", "report.txt", models.ConflictOverwrite, deletedAt)
+	if err != nil {
+		t.Fatalf("MoveFile: %v", err)
+	}
+	if moved.Path() != "/a/report.txt" {
+		t.Fatalf("moved file at %s, want /a/report.txt", moved.Path())
+	}
+	if _, err := r.GetByID(ctx, "report"); !errors.Is(err, ErrFileNotFound) {
+		t.Fatalf("GetByID of the replaced file = %v, want ErrFileNotFound", err)
+	}
+	item, err := r.GetTrashItem(ctx, "report")
+	if err != nil {
+		t.Fatalf("GetTrashItem: %v", err)
+	}
+	if item.Path != "/a/report.txt" || item.ParentID != "a" || !item.DeletedAt.Equal(deletedAt) || item.Size != 30 {
+		t.Fatalf("trash item = %+v, want /a/report.txt deleted at %v with 30 bytes", item, deletedAt)
+	}
+	if versions := item.Versions(); len(versions) != 2 {
+		t.Fatalf("trash item holds %d versions, want 2", len(versions))
+	}
+	// The trash keeps its content charged and referenced
+	assertUsage(t, r, 35)
+	refs, err := r.BlobReferences(ctx)
+	if err != nil {
+		t.Fatalf("BlobReferences: %v", err)
+	}
+	for _, key := range []string{"report-v1", "report-v2", "other-v1"} {
+		if refs[key] != 1 {
+			t.Errorf("references to %s = %d, want 1", key, refs[key])
+		}
+	}
+
+	// Restoring over other puts report back with its history and takes
+	// other to the trash in turn
+	_, restored, err := r.RestoreTrashItem(ctx, "report", "", models.ConflictOverwrite, testTime.Add(3*time.Minute))
+	if err != nil {
+		t.Fatalf("RestoreTrashItem: %v", err)
+	}
+	if restored.ID != "report" || restored.Path() != "/a/report.txt" || restored.Version != 2 || restored.BlobKey != "report-v2" {
+		t.Fatalf("restored file = %+v, want report version 2 at /a/report.txt", restored)
+	}
+	numbers, keys := versionNumbers(t, r, "report")
+	if len(numbers) != 2 || numbers[0] != 2 || numbers[1] != 1 || keys[0] != "report-v2" || keys[1] != "report-v1" {
+		t.Fatalf("versions after the restore = %v %v, want 2 and 1", numbers, keys)
+	}
+	if _, err := r.GetTrashItem(ctx, "report"); !errors.Is(err, ErrTrashItemNotFound) {
+		t.Fatalf("GetTrashItem of the restored file = %v, want ErrTrashItemNotFound", err)
+	}
+	if item, err := r.GetTrashItem(ctx, "other"); err != nil || item.Size != 5 {
+		t.Fatalf("GetTrashItem of the file replaced by the restore = %+v, %v, want 5 bytes", item, err)
+	}
+	assertUsage(t, r, 35)
+}
+
+func TestOverwriteMovesFolderToTrash(t *testing.T) {
+	r := NewInMemoryFileRepository()
+	ctx := context.Background()
+	createFolder(t, r, "alice", "a", models.RootFolderID, "a")
+	createFolder(t, r, "alice", "old", "a", "sub")
+	createFolder(t, r, "alice", "deep", "old", "deep")
+	createFile(t, r, "alice", "x", "deep", "x.txt", "x-v1", 1, models.ConflictFail, testTime)
+	createFile(t, r, "alice", "ignored", "deep", "x.txt", "x-v2", 2, models.ConflictOverwrite, testTime)
+	createFolder(t, r, "alice", "new", models.RootFolderID, "sub")
+
+	if _, err := r.MoveFolder(ctx, "new", "a", "sub", models.ConflictOverwrite, testTime); err != nil {
+		t.Fatalf("MoveFolder: %v", err)
+	}
+	item, err := r.GetTrashItem(ctx, "old")
+	if err != nil {
+		t.Fatalf("GetTrashItem: %v", err)
+	}
+	if !item.IsFolder || len(item.Folders) != 2 || len(item.Files) != 1 || item.Size != 3 {
+		t.Fatalf("trash item = %+v, want the folder, its subfolder and x.txt with 3 bytes", item)
+	}
+	if _, err := r.GetFolder(ctx, "deep"); !errors.Is(err, ErrFolderNotFound) {
+		t.Fatalf("GetFolder below the replaced folder = %v, want ErrFolderNotFound", err)
+	}
+
+	// The folder that replaced it keeps the name, so the restore picks another
+	folder, _, err := r.RestoreTrashItem(ctx, "old", "", models.ConflictRename, testTime)
+	if err != nil {
+		t.Fatalf("RestoreTrashItem: %v", err)
+	}
+	if folder.Path != "/a/sub (1)" {
+		t.Fatalf("restored folder at %s, want /a/sub (1)", folder.Path)
+	}
+	x, err := r.GetByID(ctx, "x")
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	if x.Path() != "/a/sub (1)/deep/x.txt" || x.Version != 2 {
+		t.Fatalf("restored file = %s version %d, want /a/sub (1)/deep/x.txt version 2", x.Path(), x.Version)
+	}
+	if numbers, _ := versionNumbers(t, r, "x"); len(numbers) != 2 {
+		t.Fatalf("versions of the restored file = %v, want 2 and 1", numbers)
+	}
+	assertUsage(t, r, 3)
+}
+
+func TestPurgeTrash(t *testing.T) {
+	r := NewInMemoryFileRepository()
+	ctx := context.Background()
+	for _, id := range []string{"day0", "day1", "day2"} {
+		createFile(t, r, "alice", id, models.RootFolderID, id+".txt", id, 10, models.ConflictFail, testTime)
+	}
+	createFile(t, r, "bob", "bob0", models.RootFolderID, "bob0.txt", "bob0", 7, models.ConflictFail, testTime)
+	if err := r.PutShare(ctx, share("s", "day0", false, models.RoleViewer)); err != nil {
+		t.Fatalf("PutShare: %v", err)
+	}
+	for id, deletedAt := range map[string]time.Time{
+		"day0": testTime,
+		"day1": testTime.Add(24 * time.Hour),
+		"day2": testTime.Add(48 * time.Hour),
+		"bob0": testTime,
+	} {
+		if _, err := r.TrashFile(ctx, id, deletedAt); err != nil {
+			t.Fatalf("TrashFile: %v", err)
+		}
+	}
+
+	// Items deleted exactly at the cutoff are kept
+	purged, err := r.PurgeTrash(ctx, testTime.Add(24*time.Hour))
+	if err != nil {
+		t.Fatalf("PurgeTrash: %v", err)
+	}
+	ids := map[string]bool{}
+	for _, item := range purged {
+		ids[item.ID] = true
+		if len(item.Versions()) != 1 {
+			t.Errorf("purged item %s holds %d versions, want 1 to release", item.ID, len(item.Versions()))
+		}
+	}
+	if len(purged) != 2 || !ids["day0"] || !ids["bob0"] {
+		t.Fatalf("purged %v, want day0 of alice and bob0 of bob", ids)
+	}
+	if _, err := r.GetShare(ctx, "s"); !errors.Is(err, ErrShareNotFound) {
+		t.Fatalf("GetShare of a purged file = %v, want ErrShareNotFound", err)
+	}
+	trash, err := r.ListTrash(ctx, "alice", 10, 0)
+	if err != nil {
+		t.Fatalf("ListTrash: %v", err)
+	}
+	if len(trash) != 2 || trash[0].ID != "day2" || trash[1].ID != "day1" {
+		t.Fatalf("trash of alice = %d items, want day2 and day1", len(trash))
+	}
+	assertUsage(t, r, 20)
+	refs, err := r.BlobReferences(ctx)
+	if err != nil {
+		t.Fatalf("BlobReferences: %v", err)
+	}
+	if refs["day0"] != 0 || refs["day1"] != 1 {
+		t.Fatalf("references after the purge = %v, want none to day0", refs)
+	}
+
+	if purged, _ := r.PurgeTrash(ctx, testTime.Add(24*time.Hour)); len(purged) != 0 {
+		t.Fatalf("second purge deleted %d items, want none", len(purged))
+	}
+	if purged, _ := r.PurgeTrash(ctx, testTime.Add(72*time.Hour)); len(purged) != 2 {
+		t.Fatalf("purge past every item deleted %d items, want 2", len(purged))
+	}
+	assertUsage(t, r, 0)
+}
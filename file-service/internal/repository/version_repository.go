@@ -0,0 +1,127 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/cloud-drive/file-service/internal/models"
+)
+
+// ErrVersionNotFound is returned when a file has no version with a number
+var ErrVersionNotFound = errors.New("file version not found")
+
+// VersionRepository defines the interface for the version history of files.
+// Every file has at least one version, its current content; overwriting or
+// restoring adds a version and earlier versions stay until pruned.
+type VersionRepository interface {
+	// ListVersions returns the versions of a file, newest first
+	ListVersions(ctx context.Context, fileID string) ([]*models.FileVersion, error)
+	// GetVersion returns one version of a file, the current one included
+	GetVersion(ctx context.Context, fileID string, version int) (*models.FileVersion, error)
+	// RestoreVersion adds the content of version as the new current version
+	// of a file and returns the file
+	RestoreVersion(ctx context.Context, fileID string, version int, now time.Time) (*models.File, error)
+	// PruneVersions deletes and returns the versions that are not current
+	// and either have keep newer non-current versions (when keep > 0) or
+	// were replaced before replacedBefore (when not zero)
+	PruneVersions(ctx context.Context, keep int, replacedBefore time.Time) ([]*models.FileVersion, error)
+}
+
+// ListVersions returns the versions of a file
+func (r *InMemoryFileRepository) ListVersions(ctx context.Context, fileID string) ([]*models.FileVersion, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if _, ok := r.files[fileID]; !ok {
+		return nil, ErrFileNotFound
+	}
+	stored := r.versions[fileID]
+	versions := make([]*models.FileVersion, 0, len(stored))
+	for i := len(stored) - 1; i >= 0; i-- {
+		copied := *stored[i]
+		versions = append(versions, &copied)
+	}
+	return versions, nil
+}
+
+// GetVersion returns one version of a file
+func (r *InMemoryFileRepository) GetVersion(ctx context.Context, fileID string, version int) (*models.FileVersion, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	v, err := r.version(fileID, version)
+	if err != nil {
+		return nil, err
+	}
+	copied := *v
+	return &copied, nil
+}
+
+// RestoreVersion adds an older content as a new version
+func (r *InMemoryFileRepository) RestoreVersion(ctx context.Context, fileID string, version int, now time.Time) (*models.File, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	v, err := r.version(fileID, version)
+	if err != nil {
+		return nil, err
+	}
+	restored := *v
+	restored.CreatedAt = now
+	restored.ReplacedAt = time.Time{}
+	file := r.files[fileID]
+	r.addVersion(file, &restored, now)
+	copied := *file
+	return &copied, nil
+}
+
+// PruneVersions deletes the versions outside the retention
+func (r *InMemoryFileRepository) PruneVersions(ctx context.Context, keep int, replacedBefore time.Time) ([]*models.FileVersion, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var pruned []*models.FileVersion
+	for fileID, versions := range r.versions {
+		previous, current := versions[:len(versions)-1], versions[len(versions)-1]
+		kept := make([]*models.FileVersion, 0, len(versions))
+		for i, v := range previous {
+			newer := len(previous) - 1 - i
+			if (keep > 0 && newer >= keep) || v.ReplacedAt.Before(replacedBefore) {
+				pruned = append(pruned, v)
+				continue
+			}
+			kept = append(kept, v)
+		}
+		if len(kept) < len(previous) {
+			r.versions[fileID] = append(kept, current)
+		}
+	}
+	return pruned, nil
+}
+
+// version returns a stored version of a file. The caller holds the lock.
+func (r *InMemoryFileRepository) version(fileID string, version int) (*models.FileVersion, error) {
+	if _, ok := r.files[fileID]; !ok {
+		return nil, ErrFileNotFound
+	}
+	for _, v := range r.versions[fileID] {
+		if v.Version == version {
+			return v, nil
+		}
+	}
+	return nil, ErrVersionNotFound
+}
+
+// addVersion makes content the current version of a stored file, numbered
+// after the previous current version, which is marked replaced at now. The
+// caller holds the write lock.
+func (r *InMemoryFileRepository) addVersion(file *models.File, content *models.FileVersion, now time.Time) {
+	versions := r.versions[file.ID]
+	replaced := *versions[len(versions)-1]
+	replaced.ReplacedAt = now
+	versions[len(versions)-1] = &replaced
+
+	content.FileID = file.ID
+	content.OwnerID = file.OwnerID
+	content.Version = file.Version + 1
+	r.versions[file.ID] = append(versions, content)
+	file.SetContent(content)
+	file.UpdatedAt = now
+}
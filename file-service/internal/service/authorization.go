@@ -0,0 +1,49 @@
+package service
+
+import (
+	"github.com/cloud-drive/shared/interceptor"
+)
+
+// AuthorizationRules returns who may call each RPC on behalf of an end user.
+// Every RPC works on the caller's own files, folders, trash and uploads or on
+// entries shared with them, so any signed-in user may call them; the service
+// itself checks the role of the caller on each entry.
+func AuthorizationRules() map[string]interceptor.Rule {
+	return map[string]interceptor.Rule{
+		"/file.FileService/UploadFile":         {},
+		"/file.FileService/DownloadFile":       {},
+		"/file.FileService/UploadFileStream":   {},
+		"/file.FileService/DownloadFileStream": {},
+		"/file.FileService/ListFiles":          {},
+		"/file.FileService/GetFile":            {},
+		"/file.FileService/GetDownloadUrl":     {},
+		"/file.FileService/MoveFile":           {},
+		"/file.FileService/RenameFile":         {},
+		"/file.FileService/CopyFile":           {},
+		"/file.FileService/DeleteFile":         {},
+		"/file.FileService/CreateFolder":       {},
+		"/file.FileService/GetFolder":          {},
+		"/file.FileService/ListChildren":       {},
+		"/file.FileService/MoveFolder":         {},
+		"/file.FileService/RenameFolder":       {},
+		"/file.FileService/CopyFolder":         {},
+		"/file.FileService/DeleteFolder":       {},
+		"/file.FileService/ListFileVersions":   {},
+		"/file.FileService/GetFileVersion":     {},
+		"/file.FileService/RestoreFileVersion": {},
+		"/file.FileService/ListTrash":          {},
+		"/file.FileService/RestoreTrashItem":   {},
+		"/file.FileService/DeleteTrashItem":    {},
+		"/file.FileService/EmptyTrash":         {},
+		"/file.FileService/CreateShare":        {},
+		"/file.FileService/ListShares":         {},
+		"/file.FileService/UpdateShare":        {},
+		"/file.FileService/DeleteShare":        {},
+		"/file.FileService/ListSharedWithMe":   {},
+		"/file.FileService/ResolvePath":        {},
+		"/file.FileService/CreateUpload":       {},
+		"/file.FileService/GetUpload":          {},
+		"/file.FileService/AppendUpload":       {},
+		"/file.FileService/DeleteUpload":       {},
+	}
+}
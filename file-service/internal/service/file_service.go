@@ -0,0 +1,675 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/cloud-drive/file-service/internal/directory"
+	"github.com/cloud-drive/file-service/internal/metrics"
+	"github.com/cloud-drive/file-service/internal/models"
+	"github.com/cloud-drive/file-service/internal/quota"
+	"github.com/cloud-drive/file-service/internal/repository"
+	"github.com/cloud-drive/file-service/internal/storage"
+	"github.com/cloud-drive/file-service/internal/uploads"
+	"github.com/cloud-drive/proto-definitions/file"
+	"github.com/cloud-drive/shared/identity"
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// errOtherDrive rejects moving an entry to a folder of another owner, which
+// only a copy can do
+var errOtherDrive = status.Error(codes.FailedPrecondition, "entries can only be moved within the drive of their owner")
+
+const (
+	// defaultListLimit is the page size of ListFiles when none is given
+	defaultListLimit = 100
+	// sniffLen is how much content http.DetectContentType looks at
+	sniffLen = 512
+	// MaxMessageContent caps the content carried in one message. Files up to
+	// this size fit in UploadFile and DownloadFile; larger files need the
+	// streaming RPCs.
+	MaxMessageContent = 64 << 20
+)
+
+// FileService implements the gRPC FileService
+type FileService struct {
+	file.UnimplementedFileServiceServer
+	repo           repository.FileRepository
+	blobs          *storage.ContentStore
+	uploads        *uploads.Store
+	quota          *quota.Quota
+	directory      *directory.Directory
+	metrics        *metrics.Metrics
+	maxFileSize    int64
+	uploadExpiry   time.Duration
+	presignExpiry  time.Duration
+	trashRetention time.Duration
+
+	// quotaMu is held for reading from a quota reservation or release until
+	// the matching metadata change is made, and for writing while usage is
+	// reconciled, so reconciliation never sees one without the other
+	quotaMu sync.RWMutex
+	// reserved holds the bytes reserved per owner for content still being
+	// received, which reconciliation counts as used
+	reservedMu sync.Mutex
+	reserved   map[string]int64
+}
+
+// NewFileService creates a new FileService accepting files up to maxFileSize
+// bytes and charging them to the quota of their owner, who shares them with
+// users found in dir. Resumable uploads are kept in uploadStore for
+// uploadExpiry, download URLs are valid for presignExpiry and deleted entries
+// stay in the trash for trashRetention (0 keeps them until the trash is
+// emptied).
+func NewFileService(repo repository.FileRepository, blobs *storage.ContentStore, uploadStore *uploads.Store, q *quota.Quota, dir *directory.Directory, m *metrics.Metrics, maxFileSize int64, uploadExpiry, presignExpiry, trashRetention time.Duration) *FileService {
+	return &FileService{
+		repo:           repo,
+		blobs:          blobs,
+		uploads:        uploadStore,
+		quota:          q,
+		directory:      dir,
+		metrics:        m,
+		maxFileSize:    maxFileSize,
+		uploadExpiry:   uploadExpiry,
+		presignExpiry:  presignExpiry,
+		trashRetention: trashRetention,
+		reserved:       make(map[string]int64),
+	}
+}
+
+// UploadFile lưu file mới vào thư mục của người dùng, chọn theo folder_id hoặc
+// theo path. Kích thước file được trừ vào hạn mức lưu trữ trước, rồi nội
+// dung được ghi vào blob store, metadata sau cùng; nếu vượt hạn mức thì không
+// có gì được ghi, nếu tên đã tồn tại và on_conflict là "fail" thì hạn mức được
+// trả lại và tham chiếu tới blob được bỏ. Với "overwrite", file đang có giữ
+// nguyên ID và nhận nội dung mới thành một phiên bản mới. File tải vào thư mục
+// được chia sẻ thuộc về và được tính vào hạn mức của chủ thư mục.
+func (s *FileService) UploadFile(ctx context.Context, req *file.UploadFileRequest) (*file.FileResponse, error) {
+	owner, err := ownerFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(req.Content)) > s.maxFileSize {
+		return nil, status.Errorf(codes.InvalidArgument, "file is larger than %d bytes", s.maxFileSize)
+	}
+	folder, err := s.targetFolder(ctx, owner, req.FolderId, req.Folder)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	fileModel := &models.File{
+		ID:          uuid.New().String(),
+		OwnerID:     folder.OwnerID,
+		FolderID:    folder.ID,
+		Name:        req.Name,
+		ContentType: req.ContentType,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	r, err := s.reserve(ctx, folder.OwnerID, int64(len(req.Content)))
+	if err != nil {
+		return nil, err
+	}
+	if err := s.storeFile(ctx, fileModel, bytes.NewReader(req.Content), parseConflict(req.OnConflict), r); err != nil {
+		s.cancelReservation(ctx, r)
+		return nil, err
+	}
+	s.metrics.TransferredBytes.WithLabelValues("upload").Add(float64(fileModel.Size))
+
+	return &file.FileResponse{
+		File: convertFileToProto(fileModel),
+	}, nil
+}
+
+// DownloadFile trả về metadata và nội dung của file, hoặc của một phiên bản
+// cũ khi có version
+func (s *FileService) DownloadFile(ctx context.Context, req *file.DownloadFileRequest) (*file.DownloadFileResponse, error) {
+	fileModel, err := s.fileAtVersion(ctx, req.Id, req.Version)
+	if err != nil {
+		return nil, err
+	}
+	if fileModel.Size > MaxMessageContent {
+		return nil, status.Errorf(codes.FailedPrecondition, "file is larger than %d bytes, use DownloadFileStream", MaxMessageContent)
+	}
+
+	blob, err := s.blobs.Open(ctx, fileModel.BlobKey)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to open file content: %v", err)
+	}
+	defer blob.Close()
+	content, err := io.ReadAll(blob)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to read file content: %v", err)
+	}
+	s.metrics.TransferredBytes.WithLabelValues("download").Add(float64(len(content)))
+
+	return &file.DownloadFileResponse{
+		File:    convertFileToProto(fileModel),
+		Content: content,
+	}, nil
+}
+
+// ListFiles liệt kê các file nằm trực tiếp trong một thư mục
+func (s *FileService) ListFiles(ctx context.Context, req *file.ListFilesRequest) (*file.ListFilesResponse, error) {
+	owner, err := ownerFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	limit := int(req.Limit)
+	if limit == 0 {
+		limit = defaultListLimit
+	}
+	files, err := s.repo.List(ctx, owner, cleanFolder(req.Folder), limit, int(req.Offset))
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to list files: %v", err)
+	}
+
+	protoFiles := make([]*file.File, 0, len(files))
+	for _, f := range files {
+		protoFiles = append(protoFiles, convertFileToProto(f))
+	}
+
+	return &file.ListFilesResponse{
+		Files: protoFiles,
+	}, nil
+}
+
+// GetFile trả về metadata của file
+func (s *FileService) GetFile(ctx context.Context, req *file.GetFileRequest) (*file.FileResponse, error) {
+	fileModel, err := s.accessibleFile(ctx, req.Id, models.RoleViewer)
+	if err != nil {
+		return nil, err
+	}
+
+	return &file.FileResponse{
+		File: convertFileToProto(fileModel),
+	}, nil
+}
+
+// GetDownloadUrl trả về URL tải nội dung file thẳng từ object storage, hết hạn
+// sau presignExpiry. Backend không ký được URL (local disk) trả Unimplemented,
+// client dùng /api/files/{id}/content thay thế.
+func (s *FileService) GetDownloadUrl(ctx context.Context, req *file.GetDownloadUrlRequest) (*file.DownloadUrlResponse, error) {
+	fileModel, err := s.accessibleFile(ctx, req.Id, models.RoleViewer)
+	if err != nil {
+		return nil, err
+	}
+
+	expiresAt := time.Now().Add(s.presignExpiry)
+	url, err := s.blobs.PresignGet(ctx, fileModel.BlobKey, s.presignExpiry, fileModel.Name)
+	if errors.Is(err, storage.ErrPresignUnsupported) {
+		return nil, status.Error(codes.Unimplemented, "download URLs are not supported by the storage backend")
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to create download URL: %v", err)
+	}
+
+	return &file.DownloadUrlResponse{
+		Url:       url,
+		ExpiresAt: expiresAt.Format(time.RFC3339),
+	}, nil
+}
+
+// MoveFile chuyển file sang thư mục khác trong cùng ổ đĩa, giữ nguyên tên;
+// người được chia sẻ cần quyền editor trên cả file và thư mục đích
+func (s *FileService) MoveFile(ctx context.Context, req *file.MoveFileRequest) (*file.FileResponse, error) {
+	fileModel, err := s.accessibleFile(ctx, req.Id, models.RoleEditor)
+	if err != nil {
+		return nil, err
+	}
+	folder, err := s.targetFolder(ctx, fileModel.OwnerID, req.FolderId, req.Folder)
+	if err != nil {
+		return nil, err
+	}
+	if folder.OwnerID != fileModel.OwnerID {
+		return nil, errOtherDrive
+	}
+
+	return s.moveFile(ctx, fileModel.ID, folder.ID, fileModel.Name, req.OnConflict)
+}
+
+// RenameFile đổi tên file trong thư mục hiện tại
+func (s *FileService) RenameFile(ctx context.Context, req *file.RenameFileRequest) (*file.FileResponse, error) {
+	fileModel, err := s.accessibleFile(ctx, req.Id, models.RoleEditor)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.moveFile(ctx, fileModel.ID, fileModel.FolderID, req.Name, req.OnConflict)
+}
+
+// CopyFile sao chép phiên bản hiện tại của file sang thư mục đích, mặc định là
+// thư mục hiện tại. Bản sao dùng chung blob với file gốc, chỉ thêm một tham
+// chiếu, nên xoá bản này không ảnh hưởng bản kia; hạn mức lưu trữ vẫn tính đủ
+// kích thước bản sao. Ghi đè một file thêm bản sao thành phiên bản mới của nó.
+// Bản sao thuộc về chủ thư mục đích; bản sao của file được chia sẻ mặc định
+// nằm ở thư mục gốc của người gọi.
+func (s *FileService) CopyFile(ctx context.Context, req *file.CopyFileRequest) (*file.FileResponse, error) {
+	source, err := s.accessibleFile(ctx, req.Id, models.RoleViewer)
+	if err != nil {
+		return nil, err
+	}
+	folderID, err := copyTarget(ctx, source.OwnerID, source.FolderID, req.FolderId)
+	if err != nil {
+		return nil, err
+	}
+	folder, err := s.accessibleFolder(ctx, folderID, models.RoleEditor)
+	if err != nil {
+		return nil, err
+	}
+	s.quotaMu.RLock()
+	defer s.quotaMu.RUnlock()
+
+	now := time.Now()
+	copied := *source
+	copied.ID = uuid.New().String()
+	copied.OwnerID = folder.OwnerID
+	copied.FolderID = folder.ID
+	copied.CreatedAt = now
+	copied.UpdatedAt = now
+	if req.Name != "" {
+		copied.Name = req.Name
+	}
+
+	if err := s.quota.Reserve(ctx, copied.OwnerID, copied.Size); err != nil {
+		return nil, err
+	}
+	if err := s.blobs.Retain(ctx, copied.BlobKey); err != nil {
+		s.quota.Release(ctx, copied.OwnerID, copied.Size)
+		return nil, status.Errorf(codes.Internal, "failed to copy file content: %v", err)
+	}
+	if err := s.repo.Create(ctx, &copied, parseConflict(req.OnConflict)); err != nil {
+		s.quota.Release(ctx, copied.OwnerID, copied.Size)
+		s.releaseBlob(ctx, copied.BlobKey)
+		return nil, entryError(err, "copy file")
+	}
+	if copied.Version > 1 {
+		s.metrics.VersionsCreated.Inc()
+	}
+
+	return &file.FileResponse{
+		File: convertFileToProto(&copied),
+	}, nil
+}
+
+// DeleteFile chuyển file cùng mọi phiên bản vào thùng rác. Nội dung và dung
+// lượng chỉ được trả lại khi file bị xoá hẳn khỏi thùng rác. File được chia
+// sẻ do editor xoá vào thùng rác của chủ sở hữu.
+func (s *FileService) DeleteFile(ctx context.Context, req *file.DeleteFileRequest) (*file.DeleteFileResponse, error) {
+	fileModel, err := s.accessibleFile(ctx, req.Id, models.RoleEditor)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.repo.TrashFile(ctx, fileModel.ID, time.Now()); err != nil {
+		return nil, entryError(err, "delete file")
+	}
+
+	return &file.DeleteFileResponse{
+		Success: true,
+	}, nil
+}
+
+// storeFile writes content to the blob store and then the metadata of the
+// file, which takes over r
+func (s *FileService) storeFile(ctx context.Context, fileModel *models.File, content io.Reader, policy models.ConflictPolicy, r reservation) error {
+	if err := s.putContent(ctx, fileModel, content, ""); err != nil {
+		return err
+	}
+	return s.createFile(ctx, fileModel, policy, r)
+}
+
+// putContent writes content to the blob store, which keys it by its SHA-256,
+// so the blob key is also the checksum of the file. digest is the SHA-256 of
+// content when it was computed while receiving it, or "" to hash it while
+// storing. A missing content type is sniffed from the content. Errors of the
+// content reader that carry a gRPC status are returned as is.
+func (s *FileService) putContent(ctx context.Context, fileModel *models.File, content io.Reader, digest string) error {
+	reader := bufio.NewReaderSize(content, sniffLen)
+	if fileModel.ContentType == "" {
+		head, _ := reader.Peek(sniffLen)
+		fileModel.ContentType = http.DetectContentType(head)
+	}
+
+	var blob storage.Blob
+	var err error
+	if digest != "" {
+		blob, err = s.blobs.PutHashed(ctx, digest, reader)
+	} else {
+		blob, err = s.blobs.Put(ctx, reader)
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			return status.FromContextError(ctx.Err()).Err()
+		}
+		if _, ok := status.FromError(err); ok {
+			return err
+		}
+		return status.Errorf(codes.Internal, "failed to store file content: %v", err)
+	}
+	fileModel.BlobKey = blob.Key
+	fileModel.Size = blob.Size
+	fileModel.Checksum = blob.Key
+	return nil
+}
+
+// createFile charges the size of a file whose content is already stored to
+// the quota of its owner and stores its metadata, as a new version when it
+// overwrites a file; if either fails the reference to the blob is released.
+// r, reserved before the content was received, is taken over by the file
+// when it matches its owner and size, and given back otherwise; on failure
+// the caller keeps it. Earlier versions stay charged until the retention
+// prunes them.
+func (s *FileService) createFile(ctx context.Context, fileModel *models.File, policy models.ConflictPolicy, r reservation) error {
+	s.quotaMu.RLock()
+	defer s.quotaMu.RUnlock()
+	charged := r.owner == fileModel.OwnerID && r.bytes == fileModel.Size
+	if !charged {
+		if err := s.quota.Reserve(ctx, fileModel.OwnerID, fileModel.Size); err != nil {
+			s.releaseBlob(ctx, fileModel.BlobKey)
+			return err
+		}
+	}
+	if err := s.repo.Create(ctx, fileModel, policy); err != nil {
+		if !charged {
+			s.quota.Release(ctx, fileModel.OwnerID, fileModel.Size)
+		}
+		s.releaseBlob(ctx, fileModel.BlobKey)
+		return entryError(err, "create file")
+	}
+	s.untrack(r)
+	if !charged {
+		s.quota.Release(ctx, r.owner, r.bytes)
+	}
+	if fileModel.Version > 1 {
+		s.metrics.VersionsCreated.Inc()
+	}
+	return nil
+}
+
+// moveFile places a file in folderID under name
+func (s *FileService) moveFile(ctx context.Context, id, folderID, name, onConflict string) (*file.FileResponse, error) {
+	fileModel, err := s.repo.MoveFile(ctx, id, folderID, name, parseConflict(onConflict), time.Now())
+	if err != nil {
+		return nil, entryError(err, "move file")
+	}
+
+	return &file.FileResponse{
+		File: convertFileToProto(fileModel),
+	}, nil
+}
+
+// accessibleFile returns a file the calling user has at least role on, as
+// its owner or through a share. Files they have no access to are reported as
+// not found so their IDs are not revealed.
+func (s *FileService) accessibleFile(ctx context.Context, id string, role models.Role) (*models.File, error) {
+	fileModel, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, repository.ErrFileNotFound) {
+			return nil, status.Errorf(codes.NotFound, "file not found")
+		}
+		return nil, status.Errorf(codes.Internal, "failed to get file: %v", err)
+	}
+	if err := s.authorize(ctx, fileModel.OwnerID, fileModel.ID, fileModel.Path(), role, "file"); err != nil {
+		return nil, err
+	}
+	return fileModel, nil
+}
+
+// targetFolder returns the folder an entry is placed in, by ID when folderID
+// is set and by path in the drive of owner otherwise. The caller needs editor
+// access to it.
+func (s *FileService) targetFolder(ctx context.Context, owner, folderID, folderPath string) (*models.Folder, error) {
+	if folderID != "" {
+		return s.accessibleFolder(ctx, folderID, models.RoleEditor)
+	}
+	folder, _, err := s.repo.ResolvePath(ctx, owner, cleanFolder(folderPath))
+	if err != nil {
+		if errors.Is(err, repository.ErrPathNotFound) {
+			return nil, status.Errorf(codes.NotFound, "folder %s not found", cleanFolder(folderPath))
+		}
+		return nil, status.Errorf(codes.Internal, "failed to resolve folder: %v", err)
+	}
+	if folder == nil {
+		return nil, status.Errorf(codes.NotFound, "folder %s not found", cleanFolder(folderPath))
+	}
+	if err := s.authorize(ctx, folder.OwnerID, folder.ID, folder.Path, models.RoleEditor, "folder"); err != nil {
+		return nil, err
+	}
+	return folder, nil
+}
+
+// copyTarget returns the ID of the folder a copy is placed in: folderID when
+// set, otherwise the folder of the source when the caller owns it and their
+// root folder when it is shared with them
+func copyTarget(ctx context.Context, sourceOwner, sourceFolderID, folderID string) (string, error) {
+	if folderID != "" {
+		return folderID, nil
+	}
+	owner, err := ownerFromContext(ctx)
+	if err != nil {
+		return "", err
+	}
+	if sourceOwner != owner {
+		return models.RootFolderID, nil
+	}
+	return sourceFolderID, nil
+}
+
+// ReconcileQuota sends user-service the usage computed from the stored
+// files and the reservations for content still being received, correcting
+// drift left by releases that failed, and returns the number of users
+// corrected. Changes to files wait until it is done.
+func (s *FileService) ReconcileQuota(ctx context.Context) (int, error) {
+	if !s.quota.Enabled() {
+		return 0, nil
+	}
+	s.quotaMu.Lock()
+	defer s.quotaMu.Unlock()
+	usage, err := s.repo.UsageByOwner(ctx)
+	if err != nil {
+		return 0, err
+	}
+	s.reservedMu.Lock()
+	for owner, bytes := range s.reserved {
+		usage[owner] += bytes
+	}
+	s.reservedMu.Unlock()
+	return s.quota.Reconcile(ctx, usage)
+}
+
+// RestoreReservations tracks the quota reserved by the resumable uploads of
+// an earlier run again, so reconciliation keeps it charged while they can
+// still complete. It returns the number of uploads holding a reservation.
+func (s *FileService) RestoreReservations(ctx context.Context) (int, error) {
+	pending, err := s.uploads.Pending(ctx)
+	if err != nil {
+		return 0, err
+	}
+	restored := 0
+	for _, upload := range pending {
+		if r := uploadReservation(upload); r.bytes > 0 {
+			s.track(r)
+			restored++
+		}
+	}
+	return restored, nil
+}
+
+// reservation is quota charged to owner before the content it is for was
+// received. The zero reservation holds nothing.
+type reservation struct {
+	owner string
+	bytes int64
+}
+
+// reserve charges bytes of content still to be received to the quota of
+// owner, so a transfer that cannot fit fails before anything is stored. The
+// reservation is taken over by createFile or given back with
+// cancelReservation.
+func (s *FileService) reserve(ctx context.Context, owner string, bytes int64) (reservation, error) {
+	if !s.quota.Enabled() || bytes == 0 {
+		return reservation{}, nil
+	}
+	s.quotaMu.RLock()
+	defer s.quotaMu.RUnlock()
+	if err := s.quota.Reserve(ctx, owner, bytes); err != nil {
+		return reservation{}, err
+	}
+	r := reservation{owner: owner, bytes: bytes}
+	s.track(r)
+	return r, nil
+}
+
+// cancelReservation gives back a reservation no file was created for
+func (s *FileService) cancelReservation(ctx context.Context, r reservation) {
+	if r.bytes == 0 {
+		return
+	}
+	s.quotaMu.RLock()
+	defer s.quotaMu.RUnlock()
+	s.untrack(r)
+	s.quota.Release(ctx, r.owner, r.bytes)
+}
+
+// track counts a reservation as used until untrack
+func (s *FileService) track(r reservation) {
+	if r.bytes == 0 {
+		return
+	}
+	s.reservedMu.Lock()
+	defer s.reservedMu.Unlock()
+	s.reserved[r.owner] += r.bytes
+}
+
+// untrack stops counting a reservation. An upload whose commit was not
+// recorded may give back a reservation its file already took over, so the
+// count never goes below zero.
+func (s *FileService) untrack(r reservation) {
+	if r.bytes == 0 {
+		return
+	}
+	s.reservedMu.Lock()
+	defer s.reservedMu.Unlock()
+	if s.reserved[r.owner] <= r.bytes {
+		delete(s.reserved, r.owner)
+		return
+	}
+	s.reserved[r.owner] -= r.bytes
+}
+
+// ReconcileBlobs sets the reference counts of the content store to the
+// number of file versions referring to each blob, so content no file refers
+// to any more, such as the content of files lost with the metadata of an
+// earlier run, is collected after the grace period. It returns the number of
+// blobs corrected; changes to files wait until it is done.
+func (s *FileService) ReconcileBlobs(ctx context.Context) (int, error) {
+	s.quotaMu.Lock()
+	defer s.quotaMu.Unlock()
+	refs, err := s.repo.BlobReferences(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return s.blobs.Reconcile(ctx, refs)
+}
+
+// releaseVersions drops the blob references of versions deleted in the
+// repository and gives their size back to the quota of their owners. The
+// caller holds quotaMu for reading.
+func (s *FileService) releaseVersions(ctx context.Context, versions []*models.FileVersion) {
+	released := make(map[string]int64)
+	for _, v := range versions {
+		s.releaseBlob(ctx, v.BlobKey)
+		released[v.OwnerID] += v.Size
+	}
+	for owner, bytes := range released {
+		s.quota.Release(ctx, owner, bytes)
+	}
+}
+
+// releaseBlob drops the reference of a file that no longer exists; the blob
+// store collects content without references later. A failure only keeps the
+// blob stored, so it is logged rather than returned.
+func (s *FileService) releaseBlob(ctx context.Context, key string) {
+	if err := s.blobs.Release(ctx, key); err != nil && !errors.Is(err, storage.ErrBlobNotFound) {
+		slog.WarnContext(ctx, "Failed to release blob", "key", key, "error", err)
+	}
+}
+
+// ownerFromContext returns the user the call is made for
+func ownerFromContext(ctx context.Context) (string, error) {
+	caller, ok := identity.FromContext(ctx)
+	if !ok {
+		return "", status.Errorf(codes.Unauthenticated, "user identity required")
+	}
+	return caller.UserID, nil
+}
+
+// parseConflict returns the conflict policy of a request validated by
+// Validators; empty means fail
+func parseConflict(onConflict string) models.ConflictPolicy {
+	if onConflict == "" {
+		return models.ConflictFail
+	}
+	return models.ConflictPolicy(onConflict)
+}
+
+// entryError converts a repository error of an operation on a file or folder
+// to a gRPC status
+func entryError(err error, operation string) error {
+	switch {
+	case errors.Is(err, repository.ErrFileNotFound):
+		return status.Errorf(codes.NotFound, "file not found")
+	case errors.Is(err, repository.ErrVersionNotFound):
+		return status.Errorf(codes.NotFound, "file version not found")
+	case errors.Is(err, repository.ErrFolderNotFound):
+		return status.Errorf(codes.NotFound, "folder not found")
+	case errors.Is(err, repository.ErrPathNotFound):
+		return status.Errorf(codes.NotFound, "path not found")
+	case errors.Is(err, repository.ErrTrashItemNotFound):
+		return status.Errorf(codes.NotFound, "trash item not found")
+	case errors.Is(err, repository.ErrShareNotFound):
+		return status.Errorf(codes.NotFound, "share not found")
+	case errors.Is(err, repository.ErrNameExists):
+		return status.Errorf(codes.AlreadyExists, "an entry with the same name already exists in the target folder")
+	case errors.Is(err, repository.ErrInvalidMove):
+		return status.Errorf(codes.FailedPrecondition, "%v", err)
+	}
+	return status.Errorf(codes.Internal, "failed to %s: %v", operation, err)
+}
+
+// cleanFolder normalises a folder path validated by Validators; empty means the root
+func cleanFolder(folder string) string {
+	if folder == "" {
+		return "/"
+	}
+	return path.Clean(folder)
+}
+
+// convertFileToProto converts a file model to a proto file
+func convertFileToProto(f *models.File) *file.File {
+	return &file.File{
+		Id:          f.ID,
+		OwnerId:     f.OwnerID,
+		FolderId:    f.FolderID,
+		Name:        f.Name,
+		Folder:      f.Folder,
+		Size:        f.Size,
+		ContentType: f.ContentType,
+		Checksum:    f.Checksum,
+		CreatedAt:   f.CreatedAt.Format(time.RFC3339),
+		UpdatedAt:   f.UpdatedAt.Format(time.RFC3339),
+		Version:     int32(f.Version),
+	}
+}
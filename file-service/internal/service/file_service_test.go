@@ -0,0 +1,137 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/cloud-drive/proto-definitions/file"
+	"google.golang.org/grpc/codes"
+)
+
+// createTestFolder creates a folder named name in the root folder of the
+// caller and returns its ID
+func createTestFolder(t *testing.T, s *FileService, ctx context.Context, name string) string {
+	t.Helper()
+	resp, err := s.CreateFolder(ctx, &file.CreateFolderRequest{Name: name})
+	if err != nil {
+		t.Fatalf("CreateFolder: %v", err)
+	}
+	return resp.Folder.Id
+}
+
+// assertReserved checks the quota the service holds for content still being
+// received
+func assertReserved(t *testing.T, s *FileService, want map[string]int64) {
+	t.Helper()
+	s.reservedMu.Lock()
+	defer s.reservedMu.Unlock()
+	if len(s.reserved) != len(want) {
+		t.Fatalf("reserved = %v, want %v", s.reserved, want)
+	}
+	for owner, bytes := range want {
+		if s.reserved[owner] != bytes {
+			t.Fatalf("reserved = %v, want %v", s.reserved, want)
+		}
+	}
+}
+
+func TestFailedUploadCancelsReservation(t *testing.T) {
+	users := newFakeUsers()
+	s := newQuotaTestService(t, users)
+	alice := as("alice")
+	folderID := createTestFolder(t, s, alice, "a")
+	upload(t, s, alice, folderID, "report.txt", '1', 10, "")
+
+	// The name is taken, which is found only after the content is reserved
+	_, err := s.UploadFile(alice, &file.UploadFileRequest{
+		FolderId: folderID,
+		Name:     "report.txt",
+		Content:  bytes.Repeat([]byte{'2'}, 20),
+	})
+	assertCode(t, "upload over an existing name", err, codes.AlreadyExists)
+	assertQuota(t, users, "the failed upload", 10, 20)
+	assertReserved(t, s, nil)
+
+	// Content over the quota is refused before anything is reserved
+	users.setLimit("alice", 15)
+	_, err = s.UploadFile(alice, &file.UploadFileRequest{
+		FolderId: folderID,
+		Name:     "big.txt",
+		Content:  bytes.Repeat([]byte{'3'}, 10),
+	})
+	assertCode(t, "upload over the quota", err, codes.ResourceExhausted)
+	assertQuota(t, users, "the refused upload", 10, 20)
+	assertReserved(t, s, nil)
+}
+
+func TestCopyOverQuotaStoresNothing(t *testing.T) {
+	users := newFakeUsers()
+	s := newQuotaTestService(t, users)
+	alice := as("alice")
+	folderID := createTestFolder(t, s, alice, "a")
+	source := upload(t, s, alice, folderID, "report.txt", '1', 10, "")
+	users.setLimit("alice", 25)
+
+	if _, err := s.CopyFile(alice, &file.CopyFileRequest{Id: source.Id, Name: "copy.txt"}); err != nil {
+		t.Fatalf("CopyFile within the quota: %v", err)
+	}
+	assertQuota(t, users, "the copy", 20, 0)
+	_, err := s.CopyFile(alice, &file.CopyFileRequest{Id: source.Id, Name: "copy2.txt"})
+	assertCode(t, "copy over the quota", err, codes.ResourceExhausted)
+	assertQuota(t, users, "the refused copy", 20, 0)
+
+	files, err := s.ListFiles(alice, &file.ListFilesRequest{Folder: "/a"})
+	if err != nil {
+		t.Fatalf("ListFiles: %v", err)
+	}
+	if len(files.Files) != 2 {
+		t.Fatalf("folder holds %d files after the refused copy, want 2", len(files.Files))
+	}
+	stored, err := s.repo.GetByID(context.Background(), source.Id)
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	refs, err := s.repo.BlobReferences(context.Background())
+	if err != nil {
+		t.Fatalf("BlobReferences: %v", err)
+	}
+	if refs[stored.BlobKey] != 2 {
+		t.Fatalf("references to the content = %d, want 2", refs[stored.BlobKey])
+	}
+}
+
+func TestReconcileQuotaCountsReservations(t *testing.T) {
+	users := newFakeUsers()
+	s := newQuotaTestService(t, users)
+	alice := as("alice")
+	folderID := createTestFolder(t, s, alice, "a")
+	stored := upload(t, s, alice, folderID, "report.txt", '1', 10, "")
+	if _, err := s.DeleteFile(alice, &file.DeleteFileRequest{Id: stored.Id}); err != nil {
+		t.Fatalf("DeleteFile: %v", err)
+	}
+	resp, err := s.CreateUpload(alice, &file.CreateUploadRequest{FolderId: folderID, Name: "big.bin", Length: 40})
+	if err != nil {
+		t.Fatalf("CreateUpload: %v", err)
+	}
+	assertReserved(t, s, map[string]int64{"alice": 40})
+
+	// The trash and the unfinished upload both stay charged
+	if _, err := s.ReconcileQuota(context.Background()); err != nil {
+		t.Fatalf("ReconcileQuota: %v", err)
+	}
+	if got := users.reconciledUsage("alice"); got != 50 {
+		t.Fatalf("reconciled usage = %d, want 50", got)
+	}
+
+	if _, err := s.DeleteUpload(alice, &file.DeleteUploadRequest{Id: resp.Upload.Id}); err != nil {
+		t.Fatalf("DeleteUpload: %v", err)
+	}
+	assertReserved(t, s, nil)
+	if _, err := s.ReconcileQuota(context.Background()); err != nil {
+		t.Fatalf("ReconcileQuota: %v", err)
+	}
+	if got := users.reconciledUsage("alice"); got != 10 {
+		t.Fatalf("reconciled usage after the upload was deleted = %d, want 10", got)
+	}
+}
@@ -0,0 +1,302 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/cloud-drive/file-service/internal/models"
+	"github.com/cloud-drive/file-service/internal/repository"
+	"github.com/cloud-drive/proto-definitions/file"
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// maxCopyEntries caps the folders and files one CopyFolder call copies, so a
+// single request cannot duplicate a whole drive
+const maxCopyEntries = 10000
+
+// CreateFolder tạo thư mục mới, mặc định nằm ngay dưới thư mục gốc. Thư mục
+// tạo trong thư mục được chia sẻ thuộc về chủ thư mục cha.
+func (s *FileService) CreateFolder(ctx context.Context, req *file.CreateFolderRequest) (*file.FolderResponse, error) {
+	parentID := req.ParentId
+	if parentID == "" {
+		parentID = models.RootFolderID
+	}
+	parent, err := s.accessibleFolder(ctx, parentID, models.RoleEditor)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	folder := &models.Folder{
+		ID:        uuid.New().String(),
+		OwnerID:   parent.OwnerID,
+		ParentID:  parent.ID,
+		Name:      req.Name,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := s.repo.CreateFolder(ctx, folder, parseConflict(req.OnConflict)); err != nil {
+		return nil, entryError(err, "create folder")
+	}
+
+	return &file.FolderResponse{
+		Folder: convertFolderToProto(folder),
+	}, nil
+}
+
+// GetFolder trả về thư mục, kể cả thư mục gốc "root"
+func (s *FileService) GetFolder(ctx context.Context, req *file.GetFolderRequest) (*file.FolderResponse, error) {
+	folder, err := s.accessibleFolder(ctx, req.Id, models.RoleViewer)
+	if err != nil {
+		return nil, err
+	}
+
+	return &file.FolderResponse{
+		Folder: convertFolderToProto(folder),
+	}, nil
+}
+
+// ListChildren liệt kê thư mục con rồi đến file nằm trực tiếp trong thư mục
+func (s *FileService) ListChildren(ctx context.Context, req *file.ListChildrenRequest) (*file.ListChildrenResponse, error) {
+	folder, err := s.accessibleFolder(ctx, req.Id, models.RoleViewer)
+	if err != nil {
+		return nil, err
+	}
+
+	limit := int(req.Limit)
+	if limit == 0 {
+		limit = defaultListLimit
+	}
+	folders, files, err := s.repo.ListChildren(ctx, folder.OwnerID, folder.ID, limit, int(req.Offset))
+	if err != nil {
+		return nil, entryError(err, "list folder")
+	}
+
+	resp := &file.ListChildrenResponse{
+		Folder:  convertFolderToProto(folder),
+		Folders: make([]*file.Folder, 0, len(folders)),
+		Files:   make([]*file.File, 0, len(files)),
+	}
+	for _, f := range folders {
+		resp.Folders = append(resp.Folders, convertFolderToProto(f))
+	}
+	for _, f := range files {
+		resp.Files = append(resp.Files, convertFileToProto(f))
+	}
+	return resp, nil
+}
+
+// MoveFolder chuyển thư mục cùng toàn bộ nội dung sang thư mục cha khác trong
+// cùng ổ đĩa; người được chia sẻ cần quyền editor trên cả hai thư mục
+func (s *FileService) MoveFolder(ctx context.Context, req *file.MoveFolderRequest) (*file.FolderResponse, error) {
+	folder, err := s.accessibleFolder(ctx, req.Id, models.RoleEditor)
+	if err != nil {
+		return nil, err
+	}
+	parent, err := s.accessibleFolder(ctx, req.ParentId, models.RoleEditor)
+	if err != nil {
+		return nil, err
+	}
+	if parent.OwnerID != folder.OwnerID {
+		return nil, errOtherDrive
+	}
+
+	return s.moveFolder(ctx, folder.ID, parent.ID, folder.Name, req.OnConflict)
+}
+
+// RenameFolder đổi tên thư mục; path của mọi thứ bên trong được cập nhật theo
+func (s *FileService) RenameFolder(ctx context.Context, req *file.RenameFolderRequest) (*file.FolderResponse, error) {
+	folder, err := s.accessibleFolder(ctx, req.Id, models.RoleEditor)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.moveFolder(ctx, folder.ID, folder.ParentID, req.Name, req.OnConflict)
+}
+
+// CopyFolder sao chép thư mục cùng toàn bộ nội dung. Các file sao chép dùng
+// chung blob với file gốc; tổng kích thước được trừ vào hạn mức và tham chiếu
+// được thêm trước, metadata được thêm trong một thao tác, nếu thất bại thì
+// hạn mức và các tham chiếu đã thêm được trả lại. Bản sao thuộc về chủ thư
+// mục cha đích như với CopyFile.
+func (s *FileService) CopyFolder(ctx context.Context, req *file.CopyFolderRequest) (*file.FolderResponse, error) {
+	source, err := s.accessibleFolder(ctx, req.Id, models.RoleViewer)
+	if err != nil {
+		return nil, err
+	}
+	parentID, err := copyTarget(ctx, source.OwnerID, source.ParentID, req.ParentId)
+	if err != nil {
+		return nil, err
+	}
+	parent, err := s.accessibleFolder(ctx, parentID, models.RoleEditor)
+	if err != nil {
+		return nil, err
+	}
+	folders, files, err := s.repo.Subtree(ctx, source.ID)
+	if err != nil {
+		return nil, entryError(err, "read folder")
+	}
+	if len(folders)+len(files) > maxCopyEntries {
+		return nil, status.Errorf(codes.FailedPrecondition, "folder has more than %d entries to copy", maxCopyEntries)
+	}
+
+	// Cấp ID mới và nối lại quan hệ cha con theo ID mới
+	now := time.Now()
+	ids := make(map[string]string, len(folders))
+	for _, f := range folders {
+		ids[f.ID] = uuid.New().String()
+	}
+	for i, f := range folders {
+		f.ID = ids[f.ID]
+		f.OwnerID = parent.OwnerID
+		if i == 0 {
+			f.ParentID = parent.ID
+			if req.Name != "" {
+				f.Name = req.Name
+			}
+		} else {
+			f.ParentID = ids[f.ParentID]
+		}
+		f.CreatedAt = now
+		f.UpdatedAt = now
+	}
+
+	s.quotaMu.RLock()
+	defer s.quotaMu.RUnlock()
+	var size int64
+	for _, f := range files {
+		size += f.Size
+	}
+	if err := s.quota.Reserve(ctx, parent.OwnerID, size); err != nil {
+		return nil, err
+	}
+
+	retained := make([]*models.File, 0, len(files))
+	for _, f := range files {
+		f.ID = uuid.New().String()
+		f.OwnerID = parent.OwnerID
+		f.FolderID = ids[f.FolderID]
+		f.CreatedAt = now
+		f.UpdatedAt = now
+		if err := s.blobs.Retain(ctx, f.BlobKey); err != nil {
+			s.releaseCopies(ctx, parent.OwnerID, size, retained)
+			return nil, status.Errorf(codes.Internal, "failed to copy file content: %v", err)
+		}
+		retained = append(retained, f)
+	}
+
+	if err := s.repo.InsertTree(ctx, source.ID, folders, files, parseConflict(req.OnConflict), now); err != nil {
+		s.releaseCopies(ctx, parent.OwnerID, size, retained)
+		return nil, entryError(err, "copy folder")
+	}
+
+	return &file.FolderResponse{
+		Folder: convertFolderToProto(folders[0]),
+	}, nil
+}
+
+// DeleteFolder chuyển thư mục cùng toàn bộ nội dung vào thùng rác thành một
+// mục duy nhất, trong thùng rác của chủ sở hữu
+func (s *FileService) DeleteFolder(ctx context.Context, req *file.DeleteFolderRequest) (*file.DeleteFolderResponse, error) {
+	folder, err := s.accessibleFolder(ctx, req.Id, models.RoleEditor)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.repo.TrashFolder(ctx, folder.ID, time.Now()); err != nil {
+		return nil, entryError(err, "delete folder")
+	}
+
+	return &file.DeleteFolderResponse{
+		Success: true,
+	}, nil
+}
+
+// ResolvePath tìm thư mục hoặc file theo path tuyệt đối như
+// "/Documents/2026/report.pdf"
+func (s *FileService) ResolvePath(ctx context.Context, req *file.ResolvePathRequest) (*file.ResolvePathResponse, error) {
+	owner, err := ownerFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	folder, fileModel, err := s.repo.ResolvePath(ctx, owner, cleanPath(req.Path))
+	if err != nil {
+		return nil, entryError(err, "resolve path")
+	}
+	if folder != nil {
+		return &file.ResolvePathResponse{Folder: convertFolderToProto(folder)}, nil
+	}
+	return &file.ResolvePathResponse{File: convertFileToProto(fileModel)}, nil
+}
+
+// moveFolder places a folder in parentID under name
+func (s *FileService) moveFolder(ctx context.Context, id, parentID, name, onConflict string) (*file.FolderResponse, error) {
+	folder, err := s.repo.MoveFolder(ctx, id, parentID, name, parseConflict(onConflict), time.Now())
+	if err != nil {
+		return nil, entryError(err, "move folder")
+	}
+
+	return &file.FolderResponse{
+		Folder: convertFolderToProto(folder),
+	}, nil
+}
+
+// releaseCopies undoes the quota reservation and the blob references of a
+// folder copy that failed
+func (s *FileService) releaseCopies(ctx context.Context, owner string, size int64, retained []*models.File) {
+	s.quota.Release(ctx, owner, size)
+	for _, f := range retained {
+		s.releaseBlob(ctx, f.BlobKey)
+	}
+}
+
+// accessibleFolder returns a folder the calling user has at least role on,
+// as its owner or through a share; "root" is the root folder of the caller.
+// Folders they have no access to are reported as not found.
+func (s *FileService) accessibleFolder(ctx context.Context, id string, role models.Role) (*models.Folder, error) {
+	if id == models.RootFolderID {
+		owner, err := ownerFromContext(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return models.RootFolder(owner), nil
+	}
+	folder, err := s.repo.GetFolder(ctx, id)
+	if err != nil {
+		if errors.Is(err, repository.ErrFolderNotFound) {
+			return nil, status.Errorf(codes.NotFound, "folder not found")
+		}
+		return nil, status.Errorf(codes.Internal, "failed to get folder: %v", err)
+	}
+	if err := s.authorize(ctx, folder.OwnerID, folder.ID, folder.Path, role, "folder"); err != nil {
+		return nil, err
+	}
+	return folder, nil
+}
+
+// cleanPath normalises a path validated by Validators. The gateway passes the
+// path of /api/paths/{path} without the leading slash.
+func cleanPath(p string) string {
+	return cleanFolder("/" + strings.TrimPrefix(p, "/"))
+}
+
+// convertFolderToProto converts a folder model to a proto folder. The root
+// folder has no timestamps.
+func convertFolderToProto(f *models.Folder) *file.Folder {
+	folder := &file.Folder{
+		Id:       f.ID,
+		OwnerId:  f.OwnerID,
+		ParentId: f.ParentID,
+		Name:     f.Name,
+		Path:     f.Path,
+	}
+	if !f.IsRoot() {
+		folder.CreatedAt = f.CreatedAt.Format(time.RFC3339)
+		folder.UpdatedAt = f.UpdatedAt.Format(time.RFC3339)
+	}
+	return folder
+}
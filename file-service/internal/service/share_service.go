@@ -0,0 +1,231 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/cloud-drive/file-service/internal/models"
+	"github.com/cloud-drive/proto-definitions/file"
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// CreateShare chia sẻ file hoặc thư mục của người gọi với người dùng có email
+// cho trước, mặc định với role viewer. Chia sẻ lại với cùng người dùng chỉ
+// thay role của lần chia sẻ trước.
+func (s *FileService) CreateShare(ctx context.Context, req *file.CreateShareRequest) (*file.ShareResponse, error) {
+	owner, err := ownerFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	entryID, isFolder, err := s.sharedEntry(ctx, req.FileId, req.FolderId)
+	if err != nil {
+		return nil, err
+	}
+	grantee, err := s.directory.UserByEmail(ctx, req.Email)
+	if err != nil {
+		return nil, err
+	}
+	if grantee.Id == owner {
+		return nil, status.Errorf(codes.InvalidArgument, "an entry cannot be shared with its owner")
+	}
+	role := models.Role(req.Role)
+	if role == "" {
+		role = models.RoleViewer
+	}
+
+	now := time.Now()
+	share := &models.Share{
+		ID:        uuid.New().String(),
+		OwnerID:   owner,
+		EntryID:   entryID,
+		IsFolder:  isFolder,
+		UserID:    grantee.Id,
+		Email:     grantee.Email,
+		Role:      role,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := s.repo.PutShare(ctx, share); err != nil {
+		return nil, entryError(err, "share entry")
+	}
+
+	return &file.ShareResponse{
+		Share: convertShareToProto(share),
+	}, nil
+}
+
+// ListShares liệt kê những người được chia sẻ một file hoặc thư mục của người
+// gọi, không gồm chia sẻ của các thư mục bên trên
+func (s *FileService) ListShares(ctx context.Context, req *file.ListSharesRequest) (*file.ListSharesResponse, error) {
+	entryID, _, err := s.sharedEntry(ctx, req.FileId, req.FolderId)
+	if err != nil {
+		return nil, err
+	}
+	shares, err := s.repo.ListShares(ctx, entryID)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to list shares: %v", err)
+	}
+
+	protoShares := make([]*file.Share, 0, len(shares))
+	for _, share := range shares {
+		protoShares = append(protoShares, convertShareToProto(share))
+	}
+
+	return &file.ListSharesResponse{
+		Shares: protoShares,
+	}, nil
+}
+
+// UpdateShare đổi role của một lần chia sẻ; chỉ chủ sở hữu được đổi
+func (s *FileService) UpdateShare(ctx context.Context, req *file.UpdateShareRequest) (*file.ShareResponse, error) {
+	owner, err := ownerFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	share, err := s.visibleShare(ctx, req.Id)
+	if err != nil {
+		return nil, err
+	}
+	if share.OwnerID != owner {
+		return nil, status.Errorf(codes.PermissionDenied, "only the owner can change a share")
+	}
+
+	share.Role = models.Role(req.Role)
+	share.UpdatedAt = time.Now()
+	if err := s.repo.PutShare(ctx, share); err != nil {
+		return nil, entryError(err, "update share")
+	}
+
+	return &file.ShareResponse{
+		Share: convertShareToProto(share),
+	}, nil
+}
+
+// DeleteShare thu hồi một lần chia sẻ. Người được chia sẻ cũng tự bỏ được
+// chia sẻ với mình.
+func (s *FileService) DeleteShare(ctx context.Context, req *file.DeleteShareRequest) (*file.DeleteShareResponse, error) {
+	share, err := s.visibleShare(ctx, req.Id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.DeleteShare(ctx, share.ID); err != nil {
+		return nil, entryError(err, "delete share")
+	}
+
+	return &file.DeleteShareResponse{
+		Success: true,
+	}, nil
+}
+
+// ListSharedWithMe liệt kê file và thư mục người khác chia sẻ với người gọi,
+// chia sẻ gần nhất trước; mục đang trong thùng rác của chủ sở hữu bị bỏ qua
+func (s *FileService) ListSharedWithMe(ctx context.Context, req *file.ListSharedWithMeRequest) (*file.ListSharedWithMeResponse, error) {
+	caller, err := ownerFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	limit := int(req.Limit)
+	if limit == 0 {
+		limit = defaultListLimit
+	}
+
+	items, err := s.repo.SharedWith(ctx, caller, limit, int(req.Offset))
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to list shared entries: %v", err)
+	}
+	protoItems := make([]*file.SharedItem, 0, len(items))
+	for _, item := range items {
+		protoItem := &file.SharedItem{Share: convertShareToProto(item.Share)}
+		if item.Folder != nil {
+			protoItem.Folder = convertFolderToProto(item.Folder)
+		} else {
+			protoItem.File = convertFileToProto(item.File)
+		}
+		protoItems = append(protoItems, protoItem)
+	}
+
+	return &file.ListSharedWithMeResponse{
+		Items: protoItems,
+	}, nil
+}
+
+// authorize checks that the calling user has at least required on the entry
+// entryID of ownerID at path p, either as its owner or through a share of the
+// entry or of a folder above it. Callers without any role are told the entry
+// does not exist, callers with a lower role that they lack access; kind names
+// the entry in errors.
+func (s *FileService) authorize(ctx context.Context, ownerID, entryID, p string, required models.Role, kind string) error {
+	caller, err := ownerFromContext(ctx)
+	if err != nil {
+		return err
+	}
+	if caller == ownerID {
+		return nil
+	}
+	role, err := s.repo.Role(ctx, caller, ownerID, entryID, p)
+	if err != nil {
+		return status.Errorf(codes.Internal, "failed to check access: %v", err)
+	}
+	if role == "" {
+		return status.Errorf(codes.NotFound, "%s not found", kind)
+	}
+	if !role.Includes(required) {
+		return status.Errorf(codes.PermissionDenied, "%s access to the %s is required", required, kind)
+	}
+	return nil
+}
+
+// sharedEntry returns the ID of the file or folder of the calling user a
+// share request is about
+func (s *FileService) sharedEntry(ctx context.Context, fileID, folderID string) (string, bool, error) {
+	if folderID != "" {
+		folder, err := s.accessibleFolder(ctx, folderID, models.RoleOwner)
+		if err != nil {
+			return "", false, err
+		}
+		return folder.ID, true, nil
+	}
+	fileModel, err := s.accessibleFile(ctx, fileID, models.RoleOwner)
+	if err != nil {
+		return "", false, err
+	}
+	return fileModel.ID, false, nil
+}
+
+// visibleShare returns a share made by or with the calling user. Other
+// shares are reported as not found.
+func (s *FileService) visibleShare(ctx context.Context, id string) (*models.Share, error) {
+	caller, err := ownerFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	share, err := s.repo.GetShare(ctx, id)
+	if err != nil {
+		return nil, entryError(err, "get share")
+	}
+	if share.OwnerID != caller && share.UserID != caller {
+		return nil, status.Errorf(codes.NotFound, "share not found")
+	}
+	return share, nil
+}
+
+// convertShareToProto converts a share to a proto share
+func convertShareToProto(share *models.Share) *file.Share {
+	protoShare := &file.Share{
+		Id:        share.ID,
+		OwnerId:   share.OwnerID,
+		UserId:    share.UserID,
+		Email:     share.Email,
+		Role:      string(share.Role),
+		CreatedAt: share.CreatedAt.Format(time.RFC3339),
+		UpdatedAt: share.UpdatedAt.Format(time.RFC3339),
+	}
+	if share.IsFolder {
+		protoShare.FolderId = share.EntryID
+	} else {
+		protoShare.FileId = share.EntryID
+	}
+	return protoShare
+}
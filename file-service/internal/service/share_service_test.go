@@ -0,0 +1,237 @@
+package service
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/cloud-drive/file-service/internal/directory"
+	"github.com/cloud-drive/file-service/internal/metrics"
+	"github.com/cloud-drive/file-service/internal/models"
+	"github.com/cloud-drive/file-service/internal/quota"
+	"github.com/cloud-drive/file-service/internal/repository"
+	"github.com/cloud-drive/proto-definitions/file"
+	"github.com/cloud-drive/proto-definitions/user"
+	"github.com/cloud-drive/shared/identity"
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// as returns a context making calls as userID
+func as(userID string) context.Context {
+	return identity.NewContext(context.Background(), identity.Identity{UserID: userID, Role: "user"})
+}
+
+// assertCode checks the gRPC status code of err
+func assertCode(t *testing.T, name string, err error, want codes.Code) {
+	t.Helper()
+	if got := status.Code(err); got != want {
+		t.Errorf("%s = %v, want %v", name, err, want)
+	}
+}
+
+// newShareTestService returns a service without content or quota over the
+// drive of alice, who can share with bob and carol:
+//
+//	/team/plan.txt
+//	/team/drafts
+//	/private/secret.txt
+func newShareTestService(t *testing.T) *FileService {
+	t.Helper()
+	repo := repository.NewInMemoryFileRepository()
+	ctx := context.Background()
+	now := time.Now()
+	for _, folder := range []*models.Folder{
+		{ID: "team", ParentID: models.RootFolderID, Name: "team"},
+		{ID: "drafts", ParentID: "team", Name: "drafts"},
+		{ID: "private", ParentID: models.RootFolderID, Name: "private"},
+	} {
+		folder.OwnerID, folder.CreatedAt, folder.UpdatedAt = "alice", now, now
+		if err := repo.CreateFolder(ctx, folder, models.ConflictFail); err != nil {
+			t.Fatalf("CreateFolder %s: %v", folder.Name, err)
+		}
+	}
+	for _, f := range []*models.File{
+		{ID: "plan", FolderID: "team", Name: "plan.txt"},
+		{ID: "secret", FolderID: "private", Name: "secret.txt"},
+	} {
+		f.OwnerID, f.CreatedAt, f.UpdatedAt = "alice", now, now
+		if err := repo.Create(ctx, f, models.ConflictFail); err != nil {
+			t.Fatalf("Create %s: %v", f.Name, err)
+		}
+	}
+
+	m := metrics.New(prometheus.NewRegistry())
+	users := newFakeUsers(
+		&user.User{Id: "alice", Email: "alice@example.com"},
+		&user.User{Id: "bob", Email: "bob@example.com"},
+		&user.User{Id: "carol", Email: "carol@example.com"},
+	)
+	return NewFileService(repo, nil, nil, quota.New(nil, m), directory.New(users), m, 1<<20, time.Hour, time.Minute, time.Hour)
+}
+
+// shareWith shares the file or folder of alice with the user of email
+func shareWith(t *testing.T, s *FileService, fileID, folderID, email string, role models.Role) *file.Share {
+	t.Helper()
+	resp, err := s.CreateShare(as("alice"), &file.CreateShareRequest{FileId: fileID, FolderId: folderID, Email: email, Role: string(role)})
+	if err != nil {
+		t.Fatalf("CreateShare: %v", err)
+	}
+	return resp.Share
+}
+
+func TestShareRoles(t *testing.T) {
+	for _, tc := range []struct {
+		name               string
+		fileID, folderID   string
+		role               models.Role
+		wantRead, wantEdit codes.Code
+	}{
+		{"not shared", "", "", "", codes.NotFound, codes.NotFound},
+		{"viewer on the file", "plan", "", models.RoleViewer, codes.OK, codes.PermissionDenied},
+		{"commenter on the file", "plan", "", models.RoleCommenter, codes.OK, codes.PermissionDenied},
+		{"editor on the file", "plan", "", models.RoleEditor, codes.OK, codes.OK},
+		{"viewer on the folder", "", "team", models.RoleViewer, codes.OK, codes.PermissionDenied},
+		{"commenter on the folder", "", "team", models.RoleCommenter, codes.OK, codes.PermissionDenied},
+		{"editor on the folder", "", "team", models.RoleEditor, codes.OK, codes.OK},
+		{"editor on another folder", "", "private", models.RoleEditor, codes.NotFound, codes.NotFound},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newShareTestService(t)
+			if tc.role != "" {
+				shareWith(t, s, tc.fileID, tc.folderID, "bob@example.com", tc.role)
+			}
+			bob := as("bob")
+
+			_, err := s.GetFile(bob, &file.GetFileRequest{Id: "plan"})
+			assertCode(t, "GetFile", err, tc.wantRead)
+			_, err = s.RenameFile(bob, &file.RenameFileRequest{Id: "plan", Name: "plan-v2.txt"})
+			assertCode(t, "RenameFile", err, tc.wantEdit)
+			_, err = s.DeleteFile(bob, &file.DeleteFileRequest{Id: "plan"})
+			assertCode(t, "DeleteFile", err, tc.wantEdit)
+
+			// Carol has no share whatever bob has
+			_, err = s.GetFile(as("carol"), &file.GetFileRequest{Id: "plan"})
+			assertCode(t, "GetFile by carol", err, codes.NotFound)
+		})
+	}
+}
+
+func TestShareRoleHighestWins(t *testing.T) {
+	s := newShareTestService(t)
+	shareWith(t, s, "plan", "", "bob@example.com", models.RoleViewer)
+	shareWith(t, s, "", "team", "bob@example.com", models.RoleEditor)
+
+	if _, err := s.RenameFile(as("bob"), &file.RenameFileRequest{Id: "plan", Name: "plan-v2.txt"}); err != nil {
+		t.Fatalf("RenameFile with viewer on the file and editor on its folder: %v", err)
+	}
+}
+
+func TestFolderEditorStaysInFolder(t *testing.T) {
+	s := newShareTestService(t)
+	granted := shareWith(t, s, "", "team", "bob@example.com", models.RoleEditor)
+	bob := as("bob")
+
+	// Sharing stays with the owner
+	_, err := s.CreateShare(bob, &file.CreateShareRequest{FolderId: "team", Email: "carol@example.com", Role: "viewer"})
+	assertCode(t, "CreateShare of the shared folder", err, codes.PermissionDenied)
+	_, err = s.CreateShare(bob, &file.CreateShareRequest{FileId: "plan", Email: "carol@example.com", Role: "viewer"})
+	assertCode(t, "CreateShare of a file in the shared folder", err, codes.PermissionDenied)
+	_, err = s.CreateShare(bob, &file.CreateShareRequest{FileId: "secret", Email: "carol@example.com", Role: "viewer"})
+	assertCode(t, "CreateShare of a file outside the shared folder", err, codes.NotFound)
+	_, err = s.UpdateShare(bob, &file.UpdateShareRequest{Id: granted.Id, Role: "viewer"})
+	assertCode(t, "UpdateShare of the share with bob", err, codes.PermissionDenied)
+	_, err = s.ListShares(bob, &file.ListSharesRequest{FolderId: "team"})
+	assertCode(t, "ListShares of the shared folder", err, codes.PermissionDenied)
+
+	// Moves stay within the shared folder
+	_, err = s.MoveFile(bob, &file.MoveFileRequest{Id: "plan", FolderId: "private"})
+	assertCode(t, "MoveFile to a folder outside by ID", err, codes.NotFound)
+	_, err = s.MoveFile(bob, &file.MoveFileRequest{Id: "plan", Folder: "/private"})
+	assertCode(t, "MoveFile to a folder outside by path", err, codes.NotFound)
+	_, err = s.MoveFile(bob, &file.MoveFileRequest{Id: "plan", Folder: "/"})
+	assertCode(t, "MoveFile to the root of the owner", err, codes.NotFound)
+	_, err = s.MoveFile(bob, &file.MoveFileRequest{Id: "plan", FolderId: models.RootFolderID})
+	assertCode(t, "MoveFile to the own root", err, codes.FailedPrecondition)
+	_, err = s.MoveFile(bob, &file.MoveFileRequest{Id: "secret", FolderId: "team"})
+	assertCode(t, "MoveFile of a file outside", err, codes.NotFound)
+	_, err = s.MoveFolder(bob, &file.MoveFolderRequest{Id: "drafts", ParentId: "private"})
+	assertCode(t, "MoveFolder to a folder outside", err, codes.NotFound)
+	_, err = s.MoveFolder(bob, &file.MoveFolderRequest{Id: "team", ParentId: models.RootFolderID})
+	assertCode(t, "MoveFolder of the shared folder to the own root", err, codes.FailedPrecondition)
+
+	moved, err := s.MoveFile(bob, &file.MoveFileRequest{Id: "plan", FolderId: "drafts"})
+	if err != nil {
+		t.Fatalf("MoveFile within the shared folder: %v", err)
+	}
+	if moved.File.Folder != "/team/drafts" {
+		t.Errorf("moved to %s, want /team/drafts", moved.File.Folder)
+	}
+
+	// Nothing above changed the share
+	shares, err := s.ListShares(as("alice"), &file.ListSharesRequest{FolderId: "team"})
+	if err != nil {
+		t.Fatalf("ListShares: %v", err)
+	}
+	if len(shares.Shares) != 1 || shares.Shares[0].UserId != "bob" || shares.Shares[0].Role != string(models.RoleEditor) {
+		t.Fatalf("shares of the folder = %v, want only editor for bob", shares.Shares)
+	}
+	if secret, err := s.GetFile(as("alice"), &file.GetFileRequest{Id: "secret"}); err != nil || secret.File.Folder != "/private" {
+		t.Fatalf("GetFile of the file outside = %v, %v, want it still in /private", secret, err)
+	}
+}
+
+func TestListSharedWithMeSkipsTrash(t *testing.T) {
+	s := newShareTestService(t)
+	shareWith(t, s, "secret", "", "bob@example.com", models.RoleViewer)
+	shareWith(t, s, "", "team", "bob@example.com", models.RoleEditor)
+	alice, bob := as("alice"), as("bob")
+
+	shared := func() []string {
+		t.Helper()
+		resp, err := s.ListSharedWithMe(bob, &file.ListSharedWithMeRequest{})
+		if err != nil {
+			t.Fatalf("ListSharedWithMe: %v", err)
+		}
+		var names []string
+		for _, item := range resp.Items {
+			if item.Folder != nil {
+				names = append(names, item.Folder.Name)
+			} else {
+				names = append(names, item.File.Name)
+			}
+		}
+		slices.Sort(names)
+		return names
+	}
+
+	if got := shared(); len(got) != 2 || got[0] != "secret.txt" || got[1] != "team" {
+		t.Fatalf("ListSharedWithMe = %v, want secret.txt and team", got)
+	}
+
+	if _, err := s.DeleteFile(alice, &file.DeleteFileRequest{Id: "secret"}); err != nil {
+		t.Fatalf("DeleteFile: %v", err)
+	}
+	if got := shared(); len(got) != 1 || got[0] != "team" {
+		t.Fatalf("ListSharedWithMe with secret.txt in the trash = %v, want only team", got)
+	}
+	_, err := s.GetFile(bob, &file.GetFileRequest{Id: "secret"})
+	assertCode(t, "GetFile of a shared file in the trash", err, codes.NotFound)
+
+	// An editor deleting the shared folder moves it to the trash of alice
+	if _, err := s.DeleteFolder(bob, &file.DeleteFolderRequest{Id: "team"}); err != nil {
+		t.Fatalf("DeleteFolder by the editor: %v", err)
+	}
+	if got := shared(); len(got) != 0 {
+		t.Fatalf("ListSharedWithMe with everything in the trash = %v, want none", got)
+	}
+
+	if _, err := s.RestoreTrashItem(alice, &file.RestoreTrashItemRequest{Id: "secret"}); err != nil {
+		t.Fatalf("RestoreTrashItem: %v", err)
+	}
+	if got := shared(); len(got) != 1 || got[0] != "secret.txt" {
+		t.Fatalf("ListSharedWithMe after the restore = %v, want secret.txt", got)
+	}
+}
@@ -0,0 +1,239 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"hash/crc32"
+	"io"
+	"time"
+
+	"github.com/cloud-drive/file-service/internal/models"
+	"github.com/cloud-drive/proto-definitions/file"
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// streamChunkSize is the size of the chunks DownloadFileStream sends
+const streamChunkSize = 256 << 10
+
+// castagnoli is the CRC-32C table used for chunk checksums
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// UploadFileStream nhận nội dung file theo từng chunk và lưu thẳng vào blob
+// store, chỉ giữ một chunk trong bộ nhớ. Thông tin file có thể đến trước hoặc
+// sau các chunk, nên thư mục đích được xác định sau khi nội dung đã được ghi;
+// nếu thất bại thì tham chiếu tới blob được bỏ. Khi thông tin đến trước và có
+// size, size được trừ vào hạn mức trước khi nhận nội dung.
+func (s *FileService) UploadFileStream(stream grpc.ClientStreamingServer[file.UploadFileStreamRequest, file.FileResponse]) error {
+	ctx := stream.Context()
+	owner, err := ownerFromContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	content := &chunkReader{stream: stream, limit: s.maxFileSize}
+	if err := content.start(); err != nil {
+		return err
+	}
+	var r reservation
+	if info := content.info; info != nil && info.Size != 0 {
+		if info.Size < 0 {
+			return status.Errorf(codes.InvalidArgument, "size must not be negative")
+		}
+		if info.Size > s.maxFileSize {
+			return status.Errorf(codes.InvalidArgument, "file is larger than %d bytes", s.maxFileSize)
+		}
+		folder, err := s.targetFolder(ctx, owner, info.FolderId, info.Folder)
+		if err != nil {
+			return err
+		}
+		if r, err = s.reserve(ctx, folder.OwnerID, info.Size); err != nil {
+			return err
+		}
+		content.limit = info.Size
+	}
+
+	fileModel, err := s.storeStream(ctx, owner, content, r)
+	if err != nil {
+		s.cancelReservation(ctx, r)
+		return err
+	}
+	s.metrics.TransferredBytes.WithLabelValues("upload").Add(float64(fileModel.Size))
+
+	return stream.SendAndClose(&file.FileResponse{
+		File: convertFileToProto(fileModel),
+	})
+}
+
+// storeStream stores the content of a streamed upload and then the metadata
+// of the file, which takes over r
+func (s *FileService) storeStream(ctx context.Context, owner string, content *chunkReader, r reservation) (*models.File, error) {
+	now := time.Now()
+	fileModel := &models.File{
+		ID:        uuid.New().String(),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := s.putContent(ctx, fileModel, content, ""); err != nil {
+		return nil, err
+	}
+
+	info := content.info
+	if info == nil {
+		s.releaseBlob(ctx, fileModel.BlobKey)
+		return nil, status.Errorf(codes.InvalidArgument, "upload info is required")
+	}
+	if info.Size != 0 && fileModel.Size != info.Size {
+		s.releaseBlob(ctx, fileModel.BlobKey)
+		return nil, status.Errorf(codes.InvalidArgument, "received %d bytes, size is %d", fileModel.Size, info.Size)
+	}
+	folder, err := s.targetFolder(ctx, owner, info.FolderId, info.Folder)
+	if err != nil {
+		s.releaseBlob(ctx, fileModel.BlobKey)
+		return nil, err
+	}
+	fileModel.OwnerID = folder.OwnerID
+	fileModel.FolderID = folder.ID
+	fileModel.Name = info.Name
+	if info.ContentType != "" {
+		fileModel.ContentType = info.ContentType
+	}
+	if err := s.createFile(ctx, fileModel, parseConflict(info.OnConflict), r); err != nil {
+		return nil, err
+	}
+	return fileModel, nil
+}
+
+// DownloadFileStream gửi metadata của file rồi nội dung trong khoảng
+// [offset, offset+length) theo từng chunk streamChunkSize byte; với version
+// là nội dung của phiên bản đó
+func (s *FileService) DownloadFileStream(req *file.DownloadFileStreamRequest, stream grpc.ServerStreamingServer[file.DownloadFileStreamResponse]) error {
+	ctx := stream.Context()
+	fileModel, err := s.fileAtVersion(ctx, req.Id, req.Version)
+	if err != nil {
+		return err
+	}
+	if req.Offset > fileModel.Size {
+		return status.Errorf(codes.OutOfRange, "offset %d is past the end of the file (%d bytes)", req.Offset, fileModel.Size)
+	}
+	length := fileModel.Size - req.Offset
+	if req.Length > 0 && req.Length < length {
+		length = req.Length
+	}
+
+	blob, err := s.blobs.OpenRange(ctx, fileModel.BlobKey, req.Offset, length)
+	if err != nil {
+		return status.Errorf(codes.Internal, "failed to open file content: %v", err)
+	}
+	defer blob.Close()
+
+	err = stream.Send(&file.DownloadFileStreamResponse{
+		Payload: &file.DownloadFileStreamResponse_File{File: convertFileToProto(fileModel)},
+	})
+	if err != nil {
+		return err
+	}
+
+	// Send serialises the message before returning, so the buffer is reused
+	buf := make([]byte, min(streamChunkSize, max(length, 1)))
+	offset, end := req.Offset, req.Offset+length
+	for offset < end {
+		n, err := io.ReadFull(blob, buf[:min(int64(len(buf)), end-offset)])
+		if n > 0 {
+			sendErr := stream.Send(&file.DownloadFileStreamResponse{
+				Payload: &file.DownloadFileStreamResponse_Chunk{Chunk: &file.FileChunk{
+					Offset: offset,
+					Data:   buf[:n],
+					Crc32C: crc32.Checksum(buf[:n], castagnoli),
+				}},
+			})
+			if sendErr != nil {
+				return sendErr
+			}
+			offset += int64(n)
+			s.metrics.TransferredBytes.WithLabelValues("download").Add(float64(n))
+		}
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			break
+		}
+		if err != nil {
+			return status.Errorf(codes.Internal, "failed to read file content: %v", err)
+		}
+	}
+	if offset != end {
+		return status.Errorf(codes.DataLoss, "file content is shorter than its recorded size")
+	}
+	return nil
+}
+
+// chunkReader reads the chunks of a streamed upload as one stream of bytes,
+// checking the offset and checksum of every chunk and keeping the info
+// message wherever it comes in the stream
+type chunkReader struct {
+	stream grpc.ClientStreamingServer[file.UploadFileStreamRequest, file.FileResponse]
+	limit  int64
+	info   *file.UploadFileInfo
+	buf    []byte
+	offset int64
+	// eof is set when start reached the end of the stream
+	eof bool
+}
+
+// start receives the first message, so info sent before the chunks is known
+// before any content is read
+func (r *chunkReader) start() error {
+	msg, err := r.stream.Recv()
+	if errors.Is(err, io.EOF) {
+		r.eof = true
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return r.handle(msg)
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		if r.eof {
+			return 0, io.EOF
+		}
+		msg, err := r.stream.Recv()
+		if err != nil {
+			return 0, err
+		}
+		if err := r.handle(msg); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+// handle keeps the info or checks a chunk and makes its data the next to read
+func (r *chunkReader) handle(msg *file.UploadFileStreamRequest) error {
+	switch payload := msg.Payload.(type) {
+	case *file.UploadFileStreamRequest_Info:
+		if r.info != nil {
+			return status.Errorf(codes.InvalidArgument, "upload info sent more than once")
+		}
+		r.info = payload.Info
+	case *file.UploadFileStreamRequest_Chunk:
+		chunk := payload.Chunk
+		if chunk.Offset != r.offset {
+			return status.Errorf(codes.InvalidArgument, "chunk at offset %d, expected %d", chunk.Offset, r.offset)
+		}
+		if crc32.Checksum(chunk.Data, castagnoli) != chunk.Crc32C {
+			return status.Errorf(codes.DataLoss, "checksum mismatch in chunk at offset %d", chunk.Offset)
+		}
+		r.offset += int64(len(chunk.Data))
+		if r.offset > r.limit {
+			return status.Errorf(codes.InvalidArgument, "file is larger than %d bytes", r.limit)
+		}
+		r.buf = chunk.Data
+	}
+	return nil
+}
@@ -0,0 +1,293 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"hash/crc32"
+	"io"
+	"math/rand"
+	"net"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cloud-drive/file-service/internal/directory"
+	"github.com/cloud-drive/file-service/internal/metrics"
+	"github.com/cloud-drive/file-service/internal/quota"
+	"github.com/cloud-drive/file-service/internal/repository"
+	"github.com/cloud-drive/file-service/internal/storage"
+	"github.com/cloud-drive/file-service/internal/uploads"
+	"github.com/cloud-drive/proto-definitions/file"
+	"github.com/cloud-drive/shared/identity"
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+const (
+	// streamTestSize is the size of the file streamed through the service,
+	// far larger than the heap the transfer may use
+	streamTestSize = 2 << 30
+	// streamTestShortSize replaces it with -short
+	streamTestShortSize = 512 << 20
+	// heapCeiling is how much the live heap may grow over its size before
+	// the transfer. Samples collect garbage while the transfer keeps
+	// allocating, so chunks received during a collection count as live; the
+	// ceiling leaves room for them while staying far below the file size.
+	heapCeiling = 128 << 20
+)
+
+// TestStreamingMemoryIsBounded uploads and downloads a multi-GB file through
+// UploadFileStream and DownloadFileStream and checks that the heap stays
+// bounded by the chunk size rather than growing with the file
+func TestStreamingMemoryIsBounded(t *testing.T) {
+	size := int64(streamTestSize)
+	if testing.Short() {
+		size = streamTestShortSize
+	}
+	client := newStreamTestClient(t, size)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	// A small transfer first, so allocations made once on first use are not
+	// counted
+	warm, _ := uploadSynthetic(t, ctx, client, "warm.bin", 1<<20)
+	downloadChecksum(t, ctx, client, warm.Id, warm.Size)
+
+	runtime.GC()
+	var base runtime.MemStats
+	runtime.ReadMemStats(&base)
+	peak := sampleHeap(t)
+
+	uploaded, checksum := uploadSynthetic(t, ctx, client, "big.bin", size)
+	if uploaded.Size != size {
+		t.Fatalf("uploaded size = %d, want %d", uploaded.Size, size)
+	}
+	if uploaded.Checksum != checksum {
+		t.Fatalf("uploaded checksum = %s, want %s", uploaded.Checksum, checksum)
+	}
+	if got := downloadChecksum(t, ctx, client, uploaded.Id, size); got != checksum {
+		t.Fatalf("downloaded checksum = %s, want %s", got, checksum)
+	}
+
+	if grown := int64(peak()) - int64(base.HeapAlloc); grown > heapCeiling {
+		t.Fatalf("heap grew by %d MiB while streaming %d MiB, want at most %d MiB", grown>>20, size>>20, heapCeiling>>20)
+	}
+}
+
+// newStreamTestClient serves a FileService over bufconn with content on disk
+// and returns a client whose calls are made as one user
+func newStreamTestClient(t *testing.T, maxFileSize int64) file.FileServiceClient {
+	t.Helper()
+	reg := prometheus.NewRegistry()
+	m := metrics.New(reg)
+	backend, err := storage.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("open blob store: %v", err)
+	}
+	blobs, err := storage.NewContentStore(context.Background(), backend, m)
+	if err != nil {
+		t.Fatalf("open content store: %v", err)
+	}
+	uploadStore, err := uploads.NewStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("open upload store: %v", err)
+	}
+	svc := NewFileService(repository.NewInMemoryFileRepository(), blobs, uploadStore, quota.New(nil, m), directory.New(nil), m, maxFileSize, time.Hour, time.Minute, time.Hour)
+
+	server := grpc.NewServer(grpc.StreamInterceptor(func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx := identity.NewContext(ss.Context(), identity.Identity{UserID: "u1", Role: "user"})
+		return handler(srv, &identityStream{ServerStream: ss, ctx: ctx})
+	}))
+	file.RegisterFileServiceServer(server, svc)
+	lis := bufconn.Listen(1 << 20)
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return file.NewFileServiceClient(conn)
+}
+
+// identityStream gives handlers the context carrying the test user
+type identityStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *identityStream) Context() context.Context {
+	return s.ctx
+}
+
+// sampleHeap records the largest live heap seen until the test ends and
+// returns a function reporting it so far. Each sample collects garbage first,
+// so chunks already handled do not count.
+func sampleHeap(t *testing.T) func() uint64 {
+	var (
+		mu   sync.Mutex
+		peak uint64
+	)
+	record := func() {
+		var stats runtime.MemStats
+		runtime.GC()
+		runtime.ReadMemStats(&stats)
+		mu.Lock()
+		peak = max(peak, stats.HeapAlloc)
+		mu.Unlock()
+	}
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(20 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				record()
+			}
+		}
+	}()
+	t.Cleanup(func() {
+		close(done)
+		<-stopped
+	})
+	return func() uint64 {
+		record()
+		mu.Lock()
+		defer mu.Unlock()
+		return peak
+	}
+}
+
+// uploadSynthetic streams size bytes of generated content in 256 KiB chunks
+// as a file named name and returns the stored file with the SHA-256 of the content sent
+func uploadSynthetic(t *testing.T, ctx context.Context, client file.FileServiceClient, name string, size int64) (*file.File, string) {
+	t.Helper()
+	stream, err := client.UploadFileStream(ctx)
+	if err != nil {
+		t.Fatalf("open upload stream: %v", err)
+	}
+	err = stream.Send(&file.UploadFileStreamRequest{Payload: &file.UploadFileStreamRequest_Info{Info: &file.UploadFileInfo{
+		Name:        name,
+		Folder:      "/",
+		ContentType: "application/octet-stream",
+	}}})
+	if err != nil {
+		t.Fatalf("send upload info: %v", err)
+	}
+
+	// One block of random bytes, varied per chunk so the content does not
+	// repeat
+	block := make([]byte, streamChunkSize)
+	rand.New(rand.NewSource(1)).Read(block)
+	hash := sha256.New()
+	for offset := int64(0); offset < size; {
+		n := min(int64(len(block)), size-offset)
+		data := block[:n]
+		data[0] = byte(offset / streamChunkSize)
+		hash.Write(data)
+		err := stream.Send(&file.UploadFileStreamRequest{Payload: &file.UploadFileStreamRequest_Chunk{Chunk: &file.FileChunk{
+			Offset: offset,
+			Data:   data,
+			Crc32C: crc32.Checksum(data, castagnoli),
+		}}})
+		if err != nil {
+			t.Fatalf("send chunk at %d: %v", offset, err)
+		}
+		offset += n
+	}
+	resp, err := stream.CloseAndRecv()
+	if err != nil {
+		t.Fatalf("upload: %v", err)
+	}
+	return resp.File, hex.EncodeToString(hash.Sum(nil))
+}
+
+// downloadChecksum streams a file back, checking the offset and CRC-32C of
+// every chunk, and returns the SHA-256 of its content
+func downloadChecksum(t *testing.T, ctx context.Context, client file.FileServiceClient, id string, size int64) string {
+	t.Helper()
+	stream, err := client.DownloadFileStream(ctx, &file.DownloadFileStreamRequest{Id: id})
+	if err != nil {
+		t.Fatalf("open download stream: %v", err)
+	}
+	hash := sha256.New()
+	var offset int64
+	for {
+		msg, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("download at %d: %v", offset, err)
+		}
+		chunk := msg.GetChunk()
+		if chunk == nil {
+			continue
+		}
+		if chunk.Offset != offset {
+			t.Fatalf("chunk at offset %d, want %d", chunk.Offset, offset)
+		}
+		if crc32.Checksum(chunk.Data, castagnoli) != chunk.Crc32C {
+			t.Fatalf("checksum mismatch in chunk at offset %d", offset)
+		}
+		hash.Write(chunk.Data)
+		offset += int64(len(chunk.Data))
+	}
+	if offset != size {
+		t.Fatalf("downloaded %d bytes, want %d", offset, size)
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// TestStreamDeclaredSize checks that a stream declaring its size up front must
+// carry exactly that many bytes
+func TestStreamDeclaredSize(t *testing.T) {
+	client := newStreamTestClient(t, 1<<20)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	for _, tc := range []struct {
+		name     string
+		declared int64
+		want     codes.Code
+	}{
+		{"exact.bin", 1000, codes.OK},
+		{"short.bin", 2000, codes.InvalidArgument},
+		{"long.bin", 500, codes.InvalidArgument},
+		{"huge.bin", 2 << 20, codes.InvalidArgument},
+	} {
+		stream, err := client.UploadFileStream(ctx)
+		if err != nil {
+			t.Fatalf("open upload stream: %v", err)
+		}
+		stream.Send(&file.UploadFileStreamRequest{Payload: &file.UploadFileStreamRequest_Info{Info: &file.UploadFileInfo{
+			Name: tc.name,
+			Size: tc.declared,
+		}}})
+		data := make([]byte, 1000)
+		stream.Send(&file.UploadFileStreamRequest{Payload: &file.UploadFileStreamRequest_Chunk{Chunk: &file.FileChunk{
+			Data:   data,
+			Crc32C: crc32.Checksum(data, castagnoli),
+		}}})
+		_, err = stream.CloseAndRecv()
+		if got := status.Code(err); got != tc.want {
+			t.Errorf("%s: upload of 1000 bytes declaring %d = %v, want %v", tc.name, tc.declared, err, tc.want)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/cloud-drive/file-service/internal/models"
+	"github.com/cloud-drive/file-service/internal/repository"
+	"github.com/cloud-drive/proto-definitions/file"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ListTrash liệt kê thùng rác của người dùng, mục bị xoá gần nhất trước
+func (s *FileService) ListTrash(ctx context.Context, req *file.ListTrashRequest) (*file.ListTrashResponse, error) {
+	owner, err := ownerFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	limit := int(req.Limit)
+	if limit == 0 {
+		limit = defaultListLimit
+	}
+
+	items, err := s.repo.ListTrash(ctx, owner, limit, int(req.Offset))
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to list trash: %v", err)
+	}
+	protoItems := make([]*file.TrashItem, 0, len(items))
+	for _, item := range items {
+		protoItems = append(protoItems, convertTrashItemToProto(item, s.trashRetention))
+	}
+
+	return &file.ListTrashResponse{
+		Items: protoItems,
+	}, nil
+}
+
+// RestoreTrashItem đưa một mục trong thùng rác trở lại ổ đĩa, vào folder_id
+// nếu có, mặc định là thư mục chứa nó lúc bị xoá hoặc thư mục gốc khi thư mục
+// đó không còn. Tên trùng được xử lý theo on_conflict như khi chuyển; mục bị
+// thay thế khi "overwrite" được chuyển vào thùng rác.
+func (s *FileService) RestoreTrashItem(ctx context.Context, req *file.RestoreTrashItemRequest) (*file.RestoreTrashItemResponse, error) {
+	item, err := s.ownedTrashItem(ctx, req.Id)
+	if err != nil {
+		return nil, err
+	}
+	if req.FolderId != "" {
+		if _, err := s.accessibleFolder(ctx, req.FolderId, models.RoleOwner); err != nil {
+			return nil, err
+		}
+	}
+
+	folder, fileModel, err := s.repo.RestoreTrashItem(ctx, item.ID, req.FolderId, parseConflict(req.OnConflict), time.Now())
+	if err != nil {
+		return nil, entryError(err, "restore trash item")
+	}
+
+	if folder != nil {
+		return &file.RestoreTrashItemResponse{Folder: convertFolderToProto(folder)}, nil
+	}
+	return &file.RestoreTrashItemResponse{File: convertFileToProto(fileModel)}, nil
+}
+
+// DeleteTrashItem xoá hẳn một mục trong thùng rác, bỏ tham chiếu tới nội dung
+// của mọi phiên bản và trả lại dung lượng cho hạn mức
+func (s *FileService) DeleteTrashItem(ctx context.Context, req *file.DeleteTrashItemRequest) (*file.DeleteTrashItemResponse, error) {
+	item, err := s.ownedTrashItem(ctx, req.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	s.quotaMu.RLock()
+	defer s.quotaMu.RUnlock()
+	deleted, err := s.repo.DeleteTrashItem(ctx, item.ID)
+	if err != nil {
+		return nil, entryError(err, "delete trash item")
+	}
+	s.releaseTrash(ctx, []*models.TrashItem{deleted})
+
+	return &file.DeleteTrashItemResponse{
+		Success: true,
+	}, nil
+}
+
+// EmptyTrash xoá hẳn mọi mục trong thùng rác của người dùng
+func (s *FileService) EmptyTrash(ctx context.Context, req *file.EmptyTrashRequest) (*file.EmptyTrashResponse, error) {
+	owner, err := ownerFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	s.quotaMu.RLock()
+	defer s.quotaMu.RUnlock()
+	deleted, err := s.repo.EmptyTrash(ctx, owner)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to empty trash: %v", err)
+	}
+	s.releaseTrash(ctx, deleted)
+
+	return &file.EmptyTrashResponse{
+		Deleted: int32(len(deleted)),
+	}, nil
+}
+
+// PurgeTrash deletes the trash items deleted longer than the retention ago
+// for good, releasing their content and quota, and returns how many were
+// deleted. Nothing is purged when the retention is zero.
+func (s *FileService) PurgeTrash(ctx context.Context) (int, error) {
+	if s.trashRetention == 0 {
+		return 0, nil
+	}
+	s.quotaMu.RLock()
+	defer s.quotaMu.RUnlock()
+	purged, err := s.repo.PurgeTrash(ctx, time.Now().Add(-s.trashRetention))
+	if err != nil {
+		return 0, err
+	}
+	s.releaseTrash(ctx, purged)
+
+	s.metrics.TrashPurged.Add(float64(len(purged)))
+	for _, item := range purged {
+		s.metrics.TrashPurgedBytes.Add(float64(item.Size))
+	}
+	return len(purged), nil
+}
+
+// ownedTrashItem returns a trash item of the calling user. Items of other
+// users are reported as not found.
+func (s *FileService) ownedTrashItem(ctx context.Context, id string) (*models.TrashItem, error) {
+	owner, err := ownerFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	item, err := s.repo.GetTrashItem(ctx, id)
+	if err != nil {
+		if errors.Is(err, repository.ErrTrashItemNotFound) {
+			return nil, status.Errorf(codes.NotFound, "trash item not found")
+		}
+		return nil, status.Errorf(codes.Internal, "failed to get trash item: %v", err)
+	}
+	if item.OwnerID != owner {
+		return nil, status.Errorf(codes.NotFound, "trash item not found")
+	}
+	return item, nil
+}
+
+// releaseTrash releases all versions of the files in trash items deleted for
+// good. The caller holds quotaMu for reading.
+func (s *FileService) releaseTrash(ctx context.Context, items []*models.TrashItem) {
+	var versions []*models.FileVersion
+	for _, item := range items {
+		versions = append(versions, item.Versions()...)
+	}
+	s.releaseVersions(ctx, versions)
+}
+
+// convertTrashItemToProto converts a trash item to a proto trash item; the
+// purge time is left empty when retention is zero
+func convertTrashItemToProto(item *models.TrashItem, retention time.Duration) *file.TrashItem {
+	protoItem := &file.TrashItem{
+		Id:        item.ID,
+		OwnerId:   item.OwnerID,
+		Name:      item.Name,
+		IsFolder:  item.IsFolder,
+		ParentId:  item.ParentID,
+		Path:      item.Path,
+		Size:      item.Size,
+		DeletedAt: item.DeletedAt.Format(time.RFC3339),
+	}
+	if retention > 0 {
+		protoItem.PurgeAt = item.DeletedAt.Add(retention).Format(time.RFC3339)
+	}
+	return protoItem
+}
@@ -0,0 +1,120 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cloud-drive/file-service/internal/directory"
+	"github.com/cloud-drive/file-service/internal/metrics"
+	"github.com/cloud-drive/file-service/internal/quota"
+	"github.com/cloud-drive/file-service/internal/repository"
+	"github.com/cloud-drive/file-service/internal/storage"
+	"github.com/cloud-drive/file-service/internal/uploads"
+	"github.com/cloud-drive/proto-definitions/file"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// newQuotaTestService returns a service storing content on disk and
+// charging it to the quota kept by users, with a trash retention of an hour
+func newQuotaTestService(t *testing.T, users *fakeUsers) *FileService {
+	t.Helper()
+	m := metrics.New(prometheus.NewRegistry())
+	backend, err := storage.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("open blob store: %v", err)
+	}
+	blobs, err := storage.NewContentStore(context.Background(), backend, m)
+	if err != nil {
+		t.Fatalf("open content store: %v", err)
+	}
+	uploadStore, err := uploads.NewStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("open upload store: %v", err)
+	}
+	return NewFileService(repository.NewInMemoryFileRepository(), blobs, uploadStore, quota.New(users, m), directory.New(users), m, 1<<20, time.Hour, time.Minute, time.Hour)
+}
+
+// upload stores size bytes of content made of fill as name in folderID
+func upload(t *testing.T, s *FileService, ctx context.Context, folderID, name string, fill byte, size int, onConflict string) *file.File {
+	t.Helper()
+	resp, err := s.UploadFile(ctx, &file.UploadFileRequest{
+		FolderId:   folderID,
+		Name:       name,
+		Content:    bytes.Repeat([]byte{fill}, size),
+		OnConflict: onConflict,
+	})
+	if err != nil {
+		t.Fatalf("UploadFile %s: %v", name, err)
+	}
+	return resp.File
+}
+
+// assertQuota checks the storage charged to and given back by alice
+func assertQuota(t *testing.T, users *fakeUsers, step string, wantUsed, wantReleased int64) {
+	t.Helper()
+	used, released := users.usage("alice")
+	if used != wantUsed || released != wantReleased {
+		t.Fatalf("after %s: %d bytes charged and %d released, want %d and %d", step, used, released, wantUsed, wantReleased)
+	}
+}
+
+func TestQuotaIsReleasedOnlyWhenTrashIsDeleted(t *testing.T) {
+	users := newFakeUsers()
+	s := newQuotaTestService(t, users)
+	alice := as("alice")
+	var folders []string
+	for _, name := range []string{"a", "b"} {
+		resp, err := s.CreateFolder(alice, &file.CreateFolderRequest{Name: name})
+		if err != nil {
+			t.Fatalf("CreateFolder: %v", err)
+		}
+		folders = append(folders, resp.Folder.Id)
+	}
+
+	report := upload(t, s, alice, folders[0], "report.txt", '1', 10, "")
+	upload(t, s, alice, folders[0], "report.txt", '2', 20, "overwrite")
+	other := upload(t, s, alice, folders[1], "report.txt", '3', 5, "")
+	assertQuota(t, users, "the uploads", 35, 0)
+
+	// Entries replaced by overwrites and deleted entries go to the trash
+	// still charged
+	if _, err := s.MoveFile(alice, &file.MoveFileRequest{Id: other.Id, FolderId: folders[0], OnConflict: "overwrite"}); err != nil {
+		t.Fatalf("MoveFile: %v", err)
+	}
+	assertQuota(t, users, "the move over report.txt", 35, 0)
+	if _, err := s.RestoreTrashItem(alice, &file.RestoreTrashItemRequest{Id: report.Id, OnConflict: "overwrite"}); err != nil {
+		t.Fatalf("RestoreTrashItem: %v", err)
+	}
+	assertQuota(t, users, "the restore over the moved file", 35, 0)
+	versions, err := s.ListFileVersions(alice, &file.ListFileVersionsRequest{Id: report.Id})
+	if err != nil {
+		t.Fatalf("ListFileVersions: %v", err)
+	}
+	if len(versions.Versions) != 2 {
+		t.Fatalf("restored file has %d versions, want 2", len(versions.Versions))
+	}
+	if _, err := s.DeleteFile(alice, &file.DeleteFileRequest{Id: report.Id}); err != nil {
+		t.Fatalf("DeleteFile: %v", err)
+	}
+	assertQuota(t, users, "deleting report.txt", 35, 0)
+
+	// Deleting for good releases every version
+	if _, err := s.DeleteTrashItem(alice, &file.DeleteTrashItemRequest{Id: report.Id}); err != nil {
+		t.Fatalf("DeleteTrashItem: %v", err)
+	}
+	assertQuota(t, users, "deleting report.txt for good", 5, 30)
+
+	// Purging releases only items past the retention
+	if n, err := s.PurgeTrash(context.Background()); err != nil || n != 0 {
+		t.Fatalf("PurgeTrash = %d, %v, want nothing purged within the retention", n, err)
+	}
+	assertQuota(t, users, "purging within the retention", 5, 30)
+	s.trashRetention = time.Nanosecond
+	time.Sleep(time.Millisecond)
+	if n, err := s.PurgeTrash(context.Background()); err != nil || n != 1 {
+		t.Fatalf("PurgeTrash = %d, %v, want the moved file purged", n, err)
+	}
+	assertQuota(t, users, "purging past the retention", 0, 35)
+}
@@ -0,0 +1,284 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"time"
+
+	"github.com/cloud-drive/file-service/internal/models"
+	"github.com/cloud-drive/file-service/internal/uploads"
+	"github.com/cloud-drive/proto-definitions/file"
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// CreateUpload bắt đầu một lần upload có thể tiếp tục. Thư mục đích được xác
+// định ngay lúc tạo và Upload-Length được trừ vào hạn mức của chủ thư mục cho
+// tới khi upload được lưu, bị huỷ hoặc hết hạn; upload rỗng được lưu thành
+// file luôn.
+func (s *FileService) CreateUpload(ctx context.Context, req *file.CreateUploadRequest) (*file.UploadResponse, error) {
+	owner, err := ownerFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if req.Length > s.maxFileSize {
+		return nil, status.Errorf(codes.InvalidArgument, "file is larger than %d bytes", s.maxFileSize)
+	}
+	folder, err := s.targetFolder(ctx, owner, req.FolderId, req.Folder)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := s.reserve(ctx, folder.OwnerID, req.Length)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	upload := &uploads.Upload{
+		ID:          uuid.New().String(),
+		OwnerID:     owner,
+		Length:      req.Length,
+		FolderID:    folder.ID,
+		Name:        req.Name,
+		ContentType: req.ContentType,
+		OnConflict:  req.OnConflict,
+		Metadata:    req.Metadata,
+		QuotaOwner:  r.owner,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(s.uploadExpiry),
+	}
+	if err := s.uploads.Create(ctx, upload); err != nil {
+		s.cancelReservation(ctx, r)
+		return nil, status.Errorf(codes.Internal, "failed to create upload: %v", err)
+	}
+	if !upload.Complete() {
+		return &file.UploadResponse{
+			Upload: convertUploadToProto(upload),
+		}, nil
+	}
+
+	unlock, err := s.uploads.Lock(upload.ID)
+	if err != nil {
+		return nil, uploadError(err, "lock upload")
+	}
+	defer unlock()
+	return s.commitUpload(ctx, upload)
+}
+
+// GetUpload trả về trạng thái upload, gồm offset đã nhận được
+func (s *FileService) GetUpload(ctx context.Context, req *file.GetUploadRequest) (*file.UploadResponse, error) {
+	upload, err := s.ownedUpload(ctx, req.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	return &file.UploadResponse{
+		Upload: convertUploadToProto(upload),
+	}, nil
+}
+
+// AppendUpload ghi thêm dữ liệu tại offset hiện tại của upload. Khi đã nhận đủ
+// dữ liệu, upload được lưu thành file trong thư mục đích. Nếu lưu thất bại,
+// client gửi lại một lần ghi rỗng tại offset cuối để thử lại.
+func (s *FileService) AppendUpload(ctx context.Context, req *file.AppendUploadRequest) (*file.UploadResponse, error) {
+	upload, err := s.ownedUpload(ctx, req.Id)
+	if err != nil {
+		return nil, err
+	}
+	unlock, err := s.uploads.Lock(upload.ID)
+	if err != nil {
+		return nil, uploadError(err, "lock upload")
+	}
+	defer unlock()
+
+	// Lần ghi rỗng lặp lại sau khi upload đã được lưu chỉ trả về trạng thái
+	if upload, err = s.uploads.Get(ctx, upload.ID); err != nil {
+		return nil, uploadError(err, "get upload")
+	}
+	if upload.Committed() && req.Offset == upload.Offset && len(req.Content) == 0 {
+		return &file.UploadResponse{
+			Upload: convertUploadToProto(upload),
+		}, nil
+	}
+
+	upload, err = s.uploads.Append(ctx, upload.ID, req.Offset, bytes.NewReader(req.Content))
+	if err != nil {
+		return nil, uploadError(err, "append upload")
+	}
+	if !upload.Complete() {
+		return &file.UploadResponse{
+			Upload: convertUploadToProto(upload),
+		}, nil
+	}
+	return s.commitUpload(ctx, upload)
+}
+
+// DeleteUpload huỷ upload, xoá dữ liệu đã nhận và trả lại hạn mức đã giữ cho
+// upload. File đã được lưu từ upload không bị ảnh hưởng.
+func (s *FileService) DeleteUpload(ctx context.Context, req *file.DeleteUploadRequest) (*file.DeleteUploadResponse, error) {
+	upload, err := s.ownedUpload(ctx, req.Id)
+	if err != nil {
+		return nil, err
+	}
+	unlock, err := s.uploads.Lock(upload.ID)
+	if err != nil {
+		return nil, uploadError(err, "lock upload")
+	}
+	defer unlock()
+
+	if err := s.deleteUpload(ctx, upload.ID); err != nil {
+		return nil, uploadError(err, "delete upload")
+	}
+
+	return &file.DeleteUploadResponse{
+		Success: true,
+	}, nil
+}
+
+// ExpireUploads deletes the uploads that expired before now, giving back the
+// quota reserved for them, and returns how many were deleted. Uploads in use
+// by a request are left for the next run.
+func (s *FileService) ExpireUploads(ctx context.Context, now time.Time) (int, error) {
+	expired, err := s.uploads.Expired(ctx, now)
+	if err != nil {
+		return 0, err
+	}
+	deleted := 0
+	for _, upload := range expired {
+		unlock, err := s.uploads.Lock(upload.ID)
+		if err != nil {
+			continue
+		}
+		err = s.deleteUpload(ctx, upload.ID)
+		unlock()
+		if err != nil && !errors.Is(err, uploads.ErrUploadNotFound) {
+			return deleted, err
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+// commitUpload stores the data of a complete upload as a file owned by the
+// owner of its folder, checking again that the caller may still add to it.
+// The data was hashed while it was appended, so content already stored is
+// not read again. The file takes over the quota reserved for the upload; if
+// storing fails the reservation stays with the upload for a retry. The caller
+// holds the lock of the upload.
+func (s *FileService) commitUpload(ctx context.Context, upload *uploads.Upload) (*file.UploadResponse, error) {
+	folder, err := s.accessibleFolder(ctx, upload.FolderID, models.RoleEditor)
+	if err != nil {
+		return nil, err
+	}
+	digest, err := upload.Digest()
+	if err != nil {
+		return nil, uploadError(err, "hash upload")
+	}
+	content, err := s.uploads.Open(ctx, upload.ID)
+	if err != nil {
+		return nil, uploadError(err, "open upload")
+	}
+	defer content.Close()
+
+	now := time.Now()
+	fileModel := &models.File{
+		ID:          uuid.New().String(),
+		OwnerID:     folder.OwnerID,
+		FolderID:    folder.ID,
+		Name:        upload.Name,
+		ContentType: upload.ContentType,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if err := s.putContent(ctx, fileModel, content, digest); err != nil {
+		return nil, err
+	}
+	if err := s.createFile(ctx, fileModel, parseConflict(upload.OnConflict), uploadReservation(upload)); err != nil {
+		return nil, err
+	}
+	s.metrics.TransferredBytes.WithLabelValues("upload").Add(float64(fileModel.Size))
+
+	upload, err = s.uploads.Commit(ctx, upload.ID, fileModel.ID)
+	if err != nil {
+		return nil, uploadError(err, "commit upload")
+	}
+
+	return &file.UploadResponse{
+		Upload: convertUploadToProto(upload),
+		File:   convertFileToProto(fileModel),
+	}, nil
+}
+
+// deleteUpload deletes an upload and gives back the quota reserved for it if
+// it was not stored in the drive. The caller holds the lock of the upload.
+func (s *FileService) deleteUpload(ctx context.Context, id string) error {
+	upload, err := s.uploads.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := s.uploads.Delete(ctx, id); err != nil {
+		return err
+	}
+	s.cancelReservation(ctx, uploadReservation(upload))
+	return nil
+}
+
+// uploadReservation returns the quota reserved for an upload until it is
+// stored in the drive
+func uploadReservation(u *uploads.Upload) reservation {
+	if u.QuotaOwner == "" {
+		return reservation{}
+	}
+	return reservation{owner: u.QuotaOwner, bytes: u.Length}
+}
+
+// ownedUpload returns an upload of the calling user. Uploads of other users
+// are reported as not found.
+func (s *FileService) ownedUpload(ctx context.Context, id string) (*uploads.Upload, error) {
+	owner, err := ownerFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	upload, err := s.uploads.Get(ctx, id)
+	if err != nil {
+		return nil, uploadError(err, "get upload")
+	}
+	if upload.OwnerID != owner {
+		return nil, status.Errorf(codes.NotFound, "upload not found")
+	}
+	return upload, nil
+}
+
+// uploadError converts an error of the upload store to a gRPC status
+func uploadError(err error, operation string) error {
+	switch {
+	case errors.Is(err, uploads.ErrUploadNotFound):
+		return status.Errorf(codes.NotFound, "upload not found")
+	case errors.Is(err, uploads.ErrOffsetMismatch):
+		return status.Errorf(codes.FailedPrecondition, "%v", err)
+	case errors.Is(err, uploads.ErrLengthExceeded):
+		return status.Errorf(codes.InvalidArgument, "%v", err)
+	case errors.Is(err, uploads.ErrUploadLocked):
+		return status.Errorf(codes.Aborted, "%v", err)
+	}
+	return status.Errorf(codes.Internal, "failed to %s: %v", operation, err)
+}
+
+// convertUploadToProto converts an upload to a proto upload
+func convertUploadToProto(u *uploads.Upload) *file.Upload {
+	return &file.Upload{
+		Id:          u.ID,
+		Length:      u.Length,
+		Offset:      u.Offset,
+		Name:        u.Name,
+		FolderId:    u.FolderID,
+		ContentType: u.ContentType,
+		Metadata:    u.Metadata,
+		CreatedAt:   u.CreatedAt.Format(time.RFC3339),
+		ExpiresAt:   u.ExpiresAt.Format(time.RFC3339),
+		FileId:      u.FileID,
+	}
+}
@@ -0,0 +1,98 @@
+package service
+
+import (
+	"context"
+	"sync"
+
+	"github.com/cloud-drive/proto-definitions/user"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// fakeUsers is an in-process user-service covering the calls file-service
+// makes: user lookups to share entries and storage reservations. Other
+// methods of the embedded client panic.
+type fakeUsers struct {
+	user.UserServiceClient
+
+	mu      sync.Mutex
+	byEmail map[string]*user.User
+	// used is the storage charged to each user
+	used map[string]int64
+	// released is the storage given back by each user
+	released map[string]int64
+	// limits caps the storage charged to a user; users without one have no limit
+	limits map[string]int64
+	// reconciled is the usage sent by the last reconciliation
+	reconciled map[string]int64
+}
+
+func newFakeUsers(users ...*user.User) *fakeUsers {
+	f := &fakeUsers{
+		byEmail:  make(map[string]*user.User),
+		used:     make(map[string]int64),
+		released: make(map[string]int64),
+		limits:   make(map[string]int64),
+	}
+	for _, u := range users {
+		f.byEmail[u.Email] = u
+	}
+	return f
+}
+
+func (f *fakeUsers) GetUserByEmail(ctx context.Context, in *user.GetUserByEmailRequest, opts ...grpc.CallOption) (*user.UserResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	u, ok := f.byEmail[in.Email]
+	if !ok {
+		return nil, status.Error(codes.NotFound, "user not found")
+	}
+	return &user.UserResponse{User: u}, nil
+}
+
+func (f *fakeUsers) ReserveStorage(ctx context.Context, in *user.StorageRequest, opts ...grpc.CallOption) (*user.StorageUsage, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if limit, ok := f.limits[in.UserId]; ok && f.used[in.UserId]+in.Bytes > limit {
+		return nil, status.Error(codes.ResourceExhausted, "storage quota exceeded")
+	}
+	f.used[in.UserId] += in.Bytes
+	return &user.StorageUsage{UserId: in.UserId, UsedBytes: f.used[in.UserId]}, nil
+}
+
+func (f *fakeUsers) ReleaseStorage(ctx context.Context, in *user.StorageRequest, opts ...grpc.CallOption) (*user.StorageUsage, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.used[in.UserId] -= in.Bytes
+	f.released[in.UserId] += in.Bytes
+	return &user.StorageUsage{UserId: in.UserId, UsedBytes: f.used[in.UserId]}, nil
+}
+
+func (f *fakeUsers) ReconcileStorageUsage(ctx context.Context, in *user.ReconcileStorageUsageRequest, opts ...grpc.CallOption) (*user.ReconcileStorageUsageResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.reconciled = in.UsedBytes
+	return &user.ReconcileStorageUsageResponse{Corrected: int32(len(in.UsedBytes))}, nil
+}
+
+// setLimit caps the storage charged to a user
+func (f *fakeUsers) setLimit(userID string, bytes int64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.limits[userID] = bytes
+}
+
+// reconciledUsage returns the usage of a user sent by the last reconciliation
+func (f *fakeUsers) reconciledUsage(userID string) int64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.reconciled[userID]
+}
+
+// usage returns the storage charged to and given back by a user
+func (f *fakeUsers) usage(userID string) (used, released int64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.used[userID], f.released[userID]
+}
@@ -0,0 +1,360 @@
+package service
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/cloud-drive/file-service/internal/models"
+	"github.com/cloud-drive/proto-definitions/file"
+	"github.com/cloud-drive/shared/interceptor"
+)
+
+const (
+	// maxNameLength is the longest file or folder name, as on most file systems
+	maxNameLength = 255
+	// maxFolderLength caps the length of a folder path
+	maxFolderLength = 1024
+	// maxListLimit caps the page size of ListFiles, ListChildren, ListTrash
+	// and ListSharedWithMe
+	maxListLimit = 1000
+	// maxChunkSize caps the data of one chunk of a streamed upload
+	maxChunkSize = 4 << 20
+)
+
+// Validators returns the request validation hooks of the file service by
+// full method name, run by the interceptor chain before the handlers
+func Validators() map[string]interceptor.ValidateFunc {
+	return map[string]interceptor.ValidateFunc{
+		"/file.FileService/UploadFile": func(req any) error {
+			r := req.(*file.UploadFileRequest)
+			return validateUploadTarget(r.Name, r.Folder, r.OnConflict)
+		},
+		"/file.FileService/DownloadFile": func(req any) error {
+			r := req.(*file.DownloadFileRequest)
+			if r.Version < 0 {
+				return errors.New("version must not be negative")
+			}
+			return validateID(r.Id)
+		},
+		// Every message of the stream is validated as it is received
+		"/file.FileService/UploadFileStream": func(req any) error {
+			switch payload := req.(*file.UploadFileStreamRequest).Payload.(type) {
+			case *file.UploadFileStreamRequest_Info:
+				info := payload.Info
+				return validateUploadTarget(info.Name, info.Folder, info.OnConflict)
+			case *file.UploadFileStreamRequest_Chunk:
+				if len(payload.Chunk.Data) > maxChunkSize {
+					return errors.New("chunk must be at most 4 MiB")
+				}
+				return nil
+			}
+			return errors.New("info or chunk is required")
+		},
+		"/file.FileService/DownloadFileStream": func(req any) error {
+			r := req.(*file.DownloadFileStreamRequest)
+			if r.Offset < 0 || r.Length < 0 || r.Version < 0 {
+				return errors.New("offset, length and version must not be negative")
+			}
+			return validateID(r.Id)
+		},
+		"/file.FileService/ListFiles": func(req any) error {
+			r := req.(*file.ListFilesRequest)
+			if err := validatePage(r.Limit, r.Offset); err != nil {
+				return err
+			}
+			return validateFolder(r.Folder)
+		},
+		"/file.FileService/GetFile": func(req any) error {
+			return validateID(req.(*file.GetFileRequest).Id)
+		},
+		"/file.FileService/GetDownloadUrl": func(req any) error {
+			return validateID(req.(*file.GetDownloadUrlRequest).Id)
+		},
+		"/file.FileService/MoveFile": func(req any) error {
+			r := req.(*file.MoveFileRequest)
+			if err := validateID(r.Id); err != nil {
+				return err
+			}
+			if r.Folder == "" && r.FolderId == "" {
+				return errors.New("folder or folder_id is required")
+			}
+			if err := validateConflict(r.OnConflict); err != nil {
+				return err
+			}
+			return validateFolder(r.Folder)
+		},
+		"/file.FileService/RenameFile": func(req any) error {
+			r := req.(*file.RenameFileRequest)
+			if err := validateID(r.Id); err != nil {
+				return err
+			}
+			if err := validateConflict(r.OnConflict); err != nil {
+				return err
+			}
+			return validateName(r.Name)
+		},
+		"/file.FileService/CopyFile": func(req any) error {
+			r := req.(*file.CopyFileRequest)
+			if err := validateID(r.Id); err != nil {
+				return err
+			}
+			if err := validateConflict(r.OnConflict); err != nil {
+				return err
+			}
+			return validateOptionalName(r.Name)
+		},
+		"/file.FileService/DeleteFile": func(req any) error {
+			return validateID(req.(*file.DeleteFileRequest).Id)
+		},
+		"/file.FileService/CreateFolder": func(req any) error {
+			r := req.(*file.CreateFolderRequest)
+			if r.OnConflict == string(models.ConflictOverwrite) {
+				return errors.New("on_conflict must be fail or rename")
+			}
+			if err := validateConflict(r.OnConflict); err != nil {
+				return err
+			}
+			return validateName(r.Name)
+		},
+		"/file.FileService/GetFolder": func(req any) error {
+			return validateID(req.(*file.GetFolderRequest).Id)
+		},
+		"/file.FileService/ListChildren": func(req any) error {
+			r := req.(*file.ListChildrenRequest)
+			if err := validateID(r.Id); err != nil {
+				return err
+			}
+			return validatePage(r.Limit, r.Offset)
+		},
+		"/file.FileService/MoveFolder": func(req any) error {
+			r := req.(*file.MoveFolderRequest)
+			if err := validateFolderID(r.Id); err != nil {
+				return err
+			}
+			if r.ParentId == "" {
+				return errors.New("parent_id is required")
+			}
+			return validateConflict(r.OnConflict)
+		},
+		"/file.FileService/RenameFolder": func(req any) error {
+			r := req.(*file.RenameFolderRequest)
+			if err := validateFolderID(r.Id); err != nil {
+				return err
+			}
+			if err := validateConflict(r.OnConflict); err != nil {
+				return err
+			}
+			return validateName(r.Name)
+		},
+		"/file.FileService/CopyFolder": func(req any) error {
+			r := req.(*file.CopyFolderRequest)
+			if err := validateFolderID(r.Id); err != nil {
+				return err
+			}
+			if err := validateConflict(r.OnConflict); err != nil {
+				return err
+			}
+			return validateOptionalName(r.Name)
+		},
+		"/file.FileService/DeleteFolder": func(req any) error {
+			return validateFolderID(req.(*file.DeleteFolderRequest).Id)
+		},
+		"/file.FileService/ListFileVersions": func(req any) error {
+			return validateID(req.(*file.ListFileVersionsRequest).Id)
+		},
+		"/file.FileService/GetFileVersion": func(req any) error {
+			r := req.(*file.GetFileVersionRequest)
+			return validateVersion(r.Id, r.Version)
+		},
+		"/file.FileService/RestoreFileVersion": func(req any) error {
+			r := req.(*file.RestoreFileVersionRequest)
+			return validateVersion(r.Id, r.Version)
+		},
+		"/file.FileService/ListTrash": func(req any) error {
+			r := req.(*file.ListTrashRequest)
+			return validatePage(r.Limit, r.Offset)
+		},
+		"/file.FileService/RestoreTrashItem": func(req any) error {
+			r := req.(*file.RestoreTrashItemRequest)
+			if err := validateConflict(r.OnConflict); err != nil {
+				return err
+			}
+			return validateID(r.Id)
+		},
+		"/file.FileService/DeleteTrashItem": func(req any) error {
+			return validateID(req.(*file.DeleteTrashItemRequest).Id)
+		},
+		"/file.FileService/CreateShare": func(req any) error {
+			r := req.(*file.CreateShareRequest)
+			if err := validateShareEntry(r.FileId, r.FolderId); err != nil {
+				return err
+			}
+			if r.Email == "" {
+				return errors.New("email is required")
+			}
+			if r.Role == "" {
+				return nil
+			}
+			return validateRole(r.Role)
+		},
+		"/file.FileService/ListShares": func(req any) error {
+			r := req.(*file.ListSharesRequest)
+			return validateShareEntry(r.FileId, r.FolderId)
+		},
+		"/file.FileService/UpdateShare": func(req any) error {
+			r := req.(*file.UpdateShareRequest)
+			if err := validateRole(r.Role); err != nil {
+				return err
+			}
+			return validateID(r.Id)
+		},
+		"/file.FileService/DeleteShare": func(req any) error {
+			return validateID(req.(*file.DeleteShareRequest).Id)
+		},
+		"/file.FileService/ListSharedWithMe": func(req any) error {
+			r := req.(*file.ListSharedWithMeRequest)
+			return validatePage(r.Limit, r.Offset)
+		},
+		"/file.FileService/ResolvePath": func(req any) error {
+			return validateFolder("/" + strings.TrimPrefix(req.(*file.ResolvePathRequest).Path, "/"))
+		},
+		"/file.FileService/CreateUpload": func(req any) error {
+			r := req.(*file.CreateUploadRequest)
+			if r.Length < 0 {
+				return errors.New("length must not be negative")
+			}
+			return validateUploadTarget(r.Name, r.Folder, r.OnConflict)
+		},
+		"/file.FileService/GetUpload": func(req any) error {
+			return validateID(req.(*file.GetUploadRequest).Id)
+		},
+		"/file.FileService/AppendUpload": func(req any) error {
+			r := req.(*file.AppendUploadRequest)
+			if r.Offset < 0 {
+				return errors.New("offset must not be negative")
+			}
+			return validateID(r.Id)
+		},
+		"/file.FileService/DeleteUpload": func(req any) error {
+			return validateID(req.(*file.DeleteUploadRequest).Id)
+		},
+	}
+}
+
+// validateUploadTarget checks the name, folder and conflict policy of a new file
+func validateUploadTarget(name, folder, onConflict string) error {
+	if err := validateName(name); err != nil {
+		return err
+	}
+	if err := validateConflict(onConflict); err != nil {
+		return err
+	}
+	return validateFolder(folder)
+}
+
+// validateVersion checks the file ID and version number of a version request
+func validateVersion(id string, version int32) error {
+	if version < 1 {
+		return errors.New("version must be at least 1")
+	}
+	return validateID(id)
+}
+
+// validateShareEntry requires exactly one of a file and a folder other than
+// the root folder, which cannot be shared
+func validateShareEntry(fileID, folderID string) error {
+	if (fileID == "") == (folderID == "") {
+		return errors.New("exactly one of file_id and folder_id is required")
+	}
+	if folderID == models.RootFolderID {
+		return errors.New("the root folder cannot be shared")
+	}
+	return nil
+}
+
+// validateRole accepts the roles that can be shared
+func validateRole(role string) error {
+	if !models.Role(role).Shareable() {
+		return errors.New("role must be viewer, commenter or editor")
+	}
+	return nil
+}
+
+func validateID(id string) error {
+	if id == "" {
+		return errors.New("id is required")
+	}
+	return nil
+}
+
+// validateFolderID rejects the root folder, which cannot be moved, renamed,
+// copied or deleted
+func validateFolderID(id string) error {
+	if id == models.RootFolderID {
+		return errors.New("the root folder cannot be changed")
+	}
+	return validateID(id)
+}
+
+// validatePage checks the limit and offset of a list request
+func validatePage(limit, offset int32) error {
+	if limit < 0 || limit > maxListLimit {
+		return errors.New("limit must be between 0 and 1000")
+	}
+	if offset < 0 {
+		return errors.New("offset must not be negative")
+	}
+	return nil
+}
+
+// validateConflict accepts an empty policy (fail) or one of the known policies
+func validateConflict(onConflict string) error {
+	switch models.ConflictPolicy(onConflict) {
+	case "", models.ConflictFail, models.ConflictRename, models.ConflictOverwrite:
+		return nil
+	}
+	return errors.New("on_conflict must be fail, rename or overwrite")
+}
+
+// validateOptionalName accepts an empty name, which keeps the current one
+func validateOptionalName(name string) error {
+	if name == "" {
+		return nil
+	}
+	return validateName(name)
+}
+
+// validateName accepts names that are a single path segment
+func validateName(name string) error {
+	switch {
+	case name == "":
+		return errors.New("name is required")
+	case len(name) > maxNameLength:
+		return errors.New("name must be at most 255 bytes")
+	case name == "." || name == "..":
+		return errors.New("name must not be . or ..")
+	case strings.ContainsAny(name, "/\x00"):
+		return errors.New("name must not contain / or NUL")
+	}
+	return nil
+}
+
+// validateFolder accepts an empty folder (the root) or an absolute path
+// whose segments are valid names
+func validateFolder(folder string) error {
+	if folder == "" || folder == "/" {
+		return nil
+	}
+	if !strings.HasPrefix(folder, "/") {
+		return errors.New("folder must be an absolute path")
+	}
+	if len(folder) > maxFolderLength {
+		return errors.New("folder must be at most 1024 bytes")
+	}
+	for _, segment := range strings.Split(strings.Trim(folder, "/"), "/") {
+		if err := validateName(segment); err != nil {
+			return errors.New("folder: " + err.Error())
+		}
+	}
+	return nil
+}
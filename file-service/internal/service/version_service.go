@@ -0,0 +1,138 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/cloud-drive/file-service/internal/models"
+	"github.com/cloud-drive/proto-definitions/file"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ListFileVersions liệt kê các phiên bản của file, mới nhất trước; phiên bản
+// đầu tiên là nội dung hiện tại
+func (s *FileService) ListFileVersions(ctx context.Context, req *file.ListFileVersionsRequest) (*file.ListFileVersionsResponse, error) {
+	fileModel, err := s.accessibleFile(ctx, req.Id, models.RoleViewer)
+	if err != nil {
+		return nil, err
+	}
+	versions, err := s.repo.ListVersions(ctx, fileModel.ID)
+	if err != nil {
+		return nil, entryError(err, "list file versions")
+	}
+
+	protoVersions := make([]*file.FileVersion, 0, len(versions))
+	for _, v := range versions {
+		protoVersions = append(protoVersions, convertVersionToProto(v))
+	}
+
+	return &file.ListFileVersionsResponse{
+		Versions: protoVersions,
+	}, nil
+}
+
+// GetFileVersion trả về một phiên bản của file
+func (s *FileService) GetFileVersion(ctx context.Context, req *file.GetFileVersionRequest) (*file.FileVersionResponse, error) {
+	fileModel, err := s.accessibleFile(ctx, req.Id, models.RoleViewer)
+	if err != nil {
+		return nil, err
+	}
+	v, err := s.repo.GetVersion(ctx, fileModel.ID, int(req.Version))
+	if err != nil {
+		return nil, entryError(err, "get file version")
+	}
+
+	return &file.FileVersionResponse{
+		Version: convertVersionToProto(v),
+	}, nil
+}
+
+// RestoreFileVersion đưa nội dung của một phiên bản cũ trở lại thành phiên bản
+// mới nhất. Phiên bản mới dùng chung blob với phiên bản cũ nhưng vẫn được tính
+// vào hạn mức lưu trữ như mọi phiên bản khác.
+func (s *FileService) RestoreFileVersion(ctx context.Context, req *file.RestoreFileVersionRequest) (*file.FileResponse, error) {
+	fileModel, err := s.accessibleFile(ctx, req.Id, models.RoleEditor)
+	if err != nil {
+		return nil, err
+	}
+	v, err := s.repo.GetVersion(ctx, fileModel.ID, int(req.Version))
+	if err != nil {
+		return nil, entryError(err, "get file version")
+	}
+	if v.Version == fileModel.Version {
+		return nil, status.Errorf(codes.FailedPrecondition, "version %d is already the current version", v.Version)
+	}
+	s.quotaMu.RLock()
+	defer s.quotaMu.RUnlock()
+
+	if err := s.quota.Reserve(ctx, v.OwnerID, v.Size); err != nil {
+		return nil, err
+	}
+	if err := s.blobs.Retain(ctx, v.BlobKey); err != nil {
+		s.quota.Release(ctx, v.OwnerID, v.Size)
+		return nil, status.Errorf(codes.Internal, "failed to restore file content: %v", err)
+	}
+	restored, err := s.repo.RestoreVersion(ctx, fileModel.ID, v.Version, time.Now())
+	if err != nil {
+		s.quota.Release(ctx, v.OwnerID, v.Size)
+		s.releaseBlob(ctx, v.BlobKey)
+		return nil, entryError(err, "restore file version")
+	}
+	s.metrics.VersionsCreated.Inc()
+
+	return &file.FileResponse{
+		File: convertFileToProto(restored),
+	}, nil
+}
+
+// PruneVersions deletes the earlier versions of files beyond the keep newest
+// ones or replaced more than maxAge ago, releasing their content and quota,
+// and returns how many were deleted. Zero keep or maxAge disables that limit;
+// current versions are never pruned.
+func (s *FileService) PruneVersions(ctx context.Context, keep int, maxAge time.Duration) (int, error) {
+	var replacedBefore time.Time
+	if maxAge > 0 {
+		replacedBefore = time.Now().Add(-maxAge)
+	}
+	s.quotaMu.RLock()
+	defer s.quotaMu.RUnlock()
+	pruned, err := s.repo.PruneVersions(ctx, keep, replacedBefore)
+	if err != nil {
+		return 0, err
+	}
+	s.releaseVersions(ctx, pruned)
+
+	s.metrics.VersionsPruned.Add(float64(len(pruned)))
+	for _, v := range pruned {
+		s.metrics.PrunedBytes.Add(float64(v.Size))
+	}
+	return len(pruned), nil
+}
+
+// fileAtVersion returns a file the calling user can read with the content
+// of version; 0 is the current version
+func (s *FileService) fileAtVersion(ctx context.Context, id string, version int32) (*models.File, error) {
+	fileModel, err := s.accessibleFile(ctx, id, models.RoleViewer)
+	if err != nil || version == 0 || int(version) == fileModel.Version {
+		return fileModel, err
+	}
+	v, err := s.repo.GetVersion(ctx, fileModel.ID, int(version))
+	if err != nil {
+		return nil, entryError(err, "get file version")
+	}
+	fileModel.SetContent(v)
+	return fileModel, nil
+}
+
+// convertVersionToProto converts a file version to a proto file version
+func convertVersionToProto(v *models.FileVersion) *file.FileVersion {
+	return &file.FileVersion{
+		Version:     int32(v.Version),
+		Size:        v.Size,
+		ContentType: v.ContentType,
+		Checksum:    v.Checksum,
+		CreatedAt:   v.CreatedAt.Format(time.RFC3339),
+		Current:     v.ReplacedAt.IsZero(),
+	}
+}
@@ -0,0 +1,458 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloud-drive/file-service/internal/metrics"
+	"github.com/google/uuid"
+)
+
+const (
+	// refSuffix is appended to the key of a blob for its reference record
+	refSuffix = ".ref"
+	// tempPrefix starts the keys content is written under before its digest
+	// is known
+	tempPrefix = "tmp-"
+)
+
+// Blob describes content stored by ContentStore.Put
+type Blob struct {
+	// Key is the hex SHA-256 digest of the content
+	Key  string
+	Size int64
+	// Deduplicated is set when the content was already stored and only
+	// gained a reference
+	Deduplicated bool
+}
+
+// Usage describes what a content store holds
+type Usage struct {
+	// Blobs is the number of stored blobs and StoredBytes their total size
+	Blobs       int64
+	StoredBytes int64
+	// ReferencedBytes is the size of the content as files see it: every
+	// blob counted once per reference
+	ReferencedBytes int64
+}
+
+// DedupRatio returns how many bytes files refer to per byte stored, 1 for an
+// empty store
+func (u Usage) DedupRatio() float64 {
+	if u.StoredBytes == 0 {
+		return 1
+	}
+	return float64(u.ReferencedBytes) / float64(u.StoredBytes)
+}
+
+// add counts ref in the usage, or removes it when sign is -1
+func (u *Usage) add(ref *blobRef, sign int64) {
+	u.Blobs += sign
+	u.StoredBytes += sign * ref.Size
+	u.ReferencedBytes += sign * ref.Size * ref.Refs
+}
+
+// Collected describes the blobs removed by Collect
+type Collected struct {
+	Blobs int
+	Bytes int64
+}
+
+// blobRef is the persisted reference count of a blob
+type blobRef struct {
+	Size int64 `json:"size"`
+	Refs int64 `json:"refs"`
+	// UnreferencedAt is when the last reference was released
+	UnreferencedAt time.Time `json:"unreferenced_at"`
+}
+
+// ContentStore keeps file content in a BlobStore under the SHA-256 digest of
+// its bytes with a reference count per blob, stored next to the blob as
+// "<key>.ref". Put and Retain add a reference and Release drops one. A blob
+// without references stays readable until Collect removes it once it has been
+// unreferenced for a grace period, so reads in flight are not cut off and
+// content stored again soon after is not written twice.
+//
+// The records are loaded into memory when the store is opened, so one
+// process owns the backend. Counts left by an earlier run only match the file
+// metadata kept with them; Reconcile corrects them from the metadata.
+type ContentStore struct {
+	blobs   BlobStore
+	metrics *metrics.Metrics
+
+	mu    sync.Mutex
+	refs  map[string]*blobRef
+	usage Usage
+}
+
+// NewContentStore loads the reference records of blobs and returns a store
+// using it
+func NewContentStore(ctx context.Context, blobs BlobStore, m *metrics.Metrics) (*ContentStore, error) {
+	s := &ContentStore{blobs: blobs, metrics: m, refs: make(map[string]*blobRef)}
+	if err := s.load(ctx); err != nil {
+		return nil, fmt.Errorf("load blob references: %w", err)
+	}
+	s.recordUsage()
+	return s, nil
+}
+
+// load reads the reference records. A blob whose record is missing, because
+// the service stopped between writing the two, is treated as unreferenced
+// since it was written; a record without its blob is dropped, and so is
+// content left under a temporary key by a Put that did not finish.
+func (s *ContentStore) load(ctx context.Context) error {
+	var records, temps []string
+	err := s.blobs.List(ctx, func(o Object) error {
+		switch {
+		case strings.HasPrefix(o.Key, tempPrefix):
+			temps = append(temps, o.Key)
+		case contentKey(o.Key):
+			s.refs[o.Key] = &blobRef{Size: o.Size, UnreferencedAt: o.ModTime}
+		default:
+			if key, ok := strings.CutSuffix(o.Key, refSuffix); ok && contentKey(key) {
+				records = append(records, key)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, key := range records {
+		ref := s.refs[key]
+		if ref == nil {
+			if err := s.blobs.Delete(ctx, key+refSuffix); err != nil && !errors.Is(err, ErrBlobNotFound) {
+				return err
+			}
+			continue
+		}
+		if err := s.readRef(ctx, key, ref); err != nil {
+			return err
+		}
+	}
+	for _, key := range temps {
+		if err := s.blobs.Delete(ctx, key); err != nil && !errors.Is(err, ErrBlobNotFound) {
+			return err
+		}
+	}
+	for _, ref := range s.refs {
+		s.usage.add(ref, 1)
+	}
+	return nil
+}
+
+// Put stores the content of r with one reference and returns its key.
+// Content is written under a temporary key while it is hashed, then copied
+// to its digest unless the same content is already stored. A failed Put
+// leaves neither a blob nor a reference.
+func (s *ContentStore) Put(ctx context.Context, r io.Reader) (Blob, error) {
+	tmpKey := tempPrefix + uuid.New().String()
+	hash := sha256.New()
+	n, err := s.blobs.Put(ctx, tmpKey, io.TeeReader(r, hash))
+	if err != nil {
+		return Blob{}, err
+	}
+	defer s.deleteTemp(ctx, tmpKey)
+	return s.commit(ctx, tmpKey, hex.EncodeToString(hash.Sum(nil)), n)
+}
+
+// PutHashed stores content whose SHA-256 digest key the caller computed
+// while receiving it, with one reference. Content already stored only gains a
+// reference without r being read; other content is written without hashing
+// it again. A failed PutHashed leaves neither a blob nor a reference.
+func (s *ContentStore) PutHashed(ctx context.Context, key string, r io.Reader) (Blob, error) {
+	if !contentKey(key) {
+		return Blob{}, fmt.Errorf("invalid content key %q", key)
+	}
+	s.mu.Lock()
+	if ref, ok := s.refs[key]; ok {
+		next := *ref
+		next.Refs++
+		next.UnreferencedAt = time.Time{}
+		err := s.setRef(ctx, key, ref, &next, false)
+		s.mu.Unlock()
+		if err != nil {
+			return Blob{}, err
+		}
+		s.metrics.DedupHits.Inc()
+		return Blob{Key: key, Size: next.Size, Deduplicated: true}, nil
+	}
+	s.mu.Unlock()
+
+	tmpKey := tempPrefix + uuid.New().String()
+	n, err := s.blobs.Put(ctx, tmpKey, r)
+	if err != nil {
+		return Blob{}, err
+	}
+	defer s.deleteTemp(ctx, tmpKey)
+	return s.commit(ctx, tmpKey, key, n)
+}
+
+// commit moves content written under tmpKey to its digest key unless the
+// same content is already stored, and adds a reference to it
+func (s *ContentStore) commit(ctx context.Context, tmpKey, key string, n int64) (Blob, error) {
+	// The copy runs without the lock; identical content put at the same time
+	// is copied to the same key with the same bytes
+	s.mu.Lock()
+	_, stored := s.refs[key]
+	s.mu.Unlock()
+	if !stored {
+		if err := s.blobs.Copy(ctx, tmpKey, key); err != nil {
+			return Blob{}, err
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ref, ok := s.refs[key]
+	if !ok && stored {
+		// Collected between the two checks
+		if err := s.blobs.Copy(ctx, tmpKey, key); err != nil {
+			return Blob{}, err
+		}
+	}
+	if !ok {
+		ref = &blobRef{Size: n}
+	}
+	next := *ref
+	next.Refs++
+	next.UnreferencedAt = time.Time{}
+	if err := s.setRef(ctx, key, ref, &next, !ok); err != nil {
+		if !ok {
+			s.blobs.Delete(ctx, key)
+		}
+		return Blob{}, err
+	}
+	if ok {
+		s.metrics.DedupHits.Inc()
+	}
+	return Blob{Key: key, Size: n, Deduplicated: ok}, nil
+}
+
+// Retain adds a reference to the blob
+func (s *ContentStore) Retain(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ref, ok := s.refs[key]
+	if !ok {
+		return ErrBlobNotFound
+	}
+	next := *ref
+	next.Refs++
+	next.UnreferencedAt = time.Time{}
+	return s.setRef(ctx, key, ref, &next, false)
+}
+
+// Release drops a reference to the blob; the blob is kept until Collect
+func (s *ContentStore) Release(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ref, ok := s.refs[key]
+	if !ok {
+		return ErrBlobNotFound
+	}
+	if ref.Refs == 0 {
+		return fmt.Errorf("blob %s has no references to release", key)
+	}
+	next := *ref
+	next.Refs--
+	if next.Refs == 0 {
+		next.UnreferencedAt = time.Now()
+	}
+	return s.setRef(ctx, key, ref, &next, false)
+}
+
+// Reconcile sets the reference count of every stored blob to its count in
+// refs, zero when it is missing, and returns the number of blobs corrected.
+// A blob that loses its last reference is collected after the grace period
+// counted from now. Blobs in refs that are not stored are logged.
+func (s *ContentStore) Reconcile(ctx context.Context, refs map[string]int64) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key := range refs {
+		if _, ok := s.refs[key]; !ok {
+			slog.WarnContext(ctx, "Referenced blob is not stored", "key", key)
+		}
+	}
+
+	corrected := 0
+	now := time.Now()
+	for key, ref := range s.refs {
+		if ref.Refs == refs[key] {
+			continue
+		}
+		next := *ref
+		next.Refs = refs[key]
+		if next.Refs == 0 {
+			next.UnreferencedAt = now
+		} else {
+			next.UnreferencedAt = time.Time{}
+		}
+		if err := s.setRef(ctx, key, ref, &next, false); err != nil {
+			return corrected, err
+		}
+		corrected++
+	}
+	return corrected, nil
+}
+
+// Open returns a reader for the blob; the caller closes it
+func (s *ContentStore) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	return s.blobs.Open(ctx, key)
+}
+
+// OpenRange returns a reader for length bytes of the blob starting at
+// offset; the caller closes it
+func (s *ContentStore) OpenRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	return s.blobs.OpenRange(ctx, key, offset, length)
+}
+
+// PresignGet returns a URL that downloads the blob without credentials until
+// expiry, or ErrPresignUnsupported
+func (s *ContentStore) PresignGet(ctx context.Context, key string, expiry time.Duration, filename string) (string, error) {
+	return s.blobs.PresignGet(ctx, key, expiry, filename)
+}
+
+// Collect removes the blobs that have had no references since before cutoff
+func (s *ContentStore) Collect(ctx context.Context, cutoff time.Time) (Collected, error) {
+	s.mu.Lock()
+	var candidates []string
+	for key, ref := range s.refs {
+		if ref.Refs == 0 && ref.UnreferencedAt.Before(cutoff) {
+			candidates = append(candidates, key)
+		}
+	}
+	s.mu.Unlock()
+
+	var collected Collected
+	defer s.recordUsage()
+	for _, key := range candidates {
+		if err := ctx.Err(); err != nil {
+			return collected, err
+		}
+		size, err := s.collect(ctx, key, cutoff)
+		if err != nil {
+			return collected, err
+		}
+		if size >= 0 {
+			collected.Blobs++
+			collected.Bytes += size
+			s.metrics.CollectedBlobs.Inc()
+			s.metrics.CollectedBytes.Add(float64(size))
+		}
+	}
+	return collected, nil
+}
+
+// collect removes one blob if it is still unreferenced and returns its size,
+// or -1 when it gained a reference in the meantime
+func (s *ContentStore) collect(ctx context.Context, key string, cutoff time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ref, ok := s.refs[key]
+	if !ok || ref.Refs > 0 || !ref.UnreferencedAt.Before(cutoff) {
+		return -1, nil
+	}
+	// The blob goes first: a record left by a crash is dropped on load
+	if err := s.blobs.Delete(ctx, key); err != nil && !errors.Is(err, ErrBlobNotFound) {
+		return 0, err
+	}
+	if err := s.blobs.Delete(ctx, key+refSuffix); err != nil && !errors.Is(err, ErrBlobNotFound) {
+		return 0, err
+	}
+	delete(s.refs, key)
+	s.usage.add(ref, -1)
+	return ref.Size, nil
+}
+
+// Usage returns the totals kept with the reference records
+func (s *ContentStore) Usage() Usage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.usage
+}
+
+// Ping checks that the backend is reachable
+func (s *ContentStore) Ping(ctx context.Context) error {
+	return s.blobs.Ping(ctx)
+}
+
+// setRef persists the new reference record of a blob and then updates the
+// in-memory copy; created is set for a blob that had no record. The caller
+// holds the lock.
+func (s *ContentStore) setRef(ctx context.Context, key string, old, next *blobRef, created bool) error {
+	data, err := json.Marshal(next)
+	if err != nil {
+		return err
+	}
+	if _, err := s.blobs.Put(ctx, key+refSuffix, bytes.NewReader(data)); err != nil {
+		return err
+	}
+	if !created {
+		s.usage.add(old, -1)
+	}
+	s.refs[key] = next
+	s.usage.add(next, 1)
+	s.recordUsageLocked()
+	return nil
+}
+
+// readRef decodes the stored reference record of a blob into ref
+func (s *ContentStore) readRef(ctx context.Context, key string, ref *blobRef) error {
+	r, err := s.blobs.Open(ctx, key+refSuffix)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	if err := json.NewDecoder(r).Decode(ref); err != nil {
+		return fmt.Errorf("decode reference of blob %s: %w", key, err)
+	}
+	return nil
+}
+
+// deleteTemp removes the temporary copy of put content. A failure only
+// leaves it until the next start, so it is logged rather than returned.
+func (s *ContentStore) deleteTemp(ctx context.Context, key string) {
+	if err := s.blobs.Delete(context.WithoutCancel(ctx), key); err != nil && !errors.Is(err, ErrBlobNotFound) {
+		slog.WarnContext(ctx, "Failed to delete temporary blob", "key", key, "error", err)
+	}
+}
+
+// recordUsage updates the usage and dedup gauges
+func (s *ContentStore) recordUsage() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.recordUsageLocked()
+}
+
+// recordUsageLocked updates the gauges; the caller holds the lock
+func (s *ContentStore) recordUsageLocked() {
+	s.metrics.StoredBlobs.Set(float64(s.usage.Blobs))
+	s.metrics.StoredBytes.Set(float64(s.usage.StoredBytes))
+	s.metrics.ReferencedBytes.Set(float64(s.usage.ReferencedBytes))
+	s.metrics.DedupRatio.Set(s.usage.DedupRatio())
+}
+
+// contentKey reports whether key is a lowercase hex SHA-256 digest
+func contentKey(key string) bool {
+	if len(key) != sha256.Size*2 {
+		return false
+	}
+	for _, c := range key {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
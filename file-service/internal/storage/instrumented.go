@@ -0,0 +1,116 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/cloud-drive/file-service/internal/metrics"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// InstrumentedBlobStore records a trace span, latency and errors for every
+// call to the wrapped backend
+type InstrumentedBlobStore struct {
+	next    BlobStore
+	metrics *metrics.Metrics
+	tracer  trace.Tracer
+}
+
+// NewInstrumentedBlobStore wraps next with tracing and Prometheus instrumentation
+func NewInstrumentedBlobStore(next BlobStore, m *metrics.Metrics) *InstrumentedBlobStore {
+	return &InstrumentedBlobStore{
+		next:    next,
+		metrics: m,
+		tracer:  otel.Tracer("github.com/cloud-drive/file-service/internal/storage"),
+	}
+}
+
+// begin starts a span for operation and returns the function that ends it
+// and records the metrics
+func (s *InstrumentedBlobStore) begin(ctx context.Context, operation string) (context.Context, func(error)) {
+	ctx, span := s.tracer.Start(ctx, "BlobStore."+operation,
+		trace.WithSpanKind(trace.SpanKindInternal),
+		trace.WithAttributes(attribute.String("storage.operation", operation)),
+	)
+	start := time.Now()
+	return ctx, func(err error) {
+		s.metrics.StorageDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+		if err != nil && !errors.Is(err, ErrBlobNotFound) {
+			s.metrics.StorageErrors.WithLabelValues(operation).Inc()
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}
+}
+
+// Put stores a blob
+func (s *InstrumentedBlobStore) Put(ctx context.Context, key string, r io.Reader) (int64, error) {
+	ctx, end := s.begin(ctx, "put")
+	n, err := s.next.Put(ctx, key, r)
+	end(err)
+	return n, err
+}
+
+// Open opens a blob. Only opening is measured, not reading.
+func (s *InstrumentedBlobStore) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	ctx, end := s.begin(ctx, "open")
+	rc, err := s.next.Open(ctx, key)
+	end(err)
+	return rc, err
+}
+
+// OpenRange opens part of a blob. Only opening is measured, not reading.
+func (s *InstrumentedBlobStore) OpenRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	ctx, end := s.begin(ctx, "open_range")
+	rc, err := s.next.OpenRange(ctx, key, offset, length)
+	end(err)
+	return rc, err
+}
+
+// Copy copies a blob inside the backend
+func (s *InstrumentedBlobStore) Copy(ctx context.Context, src, dst string) error {
+	ctx, end := s.begin(ctx, "copy")
+	err := s.next.Copy(ctx, src, dst)
+	end(err)
+	return err
+}
+
+// Delete removes a blob
+func (s *InstrumentedBlobStore) Delete(ctx context.Context, key string) error {
+	ctx, end := s.begin(ctx, "delete")
+	err := s.next.Delete(ctx, key)
+	end(err)
+	return err
+}
+
+// List lists the blobs; the time spent in fn is measured too
+func (s *InstrumentedBlobStore) List(ctx context.Context, fn func(Object) error) error {
+	ctx, end := s.begin(ctx, "list")
+	err := s.next.List(ctx, fn)
+	end(err)
+	return err
+}
+
+// PresignGet signs a download URL. ErrPresignUnsupported is not an error of
+// the backend and is not counted.
+func (s *InstrumentedBlobStore) PresignGet(ctx context.Context, key string, expiry time.Duration, filename string) (string, error) {
+	ctx, end := s.begin(ctx, "presign")
+	url, err := s.next.PresignGet(ctx, key, expiry, filename)
+	if errors.Is(err, ErrPresignUnsupported) {
+		end(nil)
+	} else {
+		end(err)
+	}
+	return url, err
+}
+
+// Ping checks the wrapped store without recording it
+func (s *InstrumentedBlobStore) Ping(ctx context.Context) error {
+	return s.next.Ping(ctx)
+}
@@ -0,0 +1,236 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// LocalStore keeps blobs as files under a directory, spread over
+// sub-directories named after the first two characters of the key so no
+// single directory grows too large. Writes go to a temporary file that is
+// renamed into place, so readers never see a partial blob.
+type LocalStore struct {
+	dir string
+}
+
+// NewLocalStore creates the directory if needed and returns a store using it
+func NewLocalStore(dir string) (*LocalStore, error) {
+	tmpDir := filepath.Join(dir, "tmp")
+	if err := os.MkdirAll(tmpDir, 0o750); err != nil {
+		return nil, fmt.Errorf("create storage directory: %w", err)
+	}
+	// Temporary files are left only by writes that crashed
+	entries, err := os.ReadDir(tmpDir)
+	if err != nil {
+		return nil, fmt.Errorf("read storage directory: %w", err)
+	}
+	for _, entry := range entries {
+		os.Remove(filepath.Join(tmpDir, entry.Name()))
+	}
+	return &LocalStore{dir: dir}, nil
+}
+
+// path returns where the blob of key is stored
+func (s *LocalStore) path(key string) (string, error) {
+	if !validKey(key) {
+		return "", ErrInvalidKey
+	}
+	return filepath.Join(s.dir, key[:2], key), nil
+}
+
+// open opens the file of a blob
+func (s *LocalStore) open(key string) (*os.File, error) {
+	target, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(target)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrBlobNotFound
+	}
+	return f, err
+}
+
+// Put writes the content to a temporary file and renames it into place
+func (s *LocalStore) Put(ctx context.Context, key string, r io.Reader) (int64, error) {
+	target, err := s.path(key)
+	if err != nil {
+		return 0, err
+	}
+	tmp, err := os.CreateTemp(filepath.Join(s.dir, "tmp"), "put-*")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name())
+
+	n, err := io.Copy(tmp, contextReader{ctx: ctx, r: r})
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return 0, err
+	}
+	if err := s.place(tmp.Name(), target); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// Open opens the blob for reading
+func (s *LocalStore) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	f, err := s.open(key)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// OpenRange opens the blob and seeks to offset
+func (s *LocalStore) OpenRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	f, err := s.open(key)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return rangeReader{Reader: io.LimitReader(f, length), Closer: f}, nil
+}
+
+// Copy hard-links the blob under the new key, falling back to copying the
+// bytes on file systems without links
+func (s *LocalStore) Copy(ctx context.Context, src, dst string) error {
+	source, err := s.path(src)
+	if err != nil {
+		return err
+	}
+	target, err := s.path(dst)
+	if err != nil {
+		return err
+	}
+
+	tmp := filepath.Join(s.dir, "tmp", "copy-"+dst)
+	os.Remove(tmp)
+	err = os.Link(source, tmp)
+	if errors.Is(err, fs.ErrNotExist) {
+		return ErrBlobNotFound
+	}
+	if err != nil {
+		f, err := s.open(src)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = s.Put(ctx, dst, f)
+		return err
+	}
+	defer os.Remove(tmp)
+	return s.place(tmp, target)
+}
+
+// Delete removes the file of the blob. Readers that already opened it keep
+// reading it.
+func (s *LocalStore) Delete(ctx context.Context, key string) error {
+	target, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(target)
+	if errors.Is(err, fs.ErrNotExist) {
+		return ErrBlobNotFound
+	}
+	return err
+}
+
+// List walks the shard directories
+func (s *LocalStore) List(ctx context.Context, fn func(Object) error) error {
+	shards, err := os.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+	for _, shard := range shards {
+		if !shard.IsDir() || len(shard.Name()) != 2 {
+			continue
+		}
+		entries, err := os.ReadDir(filepath.Join(s.dir, shard.Name()))
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if !entry.Type().IsRegular() || !validKey(entry.Name()) {
+				continue
+			}
+			info, err := entry.Info()
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if err := fn(Object{Key: entry.Name(), Size: info.Size(), ModTime: info.ModTime()}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// PresignGet is not supported: blobs on local disk are only served through
+// the service
+func (s *LocalStore) PresignGet(ctx context.Context, key string, expiry time.Duration, filename string) (string, error) {
+	return "", ErrPresignUnsupported
+}
+
+// Ping checks that the storage directory still exists
+func (s *LocalStore) Ping(ctx context.Context) error {
+	info, err := os.Stat(s.dir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", s.dir)
+	}
+	return nil
+}
+
+// place renames a finished temporary file to target, creating its shard
+// directory if needed
+func (s *LocalStore) place(tmp, target string) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0o750); err != nil {
+		return err
+	}
+	return os.Rename(tmp, target)
+}
+
+// rangeReader reads part of a blob and closes the whole blob
+type rangeReader struct {
+	io.Reader
+	io.Closer
+}
+
+// contextReader stops a copy once the context is cancelled, for example when
+// the client goes away in the middle of an upload
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c contextReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
@@ -0,0 +1,232 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// maxCopySize is the largest object S3 copies in a single request
+const maxCopySize = 5 << 30
+
+// S3Options configures an S3Store
+type S3Options struct {
+	// Endpoint is the host[:port] of the S3 API the service talks to
+	Endpoint string
+	// PublicEndpoint is the host[:port] download URLs point to, when clients
+	// reach the storage under another name than the service; defaults to
+	// Endpoint
+	PublicEndpoint string
+	Region         string
+	Bucket         string
+	// AccessKey and SecretKey are static credentials. Without them the
+	// credentials are taken from the AWS_* environment variables, the AWS
+	// credentials file or the instance role.
+	AccessKey string
+	SecretKey string
+	UseTLS    bool
+	// PartSize is the size of the parts content is uploaded in; it bounds
+	// both the memory a Put uses and, with at most 10000 parts, the size of
+	// a blob
+	PartSize uint64
+}
+
+// S3Store keeps blobs as objects in a bucket of an S3-compatible object
+// storage such as AWS S3 or MinIO. Content is uploaded in parts as it is
+// read, copies happen inside the storage and downloads can be handed to
+// clients as presigned URLs.
+type S3Store struct {
+	client   *minio.Client
+	core     minio.Core
+	public   *minio.Client
+	bucket   string
+	partSize uint64
+}
+
+// NewS3Store connects to the storage and checks that the bucket exists
+func NewS3Store(ctx context.Context, opts S3Options) (*S3Store, error) {
+	creds := credentials.NewStaticV4(opts.AccessKey, opts.SecretKey, "")
+	if opts.AccessKey == "" {
+		creds = credentials.NewChainCredentials([]credentials.Provider{
+			&credentials.EnvAWS{},
+			&credentials.FileAWSCredentials{},
+			&credentials.IAM{Client: &http.Client{Transport: http.DefaultTransport}},
+		})
+	}
+	clientOpts := &minio.Options{Creds: creds, Secure: opts.UseTLS, Region: opts.Region}
+
+	client, err := minio.New(opts.Endpoint, clientOpts)
+	if err != nil {
+		return nil, fmt.Errorf("create s3 client: %w", err)
+	}
+	public := client
+	if opts.PublicEndpoint != "" && opts.PublicEndpoint != opts.Endpoint {
+		// Presigning is local, the region is given, so this client never
+		// has to reach the public endpoint itself
+		public, err = minio.New(opts.PublicEndpoint, clientOpts)
+		if err != nil {
+			return nil, fmt.Errorf("create s3 client for public endpoint: %w", err)
+		}
+	}
+
+	s := &S3Store{client: client, core: minio.Core{Client: client}, public: public, bucket: opts.Bucket, partSize: opts.PartSize}
+	if err := s.Ping(ctx); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Put uploads the content in parts of PartSize as it is read. An upload that
+// fails is aborted, so no object appears.
+func (s *S3Store) Put(ctx context.Context, key string, r io.Reader) (int64, error) {
+	if !validKey(key) {
+		return 0, ErrInvalidKey
+	}
+	info, err := s.client.PutObject(ctx, s.bucket, key, contextReader{ctx: ctx, r: r}, -1, minio.PutObjectOptions{
+		ContentType: "application/octet-stream",
+		PartSize:    s.partSize,
+	})
+	if err != nil {
+		return 0, err
+	}
+	return info.Size, nil
+}
+
+// Open returns a reader for the object
+func (s *S3Store) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	return s.get(ctx, key, minio.GetObjectOptions{})
+}
+
+// OpenRange asks the storage for the bytes of the range only
+func (s *S3Store) OpenRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	if length == 0 {
+		// A range request cannot ask for nothing
+		if err := s.stat(ctx, key); err != nil {
+			return nil, err
+		}
+		return io.NopCloser(strings.NewReader("")), nil
+	}
+	opts := minio.GetObjectOptions{}
+	if err := opts.SetRange(offset, offset+length-1); err != nil {
+		return nil, err
+	}
+	return s.get(ctx, key, opts)
+}
+
+// Copy copies the object inside the storage. A single copy request takes
+// objects up to 5 GiB; larger ones are copied part by part.
+func (s *S3Store) Copy(ctx context.Context, src, dst string) error {
+	if !validKey(src) || !validKey(dst) {
+		return ErrInvalidKey
+	}
+	info, err := s.client.StatObject(ctx, s.bucket, src, minio.StatObjectOptions{})
+	if err != nil {
+		return mapS3Error(err)
+	}
+	dstOpts := minio.CopyDestOptions{Bucket: s.bucket, Object: dst}
+	srcOpts := minio.CopySrcOptions{Bucket: s.bucket, Object: src, MatchETag: info.ETag}
+	if info.Size <= maxCopySize {
+		_, err = s.client.CopyObject(ctx, dstOpts, srcOpts)
+	} else {
+		_, err = s.client.ComposeObject(ctx, dstOpts, srcOpts)
+	}
+	return mapS3Error(err)
+}
+
+// Delete removes the object. S3 does not tell whether it existed, so a
+// missing object is not reported.
+func (s *S3Store) Delete(ctx context.Context, key string) error {
+	if !validKey(key) {
+		return ErrInvalidKey
+	}
+	return mapS3Error(s.client.RemoveObject(ctx, s.bucket, key, minio.RemoveObjectOptions{}))
+}
+
+// List lists the objects of the bucket with valid keys
+func (s *S3Store) List(ctx context.Context, fn func(Object) error) error {
+	// Cancelling stops the listing goroutine when fn returns early
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	for obj := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{Recursive: true}) {
+		if obj.Err != nil {
+			return obj.Err
+		}
+		if !validKey(obj.Key) {
+			continue
+		}
+		if err := fn(Object{Key: obj.Key, Size: obj.Size, ModTime: obj.LastModified}); err != nil {
+			return err
+		}
+	}
+	return ctx.Err()
+}
+
+// PresignGet signs a GET URL on the public endpoint that makes the storage
+// send the object as an attachment named filename
+func (s *S3Store) PresignGet(ctx context.Context, key string, expiry time.Duration, filename string) (string, error) {
+	if !validKey(key) {
+		return "", ErrInvalidKey
+	}
+	params := url.Values{}
+	if disposition := mime.FormatMediaType("attachment", map[string]string{"filename": filename}); disposition != "" {
+		params.Set("response-content-disposition", disposition)
+	}
+	u, err := s.public.PresignedGetObject(ctx, s.bucket, key, expiry, params)
+	if err != nil {
+		return "", err
+	}
+	return u.String(), nil
+}
+
+// Ping checks that the bucket exists and the credentials can reach it
+func (s *S3Store) Ping(ctx context.Context) error {
+	ok, err := s.client.BucketExists(ctx, s.bucket)
+	if err != nil {
+		return fmt.Errorf("check bucket %s: %w", s.bucket, err)
+	}
+	if !ok {
+		return fmt.Errorf("bucket %s does not exist", s.bucket)
+	}
+	return nil
+}
+
+// get sends the GET request right away, so a missing object is reported here
+// rather than on the first read
+func (s *S3Store) get(ctx context.Context, key string, opts minio.GetObjectOptions) (io.ReadCloser, error) {
+	if !validKey(key) {
+		return nil, ErrInvalidKey
+	}
+	body, _, _, err := s.core.GetObject(ctx, s.bucket, key, opts)
+	if err != nil {
+		return nil, mapS3Error(err)
+	}
+	return body, nil
+}
+
+// stat checks that the object exists
+func (s *S3Store) stat(ctx context.Context, key string) error {
+	if !validKey(key) {
+		return ErrInvalidKey
+	}
+	_, err := s.client.StatObject(ctx, s.bucket, key, minio.StatObjectOptions{})
+	return mapS3Error(err)
+}
+
+// mapS3Error turns a missing object into ErrBlobNotFound
+func mapS3Error(err error) error {
+	if err == nil {
+		return nil
+	}
+	if code := minio.ToErrorResponse(err).Code; code == "NoSuchKey" || code == "NotFound" {
+		return fmt.Errorf("%w: %w", ErrBlobNotFound, err)
+	}
+	return err
+}
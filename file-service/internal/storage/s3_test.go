@@ -0,0 +1,265 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testPartSize is the smallest part size S3 accepts
+const testPartSize = 5 << 20
+
+// newTestS3Store returns an S3Store using an in-process fake S3, which it
+// also returns, with download URLs pointing to the fake under another name
+func newTestS3Store(t *testing.T) (*S3Store, *fakeS3) {
+	t.Helper()
+	fake := newFakeS3("blobs")
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+	endpoint := strings.TrimPrefix(srv.URL, "http://")
+	_, port, _ := strings.Cut(endpoint, ":")
+
+	store, err := NewS3Store(context.Background(), S3Options{
+		Endpoint:       endpoint,
+		PublicEndpoint: "localhost:" + port,
+		Region:         "us-east-1",
+		Bucket:         "blobs",
+		AccessKey:      "test",
+		SecretKey:      "test-secret",
+		PartSize:       testPartSize,
+	})
+	if err != nil {
+		t.Fatalf("NewS3Store: %v", err)
+	}
+	return store, fake
+}
+
+// randomBytes returns n reproducible random bytes
+func randomBytes(n int) []byte {
+	data := make([]byte, n)
+	rand.New(rand.NewSource(int64(n))).Read(data)
+	return data
+}
+
+// readAll reads a blob opened with open and closes it
+func readAll(t *testing.T, open func() (io.ReadCloser, error)) []byte {
+	t.Helper()
+	r, err := open()
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	return data
+}
+
+func TestS3PutUploadsInParts(t *testing.T) {
+	store, fake := newTestS3Store(t)
+	ctx := context.Background()
+	content := randomBytes(2*testPartSize + 12345)
+
+	n, err := store.Put(ctx, "blob-1", bytes.NewReader(content))
+	if err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if n != int64(len(content)) {
+		t.Fatalf("Put = %d bytes, want %d", n, len(content))
+	}
+	if got := fake.count("UploadPart"); got != 3 {
+		t.Errorf("content uploaded in %d parts, want 3", got)
+	}
+	if got := fake.count("CompleteMultipartUpload"); got != 1 {
+		t.Errorf("%d multipart uploads completed, want 1", got)
+	}
+	if got := readAll(t, func() (io.ReadCloser, error) { return store.Open(ctx, "blob-1") }); !bytes.Equal(got, content) {
+		t.Fatalf("stored content differs from the content put")
+	}
+}
+
+// failingReader returns its data and then err
+type failingReader struct {
+	data []byte
+	err  error
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	if len(r.data) == 0 {
+		return 0, r.err
+	}
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+func TestS3PutAbortsFailedUpload(t *testing.T) {
+	store, fake := newTestS3Store(t)
+	errBroken := errors.New("connection reset")
+
+	_, err := store.Put(context.Background(), "blob-1", &failingReader{data: randomBytes(testPartSize + 1), err: errBroken})
+	if !errors.Is(err, errBroken) {
+		t.Fatalf("Put = %v, want the reader error", err)
+	}
+	if fake.object("blob-1") != nil {
+		t.Fatal("object stored after a failed upload")
+	}
+	if got := fake.pendingUploads(); got != 0 {
+		t.Fatalf("%d multipart uploads left behind, want them aborted", got)
+	}
+}
+
+func TestS3OpenRange(t *testing.T) {
+	store, fake := newTestS3Store(t)
+	ctx := context.Background()
+	content := randomBytes(1000)
+	fake.put("blob-1", bytes.NewReader(content))
+	before := fake.count("GETObject")
+
+	for _, tc := range []struct {
+		offset, length int64
+	}{
+		{0, 10},
+		{500, 250},
+		{990, 10},
+		{0, 1000},
+		{400, 0},
+	} {
+		got := readAll(t, func() (io.ReadCloser, error) { return store.OpenRange(ctx, "blob-1", tc.offset, tc.length) })
+		if want := content[tc.offset : tc.offset+tc.length]; !bytes.Equal(got, want) {
+			t.Errorf("OpenRange(%d, %d) = %d bytes, want %d bytes at the offset", tc.offset, tc.length, len(got), len(want))
+		}
+	}
+	if got := fake.count("GETObject") - before; got != 4 {
+		t.Errorf("%d GET requests, want one per non-empty range", got)
+	}
+
+	for _, length := range []int64{0, 10} {
+		if _, err := store.OpenRange(ctx, "missing", 0, length); !errors.Is(err, ErrBlobNotFound) {
+			t.Errorf("OpenRange of a missing blob with length %d = %v, want ErrBlobNotFound", length, err)
+		}
+	}
+}
+
+func TestS3Copy(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("single request", func(t *testing.T) {
+		store, fake := newTestS3Store(t)
+		content := randomBytes(4096)
+		fake.put("src", bytes.NewReader(content))
+
+		if err := store.Copy(ctx, "src", "dst"); err != nil {
+			t.Fatalf("Copy: %v", err)
+		}
+		if got := fake.count("CopyObject"); got != 1 {
+			t.Errorf("%d CopyObject requests, want 1", got)
+		}
+		if got := readAll(t, func() (io.ReadCloser, error) { return store.Open(ctx, "dst") }); !bytes.Equal(got, content) {
+			t.Fatal("copy differs from the source")
+		}
+	})
+
+	t.Run("larger than a single copy", func(t *testing.T) {
+		store, fake := newTestS3Store(t)
+		size := int64(maxCopySize + 3<<20)
+		fake.put("src", patternContent(size))
+
+		if err := store.Copy(ctx, "src", "dst"); err != nil {
+			t.Fatalf("Copy: %v", err)
+		}
+		if got := fake.count("CopyObject"); got != 0 {
+			t.Errorf("%d CopyObject requests for an object over %d bytes, want none", got, maxCopySize)
+		}
+		if got := fake.count("UploadPartCopy"); got < 2 {
+			t.Errorf("%d UploadPartCopy requests, want the object copied in parts", got)
+		}
+		dst := fake.object("dst")
+		if dst == nil || dst.Size() != size {
+			t.Fatalf("copy is missing or has the wrong size")
+		}
+		// Check bytes around the start, the 5 GiB mark and the end
+		for _, offset := range []int64{0, maxCopySize - 8, size - 16} {
+			got := readAll(t, func() (io.ReadCloser, error) { return store.OpenRange(ctx, "dst", offset, 16) })
+			for i, b := range got {
+				if want := patternByte(offset + int64(i)); b != want {
+					t.Fatalf("byte %d of the copy = %d, want %d", offset+int64(i), b, want)
+				}
+			}
+		}
+	})
+
+	t.Run("missing source", func(t *testing.T) {
+		store, _ := newTestS3Store(t)
+		if err := store.Copy(ctx, "missing", "dst"); !errors.Is(err, ErrBlobNotFound) {
+			t.Fatalf("Copy = %v, want ErrBlobNotFound", err)
+		}
+	})
+}
+
+func TestS3PresignGet(t *testing.T) {
+	store, fake := newTestS3Store(t)
+	content := randomBytes(2048)
+	fake.put("blob-1", bytes.NewReader(content))
+
+	signed, err := store.PresignGet(context.Background(), "blob-1", 15*time.Minute, "report 2024.pdf")
+	if err != nil {
+		t.Fatalf("PresignGet: %v", err)
+	}
+	u, err := url.Parse(signed)
+	if err != nil {
+		t.Fatalf("parse URL: %v", err)
+	}
+	if !strings.HasPrefix(u.Host, "localhost:") {
+		t.Errorf("URL host = %s, want the public endpoint", u.Host)
+	}
+	q := u.Query()
+	if q.Get("X-Amz-Expires") != "900" || q.Get("X-Amz-Signature") == "" {
+		t.Errorf("URL is not signed for 15 minutes: %s", signed)
+	}
+
+	resp, err := http.Get(signed)
+	if err != nil {
+		t.Fatalf("GET signed URL: %v", err)
+	}
+	defer resp.Body.Close()
+	got, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || !bytes.Equal(got, content) {
+		t.Fatalf("GET signed URL = %s with %d bytes, want the blob", resp.Status, len(got))
+	}
+	if want := `attachment; filename="report 2024.pdf"`; resp.Header.Get("Content-Disposition") != want {
+		t.Errorf("Content-Disposition = %q, want %q", resp.Header.Get("Content-Disposition"), want)
+	}
+
+	if _, err := store.PresignGet(context.Background(), "../blob", time.Minute, "x"); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("PresignGet of an invalid key = %v, want ErrInvalidKey", err)
+	}
+}
+
+func TestS3ListSkipsInvalidKeys(t *testing.T) {
+	store, fake := newTestS3Store(t)
+	fake.put("blob-1", bytes.NewReader(randomBytes(10)))
+	fake.put("blob-2", bytes.NewReader(randomBytes(20)))
+	fake.put("Other/Object", bytes.NewReader(randomBytes(30)))
+
+	var listed []Object
+	err := store.List(context.Background(), func(obj Object) error {
+		listed = append(listed, obj)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(listed) != 2 || listed[0].Key != "blob-1" || listed[0].Size != 10 || listed[1].Key != "blob-2" || listed[1].Size != 20 {
+		t.Fatalf("List = %+v, want blob-1 and blob-2 with their sizes", listed)
+	}
+}
@@ -0,0 +1,535 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// fakeS3 is an in-process S3 API holding one bucket, covering the requests
+// S3Store makes: object reads, writes, copies, listing and multipart uploads
+// including part copies, with the size limits of S3 on copies and parts.
+// Objects built by copies refer to ranges of their source, so objects too
+// large for memory can be copied.
+type fakeS3 struct {
+	bucket string
+
+	mu      sync.Mutex
+	objects map[string]*fakeObject
+	uploads map[string]map[int]*fakeObject
+	calls   []string
+	nextID  int
+}
+
+type fakeObject struct {
+	content fakeContent
+	etag    string
+	modTime time.Time
+}
+
+// fakeContent is the content of a fake object
+type fakeContent interface {
+	io.ReaderAt
+	Size() int64
+}
+
+func newFakeS3(bucket string) *fakeS3 {
+	return &fakeS3{
+		bucket:  bucket,
+		objects: make(map[string]*fakeObject),
+		uploads: make(map[string]map[int]*fakeObject),
+	}
+}
+
+// put stores an object directly, as if it had been uploaded
+func (f *fakeS3) put(key string, content fakeContent) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.objects[key] = f.newObject(content)
+}
+
+// object returns the content of an object, or nil
+func (f *fakeS3) object(key string) fakeContent {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if obj, ok := f.objects[key]; ok {
+		return obj.content
+	}
+	return nil
+}
+
+// count returns how many requests of an operation were made
+func (f *fakeS3) count(op string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n := 0
+	for _, call := range f.calls {
+		if call == op {
+			n++
+		}
+	}
+	return n
+}
+
+// pendingUploads returns the number of multipart uploads neither completed
+// nor aborted
+func (f *fakeS3) pendingUploads() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.uploads)
+}
+
+// newObject gives content an ETag: the MD5 for content in memory, a serial
+// number for content made of other objects. The caller holds mu.
+func (f *fakeS3) newObject(content fakeContent) *fakeObject {
+	var etag string
+	if r, ok := content.(*bytes.Reader); ok {
+		h := md5.New()
+		io.Copy(h, io.NewSectionReader(r, 0, r.Size()))
+		etag = hex.EncodeToString(h.Sum(nil))
+	} else {
+		f.nextID++
+		etag = fmt.Sprintf("%032x", f.nextID)
+	}
+	return &fakeObject{content: content, etag: etag, modTime: time.Now().UTC().Truncate(time.Second)}
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if bucket != f.bucket {
+		writeS3Error(w, r, http.StatusNotFound, "NoSuchBucket", "bucket does not exist")
+		return
+	}
+	q := r.URL.Query()
+	copySource := r.Header.Get("X-Amz-Copy-Source")
+	switch {
+	case key == "" && r.Method == http.MethodHead:
+		f.record("HeadBucket")
+	case key == "" && r.Method == http.MethodGet && q.Get("list-type") == "2":
+		f.listObjects(w)
+	case r.Method == http.MethodPost && q.Has("uploads"):
+		f.createUpload(w, key)
+	case r.Method == http.MethodPost && q.Has("uploadId"):
+		f.completeUpload(w, r, key, q.Get("uploadId"))
+	case r.Method == http.MethodPut && q.Has("uploadId") && copySource != "":
+		f.uploadPartCopy(w, r, q.Get("uploadId"), q.Get("partNumber"), copySource)
+	case r.Method == http.MethodPut && q.Has("uploadId"):
+		f.uploadPart(w, r, q.Get("uploadId"), q.Get("partNumber"))
+	case r.Method == http.MethodDelete && q.Has("uploadId"):
+		f.abortUpload(w, r, q.Get("uploadId"))
+	case r.Method == http.MethodPut && copySource != "":
+		f.copyObject(w, r, key, copySource)
+	case r.Method == http.MethodPut:
+		f.putObject(w, r, key)
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		f.getObject(w, r, key)
+	case r.Method == http.MethodDelete:
+		f.record("DeleteObject")
+		f.mu.Lock()
+		delete(f.objects, key)
+		f.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeS3Error(w, r, http.StatusNotImplemented, "NotImplemented", r.Method+" "+r.URL.String())
+	}
+}
+
+func (f *fakeS3) record(op string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, op)
+}
+
+func (f *fakeS3) putObject(w http.ResponseWriter, r *http.Request, key string) {
+	f.record("PutObject")
+	data, err := readS3Body(r)
+	if err != nil {
+		writeS3Error(w, r, http.StatusBadRequest, "IncompleteBody", err.Error())
+		return
+	}
+	f.mu.Lock()
+	obj := f.newObject(bytes.NewReader(data))
+	f.objects[key] = obj
+	f.mu.Unlock()
+	w.Header().Set("ETag", `"`+obj.etag+`"`)
+}
+
+func (f *fakeS3) getObject(w http.ResponseWriter, r *http.Request, key string) {
+	f.record(r.Method + "Object")
+	f.mu.Lock()
+	obj, ok := f.objects[key]
+	f.mu.Unlock()
+	if !ok {
+		writeS3Error(w, r, http.StatusNotFound, "NoSuchKey", "object does not exist")
+		return
+	}
+	size := obj.content.Size()
+	start, end := int64(0), size-1
+	status := http.StatusOK
+	if spec := r.Header.Get("Range"); spec != "" {
+		var ok bool
+		if start, end, ok = parseByteRange(spec, size); !ok {
+			writeS3Error(w, r, http.StatusRequestedRangeNotSatisfiable, "InvalidRange", spec)
+			return
+		}
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, size))
+		status = http.StatusPartialContent
+	}
+	w.Header().Set("Content-Length", strconv.FormatInt(end-start+1, 10))
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("ETag", `"`+obj.etag+`"`)
+	w.Header().Set("Last-Modified", obj.modTime.Format(http.TimeFormat))
+	if disposition := r.URL.Query().Get("response-content-disposition"); disposition != "" {
+		w.Header().Set("Content-Disposition", disposition)
+	}
+	w.WriteHeader(status)
+	if r.Method == http.MethodGet {
+		io.Copy(w, io.NewSectionReader(obj.content, start, end-start+1))
+	}
+}
+
+func (f *fakeS3) copyObject(w http.ResponseWriter, r *http.Request, key, copySource string) {
+	f.record("CopyObject")
+	src, ok := f.copySource(w, r, copySource)
+	if !ok {
+		return
+	}
+	if src.content.Size() > maxCopySize {
+		writeS3Error(w, r, http.StatusBadRequest, "InvalidRequest", "copy source is larger than the maximum allowable size")
+		return
+	}
+	f.mu.Lock()
+	obj := f.newObject(src.content)
+	f.objects[key] = obj
+	f.mu.Unlock()
+	writeS3XML(w, struct {
+		XMLName      xml.Name `xml:"CopyObjectResult"`
+		ETag         string
+		LastModified string
+	}{ETag: `"` + obj.etag + `"`, LastModified: obj.modTime.Format(time.RFC3339)})
+}
+
+func (f *fakeS3) createUpload(w http.ResponseWriter, key string) {
+	f.record("CreateMultipartUpload")
+	f.mu.Lock()
+	f.nextID++
+	id := fmt.Sprintf("upload-%d", f.nextID)
+	f.uploads[id] = make(map[int]*fakeObject)
+	f.mu.Unlock()
+	writeS3XML(w, struct {
+		XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+		Bucket   string
+		Key      string
+		UploadId string
+	}{Bucket: f.bucket, Key: key, UploadId: id})
+}
+
+func (f *fakeS3) uploadPart(w http.ResponseWriter, r *http.Request, uploadID, partNumber string) {
+	f.record("UploadPart")
+	data, err := readS3Body(r)
+	if err != nil {
+		writeS3Error(w, r, http.StatusBadRequest, "IncompleteBody", err.Error())
+		return
+	}
+	part, ok := f.addPart(w, r, uploadID, partNumber, bytes.NewReader(data))
+	if !ok {
+		return
+	}
+	w.Header().Set("ETag", `"`+part.etag+`"`)
+}
+
+func (f *fakeS3) uploadPartCopy(w http.ResponseWriter, r *http.Request, uploadID, partNumber, copySource string) {
+	f.record("UploadPartCopy")
+	src, ok := f.copySource(w, r, copySource)
+	if !ok {
+		return
+	}
+	var content fakeContent = src.content
+	if spec := r.Header.Get("X-Amz-Copy-Source-Range"); spec != "" {
+		start, end, ok := parseByteRange(spec, src.content.Size())
+		if !ok {
+			writeS3Error(w, r, http.StatusRequestedRangeNotSatisfiable, "InvalidRange", spec)
+			return
+		}
+		content = io.NewSectionReader(src.content, start, end-start+1)
+	}
+	if content.Size() > maxCopySize {
+		writeS3Error(w, r, http.StatusBadRequest, "InvalidRequest", "copy source range is larger than the maximum allowable size")
+		return
+	}
+	part, ok := f.addPart(w, r, uploadID, partNumber, content)
+	if !ok {
+		return
+	}
+	writeS3XML(w, struct {
+		XMLName      xml.Name `xml:"CopyPartResult"`
+		ETag         string
+		LastModified string
+	}{ETag: `"` + part.etag + `"`, LastModified: part.modTime.Format(time.RFC3339)})
+}
+
+func (f *fakeS3) addPart(w http.ResponseWriter, r *http.Request, uploadID, partNumber string, content fakeContent) (*fakeObject, bool) {
+	n, err := strconv.Atoi(partNumber)
+	if err != nil || n < 1 || n > 10000 {
+		writeS3Error(w, r, http.StatusBadRequest, "InvalidArgument", "invalid part number "+partNumber)
+		return nil, false
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	parts, ok := f.uploads[uploadID]
+	if !ok {
+		writeS3Error(w, r, http.StatusNotFound, "NoSuchUpload", "upload does not exist")
+		return nil, false
+	}
+	part := f.newObject(content)
+	parts[n] = part
+	return part, true
+}
+
+func (f *fakeS3) completeUpload(w http.ResponseWriter, r *http.Request, key, uploadID string) {
+	f.record("CompleteMultipartUpload")
+	var req struct {
+		Parts []struct {
+			PartNumber int
+			ETag       string
+		} `xml:"Part"`
+	}
+	if err := xml.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeS3Error(w, r, http.StatusBadRequest, "MalformedXML", err.Error())
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	parts, ok := f.uploads[uploadID]
+	if !ok {
+		writeS3Error(w, r, http.StatusNotFound, "NoSuchUpload", "upload does not exist")
+		return
+	}
+	var content concatContent
+	for i, p := range req.Parts {
+		part, ok := parts[p.PartNumber]
+		if !ok || strings.Trim(p.ETag, `"`) != part.etag || (i > 0 && p.PartNumber <= req.Parts[i-1].PartNumber) {
+			writeS3Error(w, r, http.StatusBadRequest, "InvalidPart", fmt.Sprintf("part %d", p.PartNumber))
+			return
+		}
+		if part.content.Size() < 5<<20 && i < len(req.Parts)-1 {
+			writeS3Error(w, r, http.StatusBadRequest, "EntityTooSmall", fmt.Sprintf("part %d", p.PartNumber))
+			return
+		}
+		content = append(content, part.content)
+	}
+	delete(f.uploads, uploadID)
+	obj := f.newObject(content)
+	f.objects[key] = obj
+	writeS3XML(w, struct {
+		XMLName xml.Name `xml:"CompleteMultipartUploadResult"`
+		Bucket  string
+		Key     string
+		ETag    string
+	}{Bucket: f.bucket, Key: key, ETag: `"` + obj.etag + `"`})
+}
+
+func (f *fakeS3) abortUpload(w http.ResponseWriter, r *http.Request, uploadID string) {
+	f.record("AbortMultipartUpload")
+	f.mu.Lock()
+	_, ok := f.uploads[uploadID]
+	delete(f.uploads, uploadID)
+	f.mu.Unlock()
+	if !ok {
+		writeS3Error(w, r, http.StatusNotFound, "NoSuchUpload", "upload does not exist")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (f *fakeS3) listObjects(w http.ResponseWriter) {
+	f.record("ListObjectsV2")
+	type entry struct {
+		Key          string
+		LastModified string
+		ETag         string
+		Size         int64
+		StorageClass string
+	}
+	f.mu.Lock()
+	var contents []entry
+	for key, obj := range f.objects {
+		contents = append(contents, entry{
+			Key:          key,
+			LastModified: obj.modTime.Format(time.RFC3339),
+			ETag:         `"` + obj.etag + `"`,
+			Size:         obj.content.Size(),
+			StorageClass: "STANDARD",
+		})
+	}
+	f.mu.Unlock()
+	slices.SortFunc(contents, func(a, b entry) int { return strings.Compare(a.Key, b.Key) })
+	writeS3XML(w, struct {
+		XMLName     xml.Name `xml:"ListBucketResult"`
+		Name        string
+		KeyCount    int
+		MaxKeys     int
+		IsTruncated bool
+		Contents    []entry
+	}{Name: f.bucket, KeyCount: len(contents), MaxKeys: 1000, Contents: contents})
+}
+
+// copySource returns the object named by an x-amz-copy-source header,
+// checking x-amz-copy-source-if-match
+func (f *fakeS3) copySource(w http.ResponseWriter, r *http.Request, header string) (*fakeObject, bool) {
+	source, err := url.PathUnescape(header)
+	if err != nil {
+		writeS3Error(w, r, http.StatusBadRequest, "InvalidArgument", "invalid copy source")
+		return nil, false
+	}
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(source, "/"), "/")
+	f.mu.Lock()
+	obj, ok := f.objects[key]
+	f.mu.Unlock()
+	if bucket != f.bucket || !ok {
+		writeS3Error(w, r, http.StatusNotFound, "NoSuchKey", "copy source does not exist")
+		return nil, false
+	}
+	if match := r.Header.Get("X-Amz-Copy-Source-If-Match"); match != "" && strings.Trim(match, `"`) != obj.etag {
+		writeS3Error(w, r, http.StatusPreconditionFailed, "PreconditionFailed", "copy source changed")
+		return nil, false
+	}
+	return obj, true
+}
+
+// readS3Body reads a request body, decoding the aws-chunked encoding minio-go
+// uses for streaming signatures over plain HTTP
+func readS3Body(r *http.Request) ([]byte, error) {
+	if !strings.HasPrefix(r.Header.Get("X-Amz-Content-Sha256"), "STREAMING-") {
+		return io.ReadAll(r.Body)
+	}
+	var data []byte
+	br := bufio.NewReader(r.Body)
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		sizeHex, _, _ := strings.Cut(strings.TrimSpace(line), ";")
+		size, err := strconv.ParseInt(sizeHex, 16, 64)
+		if err != nil {
+			return nil, fmt.Errorf("chunk size %q: %w", sizeHex, err)
+		}
+		if size == 0 {
+			// Trailing headers, if any, are not needed
+			return data, nil
+		}
+		chunk := make([]byte, size+2)
+		if _, err := io.ReadFull(br, chunk); err != nil {
+			return nil, err
+		}
+		data = append(data, chunk[:size]...)
+	}
+}
+
+// parseByteRange parses "bytes=<start>-<end>" for content of size bytes
+func parseByteRange(spec string, size int64) (start, end int64, ok bool) {
+	first, last, found := strings.Cut(strings.TrimPrefix(spec, "bytes="), "-")
+	if !found {
+		return 0, 0, false
+	}
+	start, err1 := strconv.ParseInt(first, 10, 64)
+	end, err2 := strconv.ParseInt(last, 10, 64)
+	if err1 != nil || err2 != nil || start < 0 || start > end || start >= size {
+		return 0, 0, false
+	}
+	return start, min(end, size-1), true
+}
+
+func writeS3XML(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.Write([]byte(xml.Header))
+	xml.NewEncoder(w).Encode(v)
+}
+
+func writeS3Error(w http.ResponseWriter, r *http.Request, status int, code, message string) {
+	if r.Method == http.MethodHead {
+		w.WriteHeader(status)
+		return
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	w.Write([]byte(xml.Header))
+	xml.NewEncoder(w).Encode(struct {
+		XMLName   xml.Name `xml:"Error"`
+		Code      string
+		Message   string
+		Resource  string
+		RequestId string
+	}{Code: code, Message: message, Resource: r.URL.Path, RequestId: "fake"})
+}
+
+// concatContent is content made of parts one after the other
+type concatContent []fakeContent
+
+func (c concatContent) Size() int64 {
+	var size int64
+	for _, part := range c {
+		size += part.Size()
+	}
+	return size
+}
+
+func (c concatContent) ReadAt(p []byte, off int64) (int, error) {
+	n := 0
+	for _, part := range c {
+		size := part.Size()
+		if off >= size {
+			off -= size
+			continue
+		}
+		m, err := part.ReadAt(p[n:min(int64(len(p)), int64(n)+size-off)], off)
+		n += m
+		if err != nil && err != io.EOF {
+			return n, err
+		}
+		off = 0
+		if n == len(p) {
+			return n, nil
+		}
+	}
+	return n, io.EOF
+}
+
+// patternContent is size bytes of a repeating pattern, standing in for
+// objects too large to hold in memory
+type patternContent int64
+
+func (p patternContent) Size() int64 {
+	return int64(p)
+}
+
+func (p patternContent) ReadAt(b []byte, off int64) (int, error) {
+	if off >= int64(p) {
+		return 0, io.EOF
+	}
+	n := int(min(int64(len(b)), int64(p)-off))
+	for i := range n {
+		b[i] = patternByte(off + int64(i))
+	}
+	if n < len(b) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// patternByte is the byte of a patternContent at offset i
+func patternByte(i int64) byte {
+	return byte(i % 251)
+}
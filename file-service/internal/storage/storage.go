@@ -0,0 +1,70 @@
+// Package storage holds file content. File metadata lives in the repository;
+// a BlobStore backend (local disk or S3-compatible object storage) maps keys
+// to bytes, and a ContentStore on top of it keeps content under the SHA-256
+// of its bytes, so identical files share one blob, and counts the files
+// referring to each blob.
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+)
+
+var (
+	// ErrBlobNotFound is returned when no blob is stored under a key
+	ErrBlobNotFound = errors.New("blob not found")
+	// ErrInvalidKey is returned for keys that are not a valid blob key
+	ErrInvalidKey = errors.New("invalid blob key")
+	// ErrPresignUnsupported is returned by backends that cannot hand out
+	// download URLs
+	ErrPresignUnsupported = errors.New("storage backend does not support download URLs")
+)
+
+// Object describes a blob listed by a backend
+type Object struct {
+	Key     string
+	Size    int64
+	ModTime time.Time
+}
+
+// BlobStore is a storage backend holding blobs by key. Keys are a single
+// path segment of lowercase letters, digits, '.', '-' and '_', at least three
+// characters long.
+type BlobStore interface {
+	// Put stores the content of r under key, replacing any existing blob,
+	// and returns the number of bytes written. Content is sent as it is read,
+	// in parts where the backend needs them. A failed Put leaves no blob.
+	Put(ctx context.Context, key string, r io.Reader) (int64, error)
+	// Open returns a reader for the blob; the caller closes it
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	// OpenRange returns a reader for length bytes of the blob starting at
+	// offset; it ends early when the blob is shorter. The caller closes it.
+	OpenRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error)
+	// Copy stores the blob under src also under dst, replacing any existing
+	// blob, without moving the content through the service
+	Copy(ctx context.Context, src, dst string) error
+	// Delete removes the blob
+	Delete(ctx context.Context, key string) error
+	// List calls fn for every stored blob
+	List(ctx context.Context, fn func(Object) error) error
+	// PresignGet returns a URL that downloads the blob without credentials
+	// until expiry, saved under filename
+	PresignGet(ctx context.Context, key string, expiry time.Duration, filename string) (string, error)
+	// Ping checks that the store is reachable
+	Ping(ctx context.Context) error
+}
+
+// validKey reports whether key is a valid blob key
+func validKey(key string) bool {
+	if len(key) < 3 || key[0] == '.' {
+		return false
+	}
+	for _, c := range key {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'z') && c != '.' && c != '-' && c != '_' {
+			return false
+		}
+	}
+	return true
+}
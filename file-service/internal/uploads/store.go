@@ -0,0 +1,378 @@
+// Package uploads keeps the state and the received bytes of resumable uploads
+// on disk, so an interrupted upload survives a restart of the service. A
+// completed upload is stored in the drive by the service and its record is
+// kept until it expires, so clients can still query the final offset.
+package uploads
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrUploadNotFound is returned when no upload is stored under an ID
+	ErrUploadNotFound = errors.New("upload not found")
+	// ErrOffsetMismatch is returned when data is appended at an offset other
+	// than the current offset of the upload, or to a committed upload
+	ErrOffsetMismatch = errors.New("offset does not match the upload offset")
+	// ErrLengthExceeded is returned when appended data would exceed the
+	// declared length of the upload
+	ErrLengthExceeded = errors.New("data exceeds the upload length")
+	// ErrUploadLocked is returned when another request is using the upload
+	ErrUploadLocked = errors.New("upload is in use by another request")
+)
+
+// Upload is the persisted state of a resumable upload
+type Upload struct {
+	ID          string `json:"id"`
+	OwnerID     string `json:"owner_id"`
+	Length      int64  `json:"length"`
+	Offset      int64  `json:"offset"`
+	FolderID    string `json:"folder_id"`
+	Name        string `json:"name"`
+	ContentType string `json:"content_type"`
+	OnConflict  string `json:"on_conflict"`
+	// Metadata is the Upload-Metadata of the client, returned unchanged
+	Metadata string `json:"metadata"`
+	// Hash is the SHA-256 state of the bytes received so far, so the digest
+	// of a complete upload is known without reading its data again
+	Hash []byte `json:"hash,omitempty"`
+	// QuotaOwner is the user whose quota holds Length until the upload is
+	// stored in the drive; empty when nothing was reserved
+	QuotaOwner string `json:"quota_owner,omitempty"`
+	// FileID is set once the upload is stored in the drive
+	FileID    string    `json:"file_id,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Complete reports whether all declared bytes have been received
+func (u *Upload) Complete() bool {
+	return u.Offset == u.Length
+}
+
+// Digest returns the hex SHA-256 of the bytes received so far, or "" for an
+// upload stored without a hash state that has not been appended to since
+func (u *Upload) Digest() (string, error) {
+	if len(u.Hash) == 0 {
+		return "", nil
+	}
+	h, err := restoreHash(u.Hash)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Committed reports whether the upload has been stored in the drive
+func (u *Upload) Committed() bool {
+	return u.FileID != ""
+}
+
+// Store keeps uploads as two files under a directory: "<id>.json" with the
+// state and "<id>.part" with the bytes received so far. The state is written
+// after the data, so after a crash the data file may be longer than the
+// recorded offset; the extra bytes are dropped by the next Append.
+type Store struct {
+	dir string
+
+	mu     sync.Mutex
+	locked map[string]bool
+}
+
+// NewStore creates the directory if needed and returns a store using it
+func NewStore(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("create upload directory: %w", err)
+	}
+	return &Store{dir: dir, locked: make(map[string]bool)}, nil
+}
+
+// Create stores a new upload with no data
+func (s *Store) Create(ctx context.Context, u *Upload) error {
+	dataPath, err := s.path(u.ID, ".part")
+	if err != nil {
+		return err
+	}
+	if u.Hash, err = saveHash(sha256.New()); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(dataPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o640)
+	if err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := s.save(u); err != nil {
+		os.Remove(dataPath)
+		return err
+	}
+	return nil
+}
+
+// Get returns an upload by ID
+func (s *Store) Get(ctx context.Context, id string) (*Upload, error) {
+	infoPath, err := s.path(id, ".json")
+	if err != nil {
+		return nil, ErrUploadNotFound
+	}
+	data, err := os.ReadFile(infoPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrUploadNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var u Upload
+	if err := json.Unmarshal(data, &u); err != nil {
+		return nil, fmt.Errorf("decode upload %s: %w", id, err)
+	}
+	return &u, nil
+}
+
+// Lock reserves an upload for one request until the returned function is
+// called. Append, Commit and Delete expect the caller to hold the lock.
+func (s *Store) Lock(id string) (func(), error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.locked[id] {
+		return nil, ErrUploadLocked
+	}
+	s.locked[id] = true
+	return func() {
+		s.mu.Lock()
+		delete(s.locked, id)
+		s.mu.Unlock()
+	}, nil
+}
+
+// Append writes the content of r at offset and returns the updated upload.
+// Data is synced to disk before the new offset is recorded, together with the
+// hash of the data up to it.
+func (s *Store) Append(ctx context.Context, id string, offset int64, r io.Reader) (*Upload, error) {
+	u, err := s.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if u.Committed() || offset != u.Offset {
+		return nil, ErrOffsetMismatch
+	}
+
+	dataPath, _ := s.path(id, ".part")
+	f, err := os.OpenFile(dataPath, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	h, err := s.hashOf(u, f)
+	if err != nil {
+		return nil, err
+	}
+
+	// Drop bytes left behind by an interrupted append
+	if err := f.Truncate(u.Offset); err != nil {
+		return nil, err
+	}
+	if _, err := f.Seek(u.Offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	remaining := u.Length - u.Offset
+	n, err := io.Copy(io.MultiWriter(f, h), io.LimitReader(r, remaining+1))
+	if err == nil && n > remaining {
+		err = ErrLengthExceeded
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if err != nil {
+		f.Truncate(u.Offset)
+		return nil, err
+	}
+
+	u.Offset += n
+	if u.Hash, err = saveHash(h); err != nil {
+		return nil, err
+	}
+	if err := s.save(u); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// Open returns a reader for the received data; the caller closes it
+func (s *Store) Open(ctx context.Context, id string) (io.ReadCloser, error) {
+	dataPath, err := s.path(id, ".part")
+	if err != nil {
+		return nil, ErrUploadNotFound
+	}
+	f, err := os.Open(dataPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrUploadNotFound
+	}
+	return f, err
+}
+
+// Commit records the file the upload was stored as and drops its data. The
+// file holds the quota reserved for the upload from then on.
+func (s *Store) Commit(ctx context.Context, id, fileID string) (*Upload, error) {
+	u, err := s.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	u.FileID = fileID
+	u.QuotaOwner = ""
+	if err := s.save(u); err != nil {
+		return nil, err
+	}
+	dataPath, _ := s.path(id, ".part")
+	if err := os.Remove(dataPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	return u, nil
+}
+
+// Delete removes an upload with its data
+func (s *Store) Delete(ctx context.Context, id string) error {
+	infoPath, err := s.path(id, ".json")
+	if err != nil {
+		return ErrUploadNotFound
+	}
+	dataPath, _ := s.path(id, ".part")
+	if err := os.Remove(dataPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	err = os.Remove(infoPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return ErrUploadNotFound
+	}
+	return err
+}
+
+// Expired returns the uploads that expired before now
+func (s *Store) Expired(ctx context.Context, now time.Time) ([]*Upload, error) {
+	return s.list(ctx, func(u *Upload) bool {
+		return u.ExpiresAt.Before(now)
+	})
+}
+
+// Pending returns the uploads not stored in the drive yet
+func (s *Store) Pending(ctx context.Context) ([]*Upload, error) {
+	return s.list(ctx, func(u *Upload) bool {
+		return !u.Committed()
+	})
+}
+
+// list returns the uploads match accepts. Uploads whose state cannot be read
+// are skipped.
+func (s *Store) list(ctx context.Context, match func(*Upload) bool) ([]*Upload, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	var matched []*Upload
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), ".json")
+		if !ok || entry.IsDir() {
+			continue
+		}
+		u, err := s.Get(ctx, id)
+		if err != nil {
+			continue
+		}
+		if match(u) {
+			matched = append(matched, u)
+		}
+	}
+	return matched, nil
+}
+
+// Ping checks that the upload directory still exists
+func (s *Store) Ping(ctx context.Context) error {
+	info, err := os.Stat(s.dir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", s.dir)
+	}
+	return nil
+}
+
+// hashOf returns the hash of the data of u up to its offset. Uploads stored
+// without a hash state have their data hashed again from f.
+func (s *Store) hashOf(u *Upload, f *os.File) (hash.Hash, error) {
+	if len(u.Hash) > 0 {
+		return restoreHash(u.Hash)
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, io.NewSectionReader(f, 0, u.Offset)); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// saveHash returns the state of a SHA-256 hash
+func saveHash(h hash.Hash) ([]byte, error) {
+	return h.(encoding.BinaryMarshaler).MarshalBinary()
+}
+
+// restoreHash returns a SHA-256 hash continuing from a saved state
+func restoreHash(state []byte) (hash.Hash, error) {
+	h := sha256.New()
+	if err := h.(encoding.BinaryUnmarshaler).UnmarshalBinary(state); err != nil {
+		return nil, fmt.Errorf("restore upload hash: %w", err)
+	}
+	return h, nil
+}
+
+// path returns the file of an upload with the given suffix
+func (s *Store) path(id, suffix string) (string, error) {
+	if id == "" || strings.ContainsAny(id, `/\`) || strings.HasPrefix(id, ".") {
+		return "", ErrUploadNotFound
+	}
+	return filepath.Join(s.dir, id+suffix), nil
+}
+
+// save writes the state to a temporary file and renames it into place, so a
+// crash never leaves a partial state file
+func (s *Store) save(u *Upload) error {
+	infoPath, err := s.path(u.ID, ".json")
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(u)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(s.dir, u.ID+"-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), infoPath)
+}
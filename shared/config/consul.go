@@ -0,0 +1,73 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	consulapi "github.com/hashicorp/consul/api"
+	"gopkg.in/yaml.v3"
+)
+
+// WatchConsulKV watches a Consul KV key holding a YAML document of runtime
+// overrides and applies it to r whenever it changes, until ctx is cancelled.
+// A missing or empty key clears the overrides.
+func WatchConsulKV[T any](ctx context.Context, client *consulapi.Client, key string, r *Reloader[T]) {
+	go func() {
+		var waitIndex uint64
+		backoff := time.Second
+		for {
+			opts := (&consulapi.QueryOptions{WaitIndex: waitIndex, WaitTime: 5 * time.Minute}).WithContext(ctx)
+			pair, meta, err := client.KV().Get(key, opts)
+			if ctx.Err() != nil {
+				return
+			}
+			if err != nil {
+				slog.Warn("Failed to watch Consul key", "key", key, "error", err)
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(backoff):
+				}
+				if backoff < time.Minute {
+					backoff *= 2
+				}
+				continue
+			}
+			backoff = time.Second
+
+			// Consul returns immediately when the index did not move
+			if meta.LastIndex == waitIndex {
+				continue
+			}
+			// Index went backwards (e.g. Consul restarted), start over
+			if meta.LastIndex < waitIndex {
+				waitIndex = 0
+				continue
+			}
+			waitIndex = meta.LastIndex
+
+			overrides, err := parseOverrides(pair)
+			if err != nil {
+				slog.Error("Rejected configuration from Consul", "key", key, "error", err)
+				continue
+			}
+			if err := r.SetOverrides(overrides); err != nil {
+				slog.Error("Rejected configuration from Consul, keeping current config", "key", key, "error", err)
+			}
+		}
+	}()
+}
+
+// parseOverrides decodes the YAML value of a KV pair
+func parseOverrides(pair *consulapi.KVPair) (map[string]any, error) {
+	overrides := make(map[string]any)
+	if pair == nil || len(pair.Value) == 0 {
+		return overrides, nil
+	}
+	if err := yaml.Unmarshal(pair.Value, &overrides); err != nil {
+		return nil, fmt.Errorf("invalid YAML: %w", err)
+	}
+	return overrides, nil
+}
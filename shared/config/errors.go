@@ -0,0 +1,71 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrPrinted is returned by Load once --print-config has written the
+// effective config; the service must not start
+var ErrPrinted = errors.New("config: configuration printed")
+
+// Errors collects every problem found while loading a config so startup can
+// report all of them at once
+type Errors []error
+
+// Error lists each problem on its own line
+func (e Errors) Error() string {
+	lines := make([]string, 0, len(e)+1)
+	lines = append(lines, fmt.Sprintf("%d configuration error(s):", len(e)))
+	for _, err := range e {
+		lines = append(lines, "  - "+err.Error())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Unwrap exposes the individual errors to errors.Is and errors.As
+func (e Errors) Unwrap() []error {
+	return e
+}
+
+// FieldError describes an invalid value for a single field
+type FieldError struct {
+	Field  string
+	Source string
+	Err    error
+}
+
+// Error formats the field, where the value came from and what is wrong with it
+func (e *FieldError) Error() string {
+	if e.Source != "" {
+		return fmt.Sprintf("%s (%s): %v", e.Field, e.Source, e.Err)
+	}
+	return fmt.Sprintf("%s: %v", e.Field, e.Err)
+}
+
+// Unwrap returns the underlying error
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+// add appends err for field f if it is not nil
+func (e *Errors) add(err error, f *field, source string) {
+	if err == nil {
+		return
+	}
+	*e = append(*e, &FieldError{Field: f.label(), Source: source, Err: err})
+}
+
+// Join appends err to the list, flattening nested Errors
+func (e *Errors) Join(err error) {
+	if err == nil {
+		return
+	}
+	var nested Errors
+	if errors.As(err, &nested) {
+		*e = append(*e, nested...)
+		return
+	}
+	*e = append(*e, err)
+}
@@ -0,0 +1,413 @@
+// Package config loads service configuration from struct tags, an optional
+// YAML/TOML file, environment variables and command-line flags.
+//
+// Sources are applied in this order, each overriding the previous one:
+//
+//  1. `default` struct tags
+//  2. the config file given by --config or CONFIG_FILE (.yaml, .yml or .toml)
+//  3. legacy DEV_/PROD_ prefixed environment variables (deprecated)
+//  4. environment variables named by the `env` tag
+//  5. command-line flags named by the `flag` tag
+//  6. runtime overrides (for example from Consul KV), reloadable fields only
+//
+// Besides the fields, every config accepts --config and --print-config,
+// which writes the effective config with secrets redacted instead of
+// starting the service.
+//
+// Supported field tags:
+//
+//	config:"db.host"        key in the config file and in --print-config output ("-" to skip)
+//	env:"DB_HOST,DATABASE"  environment variables, first one set wins
+//	flag:"db-host"          command-line flag name
+//	usage:"..."             flag help text
+//	default:"localhost"     default value
+//	validate:"required"     validation rules, see Validate
+//	secret:"true"           value is redacted by Print
+//	reload:"true"           value may change at runtime, see Reloader
+package config
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigFileEnv is the environment variable used when --config is not given
+const ConfigFileEnv = "CONFIG_FILE"
+
+// Options controls a single Load call
+type Options struct {
+	// Name is used as the flag set name in usage output
+	Name string
+	// Args are the command-line arguments without the program name
+	Args []string
+	// LegacyEnvPrefix is tried in front of every env name with lower
+	// priority than the plain name, e.g. "DEV_" or "PROD_"
+	LegacyEnvPrefix string
+	// LookupEnv defaults to os.LookupEnv
+	LookupEnv func(string) (string, bool)
+	// Overrides are applied last, keyed by `config` key (nested maps are
+	// flattened). Only reloadable fields may be overridden.
+	Overrides map[string]any
+	// Output receives the config printed by --print-config, defaults to
+	// os.Stdout
+	Output io.Writer
+}
+
+// Defaulter is implemented by configs that derive defaults from other
+// fields (for example from the host mode) after all sources are applied
+type Defaulter interface {
+	ApplyDefaults()
+}
+
+// Validator is implemented by configs with cross-field rules that cannot
+// be expressed with `validate` tags
+type Validator interface {
+	Validate() error
+}
+
+// field is a single settable leaf of the config struct
+type field struct {
+	name   string
+	key    string
+	env    []string
+	flag   string
+	usage  string
+	def    string
+	rules  string
+	secret bool
+	reload bool
+	value  reflect.Value
+}
+
+// Load fills dst, which must be a pointer to a struct, from all sources and
+// validates the result. Every parse and validation problem is reported at
+// once as Errors. After printing the usage for --help it returns
+// flag.ErrHelp, and after printing a valid config for --print-config it
+// returns ErrPrinted; in both cases the caller should exit successfully.
+func Load(dst any, opts Options) error {
+	fields, err := collectFields(dst)
+	if err != nil {
+		return err
+	}
+	lookup := opts.LookupEnv
+	if lookup == nil {
+		lookup = os.LookupEnv
+	}
+
+	fs := flag.NewFlagSet(opts.Name, flag.ContinueOnError)
+	configFile := fs.String("config", "", "path to a YAML or TOML config file (env "+ConfigFileEnv+")")
+	printConfig := fs.Bool("print-config", false, "print the effective configuration with secrets redacted and exit")
+	flagValues := make(map[string]*flagValue)
+	for _, f := range fields {
+		if f.flag == "" {
+			continue
+		}
+		fv := &flagValue{isBool: f.value.Kind() == reflect.Bool}
+		flagValues[f.flag] = fv
+		fs.Var(fv, f.flag, f.usage)
+	}
+	if err := fs.Parse(opts.Args); err != nil {
+		return err
+	}
+
+	var errs Errors
+
+	for _, f := range fields {
+		if f.def != "" {
+			errs.add(f.set(f.def), f, "default")
+		}
+	}
+
+	path := *configFile
+	if path == "" {
+		path, _ = lookup(ConfigFileEnv)
+	}
+	if path != "" {
+		values, err := readFile(path)
+		if err != nil {
+			return err
+		}
+		known := make(map[string]bool, len(fields))
+		for _, f := range fields {
+			if f.key == "" {
+				continue
+			}
+			known[f.key] = true
+			if raw, ok := values[f.key]; ok {
+				errs.add(f.setAny(raw), f, "file "+path)
+			}
+		}
+		unknown := make([]string, 0)
+		for key := range values {
+			if !known[key] {
+				unknown = append(unknown, key)
+			}
+		}
+		sort.Strings(unknown)
+		for _, key := range unknown {
+			errs = append(errs, fmt.Errorf("%s: unknown key in %s", key, path))
+		}
+	}
+
+	for _, f := range fields {
+		if name, value, ok := lookupEnv(f.env, opts.LegacyEnvPrefix, lookup); ok {
+			errs.add(f.set(value), f, "env "+name)
+		}
+	}
+
+	fs.Visit(func(fl *flag.Flag) {
+		fv, ok := flagValues[fl.Name]
+		if !ok {
+			return
+		}
+		for _, f := range fields {
+			if f.flag == fl.Name {
+				errs.add(f.set(fv.value), f, "flag --"+fl.Name)
+			}
+		}
+	})
+
+	if len(opts.Overrides) > 0 {
+		overrides := make(map[string]any)
+		flatten("", opts.Overrides, overrides)
+		byKey := make(map[string]*field, len(fields))
+		for _, f := range fields {
+			if f.key != "" {
+				byKey[f.key] = f
+			}
+		}
+		keys := make([]string, 0, len(overrides))
+		for key := range overrides {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			f, ok := byKey[key]
+			switch {
+			case !ok:
+				errs = append(errs, fmt.Errorf("%s: unknown override key", key))
+			case !f.reload:
+				errs = append(errs, fmt.Errorf("%s: cannot be overridden at runtime, restart required", key))
+			default:
+				errs.add(f.setAny(overrides[key]), f, "override")
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+
+	if d, ok := dst.(Defaulter); ok {
+		d.ApplyDefaults()
+	}
+	if err := Validate(dst); err != nil {
+		return err
+	}
+	if *printConfig {
+		out := opts.Output
+		if out == nil {
+			out = os.Stdout
+		}
+		if err := Print(out, dst); err != nil {
+			return fmt.Errorf("failed to print configuration: %w", err)
+		}
+		return ErrPrinted
+	}
+	return nil
+}
+
+// lookupEnv returns the first plain env name that is set, falling back to
+// the legacy prefixed names
+func lookupEnv(names []string, legacyPrefix string, lookup func(string) (string, bool)) (string, string, bool) {
+	for _, name := range names {
+		if value, ok := lookup(name); ok && value != "" {
+			return name, value, true
+		}
+	}
+	if legacyPrefix == "" {
+		return "", "", false
+	}
+	for _, name := range names {
+		if value, ok := lookup(legacyPrefix + name); ok && value != "" {
+			return legacyPrefix + name, value, true
+		}
+	}
+	return "", "", false
+}
+
+// readFile parses a YAML or TOML file into a flat map keyed by dotted paths
+func readFile(path string) (map[string]any, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	raw := make(map[string]any)
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &raw)
+	case ".toml":
+		err = toml.Unmarshal(data, &raw)
+	default:
+		return nil, fmt.Errorf("unsupported config file extension %q (use .yaml, .yml or .toml)", filepath.Ext(path))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	flat := make(map[string]any)
+	flatten("", raw, flat)
+	return flat, nil
+}
+
+func flatten(prefix string, in map[string]any, out map[string]any) {
+	for k, v := range in {
+		key := k
+		if prefix != "" {
+			key = prefix + "." + k
+		}
+		if nested, ok := v.(map[string]any); ok {
+			flatten(key, nested, out)
+			continue
+		}
+		out[key] = v
+	}
+}
+
+// collectFields walks the struct pointed to by dst, including nested structs
+func collectFields(dst any) ([]*field, error) {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Pointer || v.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("config: destination must be a pointer to a struct, got %T", dst)
+	}
+	var fields []*field
+	walk(v.Elem(), "", &fields)
+	return fields, nil
+}
+
+func walk(v reflect.Value, prefix string, out *[]*field) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		key := sf.Tag.Get("config")
+		if key != "-" && key != "" && prefix != "" {
+			key = prefix + "." + key
+		}
+
+		fv := v.Field(i)
+		if fv.Kind() == reflect.Struct && fv.Type() != reflect.TypeOf(time.Duration(0)) {
+			walk(fv, key, out)
+			continue
+		}
+
+		f := &field{
+			name:   sf.Name,
+			key:    key,
+			flag:   sf.Tag.Get("flag"),
+			usage:  sf.Tag.Get("usage"),
+			def:    sf.Tag.Get("default"),
+			rules:  sf.Tag.Get("validate"),
+			secret: sf.Tag.Get("secret") == "true",
+			reload: sf.Tag.Get("reload") == "true",
+			value:  fv,
+		}
+		if f.key == "-" {
+			f.key = ""
+		}
+		if env := sf.Tag.Get("env"); env != "" {
+			f.env = strings.Split(env, ",")
+		}
+		*out = append(*out, f)
+	}
+}
+
+// label names the field in error messages
+func (f *field) label() string {
+	if f.key != "" {
+		return f.key
+	}
+	return f.name
+}
+
+// setAny assigns a value decoded from a config file
+func (f *field) setAny(raw any) error {
+	if list, ok := raw.([]any); ok && f.value.Kind() == reflect.Slice {
+		items := make([]string, 0, len(list))
+		for _, item := range list {
+			items = append(items, fmt.Sprint(item))
+		}
+		f.value.Set(reflect.ValueOf(items))
+		return nil
+	}
+	return f.set(fmt.Sprint(raw))
+}
+
+// set parses s according to the field type
+func (f *field) set(s string) error {
+	v := f.value
+	switch {
+	case v.Type() == reflect.TypeOf(time.Duration(0)):
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q", s)
+		}
+		v.SetInt(int64(d))
+	case v.Kind() == reflect.String:
+		v.SetString(s)
+	case v.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", s)
+		}
+		v.SetBool(b)
+	case v.Kind() >= reflect.Int && v.Kind() <= reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", s)
+		}
+		v.SetInt(n)
+	case v.Kind() == reflect.Float64:
+		n, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", s)
+		}
+		v.SetFloat(n)
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.String:
+		items := make([]string, 0)
+		for _, item := range strings.Split(s, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		v.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported field type %s", v.Type())
+	}
+	return nil
+}
+
+// flagValue records the raw string of a flag so it can be parsed with the
+// same rules as env and file values
+type flagValue struct {
+	value  string
+	isBool bool
+}
+
+func (fv *flagValue) String() string     { return fv.value }
+func (fv *flagValue) Set(s string) error { fv.value = s; return nil }
+func (fv *flagValue) IsBoolFlag() bool   { return fv.isBool }
@@ -0,0 +1,75 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"strings"
+	"testing"
+)
+
+// testConfig has a required secret so validation can fail
+type testConfig struct {
+	Port   int    `config:"server.port" env:"PORT" flag:"port" default:"8080"`
+	Secret string `config:"jwt.secret" env:"JWT_SECRET" secret:"true" validate:"required"`
+}
+
+// testOptions loads args with JWT_SECRET set to secret, printing to out
+func testOptions(out *bytes.Buffer, secret string, args ...string) Options {
+	return Options{
+		Name: "test",
+		Args: args,
+		LookupEnv: func(name string) (string, bool) {
+			if name == "JWT_SECRET" && secret != "" {
+				return secret, true
+			}
+			return "", false
+		},
+		Output: out,
+	}
+}
+
+func TestLoadHelp(t *testing.T) {
+	for _, args := range [][]string{{"-h"}, {"--help"}} {
+		var cfg testConfig
+		var out bytes.Buffer
+		// The usage goes to stderr, the output is kept for the config
+		err := Load(&cfg, testOptions(&out, "s3cret", args...))
+		if !errors.Is(err, flag.ErrHelp) {
+			t.Fatalf("Load(%v) = %v, want flag.ErrHelp", args, err)
+		}
+		if out.Len() != 0 {
+			t.Fatalf("Load(%v) printed %q, want nothing", args, out.String())
+		}
+	}
+}
+
+func TestLoadPrintConfig(t *testing.T) {
+	var cfg testConfig
+	var out bytes.Buffer
+	err := Load(&cfg, testOptions(&out, "s3cret", "--print-config", "--port", "9090"))
+	if !errors.Is(err, ErrPrinted) {
+		t.Fatalf("Load = %v, want ErrPrinted", err)
+	}
+	printed := out.String()
+	if !strings.Contains(printed, "port: 9090") || !strings.Contains(printed, Redacted) || strings.Contains(printed, "s3cret") {
+		t.Fatalf("printed config = %q, want port 9090 and the secret redacted", printed)
+	}
+
+	// An invalid config is reported as such and not printed
+	out.Reset()
+	err = Load(&testConfig{}, testOptions(&out, "", "--print-config"))
+	var errs Errors
+	if errors.Is(err, ErrPrinted) || !errors.As(err, &errs) {
+		t.Fatalf("Load of an invalid config = %v, want validation errors", err)
+	}
+	if out.Len() != 0 {
+		t.Fatalf("invalid config printed %q, want nothing", out.String())
+	}
+
+	// Without the flag nothing is printed and the config is loaded
+	out.Reset()
+	if err := Load(&cfg, testOptions(&out, "s3cret")); err != nil || out.Len() != 0 {
+		t.Fatalf("Load = %v with %q printed, want nil and nothing", err, out.String())
+	}
+}
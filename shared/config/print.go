@@ -0,0 +1,62 @@
+package config
+
+import (
+	"io"
+	"reflect"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Redacted replaces secret values in Print output
+const Redacted = "********"
+
+// Print writes the effective configuration of src as YAML using the
+// `config` keys, with every `secret` field redacted
+func Print(w io.Writer, src any) error {
+	fields, err := collectFields(src)
+	if err != nil {
+		return err
+	}
+
+	out := make(map[string]any)
+	for _, f := range fields {
+		if f.key == "" {
+			continue
+		}
+		var value any
+		switch {
+		case f.secret:
+			value = ""
+			if !f.value.IsZero() {
+				value = Redacted
+			}
+		case f.value.Type() == reflect.TypeOf(time.Duration(0)):
+			value = time.Duration(f.value.Int()).String()
+		default:
+			value = f.value.Interface()
+		}
+		insert(out, strings.Split(f.key, "."), value)
+	}
+
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(out); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// insert stores value in the nested map following path
+func insert(m map[string]any, path []string, value any) {
+	for _, key := range path[:len(path)-1] {
+		next, ok := m[key].(map[string]any)
+		if !ok {
+			next = make(map[string]any)
+			m[key] = next
+		}
+		m = next
+	}
+	m[path[len(path)-1]] = value
+}
@@ -0,0 +1,145 @@
+package config
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"reflect"
+	"sync"
+	"sync/atomic"
+)
+
+// LoadFunc builds a fresh, validated config from all sources plus the given
+// runtime overrides
+type LoadFunc[T any] func(overrides map[string]any) (*T, error)
+
+// Reloader holds the current config snapshot and replaces it atomically when
+// the sources change. Readers call Current and never see a partially applied
+// config; components that cache settings register with Subscribe.
+type Reloader[T any] struct {
+	load    LoadFunc[T]
+	current atomic.Pointer[T]
+
+	mu          sync.Mutex
+	overrides   map[string]any
+	subscribers []func(old, new *T)
+}
+
+// NewReloader performs the initial load and returns the reloader
+func NewReloader[T any](load LoadFunc[T]) (*Reloader[T], error) {
+	cfg, err := load(nil)
+	if err != nil {
+		return nil, err
+	}
+	r := &Reloader[T]{load: load}
+	r.current.Store(cfg)
+	return r, nil
+}
+
+// Current returns the active config snapshot. The returned value must be
+// treated as read-only.
+func (r *Reloader[T]) Current() *T {
+	return r.current.Load()
+}
+
+// Subscribe registers fn to be called after every successful reload
+func (r *Reloader[T]) Subscribe(fn func(old, new *T)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.subscribers = append(r.subscribers, fn)
+}
+
+// Reload re-reads every source with the current overrides. An invalid
+// config is rejected and the running config is left untouched.
+func (r *Reloader[T]) Reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.reloadLocked(r.overrides)
+}
+
+// SetOverrides replaces the runtime overrides and reloads. The overrides are
+// only kept if the resulting config is valid.
+func (r *Reloader[T]) SetOverrides(overrides map[string]any) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.reloadLocked(overrides); err != nil {
+		return err
+	}
+	r.overrides = overrides
+	return nil
+}
+
+func (r *Reloader[T]) reloadLocked(overrides map[string]any) error {
+	next, err := r.load(overrides)
+	if err != nil {
+		return err
+	}
+	old := r.current.Load()
+
+	changed, err := keepStatic(old, next)
+	if err != nil {
+		return err
+	}
+	if len(changed) == 0 {
+		return nil
+	}
+
+	r.current.Store(next)
+	slog.Info("Configuration reloaded", "changed", changed)
+	for _, fn := range r.subscribers {
+		fn(old, next)
+	}
+	return nil
+}
+
+// keepStatic copies non-reloadable values from old into next so a reload
+// never changes them, and returns the keys of reloadable fields that changed
+func keepStatic[T any](old, next *T) ([]string, error) {
+	oldFields, err := collectFields(old)
+	if err != nil {
+		return nil, err
+	}
+	nextFields, err := collectFields(next)
+	if err != nil {
+		return nil, err
+	}
+
+	var changed []string
+	for i, f := range nextFields {
+		prev := oldFields[i].value
+		if reflect.DeepEqual(prev.Interface(), f.value.Interface()) {
+			continue
+		}
+		if !f.reload {
+			if f.key != "" {
+				slog.Warn("Ignoring configuration change that requires a restart", "key", f.key)
+			}
+			f.value.Set(prev)
+			continue
+		}
+		changed = append(changed, f.label())
+	}
+	return changed, nil
+}
+
+// WatchSignals reloads the config every time one of sigs is received until
+// ctx is cancelled. Failed reloads are logged and the old config is kept.
+func (r *Reloader[T]) WatchSignals(ctx context.Context, sigs ...os.Signal) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, sigs...)
+	go func() {
+		defer signal.Stop(ch)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case sig := <-ch:
+				slog.Info("Reloading configuration", "signal", sig.String())
+				if err := r.Reload(); err != nil {
+					slog.Error("Rejected configuration reload, keeping current config", "error", err)
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,129 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Validate checks the `validate` tags of every field and, if dst implements
+// Validator, its cross-field rules. Supported rules, separated by commas:
+//
+//	required    value must not be the zero value
+//	min=N       minimum for numbers and durations, minimum length for strings
+//	max=N       maximum for numbers and durations, maximum length for strings
+//	oneof=a b   value must be one of the space separated options
+//	hostport    value must be a host:port pair
+func Validate(dst any) error {
+	fields, err := collectFields(dst)
+	if err != nil {
+		return err
+	}
+
+	var errs Errors
+	for _, f := range fields {
+		if f.rules == "" {
+			continue
+		}
+		for _, rule := range strings.Split(f.rules, ",") {
+			name, arg, _ := strings.Cut(strings.TrimSpace(rule), "=")
+			errs.add(checkRule(f.value, name, arg), f, "")
+		}
+	}
+
+	if v, ok := dst.(Validator); ok {
+		errs.Join(v.Validate())
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// checkRule applies a single validation rule to v
+func checkRule(v reflect.Value, name, arg string) error {
+	switch name {
+	case "required":
+		if v.IsZero() {
+			return errors.New("is required")
+		}
+	case "min", "max":
+		return checkBound(v, name, arg)
+	case "oneof":
+		options := strings.Fields(arg)
+		got := fmt.Sprint(v.Interface())
+		for _, option := range options {
+			if got == option {
+				return nil
+			}
+		}
+		return fmt.Errorf("must be one of [%s], got %q", strings.Join(options, ", "), got)
+	case "hostport":
+		if v.String() == "" {
+			return nil
+		}
+		if _, _, err := net.SplitHostPort(v.String()); err != nil {
+			return fmt.Errorf("must be host:port, got %q", v.String())
+		}
+	default:
+		return fmt.Errorf("unknown validation rule %q", name)
+	}
+	return nil
+}
+
+// checkBound handles min and max for durations, numbers and string lengths
+func checkBound(v reflect.Value, name, arg string) error {
+	failed := func(got, bound float64) bool {
+		if name == "min" {
+			return got < bound
+		}
+		return got > bound
+	}
+	word := "at least"
+	if name == "max" {
+		word = "at most"
+	}
+
+	switch {
+	case v.Type() == reflect.TypeOf(time.Duration(0)):
+		bound, err := time.ParseDuration(arg)
+		if err != nil {
+			return fmt.Errorf("invalid %s rule %q", name, arg)
+		}
+		if failed(float64(v.Int()), float64(bound)) {
+			return fmt.Errorf("must be %s %s, got %s", word, bound, time.Duration(v.Int()))
+		}
+	case v.Kind() == reflect.String || v.Kind() == reflect.Slice:
+		bound, err := strconv.Atoi(arg)
+		if err != nil {
+			return fmt.Errorf("invalid %s rule %q", name, arg)
+		}
+		if failed(float64(v.Len()), float64(bound)) {
+			return fmt.Errorf("length must be %s %d, got %d", word, bound, v.Len())
+		}
+	case v.Kind() >= reflect.Int && v.Kind() <= reflect.Int64:
+		bound, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid %s rule %q", name, arg)
+		}
+		if failed(float64(v.Int()), float64(bound)) {
+			return fmt.Errorf("must be %s %d, got %d", word, bound, v.Int())
+		}
+	case v.Kind() == reflect.Float64:
+		bound, err := strconv.ParseFloat(arg, 64)
+		if err != nil {
+			return fmt.Errorf("invalid %s rule %q", name, arg)
+		}
+		if failed(v.Float(), bound) {
+			return fmt.Errorf("must be %s %g, got %g", word, bound, v.Float())
+		}
+	default:
+		return fmt.Errorf("%s rule is not supported for %s", name, v.Type())
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	consulapi "github.com/hashicorp/consul/api"
+	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// ConsulCheck verifies that the Consul agent is reachable and has a leader
+func ConsulCheck(client *consulapi.Client) CheckFunc {
+	return func(ctx context.Context) error {
+		leader, err := client.Status().LeaderWithQueryOptions((&consulapi.QueryOptions{}).WithContext(ctx))
+		if err != nil {
+			return err
+		}
+		if leader == "" {
+			return errors.New("no cluster leader")
+		}
+		return nil
+	}
+}
+
+// GRPCCheck asks a gRPC server for the serving status of service using the
+// standard health protocol
+func GRPCCheck(conn grpc.ClientConnInterface, service string) CheckFunc {
+	client := healthpb.NewHealthClient(conn)
+	return func(ctx context.Context) error {
+		resp, err := client.Check(ctx, &healthpb.HealthCheckRequest{Service: service})
+		if err != nil {
+			return err
+		}
+		if resp.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+			return fmt.Errorf("status %s", resp.GetStatus())
+		}
+		return nil
+	}
+}
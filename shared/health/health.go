@@ -0,0 +1,224 @@
+// Package health runs dependency checks for liveness and readiness probes and
+// reports them over HTTP and the gRPC health protocol.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	grpchealth "google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// Status values used in reports
+const (
+	StatusUp       = "up"
+	StatusDown     = "down"
+	StatusDegraded = "degraded"
+)
+
+// CheckFunc returns nil when the dependency is healthy
+type CheckFunc func(ctx context.Context) error
+
+type check struct {
+	name     string
+	critical bool
+	fn       CheckFunc
+}
+
+// Checker runs the registered checks concurrently, each bounded by timeout.
+// A failing critical check makes the service not ready; a failing
+// non-critical check only marks it degraded.
+type Checker struct {
+	timeout time.Duration
+	started time.Time
+
+	mu     sync.RWMutex
+	checks []check
+
+	shuttingDown atomic.Bool
+}
+
+// Report is the result of running all checks
+type Report struct {
+	Status string                 `json:"status"`
+	Uptime string                 `json:"uptime"`
+	Checks map[string]CheckResult `json:"checks"`
+}
+
+// CheckResult is the result of a single check
+type CheckResult struct {
+	Status   string `json:"status"`
+	Critical bool   `json:"critical"`
+	Duration string `json:"duration"`
+	Error    string `json:"error,omitempty"`
+}
+
+// NewChecker creates a checker with the per-check timeout
+func NewChecker(timeout time.Duration) *Checker {
+	return &Checker{timeout: timeout, started: time.Now()}
+}
+
+// Add registers a check
+func (c *Checker) Add(name string, critical bool, fn CheckFunc) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checks = append(c.checks, check{name: name, critical: critical, fn: fn})
+}
+
+// SetShuttingDown makes every following report not ready, so load balancers
+// stop routing to the instance while in-flight requests drain
+func (c *Checker) SetShuttingDown() {
+	c.shuttingDown.Store(true)
+}
+
+// Run executes every check and aggregates the results
+func (c *Checker) Run(ctx context.Context) Report {
+	c.mu.RLock()
+	checks := append([]check(nil), c.checks...)
+	c.mu.RUnlock()
+
+	results := make([]CheckResult, len(checks))
+	var wg sync.WaitGroup
+	for i, chk := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, c.timeout)
+			defer cancel()
+
+			start := time.Now()
+			err := chk.fn(ctx)
+			results[i] = CheckResult{
+				Status:   StatusUp,
+				Critical: chk.critical,
+				Duration: time.Since(start).Round(time.Microsecond).String(),
+			}
+			if err != nil {
+				results[i].Status = StatusDown
+				results[i].Error = err.Error()
+			}
+		}()
+	}
+	wg.Wait()
+
+	report := Report{
+		Status: StatusUp,
+		Uptime: time.Since(c.started).Round(time.Second).String(),
+		Checks: make(map[string]CheckResult, len(checks)),
+	}
+	for i, chk := range checks {
+		res := results[i]
+		report.Checks[chk.name] = res
+		if res.Status == StatusUp {
+			continue
+		}
+		if chk.critical {
+			report.Status = StatusDown
+		} else if report.Status == StatusUp {
+			report.Status = StatusDegraded
+		}
+	}
+	if c.shuttingDown.Load() {
+		report.Status = StatusDown
+		report.Checks["shutdown"] = CheckResult{Status: StatusDown, Critical: true, Duration: "0s", Error: "shutting down"}
+	}
+	return report
+}
+
+// Ready reports whether no critical check failed
+func (r Report) Ready() bool {
+	return r.Status != StatusDown
+}
+
+// Failed returns the names of the failed critical checks, sorted
+func (r Report) Failed() []string {
+	var failed []string
+	for name, res := range r.Checks {
+		if res.Critical && res.Status != StatusUp {
+			failed = append(failed, name)
+		}
+	}
+	sort.Strings(failed)
+	return failed
+}
+
+// LivezHandler reports that the process is running. It does not check
+// dependencies so a restart is never triggered by a downstream outage.
+func LivezHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write([]byte("ok"))
+	})
+}
+
+// ReadyzHandler returns 200 when the service can take traffic and 503 with
+// the failed checks otherwise
+func (c *Checker) ReadyzHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report := c.Run(r.Context())
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if !report.Ready() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte("not ready: " + strings.Join(report.Failed(), ", ")))
+			return
+		}
+		w.Write([]byte("ok"))
+	})
+}
+
+// DetailsHandler returns the full report as JSON for operators, with 503
+// when the service is not ready
+func (c *Checker) DetailsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report := c.Run(r.Context())
+		w.Header().Set("Content-Type", "application/json")
+		if !report.Ready() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(report)
+	})
+}
+
+// Watch runs the checks every interval and sets the gRPC serving status of
+// the given services (use "" for the server as a whole) until ctx is done
+func (c *Checker) Watch(ctx context.Context, server *grpchealth.Server, interval time.Duration, services ...string) {
+	last := healthpb.HealthCheckResponse_UNKNOWN
+	update := func() {
+		report := c.Run(ctx)
+		status := healthpb.HealthCheckResponse_SERVING
+		if !report.Ready() {
+			status = healthpb.HealthCheckResponse_NOT_SERVING
+		}
+		if status != last {
+			if status == healthpb.HealthCheckResponse_SERVING {
+				slog.Info("Health status changed", "status", status.String())
+			} else {
+				slog.Warn("Health status changed", "status", status.String(), "failed", report.Failed())
+			}
+			last = status
+		}
+		for _, service := range services {
+			server.SetServingStatus(service, status)
+		}
+	}
+
+	update()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			update()
+		}
+	}
+}
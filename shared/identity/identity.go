@@ -0,0 +1,210 @@
+// Package identity carries the end user a request is made for from the
+// gateway to the services behind it. The gateway signs a short-lived HS256
+// token with the user ID and role and sends it in gRPC metadata; services
+// verify it and authorize the call themselves.
+package identity
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// MetadataKey is the gRPC metadata key holding the signed identity
+const MetadataKey = "x-user-identity"
+
+// DefaultTTL is how long a signed identity is valid. Tokens are signed per
+// RPC, so this only has to cover clock skew and the RPC itself.
+const DefaultTTL = time.Minute
+
+// audience keeps internal tokens from being accepted anywhere else
+const audience = "cloud-drive-internal"
+
+// leeway tolerates clock skew between services
+const leeway = 30 * time.Second
+
+// RoleAdmin is the role allowed to act on any user
+const RoleAdmin = "admin"
+
+// Errors returned by Verify
+var (
+	ErrMalformed = errors.New("malformed identity token")
+	ErrSignature = errors.New("invalid identity token signature")
+	ErrExpired   = errors.New("identity token expired")
+	ErrAudience  = errors.New("identity token has the wrong audience")
+)
+
+// Identity is the end user a request is made for
+type Identity struct {
+	UserID string
+	Role   string
+}
+
+// IsAdmin reports whether the user has the admin role
+func (i Identity) IsAdmin() bool {
+	return i.Role == RoleAdmin
+}
+
+type contextKey struct{}
+
+// NewContext returns a context carrying the identity
+func NewContext(ctx context.Context, id Identity) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the verified identity of the end user, or false for
+// anonymous calls such as login and registration
+func FromContext(ctx context.Context) (Identity, bool) {
+	id, ok := ctx.Value(contextKey{}).(Identity)
+	return id, ok
+}
+
+type claims struct {
+	Subject   string `json:"sub"`
+	Role      string `json:"role"`
+	Issuer    string `json:"iss"`
+	Audience  string `json:"aud"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// jwtHeader is the fixed header of every token
+var jwtHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+// Signer signs identities for outgoing RPCs
+type Signer struct {
+	secret []byte
+	issuer string
+	ttl    time.Duration
+	now    func() time.Time
+}
+
+// NewSigner creates a signer; issuer names the signing service
+func NewSigner(secret, issuer string, ttl time.Duration) *Signer {
+	return &Signer{secret: []byte(secret), issuer: issuer, ttl: ttl, now: time.Now}
+}
+
+// Sign returns a token for the identity
+func (s *Signer) Sign(id Identity) (string, error) {
+	now := s.now()
+	payload, err := json.Marshal(claims{
+		Subject:   id.UserID,
+		Role:      id.Role,
+		Issuer:    s.issuer,
+		Audience:  audience,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(s.ttl).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+	signed := jwtHeader + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return signed + "." + sign(s.secret, signed), nil
+}
+
+// UnaryClientInterceptor attaches the identity returned by lookup to every
+// RPC. Calls without an end user are sent without an identity.
+func (s *Signer) UnaryClientInterceptor(lookup func(context.Context) (Identity, bool)) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		ctx, err := s.outgoing(ctx, lookup)
+		if err != nil {
+			return err
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// StreamClientInterceptor is the streaming counterpart of UnaryClientInterceptor
+func (s *Signer) StreamClientInterceptor(lookup func(context.Context) (Identity, bool)) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		ctx, err := s.outgoing(ctx, lookup)
+		if err != nil {
+			return nil, err
+		}
+		return streamer(ctx, desc, cc, method, opts...)
+	}
+}
+
+func (s *Signer) outgoing(ctx context.Context, lookup func(context.Context) (Identity, bool)) (context.Context, error) {
+	id, ok := lookup(ctx)
+	if !ok {
+		return ctx, nil
+	}
+	token, err := s.Sign(id)
+	if err != nil {
+		return ctx, fmt.Errorf("sign identity: %w", err)
+	}
+	return metadata.AppendToOutgoingContext(ctx, MetadataKey, token), nil
+}
+
+// Verifier checks identities of incoming RPCs
+type Verifier struct {
+	secret []byte
+	now    func() time.Time
+}
+
+// NewVerifier creates a verifier for tokens signed with secret
+func NewVerifier(secret string) *Verifier {
+	return &Verifier{secret: []byte(secret), now: time.Now}
+}
+
+// Verify checks the token and returns the identity it carries
+func (v *Verifier) Verify(token string) (Identity, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || parts[0] != jwtHeader {
+		return Identity{}, ErrMalformed
+	}
+	if !hmac.Equal([]byte(parts[2]), []byte(sign(v.secret, parts[0]+"."+parts[1]))) {
+		return Identity{}, ErrSignature
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return Identity{}, ErrMalformed
+	}
+	var c claims
+	if err := json.Unmarshal(payload, &c); err != nil || c.Subject == "" {
+		return Identity{}, ErrMalformed
+	}
+	if c.Audience != audience {
+		return Identity{}, ErrAudience
+	}
+	now := v.now()
+	if now.After(time.Unix(c.ExpiresAt, 0).Add(leeway)) || now.Before(time.Unix(c.IssuedAt, 0).Add(-leeway)) {
+		return Identity{}, ErrExpired
+	}
+	return Identity{UserID: c.Subject, Role: c.Role}, nil
+}
+
+// FromIncoming verifies the identity in the incoming metadata. It returns
+// false without an error when the call carries no identity.
+func (v *Verifier) FromIncoming(ctx context.Context) (Identity, bool, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get(MetadataKey)
+	if len(values) == 0 {
+		return Identity{}, false, nil
+	}
+	if len(values) > 1 {
+		return Identity{}, false, ErrMalformed
+	}
+	id, err := v.Verify(values[0])
+	if err != nil {
+		return Identity{}, false, err
+	}
+	return id, true, nil
+}
+
+func sign(secret []byte, signed string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(signed))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
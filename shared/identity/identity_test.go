@@ -0,0 +1,193 @@
+package identity
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+const testSecret = "test-identity-secret"
+
+// testNow is the time tokens are signed and verified at unless a test moves it
+var testNow = time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+// newTestSigner returns a signer for secret whose clock reads testNow
+func newTestSigner(secret string) *Signer {
+	s := NewSigner(secret, "api-gateway", DefaultTTL)
+	s.now = func() time.Time { return testNow }
+	return s
+}
+
+// newTestVerifier returns a verifier whose clock reads testNow plus skew
+func newTestVerifier(skew time.Duration) *Verifier {
+	v := NewVerifier(testSecret)
+	v.now = func() time.Time { return testNow.Add(skew) }
+	return v
+}
+
+// signClaims returns a token for c signed with testSecret
+func signClaims(t *testing.T, c claims) string {
+	t.Helper()
+	payload, err := json.Marshal(c)
+	if err != nil {
+		t.Fatalf("marshal claims: %v", err)
+	}
+	signed := jwtHeader + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return signed + "." + sign([]byte(testSecret), signed)
+}
+
+// signRaw returns a token with payload as its raw claims, signed with testSecret
+func signRaw(payload string) string {
+	signed := jwtHeader + "." + base64.RawURLEncoding.EncodeToString([]byte(payload))
+	return signed + "." + sign([]byte(testSecret), signed)
+}
+
+// validClaims returns the claims Sign puts in a token for alice at testNow
+func validClaims() claims {
+	return claims{
+		Subject:   "alice",
+		Role:      "user",
+		Issuer:    "api-gateway",
+		Audience:  audience,
+		IssuedAt:  testNow.Unix(),
+		ExpiresAt: testNow.Add(DefaultTTL).Unix(),
+	}
+}
+
+func TestSignAndVerify(t *testing.T) {
+	token, err := newTestSigner(testSecret).Sign(Identity{UserID: "alice", Role: RoleAdmin})
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	id, err := newTestVerifier(0).Verify(token)
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if id.UserID != "alice" || !id.IsAdmin() {
+		t.Fatalf("Verify = %+v, want alice as admin", id)
+	}
+}
+
+func TestVerifyRejects(t *testing.T) {
+	valid, err := newTestSigner(testSecret).Sign(Identity{UserID: "alice", Role: "user"})
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	parts := strings.Split(valid, ".")
+	asAdmin := validClaims()
+	asAdmin.Role = RoleAdmin
+	adminPayload := strings.Split(signClaims(t, asAdmin), ".")[1]
+	otherSecret, err := newTestSigner("another-secret").Sign(Identity{UserID: "alice", Role: "user"})
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	noneHeader := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none","typ":"JWT"}`))
+	wrongAudience := validClaims()
+	wrongAudience.Audience = "somewhere-else"
+	noSubject := validClaims()
+	noSubject.Subject = ""
+
+	for _, tc := range []struct {
+		name  string
+		token string
+		skew  time.Duration
+		want  error
+	}{
+		{"empty", "", 0, ErrMalformed},
+		{"unsigned", parts[0] + "." + parts[1], 0, ErrMalformed},
+		{"empty signature", parts[0] + "." + parts[1] + ".", 0, ErrSignature},
+		{"alg none", noneHeader + "." + parts[1] + ".", 0, ErrMalformed},
+		{"payload replaced", parts[0] + "." + adminPayload + "." + parts[2], 0, ErrSignature},
+		{"signature replaced", parts[0] + "." + parts[1] + "." + strings.Repeat("A", len(parts[2])), 0, ErrSignature},
+		{"other secret", otherSecret, 0, ErrSignature},
+		{"payload not JSON", signRaw("not json"), 0, ErrMalformed},
+		{"no subject", signClaims(t, noSubject), 0, ErrMalformed},
+		{"wrong audience", signClaims(t, wrongAudience), 0, ErrAudience},
+		{"expired", valid, DefaultTTL + leeway + time.Second, ErrExpired},
+		{"issued in the future", valid, -leeway - time.Second, ErrExpired},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			id, err := newTestVerifier(tc.skew).Verify(tc.token)
+			if !errors.Is(err, tc.want) {
+				t.Fatalf("Verify = %+v, %v, want %v", id, err, tc.want)
+			}
+		})
+	}
+}
+
+func TestVerifyToleratesClockSkew(t *testing.T) {
+	token, err := newTestSigner(testSecret).Sign(Identity{UserID: "alice", Role: "user"})
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	for _, skew := range []time.Duration{-leeway, DefaultTTL + leeway} {
+		if _, err := newTestVerifier(skew).Verify(token); err != nil {
+			t.Errorf("Verify with the clock off by %v: %v", skew, err)
+		}
+	}
+}
+
+func TestFromIncoming(t *testing.T) {
+	token, err := newTestSigner(testSecret).Sign(Identity{UserID: "alice", Role: "user"})
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	v := newTestVerifier(0)
+
+	if _, found, err := v.FromIncoming(context.Background()); found || err != nil {
+		t.Fatalf("FromIncoming without metadata = %v, %v, want nothing found", found, err)
+	}
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(MetadataKey, token))
+	id, found, err := v.FromIncoming(ctx)
+	if err != nil || !found || id.UserID != "alice" {
+		t.Fatalf("FromIncoming = %+v, %v, %v, want alice", id, found, err)
+	}
+
+	ctx = metadata.NewIncomingContext(context.Background(), metadata.Pairs(MetadataKey, token, MetadataKey, token))
+	if _, _, err := v.FromIncoming(ctx); !errors.Is(err, ErrMalformed) {
+		t.Fatalf("FromIncoming with two identities = %v, want ErrMalformed", err)
+	}
+
+	ctx = metadata.NewIncomingContext(context.Background(), metadata.Pairs(MetadataKey, token+"x"))
+	if _, found, err := v.FromIncoming(ctx); found || !errors.Is(err, ErrSignature) {
+		t.Fatalf("FromIncoming with a tampered identity = %v, %v, want ErrSignature", found, err)
+	}
+}
+
+func TestUnaryClientInterceptor(t *testing.T) {
+	s := newTestSigner(testSecret)
+	interceptor := s.UnaryClientInterceptor(FromContext)
+	var sent []string
+	invoker := func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		md, _ := metadata.FromOutgoingContext(ctx)
+		sent = md.Get(MetadataKey)
+		return nil
+	}
+
+	if err := interceptor(context.Background(), "/svc/Method", nil, nil, nil, invoker); err != nil {
+		t.Fatalf("interceptor: %v", err)
+	}
+	if len(sent) != 0 {
+		t.Fatalf("call without an end user sent identity %v", sent)
+	}
+
+	ctx := NewContext(context.Background(), Identity{UserID: "alice", Role: "user"})
+	if err := interceptor(ctx, "/svc/Method", nil, nil, nil, invoker); err != nil {
+		t.Fatalf("interceptor: %v", err)
+	}
+	if len(sent) != 1 {
+		t.Fatalf("call as alice sent identities %v, want one", sent)
+	}
+	id, err := newTestVerifier(0).Verify(sent[0])
+	if err != nil || id.UserID != "alice" {
+		t.Fatalf("sent identity = %+v, %v, want alice", id, err)
+	}
+}
@@ -0,0 +1,191 @@
+package interceptor
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/x509"
+	"fmt"
+	"slices"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// Caller authentication modes
+const (
+	AuthNone  = "none"
+	AuthToken = "token"
+	AuthMTLS  = "mtls"
+)
+
+// AuthorizationMetadataKey carries the caller's service token
+const AuthorizationMetadataKey = "authorization"
+
+// HealthServicePrefix matches the gRPC health service, which Consul and
+// orchestrator probes call without credentials
+const HealthServicePrefix = "/grpc.health.v1.Health/"
+
+type callerKey struct{}
+
+// CallerAuth identifies the service calling an RPC, by a bearer token in the
+// metadata or by the verified client certificate, and rejects callers that
+// are not allowed
+type CallerAuth struct {
+	// Mode is AuthNone, AuthToken or AuthMTLS
+	Mode string
+	// Tokens maps each accepted token to the caller identity
+	Tokens map[string]string
+	// Allowed are the identities that may call; empty accepts any identified caller
+	Allowed []string
+	// Public are full method names, or prefixes ending in "/", callable without credentials
+	Public []string
+}
+
+// CallerFromContext returns the identity of the calling service, or "" when
+// caller authentication is disabled
+func CallerFromContext(ctx context.Context) string {
+	caller, _ := ctx.Value(callerKey{}).(string)
+	return caller
+}
+
+// Unary authenticates unary RPCs
+func (a CallerAuth) Unary() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		ctx, err := a.authenticate(ctx, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// Stream authenticates streaming RPCs
+func (a CallerAuth) Stream() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := a.authenticate(ss.Context(), info.FullMethod)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &contextStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+func (a CallerAuth) authenticate(ctx context.Context, method string) (context.Context, error) {
+	if a.Mode == AuthNone || matchMethod(a.Public, method) {
+		return ctx, nil
+	}
+
+	var caller string
+	switch a.Mode {
+	case AuthToken:
+		caller = a.tokenCaller(ctx)
+	case AuthMTLS:
+		caller = certCaller(ctx)
+	}
+	if caller == "" {
+		return ctx, status.Error(codes.Unauthenticated, "caller credentials required")
+	}
+	if len(a.Allowed) > 0 && !slices.Contains(a.Allowed, caller) {
+		return ctx, status.Errorf(codes.PermissionDenied, "caller %q is not allowed", caller)
+	}
+	return context.WithValue(ctx, callerKey{}, caller), nil
+}
+
+// matchMethod reports whether the method equals one of patterns or starts
+// with a pattern ending in "/"
+func matchMethod(patterns []string, method string) bool {
+	for _, p := range patterns {
+		if method == p || (strings.HasSuffix(p, "/") && strings.HasPrefix(method, p)) {
+			return true
+		}
+	}
+	return false
+}
+
+// tokenCaller returns the identity of the bearer token in the metadata
+func (a CallerAuth) tokenCaller(ctx context.Context) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get(AuthorizationMetadataKey)
+	if len(values) == 0 {
+		return ""
+	}
+	token, ok := strings.CutPrefix(values[0], "Bearer ")
+	if !ok || token == "" {
+		return ""
+	}
+	// Compare against every token so the timing does not reveal which one matched
+	var caller string
+	for known, identity := range a.Tokens {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(known)) == 1 {
+			caller = identity
+		}
+	}
+	return caller
+}
+
+// certCaller returns the common name of the verified client certificate
+func certCaller(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ""
+	}
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(info.State.VerifiedChains) == 0 || len(info.State.VerifiedChains[0]) == 0 {
+		return ""
+	}
+	return certIdentity(info.State.VerifiedChains[0][0])
+}
+
+// certIdentity uses the common name, falling back to the first DNS name
+func certIdentity(cert *x509.Certificate) string {
+	if cert.Subject.CommonName != "" {
+		return cert.Subject.CommonName
+	}
+	if len(cert.DNSNames) > 0 {
+		return cert.DNSNames[0]
+	}
+	return ""
+}
+
+// ParseCallerTokens parses entries in the form "<identity>=<token>" into a
+// map from token to identity, reporting all invalid entries at once. Tokens
+// are never included in errors.
+func ParseCallerTokens(specs []string) (map[string]string, error) {
+	tokens := make(map[string]string, len(specs))
+	var errs []string
+	for i, spec := range specs {
+		identity, token, ok := strings.Cut(strings.TrimSpace(spec), "=")
+		if !ok || identity == "" || token == "" {
+			errs = append(errs, fmt.Sprintf("entry %d: expected \"<identity>=<token>\"", i+1))
+			continue
+		}
+		if _, dup := tokens[token]; dup {
+			errs = append(errs, fmt.Sprintf("entry %d: token of %s is already used", i+1, identity))
+			continue
+		}
+		tokens[token] = identity
+	}
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return tokens, nil
+}
+
+// TokenCredentials sends a service token with every RPC. It works over
+// plaintext connections, which are only used inside the service network.
+type TokenCredentials string
+
+// GetRequestMetadata implements credentials.PerRPCCredentials
+func (t TokenCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return map[string]string{AuthorizationMetadataKey: "Bearer " + string(t)}, nil
+}
+
+// RequireTransportSecurity implements credentials.PerRPCCredentials
+func (t TokenCredentials) RequireTransportSecurity() bool {
+	return false
+}
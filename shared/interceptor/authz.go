@@ -0,0 +1,148 @@
+package interceptor
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+
+	"github.com/cloud-drive/shared/identity"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Rule describes which end users, and optionally which services, may call a
+// method
+type Rule struct {
+	// Anonymous allows calls without an end user, such as login and registration
+	Anonymous bool
+	// Roles are the roles allowed to call; empty means any signed-in user.
+	// The admin role is always allowed.
+	Roles []string
+	// Owner returns the user ID the request is about; that user may call
+	// even without one of Roles
+	Owner func(req any) string
+	// Callers restricts the method to these calling services, for internal
+	// RPCs one service makes to another. It is not checked when caller
+	// authentication is disabled.
+	Callers []string
+}
+
+// AdminOnly applies to methods without a rule
+var AdminOnly = Rule{Roles: []string{identity.RoleAdmin}}
+
+// Authorization verifies the end-user identity forwarded by the gateway and
+// enforces the rule of each method, so a service does not rely on the
+// gateway's checks alone
+type Authorization struct {
+	// Verifier checks the signed identity; nil treats every call as anonymous
+	Verifier *identity.Verifier
+	// Rules by full method name; methods without a rule use AdminOnly
+	Rules map[string]Rule
+	// Public are full method names, or prefixes ending in "/", not subject to authorization
+	Public []string
+}
+
+// Unary authorizes unary RPCs
+func (a Authorization) Unary() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if matchMethod(a.Public, info.FullMethod) {
+			return handler(ctx, req)
+		}
+		ctx, rule, err := a.authorize(ctx, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkOwner(ctx, rule, req); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// Stream authorizes streaming RPCs. The owner check runs on every received
+// message.
+func (a Authorization) Stream() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if matchMethod(a.Public, info.FullMethod) {
+			return handler(srv, ss)
+		}
+		ctx, rule, err := a.authorize(ss.Context(), info.FullMethod)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &authorizedStream{
+			ServerStream: ss,
+			ctx:          ctx,
+			rule:         rule,
+		})
+	}
+}
+
+// authorize verifies the identity and checks the role part of the rule. The
+// returned rule has Owner set only when the owner still has to be checked.
+func (a Authorization) authorize(ctx context.Context, method string) (context.Context, Rule, error) {
+	rule, ok := a.Rules[method]
+	if !ok {
+		rule = AdminOnly
+	}
+	if caller := CallerFromContext(ctx); len(rule.Callers) > 0 && caller != "" && !slices.Contains(rule.Callers, caller) {
+		return ctx, rule, status.Errorf(codes.PermissionDenied, "caller %q may not call %s", caller, method)
+	}
+
+	var id identity.Identity
+	var found bool
+	if a.Verifier != nil {
+		var err error
+		id, found, err = a.Verifier.FromIncoming(ctx)
+		if err != nil {
+			slog.WarnContext(ctx, "Rejected end-user identity", "method", method, "error", err)
+			return ctx, rule, status.Error(codes.Unauthenticated, "invalid user identity")
+		}
+	}
+	if !found {
+		if rule.Anonymous {
+			return ctx, Rule{}, nil
+		}
+		return ctx, rule, status.Error(codes.Unauthenticated, "user identity required")
+	}
+
+	ctx = identity.NewContext(ctx, id)
+	if id.IsAdmin() || len(rule.Roles) == 0 || slices.Contains(rule.Roles, id.Role) {
+		return ctx, Rule{}, nil
+	}
+	if rule.Owner == nil {
+		return ctx, rule, status.Error(codes.PermissionDenied, "insufficient permissions")
+	}
+	return ctx, Rule{Owner: rule.Owner}, nil
+}
+
+// checkOwner allows the call when the request is about the calling user
+func checkOwner(ctx context.Context, rule Rule, req any) error {
+	if rule.Owner == nil {
+		return nil
+	}
+	id, _ := identity.FromContext(ctx)
+	if owner := rule.Owner(req); owner != "" && owner == id.UserID {
+		return nil
+	}
+	return status.Error(codes.PermissionDenied, "insufficient permissions")
+}
+
+// authorizedStream carries the identity and checks the owner of every message
+type authorizedStream struct {
+	grpc.ServerStream
+	ctx  context.Context
+	rule Rule
+}
+
+func (s *authorizedStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *authorizedStream) RecvMsg(m any) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	return checkOwner(s.ctx, s.rule, m)
+}
@@ -0,0 +1,222 @@
+package interceptor
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloud-drive/shared/identity"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const testSecret = "test-identity-secret"
+
+// ownedRequest is a request about the user UserID
+type ownedRequest struct {
+	UserID string
+}
+
+func requestOwner(req any) string {
+	return req.(*ownedRequest).UserID
+}
+
+// testRules covers each kind of rule
+var testRules = map[string]Rule{
+	"/svc/Login":   {Anonymous: true},
+	"/svc/List":    {},
+	"/svc/Support": {Roles: []string{"support"}},
+	"/svc/GetUser": {Roles: []string{"support"}, Owner: requestOwner},
+	"/svc/Reserve": {Callers: []string{"file-service"}},
+}
+
+// signed returns an identity token for id signed with secret, valid for ttl
+func signed(t *testing.T, secret string, id identity.Identity, ttl time.Duration) string {
+	t.Helper()
+	token, err := identity.NewSigner(secret, "api-gateway", ttl).Sign(id)
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	return token
+}
+
+// withIdentity returns a context with the incoming identity token
+func withIdentity(token string) context.Context {
+	return metadata.NewIncomingContext(context.Background(), metadata.Pairs(identity.MetadataKey, token))
+}
+
+// tamper changes the last character of the signature of token
+func tamper(token string) string {
+	last := "A"
+	if strings.HasSuffix(token, last) {
+		last = "B"
+	}
+	return token[:len(token)-1] + last
+}
+
+// callUnary runs a unary call to method through the interceptor of a and
+// returns the identity the handler saw
+func callUnary(ctx context.Context, a Authorization, method string, req any) (identity.Identity, error) {
+	var seen identity.Identity
+	handler := func(ctx context.Context, req any) (any, error) {
+		seen, _ = identity.FromContext(ctx)
+		return nil, nil
+	}
+	_, err := a.Unary()(ctx, req, &grpc.UnaryServerInfo{FullMethod: method}, handler)
+	return seen, err
+}
+
+func TestAuthorizationIdentity(t *testing.T) {
+	a := Authorization{Verifier: identity.NewVerifier(testSecret), Rules: testRules}
+	alice := identity.Identity{UserID: "alice", Role: "user"}
+	valid := signed(t, testSecret, alice, identity.DefaultTTL)
+
+	for _, tc := range []struct {
+		name string
+		ctx  context.Context
+		want codes.Code
+	}{
+		{"valid", withIdentity(valid), codes.OK},
+		{"none", context.Background(), codes.Unauthenticated},
+		{"unsigned", withIdentity(valid[:strings.LastIndex(valid, ".")]), codes.Unauthenticated},
+		{"tampered signature", withIdentity(tamper(valid)), codes.Unauthenticated},
+		{"other secret", withIdentity(signed(t, "another-secret", alice, identity.DefaultTTL)), codes.Unauthenticated},
+		{"expired", withIdentity(signed(t, testSecret, alice, -2*time.Minute)), codes.Unauthenticated},
+		{"not a token", withIdentity("alice"), codes.Unauthenticated},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			seen, err := callUnary(tc.ctx, a, "/svc/List", nil)
+			if status.Code(err) != tc.want {
+				t.Fatalf("call = %v, want %v", err, tc.want)
+			}
+			if tc.want == codes.OK && seen != alice {
+				t.Fatalf("handler saw %+v, want alice", seen)
+			}
+		})
+	}
+}
+
+func TestAuthorizationRules(t *testing.T) {
+	a := Authorization{Verifier: identity.NewVerifier(testSecret), Rules: testRules}
+	as := func(userID, role string) context.Context {
+		return withIdentity(signed(t, testSecret, identity.Identity{UserID: userID, Role: role}, identity.DefaultTTL))
+	}
+
+	for _, tc := range []struct {
+		name   string
+		ctx    context.Context
+		method string
+		req    any
+		want   codes.Code
+	}{
+		{"anonymous method without identity", context.Background(), "/svc/Login", nil, codes.OK},
+		{"anonymous method with identity", as("alice", "user"), "/svc/Login", nil, codes.OK},
+		{"any user", as("alice", "user"), "/svc/List", nil, codes.OK},
+		{"role listed", as("sam", "support"), "/svc/Support", nil, codes.OK},
+		{"role not listed", as("alice", "user"), "/svc/Support", nil, codes.PermissionDenied},
+		{"admin without listed role", as("root", identity.RoleAdmin), "/svc/Support", nil, codes.OK},
+		{"owner", as("alice", "user"), "/svc/GetUser", &ownedRequest{UserID: "alice"}, codes.OK},
+		{"another owner", as("alice", "user"), "/svc/GetUser", &ownedRequest{UserID: "bob"}, codes.PermissionDenied},
+		{"no owner", as("alice", "user"), "/svc/GetUser", &ownedRequest{}, codes.PermissionDenied},
+		{"role instead of owner", as("sam", "support"), "/svc/GetUser", &ownedRequest{UserID: "bob"}, codes.OK},
+		{"unlisted method", as("alice", "user"), "/svc/Delete", nil, codes.PermissionDenied},
+		{"unlisted method without identity", context.Background(), "/svc/Delete", nil, codes.Unauthenticated},
+		{"unlisted method as admin", as("root", identity.RoleAdmin), "/svc/Delete", nil, codes.OK},
+		{"listed caller", context.WithValue(as("alice", "user"), callerKey{}, "file-service"), "/svc/Reserve", nil, codes.OK},
+		{"other caller", context.WithValue(as("root", identity.RoleAdmin), callerKey{}, "api-gateway"), "/svc/Reserve", nil, codes.PermissionDenied},
+		{"caller not authenticated", as("alice", "user"), "/svc/Reserve", nil, codes.OK},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := callUnary(tc.ctx, a, tc.method, tc.req)
+			if status.Code(err) != tc.want {
+				t.Fatalf("call = %v, want %v", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestAuthorizationPublic(t *testing.T) {
+	a := Authorization{
+		Verifier: identity.NewVerifier(testSecret),
+		Rules:    testRules,
+		Public:   []string{"/grpc.health.v1.Health/", "/svc/Version"},
+	}
+	for _, method := range []string{"/grpc.health.v1.Health/Check", "/svc/Version"} {
+		if _, err := callUnary(withIdentity("tampered"), a, method, nil); err != nil {
+			t.Errorf("public method %s = %v, want allowed", method, err)
+		}
+	}
+	if _, err := callUnary(context.Background(), a, "/svc/VersionHistory", nil); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("method sharing a prefix with a public method = %v, want Unauthenticated", err)
+	}
+}
+
+func TestAuthorizationWithoutVerifier(t *testing.T) {
+	a := Authorization{Rules: testRules}
+	token := signed(t, testSecret, identity.Identity{UserID: "root", Role: identity.RoleAdmin}, identity.DefaultTTL)
+
+	if _, err := callUnary(withIdentity(token), a, "/svc/Login", nil); err != nil {
+		t.Fatalf("anonymous method = %v, want allowed", err)
+	}
+	if _, err := callUnary(withIdentity(token), a, "/svc/List", nil); status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("method for users = %v, want Unauthenticated", err)
+	}
+}
+
+// fakeStream is a server stream receiving msgs in order
+type fakeStream struct {
+	grpc.ServerStream
+	ctx  context.Context
+	msgs []*ownedRequest
+}
+
+func (s *fakeStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *fakeStream) RecvMsg(m any) error {
+	if len(s.msgs) == 0 {
+		return io.EOF
+	}
+	*m.(*ownedRequest) = *s.msgs[0]
+	s.msgs = s.msgs[1:]
+	return nil
+}
+
+func TestAuthorizationStreamChecksEveryMessage(t *testing.T) {
+	a := Authorization{Verifier: identity.NewVerifier(testSecret), Rules: testRules}
+	ctx := withIdentity(signed(t, testSecret, identity.Identity{UserID: "alice", Role: "user"}, identity.DefaultTTL))
+	stream := &fakeStream{ctx: ctx, msgs: []*ownedRequest{{UserID: "alice"}, {UserID: "bob"}}}
+
+	var received int
+	handler := func(srv any, ss grpc.ServerStream) error {
+		if id, ok := identity.FromContext(ss.Context()); !ok || id.UserID != "alice" {
+			t.Errorf("handler saw identity %+v, want alice", id)
+		}
+		for {
+			var req ownedRequest
+			if err := ss.RecvMsg(&req); err != nil {
+				return err
+			}
+			received++
+		}
+	}
+	err := a.Stream()(nil, stream, &grpc.StreamServerInfo{FullMethod: "/svc/GetUser"}, handler)
+	if status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("stream = %v, want PermissionDenied on the message about bob", err)
+	}
+	if received != 1 {
+		t.Fatalf("handler received %d messages, want only the one about alice", received)
+	}
+
+	stream = &fakeStream{ctx: ctx, msgs: []*ownedRequest{{UserID: "alice"}}}
+	err = a.Stream()(nil, stream, &grpc.StreamServerInfo{FullMethod: "/svc/GetUser"}, handler)
+	if !errors.Is(err, io.EOF) {
+		t.Fatalf("stream about alice = %v, want it to end normally", err)
+	}
+}
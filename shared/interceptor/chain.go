@@ -0,0 +1,57 @@
+package interceptor
+
+import (
+	"log/slog"
+
+	"github.com/cloud-drive/shared/logging"
+	sharedmetrics "github.com/cloud-drive/shared/metrics"
+	"google.golang.org/grpc"
+)
+
+// Options configures the server interceptor chain
+type Options struct {
+	// Logger writes the access log and recovered panics
+	Logger *slog.Logger
+	// Metrics records RED metrics; nil disables them
+	Metrics *sharedmetrics.GRPCServerMetrics
+	// Auth authenticates the calling service
+	Auth CallerAuth
+	// Authorization checks the end user the call is made for
+	Authorization Authorization
+	// Deadlines caps how long RPCs may run
+	Deadlines Deadlines
+	// Validators are request validation hooks by full method name
+	Validators map[string]ValidateFunc
+}
+
+// ServerOptions returns the unary and stream chains in the order
+//
+//	logging -> metrics -> recovery -> caller auth -> authorization -> deadline -> validation -> handler
+//
+// so panics and rejected calls still appear in the access log and metrics
+func (o Options) ServerOptions() []grpc.ServerOption {
+	unary := []grpc.UnaryServerInterceptor{logging.UnaryServerInterceptor(o.Logger)}
+	stream := []grpc.StreamServerInterceptor{logging.StreamServerInterceptor(o.Logger)}
+	if o.Metrics != nil {
+		unary = append(unary, o.Metrics.UnaryServerInterceptor())
+		stream = append(stream, o.Metrics.StreamServerInterceptor())
+	}
+	unary = append(unary,
+		UnaryRecovery(o.Logger),
+		o.Auth.Unary(),
+		o.Authorization.Unary(),
+		UnaryDeadline(o.Deadlines),
+		UnaryValidation(o.Validators),
+	)
+	stream = append(stream,
+		StreamRecovery(o.Logger),
+		o.Auth.Stream(),
+		o.Authorization.Stream(),
+		StreamDeadline(o.Deadlines),
+		StreamValidation(o.Validators),
+	)
+	return []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(unary...),
+		grpc.ChainStreamInterceptor(stream...),
+	}
+}
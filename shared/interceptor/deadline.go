@@ -0,0 +1,91 @@
+package interceptor
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+// Deadlines caps how long an RPC may run. A caller deadline shorter than the
+// cap is kept; a missing or longer one is shortened to the cap.
+type Deadlines struct {
+	// Unary is the cap for unary RPCs; 0 means no cap
+	Unary time.Duration
+	// Stream is the cap for streaming RPCs; 0 means no cap
+	Stream time.Duration
+	// Methods overrides the cap per full method name, 0 disables it for the method
+	Methods map[string]time.Duration
+}
+
+// limit returns the cap for the method
+func (d Deadlines) limit(method string, def time.Duration) time.Duration {
+	if limit, ok := d.Methods[method]; ok {
+		return limit
+	}
+	return def
+}
+
+// UnaryDeadline applies the unary cap to every unary RPC
+func UnaryDeadline(d Deadlines) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if limit := d.limit(info.FullMethod, d.Unary); limit > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, limit)
+			defer cancel()
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamDeadline applies the stream cap to every streaming RPC
+func StreamDeadline(d Deadlines) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if limit := d.limit(info.FullMethod, d.Stream); limit > 0 {
+			ctx, cancel := context.WithTimeout(ss.Context(), limit)
+			defer cancel()
+			ss = &contextStream{ServerStream: ss, ctx: ctx}
+		}
+		return handler(srv, ss)
+	}
+}
+
+// ParseMethodDeadlines parses entries in the form
+// "/package.Service/Method=<duration>", reporting all invalid entries at once
+func ParseMethodDeadlines(specs []string) (map[string]time.Duration, error) {
+	methods := make(map[string]time.Duration, len(specs))
+	var errs []string
+	for _, spec := range specs {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		method, value, ok := strings.Cut(spec, "=")
+		if !ok || !strings.HasPrefix(method, "/") || strings.Count(method, "/") != 2 {
+			errs = append(errs, fmt.Sprintf("%q: expected \"/package.Service/Method=<duration>\"", spec))
+			continue
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil || d < 0 {
+			errs = append(errs, fmt.Sprintf("%q: invalid duration %q", spec, value))
+			continue
+		}
+		methods[method] = d
+	}
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return methods, nil
+}
+
+// contextStream overrides the stream context
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *contextStream) Context() context.Context {
+	return s.ctx
+}
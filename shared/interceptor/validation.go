@@ -0,0 +1,66 @@
+package interceptor
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ValidateFunc checks a decoded request message. A plain error is returned
+// to the caller as codes.InvalidArgument; a status error is returned as is.
+type ValidateFunc func(req any) error
+
+// validator is implemented by messages that validate themselves, such as
+// those generated by protoc-gen-validate
+type validator interface {
+	Validate() error
+}
+
+// UnaryValidation runs the hook registered for the method, or the message's
+// own Validate method, before the handler
+func UnaryValidation(hooks map[string]ValidateFunc) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if err := validate(hooks[info.FullMethod], req); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamValidation validates every message received on a stream
+func StreamValidation(hooks map[string]ValidateFunc) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return handler(srv, &validatingStream{ServerStream: ss, hook: hooks[info.FullMethod]})
+	}
+}
+
+func validate(hook ValidateFunc, req any) error {
+	var err error
+	if hook != nil {
+		err = hook(req)
+	} else if v, ok := req.(validator); ok {
+		err = v.Validate()
+	}
+	if err == nil {
+		return nil
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	return status.Error(codes.InvalidArgument, err.Error())
+}
+
+// validatingStream validates messages as the handler receives them
+type validatingStream struct {
+	grpc.ServerStream
+	hook ValidateFunc
+}
+
+func (s *validatingStream) RecvMsg(m any) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	return validate(s.hook, m)
+}
@@ -0,0 +1,46 @@
+// Package logging configures log/slog for all services and carries the
+// request ID between the gateway and backend services.
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// New creates a logger writing to w in "text" or "json" format. The
+// returned LevelVar can be changed at runtime, e.g. on config reload.
+func New(w io.Writer, format, level string) (*slog.Logger, *slog.LevelVar, error) {
+	lvl := new(slog.LevelVar)
+	if err := SetLevel(lvl, level); err != nil {
+		return nil, nil, err
+	}
+
+	opts := &slog.HandlerOptions{
+		Level:       lvl,
+		ReplaceAttr: redactAttr,
+	}
+
+	var handler slog.Handler
+	switch format {
+	case "", "text":
+		handler = slog.NewTextHandler(w, opts)
+	case "json":
+		handler = slog.NewJSONHandler(w, opts)
+	default:
+		return nil, nil, fmt.Errorf("unknown log format %q", format)
+	}
+
+	return slog.New(&contextHandler{Handler: handler}), lvl, nil
+}
+
+// SetLevel parses level (debug, info, warn, error) into lvl
+func SetLevel(lvl *slog.LevelVar, level string) error {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(strings.ToUpper(level))); err != nil {
+		return fmt.Errorf("invalid log level %q", level)
+	}
+	lvl.Set(l)
+	return nil
+}
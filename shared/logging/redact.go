@@ -0,0 +1,39 @@
+package logging
+
+import (
+	"log/slog"
+	"strings"
+)
+
+// redactedValue replaces secrets in log output
+const redactedValue = "[REDACTED]"
+
+// secretKeys are attribute keys whose values are never logged
+var secretKeys = map[string]bool{
+	"password":      true,
+	"token":         true,
+	"authorization": true,
+	"secret":        true,
+}
+
+// redactAttr is used as slog ReplaceAttr to strip PII and secrets
+func redactAttr(_ []string, a slog.Attr) slog.Attr {
+	key := strings.ToLower(a.Key)
+	switch {
+	case secretKeys[key]:
+		return slog.String(a.Key, redactedValue)
+	case key == "email":
+		return slog.String(a.Key, RedactEmail(a.Value.String()))
+	}
+	return a
+}
+
+// RedactEmail keeps the first character of the local part and the domain,
+// e.g. "john.doe@example.com" becomes "j***@example.com"
+func RedactEmail(email string) string {
+	local, domain, ok := strings.Cut(email, "@")
+	if !ok || local == "" {
+		return redactedValue
+	}
+	return local[:1] + "***@" + domain
+}
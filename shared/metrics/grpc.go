@@ -0,0 +1,152 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// GRPCServerMetrics records RED metrics for every RPC handled by a server
+type GRPCServerMetrics struct {
+	requests *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+	inFlight *prometheus.GaugeVec
+}
+
+// NewGRPCServerMetrics registers the gRPC server metrics on reg
+func NewGRPCServerMetrics(reg prometheus.Registerer) *GRPCServerMetrics {
+	m := &GRPCServerMetrics{
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "grpc_server_handled_total",
+			Help: "Number of RPCs completed on the server, by method and status code.",
+		}, []string{"method", "code"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "grpc_server_handling_seconds",
+			Help:    "Duration of RPCs handled by the server.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"method"}),
+		inFlight: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "grpc_server_in_flight",
+			Help: "Number of RPCs currently being handled.",
+		}, []string{"method"}),
+	}
+	reg.MustRegister(m.requests, m.duration, m.inFlight)
+	return m
+}
+
+// UnaryServerInterceptor instruments unary RPCs
+func (m *GRPCServerMetrics) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		done := m.start(info.FullMethod)
+		resp, err := handler(ctx, req)
+		done(err)
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor instruments streaming RPCs
+func (m *GRPCServerMetrics) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		done := m.start(info.FullMethod)
+		err := handler(srv, ss)
+		done(err)
+		return err
+	}
+}
+
+// start marks an RPC in flight and returns the function that records its result
+func (m *GRPCServerMetrics) start(method string) func(error) {
+	start := time.Now()
+	m.inFlight.WithLabelValues(method).Inc()
+	return func(err error) {
+		m.inFlight.WithLabelValues(method).Dec()
+		m.duration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+		m.requests.WithLabelValues(method, status.Code(err).String()).Inc()
+	}
+}
+
+// GRPCClientMetrics records RED metrics for outgoing RPCs
+type GRPCClientMetrics struct {
+	requests *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+}
+
+// NewGRPCClientMetrics registers the gRPC client metrics on reg
+func NewGRPCClientMetrics(reg prometheus.Registerer) *GRPCClientMetrics {
+	m := &GRPCClientMetrics{
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "grpc_client_handled_total",
+			Help: "Number of RPCs completed by the client, by method and status code.",
+		}, []string{"method", "code"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "grpc_client_handling_seconds",
+			Help:    "Duration of RPCs made by the client.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"method"}),
+	}
+	reg.MustRegister(m.requests, m.duration)
+	return m
+}
+
+// UnaryClientInterceptor instruments outgoing unary RPCs
+func (m *GRPCClientMetrics) UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		start := time.Now()
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		m.record(method, start, err)
+		return err
+	}
+}
+
+// StreamClientInterceptor instruments outgoing streaming RPCs. A stream is
+// recorded when receiving ends it: at io.EOF or an error, or at the single
+// response of a stream the server does not stream on. A stream the caller
+// abandons without reading to the end is not recorded.
+func (m *GRPCClientMetrics) StreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		start := time.Now()
+		stream, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			m.record(method, start, err)
+			return nil, err
+		}
+		return &monitoredClientStream{
+			ClientStream:  stream,
+			serverStreams: desc.ServerStreams,
+			done:          func(err error) { m.record(method, start, err) },
+		}, nil
+	}
+}
+
+// record counts a finished RPC started at start
+func (m *GRPCClientMetrics) record(method string, start time.Time, err error) {
+	m.duration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+	m.requests.WithLabelValues(method, status.Code(err).String()).Inc()
+}
+
+// monitoredClientStream records its RPC once receiving ends the stream
+type monitoredClientStream struct {
+	grpc.ClientStream
+	serverStreams bool
+	done          func(error)
+	once          sync.Once
+}
+
+func (s *monitoredClientStream) RecvMsg(m any) error {
+	err := s.ClientStream.RecvMsg(m)
+	switch {
+	case errors.Is(err, io.EOF):
+		s.once.Do(func() { s.done(nil) })
+	case err != nil:
+		s.once.Do(func() { s.done(err) })
+	case !s.serverStreams:
+		s.once.Do(func() { s.done(nil) })
+	}
+	return err
+}
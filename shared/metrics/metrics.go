@@ -0,0 +1,58 @@
+// Package metrics holds the Prometheus instrumentation shared by all
+// services: registry setup, gRPC interceptors and service discovery status.
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// NewRegistry returns a registry with the Go runtime and process collectors
+func NewRegistry() *prometheus.Registry {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return reg
+}
+
+// Handler serves the metrics of reg in the Prometheus exposition format
+func Handler(reg *prometheus.Registry) http.Handler {
+	return promhttp.HandlerFor(reg, promhttp.HandlerOpts{Registry: reg})
+}
+
+// ConsulMetrics reports the service discovery registration state
+type ConsulMetrics struct {
+	registered prometheus.Gauge
+	failures   prometheus.Counter
+}
+
+// NewConsulMetrics registers the Consul registration metrics on reg
+func NewConsulMetrics(reg prometheus.Registerer) *ConsulMetrics {
+	m := &ConsulMetrics{
+		registered: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "consul_registration_up",
+			Help: "Whether the last Consul service registration succeeded (1) or failed (0).",
+		}),
+		failures: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "consul_registration_failures_total",
+			Help: "Number of failed Consul service registrations.",
+		}),
+	}
+	reg.MustRegister(m.registered, m.failures)
+	return m
+}
+
+// Observe records the result of a registration attempt
+func (m *ConsulMetrics) Observe(err error) {
+	if err != nil {
+		m.registered.Set(0)
+		m.failures.Inc()
+		return
+	}
+	m.registered.Set(1)
+}
@@ -0,0 +1,211 @@
+// Package shutdown runs the graceful shutdown of a service as ordered phases:
+// stop reporting ready, leave service discovery, wait for the change to
+// propagate, drain in-flight requests with a deadline, then release resources
+// and flush telemetry.
+package shutdown
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+// DefaultHookTimeout bounds every hook outside the drain phase
+const DefaultHookTimeout = 5 * time.Second
+
+// Phase is a step of the shutdown sequence. Phases run in declaration order.
+type Phase int
+
+const (
+	// PhaseNotReady makes readiness probes and gRPC health report not serving
+	PhaseNotReady Phase = iota
+	// PhaseDeregister removes the instance from service discovery
+	PhaseDeregister
+	// PhaseDrain stops the servers. Hooks run concurrently and must force-stop
+	// when their context is done.
+	PhaseDrain
+	// PhaseClose releases resources such as database pools
+	PhaseClose
+	// PhaseFlush flushes telemetry, last so the shutdown itself is exported
+	PhaseFlush
+)
+
+var phaseNames = [...]string{"not-ready", "deregister", "drain", "close", "flush"}
+
+// String returns the name used in logs
+func (p Phase) String() string {
+	if p >= 0 && int(p) < len(phaseNames) {
+		return phaseNames[p]
+	}
+	return fmt.Sprintf("phase(%d)", int(p))
+}
+
+// Hook is a step run during shutdown
+type Hook func(ctx context.Context) error
+
+type hook struct {
+	name string
+	fn   Hook
+}
+
+// Sequence collects hooks per phase and runs them once on shutdown
+type Sequence struct {
+	delay        time.Duration
+	drainTimeout time.Duration
+	hookTimeout  time.Duration
+
+	mu    sync.Mutex
+	hooks map[Phase][]hook
+	once  sync.Once
+	err   error
+}
+
+// New creates a sequence that waits delay between deregistering and draining,
+// so clients and load balancers stop sending new requests, and gives
+// in-flight requests drainTimeout to finish before servers are force-stopped
+func New(delay, drainTimeout time.Duration) *Sequence {
+	return &Sequence{
+		delay:        delay,
+		drainTimeout: drainTimeout,
+		hookTimeout:  DefaultHookTimeout,
+		hooks:        make(map[Phase][]hook),
+	}
+}
+
+// Add registers a hook. Hooks of the same phase run in registration order,
+// except drain hooks which run concurrently.
+func (s *Sequence) Add(phase Phase, name string, fn Hook) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hooks[phase] = append(s.hooks[phase], hook{name: name, fn: fn})
+}
+
+// Run executes the phases and returns the errors of the failed hooks. Only the
+// first call runs the sequence; later calls return the same result.
+func (s *Sequence) Run(ctx context.Context) error {
+	s.once.Do(func() {
+		s.err = s.run(ctx)
+	})
+	return s.err
+}
+
+func (s *Sequence) run(ctx context.Context) error {
+	start := time.Now()
+	var errs []error
+
+	errs = append(errs, s.runPhase(ctx, PhaseNotReady)...)
+	errs = append(errs, s.runPhase(ctx, PhaseDeregister)...)
+
+	if s.delay > 0 {
+		slog.Info("Waiting for deregistration to propagate", "delay", s.delay)
+		select {
+		case <-time.After(s.delay):
+		case <-ctx.Done():
+		}
+	}
+
+	errs = append(errs, s.runPhase(ctx, PhaseDrain)...)
+	errs = append(errs, s.runPhase(ctx, PhaseClose)...)
+	errs = append(errs, s.runPhase(ctx, PhaseFlush)...)
+
+	slog.Info("Shutdown sequence finished", "duration", time.Since(start).Round(time.Millisecond), "errors", len(errs))
+	return errors.Join(errs...)
+}
+
+func (s *Sequence) runPhase(ctx context.Context, phase Phase) []error {
+	s.mu.Lock()
+	hooks := append([]hook(nil), s.hooks[phase]...)
+	s.mu.Unlock()
+	if len(hooks) == 0 {
+		return nil
+	}
+
+	if phase == PhaseDrain {
+		ctx, cancel := context.WithTimeout(ctx, s.drainTimeout)
+		defer cancel()
+
+		errs := make([]error, len(hooks))
+		var wg sync.WaitGroup
+		for i, h := range hooks {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				errs[i] = s.runHook(ctx, phase, h)
+			}()
+		}
+		wg.Wait()
+		return compact(errs)
+	}
+
+	var errs []error
+	for _, h := range hooks {
+		ctx, cancel := context.WithTimeout(ctx, s.hookTimeout)
+		if err := s.runHook(ctx, phase, h); err != nil {
+			errs = append(errs, err)
+		}
+		cancel()
+	}
+	return errs
+}
+
+func (s *Sequence) runHook(ctx context.Context, phase Phase, h hook) error {
+	start := time.Now()
+	err := h.fn(ctx)
+	duration := time.Since(start).Round(time.Millisecond)
+	if err != nil {
+		slog.Warn("Shutdown hook failed", "phase", phase.String(), "hook", h.name, "duration", duration, "error", err)
+		return fmt.Errorf("%s %s: %w", phase, h.name, err)
+	}
+	slog.Info("Shutdown hook finished", "phase", phase.String(), "hook", h.name, "duration", duration)
+	return nil
+}
+
+func compact(errs []error) []error {
+	var out []error
+	for _, err := range errs {
+		if err != nil {
+			out = append(out, err)
+		}
+	}
+	return out
+}
+
+// HTTPServer returns a drain hook that waits for in-flight requests and closes
+// the remaining connections when the deadline passes
+func HTTPServer(srv *http.Server) Hook {
+	return func(ctx context.Context) error {
+		err := srv.Shutdown(ctx)
+		if err != nil && ctx.Err() != nil {
+			srv.Close()
+			return fmt.Errorf("in-flight requests cut off: %w", err)
+		}
+		return err
+	}
+}
+
+// GRPCServer returns a drain hook that stops the server gracefully and
+// cancels the remaining RPCs and streams when the deadline passes
+func GRPCServer(srv *grpc.Server) Hook {
+	return func(ctx context.Context) error {
+		done := make(chan struct{})
+		go func() {
+			srv.GracefulStop()
+			close(done)
+		}()
+
+		select {
+		case <-done:
+			return nil
+		case <-ctx.Done():
+			srv.Stop()
+			<-done
+			return fmt.Errorf("in-flight RPCs cut off: %w", ctx.Err())
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package shutdown
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recorder collects the names of hooks in the order they ran
+type recorder struct {
+	mu    sync.Mutex
+	names []string
+}
+
+func (r *recorder) hook(name string) Hook {
+	return func(ctx context.Context) error {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.names = append(r.names, name)
+		return nil
+	}
+}
+
+func (r *recorder) ran() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.names)
+}
+
+func TestPhasesRunInOrder(t *testing.T) {
+	var r recorder
+	s := New(0, time.Second)
+	s.Add(PhaseFlush, "tracing", r.hook("tracing"))
+	s.Add(PhaseClose, "repository", r.hook("repository"))
+	s.Add(PhaseClose, "uploads", r.hook("uploads"))
+	s.Add(PhaseDrain, "grpc", r.hook("grpc"))
+	s.Add(PhaseDeregister, "consul", r.hook("consul"))
+	s.Add(PhaseNotReady, "health", r.hook("health"))
+
+	if err := s.Run(context.Background()); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	want := []string{"health", "consul", "grpc", "repository", "uploads", "tracing"}
+	if got := r.ran(); !slices.Equal(got, want) {
+		t.Fatalf("hooks ran as %v, want %v", got, want)
+	}
+}
+
+func TestDrainHooksRunConcurrently(t *testing.T) {
+	s := New(0, time.Second)
+	// Each hook waits for the other to start, so running them one after the
+	// other would hold both until the drain timeout
+	var started sync.WaitGroup
+	started.Add(2)
+	for _, name := range []string{"http", "grpc"} {
+		s.Add(PhaseDrain, name, func(ctx context.Context) error {
+			started.Done()
+			done := make(chan struct{})
+			go func() {
+				started.Wait()
+				close(done)
+			}()
+			select {
+			case <-done:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+	}
+
+	if err := s.Run(context.Background()); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+}
+
+func TestDrainTimeoutForceStops(t *testing.T) {
+	s := New(0, 50*time.Millisecond)
+	var r recorder
+	s.Add(PhaseDrain, "stuck", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	s.Add(PhaseClose, "repository", r.hook("repository"))
+
+	start := time.Now()
+	err := s.Run(context.Background())
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Run = %v, want the drain deadline", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("Run took %s, want about the drain timeout", elapsed)
+	}
+	if got := r.ran(); !slices.Equal(got, []string{"repository"}) {
+		t.Fatalf("hooks after the drain ran as %v, want [repository]", got)
+	}
+}
+
+func TestHTTPServerCutsOffRequestsAtDeadline(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(entered)
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	})}
+	go srv.Serve(lis)
+
+	requestDone := make(chan error, 1)
+	go func() {
+		resp, err := http.Get("http://" + lis.Addr().String())
+		if err == nil {
+			resp.Body.Close()
+		}
+		requestDone <- err
+	}()
+	<-entered
+
+	s := New(0, 50*time.Millisecond)
+	s.Add(PhaseDrain, "http", HTTPServer(srv))
+	if err := s.Run(context.Background()); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Run = %v, want the drain deadline", err)
+	}
+	select {
+	case err := <-requestDone:
+		if err == nil {
+			t.Fatal("request in flight completed, want its connection closed")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("request in flight was not cut off")
+	}
+}
+
+func TestHookTimeout(t *testing.T) {
+	s := New(0, time.Second)
+	s.hookTimeout = 20 * time.Millisecond
+	var r recorder
+	s.Add(PhaseClose, "stuck", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	s.Add(PhaseClose, "repository", r.hook("repository"))
+
+	err := s.Run(context.Background())
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Run = %v, want the hook deadline", err)
+	}
+	if got := r.ran(); !slices.Equal(got, []string{"repository"}) {
+		t.Fatalf("hooks after the stuck one ran as %v, want [repository]", got)
+	}
+}
+
+func TestDelayEndsWithContext(t *testing.T) {
+	s := New(time.Hour, time.Second)
+	var r recorder
+	s.Add(PhaseDeregister, "consul", r.hook("consul"))
+	s.Add(PhaseClose, "repository", r.hook("repository"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- s.Run(ctx) }()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Run: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run still waiting for the propagation delay after the context ended")
+	}
+	if got := r.ran(); !slices.Equal(got, []string{"consul", "repository"}) {
+		t.Fatalf("hooks ran as %v, want [consul repository]", got)
+	}
+}
+
+func TestRunOnce(t *testing.T) {
+	errConsul := errors.New("consul unreachable")
+	errTracing := errors.New("exporter unreachable")
+	calls := 0
+	s := New(0, time.Second)
+	s.Add(PhaseDeregister, "consul", func(ctx context.Context) error {
+		calls++
+		return errConsul
+	})
+	s.Add(PhaseFlush, "tracing", func(ctx context.Context) error {
+		return errTracing
+	})
+
+	first := s.Run(context.Background())
+	if !errors.Is(first, errConsul) || !errors.Is(first, errTracing) {
+		t.Fatalf("Run = %v, want both hook errors", first)
+	}
+	second := s.Run(context.Background())
+	if second != first {
+		t.Fatalf("second Run = %v, want the result of the first", second)
+	}
+	if calls != 1 {
+		t.Fatalf("hooks ran %d times, want once", calls)
+	}
+}
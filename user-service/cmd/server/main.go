@@ -1,19 +1,33 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"github.com/cloud-drive/proto-definitions/user"
+	sharedconfig "github.com/cloud-drive/shared/config"
+	sharedhealth "github.com/cloud-drive/shared/health"
+	"github.com/cloud-drive/shared/identity"
+	"github.com/cloud-drive/shared/interceptor"
+	"github.com/cloud-drive/shared/logging"
+	sharedmetrics "github.com/cloud-drive/shared/metrics"
+	"github.com/cloud-drive/shared/shutdown"
+	"github.com/cloud-drive/shared/tracing"
 	"github.com/cloud-drive/user-service/internal/config"
+	"github.com/cloud-drive/user-service/internal/metrics"
 	"github.com/cloud-drive/user-service/internal/repository"
 	"github.com/cloud-drive/user-service/internal/service"
 	consulapi "github.com/hashicorp/consul/api"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/health"
 	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 	"google.golang.org/grpc/reflection"
-	"log"
+	"log/slog"
 	"net"
+	"net/http"
 	"os"
 	"os/signal"
 	"strings"
@@ -22,15 +36,40 @@ import (
 )
 
 func main() {
-	// Load configuration
-	cfg := config.LoadConfig()
+	// Load configuration: defaults < config file < env < flags
+	reloader, err := config.NewReloader(os.Args[1:])
+	switch {
+	case errors.Is(err, flag.ErrHelp), errors.Is(err, sharedconfig.ErrPrinted):
+		// --help và --print-config đã in xong, không khởi động service
+		return
+	case err != nil:
+		fmt.Fprintf(os.Stderr, "Invalid configuration: %v\n", err)
+		os.Exit(1)
+	}
+	cfg := reloader.Current()
+
+	// Structured logger, level có thể reload
+	logger, logLevel, err := logging.New(os.Stdout, cfg.LogFormat, cfg.LogLevel)
+	if err != nil {
+		fatal("Failed to create logger", "error", err)
+	}
+	slog.SetDefault(logger)
 
-	// Parse command-line flags (chỉ ghi đè nếu được cung cấp)
-	flag.IntVar(&cfg.Port, "port", cfg.Port, "User service gRPC port")
-	flag.Parse()
+	// OpenTelemetry tracing, tiếp nối trace từ traceparent do gateway gửi sang
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Config{
+		ServiceName:  "user-service",
+		Environment:  cfg.Environment,
+		Exporter:     cfg.TraceExporter,
+		OTLPEndpoint: cfg.TraceEndpoint,
+		OTLPInsecure: cfg.TraceInsecure,
+		SampleRatio:  cfg.TraceSampleRatio,
+	})
+	if err != nil {
+		fatal("Failed to set up tracing", "error", err)
+	}
 
 	// Log thông tin môi trường
-	log.Printf("Starting User Service in %s environment with host mode: %s", cfg.Environment, cfg.HostMode)
+	slog.Info("Starting User Service", "environment", cfg.Environment, "host_mode", cfg.HostMode, "caller_auth", cfg.GRPCAuthMode)
 
 	// Xác định địa chỉ lắng nghe - Quan trọng: sử dụng 0.0.0.0 để các container khác có thể kết nối
 	listenAddr := "0.0.0.0"
@@ -42,62 +81,201 @@ func main() {
 	// Set up listener
 	lis, err := net.Listen("tcp", fmt.Sprintf("%s:%d", listenAddr, cfg.Port))
 	if err != nil {
-		log.Fatalf("Failed to listen: %v", err)
+		fatal("Failed to listen", "error", err)
 	}
 
-	// Create gRPC server
-	server := grpc.NewServer()
+	// Prometheus registry: Go runtime, gRPC, repository, auth và Consul metrics
+	registry := sharedmetrics.NewRegistry()
+	serviceMetrics := metrics.New(registry)
+	grpcMetrics := sharedmetrics.NewGRPCServerMetrics(registry)
+	consulMetrics := sharedmetrics.NewConsulMetrics(registry)
+
+	// Interceptor chain: access log, metrics, recovery, xác thực service gọi tới,
+	// phân quyền theo người dùng do gateway chuyển tiếp, giới hạn deadline và
+	// validate request. Health check không cần credentials để Consul kiểm tra được.
+	serverOpts := []grpc.ServerOption{grpc.StatsHandler(otelgrpc.NewServerHandler())}
+	if cfg.GRPCAuthMode == interceptor.AuthMTLS {
+		creds, err := interceptor.ServerTLS(cfg.GRPCTLSCert, cfg.GRPCTLSKey, cfg.GRPCTLSClientCA)
+		if err != nil {
+			fatal("Failed to load gRPC TLS credentials", "error", err)
+		}
+		serverOpts = append(serverOpts, grpc.Creds(creds))
+	}
+	serverOpts = append(serverOpts, interceptor.Options{
+		Logger:  logger,
+		Metrics: grpcMetrics,
+		Auth: interceptor.CallerAuth{
+			Mode:    cfg.GRPCAuthMode,
+			Tokens:  cfg.CallerTokens(),
+			Allowed: cfg.GRPCCallers,
+			Public:  []string{interceptor.HealthServicePrefix},
+		},
+		Authorization: interceptor.Authorization{
+			Verifier: identity.NewVerifier(cfg.IdentitySecret),
+			Rules:    service.AuthorizationRules(),
+			Public: []string{
+				interceptor.HealthServicePrefix,
+				"/grpc.reflection.v1.ServerReflection/",
+				"/grpc.reflection.v1alpha.ServerReflection/",
+			},
+		},
+		Deadlines:  cfg.Deadlines(),
+		Validators: service.Validators(),
+	}.ServerOptions()...)
+	server := grpc.NewServer(serverOpts...)
 
 	// Create repository
-	userRepo := repository.NewInMemoryUserRepository()
+	userRepo := repository.NewInstrumentedUserRepository(repository.NewInMemoryUserRepository(), serviceMetrics)
 
 	// Create and register user service
-	userService := service.NewUserService(userRepo)
+	userService := service.NewUserService(userRepo, serviceMetrics, cfg.StorageLimit)
 	user.RegisterUserServiceServer(server, userService)
 
-	// Register health service
+	consulClient, err := newConsulClient(cfg)
+	if err != nil {
+		fatal("Failed to create Consul client", "error", err)
+	}
+
+	// Health checks: repository quyết định trạng thái SERVING, Consul chỉ làm trạng thái degraded
+	checker := sharedhealth.NewChecker(2 * time.Second)
+	checker.Add("repository", true, userRepo.Ping)
+	checker.Add("consul", false, sharedhealth.ConsulCheck(consulClient))
+
+	// Register health service, trạng thái được cập nhật theo kết quả health check
 	healthServer := health.NewServer()
-	healthServer.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+	healthServer.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
 	healthpb.RegisterHealthServer(server, healthServer)
+	healthCtx, stopHealth := context.WithCancel(context.Background())
+	defer stopHealth()
+	go checker.Watch(healthCtx, healthServer, 5*time.Second, "", "user.UserService")
 
 	// Register reflection service
 	reflection.Register(server)
 
-	// Register service with Consul
-	go registerWithConsul(cfg)
+	// Reload các thiết lập runtime (log level) khi nhận SIGHUP hoặc Consul KV thay đổi
+	reloadCtx, stopReload := context.WithCancel(context.Background())
+	defer stopReload()
+	reloader.Subscribe(func(old, next *config.Config) {
+		if old.LogLevel != next.LogLevel {
+			if err := logging.SetLevel(logLevel, next.LogLevel); err != nil {
+				slog.Error("Failed to change log level", "error", err)
+			} else {
+				slog.Info("Log level changed", "from", old.LogLevel, "to", next.LogLevel)
+			}
+		}
+	})
+	reloader.WatchSignals(reloadCtx, syscall.SIGHUP)
+	if cfg.ConsulKey != "" {
+		watchConsulConfig(reloadCtx, cfg, reloader)
+	}
+
+	// Metrics và health endpoint trên port HTTP riêng, không đi qua gRPC
+	metricsServer := newMetricsServer(listenAddr, cfg.MetricsPort, registry, checker)
+	go func() {
+		slog.Info("Metrics server listening", "address", metricsServer.Addr)
+		if err := metricsServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			slog.Error("Metrics server failed", "error", err)
+		}
+	}()
+
+	// Register service with Consul, keep-alive dừng khi bắt đầu shutdown
+	registration := consulRegistration(cfg)
+	keepAliveCtx, stopKeepAlive := context.WithCancel(context.Background())
+	keepAliveDone := make(chan struct{})
+	go func() {
+		defer close(keepAliveDone)
+		registerWithConsul(keepAliveCtx, consulClient, registration, consulMetrics)
+	}()
 
 	// Start gRPC server
 	go func() {
-		log.Printf("Starting User Service on %s:%d\n", listenAddr, cfg.Port)
+		slog.Info("User Service listening", "address", listenAddr, "port", cfg.Port)
 		if err := server.Serve(lis); err != nil {
-			log.Fatalf("Failed to serve: %v", err)
+			fatal("Failed to serve", "error", err)
 		}
 	}()
 
+	// Thứ tự shutdown: báo not ready, rời Consul, chờ client cập nhật, drain RPC
+	// đang chạy (stream quá hạn bị huỷ), đóng repository rồi flush trace
+	stopping := shutdown.New(cfg.ShutdownDelay, cfg.ShutdownTimeout)
+	stopping.Add(shutdown.PhaseNotReady, "health", func(ctx context.Context) error {
+		checker.SetShuttingDown()
+		stopHealth()
+		healthServer.Shutdown()
+		return nil
+	})
+	stopping.Add(shutdown.PhaseDeregister, "consul", func(ctx context.Context) error {
+		stopKeepAlive()
+		select {
+		case <-keepAliveDone:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		return consulClient.Agent().ServiceDeregisterOpts(registration.ID, (&consulapi.QueryOptions{}).WithContext(ctx))
+	})
+	stopping.Add(shutdown.PhaseDrain, "grpc", shutdown.GRPCServer(server))
+	stopping.Add(shutdown.PhaseClose, "repository", func(ctx context.Context) error {
+		return userRepo.Close()
+	})
+	stopping.Add(shutdown.PhaseClose, "metrics", shutdown.HTTPServer(metricsServer))
+	stopping.Add(shutdown.PhaseFlush, "tracing", shutdownTracing)
+
 	// Wait for interrupt signal
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
-	log.Println("Shutting down User Service...")
+	slog.Info("Shutting down User Service", "propagation_delay", cfg.ShutdownDelay, "drain_timeout", cfg.ShutdownTimeout)
 
-	// Gracefully stop server
-	server.GracefulStop()
-	log.Println("User Service stopped")
+	if err := stopping.Run(context.Background()); err != nil {
+		slog.Warn("User Service stopped with errors", "error", err)
+		return
+	}
+	slog.Info("User Service stopped")
 }
 
-// registerWithConsul registers the service with Consul
-func registerWithConsul(cfg *config.Config) {
-	consulConfig := consulapi.DefaultConfig()
+// fatal logs at error level and exits
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
 
-	// Sửa URL Consul để sử dụng IPv4
+// newConsulClient creates a Consul client, using IPv4 for localhost
+func newConsulClient(cfg *config.Config) (*consulapi.Client, error) {
+	consulConfig := consulapi.DefaultConfig()
 	consulConfig.Address = strings.Replace(cfg.ConsulURL, "localhost", "127.0.0.1", 1)
+	return consulapi.NewClient(consulConfig)
+}
 
-	client, err := consulapi.NewClient(consulConfig)
+// watchConsulConfig applies runtime overrides stored in Consul KV
+func watchConsulConfig(ctx context.Context, cfg *config.Config, reloader *sharedconfig.Reloader[config.Config]) {
+	client, err := newConsulClient(cfg)
 	if err != nil {
-		log.Printf("Failed to create Consul client: %v", err)
+		slog.Error("Failed to create Consul client for config watch", "error", err)
 		return
 	}
 
+	slog.Info("Watching Consul for configuration overrides", "key", cfg.ConsulKey)
+	sharedconfig.WatchConsulKV(ctx, client, cfg.ConsulKey, reloader)
+}
+
+// newMetricsServer serves the Prometheus registry on /metrics together with
+// the /livez, /readyz and /health/details probes
+func newMetricsServer(listenAddr string, port int, registry *prometheus.Registry, checker *sharedhealth.Checker) *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", sharedmetrics.Handler(registry))
+	mux.Handle("/livez", sharedhealth.LivezHandler())
+	mux.Handle("/readyz", checker.ReadyzHandler())
+	mux.Handle("/health/details", checker.DetailsHandler())
+
+	return &http.Server{
+		Addr:              fmt.Sprintf("%s:%d", listenAddr, port),
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+}
+
+// consulRegistration describes this instance for Consul
+func consulRegistration(cfg *config.Config) *consulapi.AgentServiceRegistration {
 	hostname, err := os.Hostname()
 	if err != nil {
 		hostname = "unknown"
@@ -110,7 +288,7 @@ func registerWithConsul(cfg *config.Config) {
 		serviceAddress = "localhost"
 	}
 
-	registration := &consulapi.AgentServiceRegistration{
+	return &consulapi.AgentServiceRegistration{
 		ID:      fmt.Sprintf("user-service-%s-%d", hostname, cfg.Port),
 		Name:    "user-service",
 		Port:    cfg.Port,
@@ -122,29 +300,49 @@ func registerWithConsul(cfg *config.Config) {
 			DeregisterCriticalServiceAfter: "30s",
 		},
 	}
+}
 
+// registerWithConsul registers the service with Consul and re-registers it
+// periodically until ctx is done
+func registerWithConsul(ctx context.Context, client *consulapi.Client, registration *consulapi.AgentServiceRegistration, consulMetrics *sharedmetrics.ConsulMetrics) {
 	// Initial registration
-	retryRegister(client, registration, 5)
+	retryRegister(ctx, client, registration, 5, consulMetrics)
 
 	// Re-register every 30 seconds as a keep-alive mechanism
 	ticker := time.NewTicker(30 * time.Second)
-	for range ticker.C {
-		if err := client.Agent().ServiceRegister(registration); err != nil {
-			log.Printf("Failed to re-register with Consul: %v", err)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		err := client.Agent().ServiceRegister(registration)
+		consulMetrics.Observe(err)
+		if err != nil {
+			slog.Warn("Failed to re-register with Consul", "error", err)
 		}
 	}
 }
 
 // retryRegister tries to register with Consul with retries
-func retryRegister(client *consulapi.Client, registration *consulapi.AgentServiceRegistration, retries int) {
+func retryRegister(ctx context.Context, client *consulapi.Client, registration *consulapi.AgentServiceRegistration, retries int, consulMetrics *sharedmetrics.ConsulMetrics) {
 	for i := 0; i < retries; i++ {
+		if ctx.Err() != nil {
+			return
+		}
 		err := client.Agent().ServiceRegister(registration)
+		consulMetrics.Observe(err)
 		if err == nil {
-			log.Printf("Registered service with Consul")
+			slog.Info("Registered service with Consul", "id", registration.ID)
+			return
+		}
+		slog.Warn("Failed to register with Consul, retrying", "error", err)
+		select {
+		case <-ctx.Done():
 			return
+		case <-time.After(time.Second * 2):
 		}
-		log.Printf("Failed to register with Consul: %v, retrying...", err)
-		time.Sleep(time.Second * 2)
 	}
-	log.Printf("Could not register with Consul after %d retries", retries)
+	slog.Error("Could not register with Consul", "retries", retries)
 }
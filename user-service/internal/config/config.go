@@ -1,89 +1,162 @@
 package config
 
 import (
+	"errors"
+	"fmt"
 	"os"
-	"strconv"
+	"time"
+
+	sharedconfig "github.com/cloud-drive/shared/config"
+	"github.com/cloud-drive/shared/interceptor"
+	"github.com/cloud-drive/shared/utils"
+)
+
+// Default secrets are only acceptable outside production
+const (
+	defaultCallerToken      = "default_internal_token"
+	defaultFileServiceToken = "default_file_service_token"
+	defaultIdentitySecret   = "default_identity_secret"
 )
 
 // Config holds the application configuration
 type Config struct {
-	Environment string
-	HostMode    string
-	Port        int
-	ConsulURL   string
-	LogLevel    string
-	DBHost      string
-	DBPort      int
-	DBUser      string
-	DBPassword  string
-	DBName      string
+	Environment      string        `config:"environment" env:"APP_ENV" default:"development" validate:"oneof=development production"`
+	HostMode         string        `config:"host_mode" env:"HOST_MODE" validate:"oneof=local docker"`
+	Port             int           `config:"port" env:"PORT" flag:"port" usage:"User service gRPC port" default:"9001" validate:"min=1,max=65535"`
+	MetricsPort      int           `config:"metrics.port" env:"METRICS_PORT" flag:"metrics-port" usage:"Port for the Prometheus /metrics endpoint" default:"9101" validate:"min=1,max=65535"`
+	ConsulURL        string        `config:"consul.url" env:"CONSUL_URL" flag:"consul-url" usage:"Consul agent address" validate:"required,hostport"`
+	ConsulKey        string        `config:"consul.config_key" env:"CONSUL_CONFIG_KEY" usage:"Consul KV key with runtime overrides (empty disables the watch)"`
+	LogFormat        string        `config:"log.format" env:"LOG_FORMAT" usage:"Log output format (text, json)" default:"text" validate:"oneof=text json"`
+	LogLevel         string        `config:"log.level" env:"LOG_LEVEL" flag:"log-level" usage:"Log level (debug, info, warn, error)" default:"info" reload:"true" validate:"oneof=debug info warn error"`
+	TraceExporter    string        `config:"tracing.exporter" env:"TRACING_EXPORTER" usage:"Trace exporter (none, stdout, otlp)" default:"none" validate:"oneof=none stdout otlp"`
+	TraceEndpoint    string        `config:"tracing.otlp_endpoint" env:"TRACING_OTLP_ENDPOINT" default:"localhost:4317" validate:"hostport"`
+	TraceInsecure    bool          `config:"tracing.otlp_insecure" env:"TRACING_OTLP_INSECURE" default:"true"`
+	TraceSampleRatio float64       `config:"tracing.sample_ratio" env:"TRACING_SAMPLE_RATIO" default:"1" validate:"min=0,max=1"`
+	DBHost           string        `config:"db.host" env:"DB_HOST" validate:"required"`
+	DBPort           int           `config:"db.port" env:"DB_PORT" default:"5432" validate:"min=1,max=65535"`
+	DBUser           string        `config:"db.user" env:"DB_USER" default:"postgres" validate:"required"`
+	DBPassword       string        `config:"db.password" env:"DB_PASSWORD" default:"postgres" secret:"true"`
+	DBName           string        `config:"db.name" env:"DB_NAME" default:"users" validate:"required"`
+	StorageLimit     int64         `config:"storage.default_limit" env:"DEFAULT_STORAGE_LIMIT" usage:"Storage quota of new users in bytes (0 for unlimited)" default:"10737418240" validate:"min=0"`
+	ShutdownDelay    time.Duration `config:"shutdown.propagation_delay" env:"SHUTDOWN_PROPAGATION_DELAY" usage:"How long to keep serving after deregistering from Consul before draining" default:"5s" validate:"max=1m"`
+	ShutdownTimeout  time.Duration `config:"shutdown.drain_timeout" env:"SHUTDOWN_DRAIN_TIMEOUT" usage:"Deadline for in-flight RPCs and streams before they are cancelled" default:"20s" validate:"min=1s,max=5m"`
+	GRPCMaxDeadline  time.Duration `config:"grpc.max_deadline" env:"GRPC_MAX_DEADLINE" usage:"Longest a unary RPC may run, shorter caller deadlines are kept (0 disables)" default:"30s"`
+	GRPCMaxStream    time.Duration `config:"grpc.max_stream_deadline" env:"GRPC_MAX_STREAM_DEADLINE" usage:"Longest a streaming RPC may run (0 disables)" default:"0s"`
+	GRPCMethodLimits []string      `config:"grpc.method_deadlines" env:"GRPC_METHOD_DEADLINES" usage:"Per-method deadline caps: /package.Service/Method=<duration>"`
+	GRPCAuthMode     string        `config:"grpc.auth.mode" env:"GRPC_AUTH_MODE" usage:"How calling services are authenticated (none, token, mtls)" default:"token" validate:"oneof=none token mtls"`
+	GRPCCallerTokens []string      `config:"grpc.auth.tokens" env:"GRPC_AUTH_TOKENS" usage:"Accepted service tokens: <identity>=<token>" default:"api-gateway=default_internal_token,file-service=default_file_service_token" secret:"true"`
+	GRPCCallers      []string      `config:"grpc.auth.allowed_callers" env:"GRPC_ALLOWED_CALLERS" usage:"Service identities allowed to call (token identity or certificate common name)" default:"api-gateway,file-service"`
+	IdentitySecret   string        `config:"grpc.auth.identity_secret" env:"INTERNAL_IDENTITY_SECRET" usage:"Secret verifying the end-user identity signed by the gateway" default:"default_identity_secret" secret:"true" validate:"required"`
+	GRPCTLSCert      string        `config:"grpc.tls.cert_file" env:"GRPC_TLS_CERT_FILE"`
+	GRPCTLSKey       string        `config:"grpc.tls.key_file" env:"GRPC_TLS_KEY_FILE"`
+	GRPCTLSClientCA  string        `config:"grpc.tls.client_ca_file" env:"GRPC_TLS_CLIENT_CA_FILE" usage:"CA that signs client certificates, required for mtls"`
+}
+
+// LoadConfig loads the application configuration from defaults, the optional
+// config file, environment variables and command-line flags, in that order
+func LoadConfig(args []string) (*Config, error) {
+	return load(args, nil)
+}
+
+// NewReloader loads the initial configuration and returns a reloader that
+// re-reads the same sources on SIGHUP or when Consul overrides change
+func NewReloader(args []string) (*sharedconfig.Reloader[Config], error) {
+	return sharedconfig.NewReloader(func(overrides map[string]any) (*Config, error) {
+		return load(args, overrides)
+	})
 }
 
-// LoadConfig loads the application configuration from environment variables
-func LoadConfig() *Config {
-	// Đọc biến môi trường HOST_MODE
-	hostMode := getEnv("HOST_MODE", "")
+func load(args []string, overrides map[string]any) (*Config, error) {
+	cfg := &Config{}
+	err := sharedconfig.Load(cfg, sharedconfig.Options{
+		Name:            "user-service",
+		Args:            args,
+		LegacyEnvPrefix: legacyEnvPrefix(),
+		Overrides:       overrides,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
 
+// ApplyDefaults fills the settings whose defaults depend on the host mode
+func (c *Config) ApplyDefaults() {
 	// Nếu HOST_MODE không được cung cấp, tự động phát hiện
-	if hostMode == "" {
-		// Kiểm tra các dấu hiệu của Docker container
-		if _, err := os.Stat("/.dockerenv"); err == nil {
-			// File /.dockerenv tồn tại -> đang trong Docker
-			hostMode = "docker"
-		} else {
-			// Mặc định là local
-			hostMode = "local"
+	if c.HostMode == "" {
+		c.HostMode = "local"
+		if utils.IsRunningInDocker() {
+			c.HostMode = "docker"
 		}
 	}
 
-	cfg := &Config{
-		Environment: getEnv("APP_ENV", "development"),
-		LogLevel:    getEnv("LOG_LEVEL", "info"),
-		HostMode:    hostMode,
+	// Trong Docker dùng tên service, khi debug local dùng IPv4
+	if c.ConsulURL == "" {
+		c.ConsulURL = "127.0.0.1:8500"
+		if c.HostMode == "docker" {
+			c.ConsulURL = "consul:8500"
+		}
 	}
-
-	// Lấy cấu hình dựa vào môi trường
-	envPrefix := "DEV_"
-	if cfg.Environment == "production" {
-		envPrefix = "PROD_"
+	if c.DBHost == "" {
+		c.DBHost = "localhost"
+		if c.HostMode == "docker" {
+			c.DBHost = "postgres"
+		}
 	}
+}
 
-	// Xác định URL Consul dựa trên chế độ host
-	if cfg.HostMode == "docker" {
-		// Trong Docker, sử dụng tên service làm hostname
-		cfg.ConsulURL = getEnv("CONSUL_URL", "consul:8500")
-	} else {
-		// Khi debug local, sử dụng IP address
-		cfg.ConsulURL = getEnv(envPrefix+"CONSUL_URL", "127.0.0.1:8500")
+// Validate rejects the default service token and identity secret in
+// production and incomplete caller authentication settings
+func (c *Config) Validate() error {
+	var errs sharedconfig.Errors
+	if c.Environment == "production" && c.GRPCAuthMode == interceptor.AuthNone {
+		errs = append(errs, errors.New("grpc.auth.mode: caller authentication must be enabled in production"))
 	}
-
-	// Cổng mặc định là 9001 cho user service
-	portStr := getEnv("PORT", "9001")
-	cfg.Port, _ = strconv.Atoi(portStr)
-
-	// Cấu hình Database - cũng dựa vào HOST_MODE
-	if cfg.HostMode == "docker" {
-		// Trong Docker, dùng tên service của DB
-		cfg.DBHost = getEnv("DB_HOST", "postgres")
-	} else {
-		// Local thì dùng localhost
-		cfg.DBHost = getEnv(envPrefix+"DB_HOST", "localhost")
+	if c.Environment == "production" && c.IdentitySecret == defaultIdentitySecret {
+		errs = append(errs, errors.New("grpc.auth.identity_secret: the default secret must not be used in production"))
+	}
+	tokens, err := interceptor.ParseCallerTokens(c.GRPCCallerTokens)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("grpc.auth.tokens: %w", err))
+	}
+	if c.GRPCAuthMode == interceptor.AuthToken && len(c.GRPCCallerTokens) == 0 {
+		errs = append(errs, errors.New("grpc.auth.tokens: at least one token is required in token mode"))
+	}
+	_, gatewayDefault := tokens[defaultCallerToken]
+	_, fileDefault := tokens[defaultFileServiceToken]
+	if (gatewayDefault || fileDefault) && c.Environment == "production" {
+		errs = append(errs, errors.New("grpc.auth.tokens: the default tokens must not be used in production"))
 	}
+	if c.GRPCAuthMode == interceptor.AuthMTLS && (c.GRPCTLSCert == "" || c.GRPCTLSKey == "" || c.GRPCTLSClientCA == "") {
+		errs = append(errs, errors.New("grpc.tls: cert_file, key_file and client_ca_file are required in mtls mode"))
+	}
+	if _, err := interceptor.ParseMethodDeadlines(c.GRPCMethodLimits); err != nil {
+		errs = append(errs, fmt.Errorf("grpc.method_deadlines: %w", err))
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
 
-	dbPortStr := getEnv("DB_PORT", getEnv(envPrefix+"DB_PORT", "5432"))
-	cfg.DBPort, _ = strconv.Atoi(dbPortStr)
-	cfg.DBUser = getEnv("DB_USER", getEnv(envPrefix+"DB_USER", "postgres"))
-	cfg.DBPassword = getEnv("DB_PASSWORD", getEnv(envPrefix+"DB_PASSWORD", "postgres"))
-	cfg.DBName = getEnv("DB_NAME", getEnv(envPrefix+"DB_NAME", "users"))
+// CallerTokens returns the accepted service tokens mapped to their identity.
+// The tokens were checked by Validate.
+func (c *Config) CallerTokens() map[string]string {
+	tokens, _ := interceptor.ParseCallerTokens(c.GRPCCallerTokens)
+	return tokens
+}
 
-	return cfg
+// Deadlines returns the RPC deadline caps. The method overrides were checked
+// by Validate.
+func (c *Config) Deadlines() interceptor.Deadlines {
+	methods, _ := interceptor.ParseMethodDeadlines(c.GRPCMethodLimits)
+	return interceptor.Deadlines{Unary: c.GRPCMaxDeadline, Stream: c.GRPCMaxStream, Methods: methods}
 }
 
-// getEnv returns the environment variable or the default value
-func getEnv(key, defaultValue string) string {
-	value := os.Getenv(key)
-	if value == "" {
-		return defaultValue
+// legacyEnvPrefix returns the deprecated DEV_/PROD_ prefix for APP_ENV
+func legacyEnvPrefix() string {
+	if os.Getenv("APP_ENV") == "production" {
+		return "PROD_"
 	}
-	return value
+	return "DEV_"
 }
@@ -0,0 +1,48 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Metrics holds the user-service specific Prometheus collectors
+type Metrics struct {
+	RepositoryDuration *prometheus.HistogramVec
+	RepositoryErrors   *prometheus.CounterVec
+	AuthAttempts       *prometheus.CounterVec
+	TokenVerifications *prometheus.CounterVec
+	QuotaExceeded      prometheus.Counter
+	UsageCorrections   prometheus.Counter
+}
+
+// New creates the user-service metrics and registers them on reg
+func New(reg prometheus.Registerer) *Metrics {
+	m := &Metrics{
+		RepositoryDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "user_repository_operation_seconds",
+			Help:    "Duration of user repository operations.",
+			Buckets: []float64{.0005, .001, .005, .01, .025, .05, .1, .25, .5, 1},
+		}, []string{"operation"}),
+		RepositoryErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "user_repository_errors_total",
+			Help: "User repository operations that returned an error, by operation and error.",
+		}, []string{"operation", "error"}),
+		AuthAttempts: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "user_authenticate_total",
+			Help: "Authenticate RPC results (success, unknown_user, bad_password).",
+		}, []string{"outcome"}),
+		TokenVerifications: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "user_access_token_verify_total",
+			Help: "VerifyAccessToken RPC results (success, invalid, expired, unknown_user).",
+		}, []string{"outcome"}),
+		QuotaExceeded: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "user_storage_quota_exceeded_total",
+			Help: "Storage reservations rejected because they would exceed the quota.",
+		}),
+		UsageCorrections: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "user_storage_usage_corrections_total",
+			Help: "Users whose storage usage was corrected by ReconcileStorageUsage.",
+		}),
+	}
+	reg.MustRegister(m.RepositoryDuration, m.RepositoryErrors, m.AuthAttempts, m.TokenVerifications, m.QuotaExceeded, m.UsageCorrections)
+	return m
+}
@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+)
+
+// AccessToken is a personal access token. Only the SHA-256 hash of the
+// secret is stored.
+type AccessToken struct {
+	ID         string    `json:"id"`
+	UserID     string    `json:"user_id"`
+	Name       string    `json:"name"`
+	TokenHash  string    `json:"-"`
+	Prefix     string    `json:"prefix"`
+	Scopes     []string  `json:"scopes"`
+	CreatedAt  time.Time `json:"created_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	LastUsedAt time.Time `json:"last_used_at"` // zero until first use
+}
+
+// Expired reports whether the token is no longer valid at now
+func (t *AccessToken) Expired(now time.Time) bool {
+	return !now.Before(t.ExpiresAt)
+}
@@ -6,40 +6,48 @@ import (
 
 // User represents a user in the system
 type User struct {
-	ID        string    `json:"id"`
-	Username  string    `json:"username"`
-	Email     string    `json:"email"`
-	FirstName string    `json:"first_name"`
-	LastName  string    `json:"last_name"`
-	Password  string    `json:"-"`    // Never expose in JSON
-	Role      string    `json:"role"` // Role of the user (admin, user, etc.)
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID        string `json:"id"`
+	Username  string `json:"username"`
+	Email     string `json:"email"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Password  string `json:"-"`    // Never expose in JSON
+	Role      string `json:"role"` // Role of the user (admin, user, etc.)
+	// StorageLimit is the storage quota in bytes, 0 for unlimited, and
+	// StorageUsed the bytes of the files the user stores
+	StorageLimit int64     `json:"storage_limit"`
+	StorageUsed  int64     `json:"storage_used"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
 }
 
 // UserDTO is a Data Transfer Object for User
 type UserDTO struct {
-	ID        string    `json:"id"`
-	Username  string    `json:"username"`
-	Email     string    `json:"email"`
-	FirstName string    `json:"first_name"`
-	LastName  string    `json:"last_name"`
-	Role      string    `json:"role"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID           string    `json:"id"`
+	Username     string    `json:"username"`
+	Email        string    `json:"email"`
+	FirstName    string    `json:"first_name"`
+	LastName     string    `json:"last_name"`
+	Role         string    `json:"role"`
+	StorageLimit int64     `json:"storage_limit"`
+	StorageUsed  int64     `json:"storage_used"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
 }
 
 // ToDTO converts a User to a UserDTO
 func (u *User) ToDTO() *UserDTO {
 	return &UserDTO{
-		ID:        u.ID,
-		Username:  u.Username,
-		Email:     u.Email,
-		FirstName: u.FirstName,
-		LastName:  u.LastName,
-		Role:      u.Role,
-		CreatedAt: u.CreatedAt,
-		UpdatedAt: u.UpdatedAt,
+		ID:           u.ID,
+		Username:     u.Username,
+		Email:        u.Email,
+		FirstName:    u.FirstName,
+		LastName:     u.LastName,
+		Role:         u.Role,
+		StorageLimit: u.StorageLimit,
+		StorageUsed:  u.StorageUsed,
+		CreatedAt:    u.CreatedAt,
+		UpdatedAt:    u.UpdatedAt,
 	}
 }
 
@@ -59,3 +67,12 @@ type UpdateUserRequest struct {
 	LastName  string `json:"last_name"`
 	Password  string `json:"password" validate:"omitempty,min=8"`
 }
+
+// StorageAvailable returns how many more bytes the user may store, or 0 when
+// the storage is unlimited
+func (u *User) StorageAvailable() int64 {
+	if u.StorageLimit == 0 {
+		return 0
+	}
+	return max(u.StorageLimit-u.StorageUsed, 0)
+}
@@ -0,0 +1,101 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/cloud-drive/user-service/internal/models"
+)
+
+// ErrAccessTokenNotFound is returned when an access token is not found
+var ErrAccessTokenNotFound = errors.New("access token not found")
+
+// AccessTokenRepository stores personal access tokens
+type AccessTokenRepository interface {
+	CreateAccessToken(ctx context.Context, token *models.AccessToken) error
+	GetAccessToken(ctx context.Context, id string) (*models.AccessToken, error)
+	// GetAccessTokenByHash looks a token up by the SHA-256 hash of its secret
+	GetAccessTokenByHash(ctx context.Context, hash string) (*models.AccessToken, error)
+	// ListAccessTokens returns the tokens of a user, newest first
+	ListAccessTokens(ctx context.Context, userID string) ([]*models.AccessToken, error)
+	DeleteAccessToken(ctx context.Context, id string) error
+	// TouchAccessToken records when the token was last used
+	TouchAccessToken(ctx context.Context, id string, usedAt time.Time) error
+}
+
+// CreateAccessToken stores a new token
+func (r *InMemoryUserRepository) CreateAccessToken(ctx context.Context, token *models.AccessToken) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored := *token
+	r.tokens[token.ID] = &stored
+	r.tokenHashes[token.TokenHash] = token.ID
+	return nil
+}
+
+// GetAccessToken returns a token by ID
+func (r *InMemoryUserRepository) GetAccessToken(ctx context.Context, id string) (*models.AccessToken, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	token, ok := r.tokens[id]
+	if !ok {
+		return nil, ErrAccessTokenNotFound
+	}
+	copied := *token
+	return &copied, nil
+}
+
+// GetAccessTokenByHash returns a token by the hash of its secret
+func (r *InMemoryUserRepository) GetAccessTokenByHash(ctx context.Context, hash string) (*models.AccessToken, error) {
+	r.mu.RLock()
+	id, ok := r.tokenHashes[hash]
+	r.mu.RUnlock()
+	if !ok {
+		return nil, ErrAccessTokenNotFound
+	}
+	return r.GetAccessToken(ctx, id)
+}
+
+// ListAccessTokens returns the tokens of a user, newest first
+func (r *InMemoryUserRepository) ListAccessTokens(ctx context.Context, userID string) ([]*models.AccessToken, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	tokens := make([]*models.AccessToken, 0)
+	for _, token := range r.tokens {
+		if token.UserID == userID {
+			copied := *token
+			tokens = append(tokens, &copied)
+		}
+	}
+	sort.Slice(tokens, func(i, j int) bool {
+		return tokens[i].CreatedAt.After(tokens[j].CreatedAt)
+	})
+	return tokens, nil
+}
+
+// DeleteAccessToken deletes a token
+func (r *InMemoryUserRepository) DeleteAccessToken(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	token, ok := r.tokens[id]
+	if !ok {
+		return ErrAccessTokenNotFound
+	}
+	delete(r.tokenHashes, token.TokenHash)
+	delete(r.tokens, id)
+	return nil
+}
+
+// TouchAccessToken records the last-used time of a token
+func (r *InMemoryUserRepository) TouchAccessToken(ctx context.Context, id string, usedAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	token, ok := r.tokens[id]
+	if !ok {
+		return ErrAccessTokenNotFound
+	}
+	token.LastUsedAt = usedAt
+	return nil
+}
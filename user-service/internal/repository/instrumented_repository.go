@@ -0,0 +1,222 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/cloud-drive/user-service/internal/metrics"
+	"github.com/cloud-drive/user-service/internal/models"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// InstrumentedUserRepository records a trace span, latency and errors for
+// every call to the wrapped repository
+type InstrumentedUserRepository struct {
+	next    UserRepository
+	metrics *metrics.Metrics
+	tracer  trace.Tracer
+}
+
+// NewInstrumentedUserRepository wraps next with tracing and Prometheus instrumentation
+func NewInstrumentedUserRepository(next UserRepository, m *metrics.Metrics) *InstrumentedUserRepository {
+	return &InstrumentedUserRepository{
+		next:    next,
+		metrics: m,
+		tracer:  otel.Tracer("github.com/cloud-drive/user-service/internal/repository"),
+	}
+}
+
+// begin starts a span for operation and returns the function that ends it
+// and records the metrics
+func (r *InstrumentedUserRepository) begin(ctx context.Context, operation string) (context.Context, func(error)) {
+	ctx, span := r.tracer.Start(ctx, "UserRepository."+operation,
+		trace.WithSpanKind(trace.SpanKindInternal),
+		trace.WithAttributes(attribute.String("db.operation", operation)),
+	)
+	start := time.Now()
+	return ctx, func(err error) {
+		r.observe(operation, start, err)
+		if err != nil && !errors.Is(err, ErrUserNotFound) && !errors.Is(err, ErrAccessTokenNotFound) && !errors.Is(err, ErrQuotaExceeded) {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}
+}
+
+// observe records the duration and outcome of an operation started at start
+func (r *InstrumentedUserRepository) observe(operation string, start time.Time, err error) {
+	r.metrics.RepositoryDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+	if err == nil {
+		return
+	}
+	reason := "internal"
+	switch {
+	case errors.Is(err, ErrUserNotFound), errors.Is(err, ErrAccessTokenNotFound):
+		reason = "not_found"
+	case errors.Is(err, ErrUserExists):
+		reason = "exists"
+	case errors.Is(err, ErrQuotaExceeded):
+		reason = "quota_exceeded"
+	}
+	r.metrics.RepositoryErrors.WithLabelValues(operation, reason).Inc()
+}
+
+// Create creates a new user
+func (r *InstrumentedUserRepository) Create(ctx context.Context, user *models.User) error {
+	ctx, end := r.begin(ctx, "create")
+	err := r.next.Create(ctx, user)
+	end(err)
+	return err
+}
+
+// GetByID returns a user by ID
+func (r *InstrumentedUserRepository) GetByID(ctx context.Context, id string) (*models.User, error) {
+	ctx, end := r.begin(ctx, "get_by_id")
+	user, err := r.next.GetByID(ctx, id)
+	end(err)
+	return user, err
+}
+
+// GetByUsername returns a user by username
+func (r *InstrumentedUserRepository) GetByUsername(ctx context.Context, username string) (*models.User, error) {
+	ctx, end := r.begin(ctx, "get_by_username")
+	user, err := r.next.GetByUsername(ctx, username)
+	end(err)
+	return user, err
+}
+
+// GetByEmail returns a user by email
+func (r *InstrumentedUserRepository) GetByEmail(ctx context.Context, email string) (*models.User, error) {
+	ctx, end := r.begin(ctx, "get_by_email")
+	user, err := r.next.GetByEmail(ctx, email)
+	end(err)
+	return user, err
+}
+
+// Update updates a user
+func (r *InstrumentedUserRepository) Update(ctx context.Context, user *models.User) error {
+	ctx, end := r.begin(ctx, "update")
+	err := r.next.Update(ctx, user)
+	end(err)
+	return err
+}
+
+// Delete deletes a user
+func (r *InstrumentedUserRepository) Delete(ctx context.Context, id string) error {
+	ctx, end := r.begin(ctx, "delete")
+	err := r.next.Delete(ctx, id)
+	end(err)
+	return err
+}
+
+// List returns a list of users
+func (r *InstrumentedUserRepository) List(ctx context.Context, limit, offset int) ([]*models.User, error) {
+	ctx, end := r.begin(ctx, "list")
+	users, err := r.next.List(ctx, limit, offset)
+	end(err)
+	return users, err
+}
+
+// FindByEmail finds a user by email
+func (r *InstrumentedUserRepository) FindByEmail(ctx context.Context, email string) (*models.User, error) {
+	ctx, end := r.begin(ctx, "find_by_email")
+	user, err := r.next.FindByEmail(ctx, email)
+	end(err)
+	return user, err
+}
+
+// Ping checks the wrapped repository. Health probes are not recorded so they
+// do not drown real traffic in metrics and traces.
+func (r *InstrumentedUserRepository) Ping(ctx context.Context) error {
+	return r.next.Ping(ctx)
+}
+
+// Close closes the wrapped repository
+func (r *InstrumentedUserRepository) Close() error {
+	return r.next.Close()
+}
+
+// CreateAccessToken stores a new access token
+func (r *InstrumentedUserRepository) CreateAccessToken(ctx context.Context, token *models.AccessToken) error {
+	ctx, end := r.begin(ctx, "create_access_token")
+	err := r.next.CreateAccessToken(ctx, token)
+	end(err)
+	return err
+}
+
+// GetAccessToken returns an access token by ID
+func (r *InstrumentedUserRepository) GetAccessToken(ctx context.Context, id string) (*models.AccessToken, error) {
+	ctx, end := r.begin(ctx, "get_access_token")
+	token, err := r.next.GetAccessToken(ctx, id)
+	end(err)
+	return token, err
+}
+
+// GetAccessTokenByHash returns an access token by the hash of its secret
+func (r *InstrumentedUserRepository) GetAccessTokenByHash(ctx context.Context, hash string) (*models.AccessToken, error) {
+	ctx, end := r.begin(ctx, "get_access_token_by_hash")
+	token, err := r.next.GetAccessTokenByHash(ctx, hash)
+	end(err)
+	return token, err
+}
+
+// ListAccessTokens returns the access tokens of a user
+func (r *InstrumentedUserRepository) ListAccessTokens(ctx context.Context, userID string) ([]*models.AccessToken, error) {
+	ctx, end := r.begin(ctx, "list_access_tokens")
+	tokens, err := r.next.ListAccessTokens(ctx, userID)
+	end(err)
+	return tokens, err
+}
+
+// DeleteAccessToken deletes an access token
+func (r *InstrumentedUserRepository) DeleteAccessToken(ctx context.Context, id string) error {
+	ctx, end := r.begin(ctx, "delete_access_token")
+	err := r.next.DeleteAccessToken(ctx, id)
+	end(err)
+	return err
+}
+
+// TouchAccessToken records the last-used time of an access token
+func (r *InstrumentedUserRepository) TouchAccessToken(ctx context.Context, id string, usedAt time.Time) error {
+	ctx, end := r.begin(ctx, "touch_access_token")
+	err := r.next.TouchAccessToken(ctx, id, usedAt)
+	end(err)
+	return err
+}
+
+// ReserveStorage adds to the storage usage of a user
+func (r *InstrumentedUserRepository) ReserveStorage(ctx context.Context, userID string, bytes int64) (*models.User, error) {
+	ctx, end := r.begin(ctx, "reserve_storage")
+	user, err := r.next.ReserveStorage(ctx, userID, bytes)
+	end(err)
+	return user, err
+}
+
+// ReleaseStorage subtracts from the storage usage of a user
+func (r *InstrumentedUserRepository) ReleaseStorage(ctx context.Context, userID string, bytes int64) (*models.User, error) {
+	ctx, end := r.begin(ctx, "release_storage")
+	user, err := r.next.ReleaseStorage(ctx, userID, bytes)
+	end(err)
+	return user, err
+}
+
+// SetStorageLimit changes the storage limit of a user
+func (r *InstrumentedUserRepository) SetStorageLimit(ctx context.Context, userID string, limit int64) (*models.User, error) {
+	ctx, end := r.begin(ctx, "set_storage_limit")
+	user, err := r.next.SetStorageLimit(ctx, userID, limit)
+	end(err)
+	return user, err
+}
+
+// ReconcileStorageUsage replaces the storage usage of all users
+func (r *InstrumentedUserRepository) ReconcileStorageUsage(ctx context.Context, used map[string]int64) (map[string]int64, error) {
+	ctx, end := r.begin(ctx, "reconcile_storage_usage")
+	corrected, err := r.next.ReconcileStorageUsage(ctx, used)
+	end(err)
+	return corrected, err
+}
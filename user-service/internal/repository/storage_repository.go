@@ -0,0 +1,86 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/cloud-drive/user-service/internal/models"
+)
+
+// ErrQuotaExceeded is returned when a reservation would take a user over
+// their storage limit
+var ErrQuotaExceeded = errors.New("storage quota exceeded")
+
+// StorageRepository keeps the storage quota of users. Every method changes
+// the quota of one user atomically and returns the user as updated.
+type StorageRepository interface {
+	// ReserveStorage adds bytes to the usage of a user, or fails with
+	// ErrQuotaExceeded and changes nothing when that would exceed the limit
+	ReserveStorage(ctx context.Context, userID string, bytes int64) (*models.User, error)
+	// ReleaseStorage subtracts bytes from the usage of a user, never going
+	// below zero
+	ReleaseStorage(ctx context.Context, userID string, bytes int64) (*models.User, error)
+	// SetStorageLimit changes the limit of a user; 0 means unlimited. Usage
+	// above a lowered limit is kept, only new reservations fail.
+	SetStorageLimit(ctx context.Context, userID string, limit int64) (*models.User, error)
+	// ReconcileStorageUsage sets the usage of every user to the bytes given
+	// for their ID, 0 when there is none, and returns the users whose usage
+	// changed with their usage before the change
+	ReconcileStorageUsage(ctx context.Context, used map[string]int64) (map[string]int64, error)
+}
+
+// ReserveStorage adds to the usage of a user within the limit
+func (r *InMemoryUserRepository) ReserveStorage(ctx context.Context, userID string, bytes int64) (*models.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	user, ok := r.users[userID]
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+	if user.StorageLimit > 0 && user.StorageUsed+bytes > user.StorageLimit {
+		return nil, ErrQuotaExceeded
+	}
+	user.StorageUsed += bytes
+	copied := *user
+	return &copied, nil
+}
+
+// ReleaseStorage subtracts from the usage of a user
+func (r *InMemoryUserRepository) ReleaseStorage(ctx context.Context, userID string, bytes int64) (*models.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	user, ok := r.users[userID]
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+	user.StorageUsed = max(user.StorageUsed-bytes, 0)
+	copied := *user
+	return &copied, nil
+}
+
+// SetStorageLimit changes the limit of a user
+func (r *InMemoryUserRepository) SetStorageLimit(ctx context.Context, userID string, limit int64) (*models.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	user, ok := r.users[userID]
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+	user.StorageLimit = limit
+	copied := *user
+	return &copied, nil
+}
+
+// ReconcileStorageUsage replaces the usage of all users
+func (r *InMemoryUserRepository) ReconcileStorageUsage(ctx context.Context, used map[string]int64) (map[string]int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	corrected := make(map[string]int64)
+	for id, user := range r.users {
+		if user.StorageUsed != used[id] {
+			corrected[id] = user.StorageUsed
+			user.StorageUsed = used[id]
+		}
+	}
+	return corrected, nil
+}
@@ -3,7 +3,6 @@ package repository
 import (
 	"context"
 	"errors"
-	"fmt"
 	"github.com/cloud-drive/user-service/internal/models"
 	"github.com/google/uuid"
 	"sync"
@@ -25,24 +24,40 @@ type UserRepository interface {
 	Update(ctx context.Context, user *models.User) error
 	Delete(ctx context.Context, id string) error
 	List(ctx context.Context, limit, offset int) ([]*models.User, error)
-	FindByEmail(email string) (*models.User, error)
+	FindByEmail(ctx context.Context, email string) (*models.User, error)
+	// Ping checks that the underlying storage is reachable
+	Ping(ctx context.Context) error
+	// Close releases the storage connections during shutdown
+	Close() error
+
+	AccessTokenRepository
+	StorageRepository
 }
 
 // InMemoryUserRepository is an in-memory implementation of UserRepository
 type InMemoryUserRepository struct {
 	users map[string]*models.User
 	mu    sync.RWMutex
+
+	// Personal access token theo ID, và ID theo hash của secret
+	tokens      map[string]*models.AccessToken
+	tokenHashes map[string]string
 }
 
 // NewInMemoryUserRepository creates a new in-memory user repository
 func NewInMemoryUserRepository() *InMemoryUserRepository {
 	return &InMemoryUserRepository{
-		users: make(map[string]*models.User),
+		users:       make(map[string]*models.User),
+		tokens:      make(map[string]*models.AccessToken),
+		tokenHashes: make(map[string]string),
 	}
 }
 
 // Create creates a new user
 func (r *InMemoryUserRepository) Create(ctx context.Context, user *models.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
 	// Check if user with same username or email already exists
 	for _, u := range r.users {
 		if u.Username == user.Username {
@@ -59,24 +74,31 @@ func (r *InMemoryUserRepository) Create(ctx context.Context, user *models.User)
 	}
 
 	// Store the user
-	r.users[user.ID] = user
+	stored := *user
+	r.users[user.ID] = &stored
 	return nil
 }
 
 // GetByID returns a user by ID
 func (r *InMemoryUserRepository) GetByID(ctx context.Context, id string) (*models.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
 	user, ok := r.users[id]
 	if !ok {
 		return nil, ErrUserNotFound
 	}
-	return user, nil
+	copied := *user
+	return &copied, nil
 }
 
 // GetByUsername returns a user by username
 func (r *InMemoryUserRepository) GetByUsername(ctx context.Context, username string) (*models.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
 	for _, user := range r.users {
 		if user.Username == username {
-			return user, nil
+			copied := *user
+			return &copied, nil
 		}
 	}
 	return nil, ErrUserNotFound
@@ -84,40 +106,55 @@ func (r *InMemoryUserRepository) GetByUsername(ctx context.Context, username str
 
 // GetByEmail returns a user by email
 func (r *InMemoryUserRepository) GetByEmail(ctx context.Context, email string) (*models.User, error) {
-	for _, user := range r.users {
-		if user.Email == email {
-			return user, nil
-		}
-	}
-	return nil, ErrUserNotFound
+	return r.FindByEmail(ctx, email)
 }
 
-// Update updates a user
+// Update updates a user. The storage quota is kept: it changes only through
+// the StorageRepository methods, so an update does not undo a reservation
+// made since the user was read.
 func (r *InMemoryUserRepository) Update(ctx context.Context, user *models.User) error {
-	_, ok := r.users[user.ID]
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	current, ok := r.users[user.ID]
 	if !ok {
 		return ErrUserNotFound
 	}
-	r.users[user.ID] = user
+	stored := *user
+	stored.StorageLimit = current.StorageLimit
+	stored.StorageUsed = current.StorageUsed
+	r.users[user.ID] = &stored
 	return nil
 }
 
 // Delete deletes a user
 func (r *InMemoryUserRepository) Delete(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
 	_, ok := r.users[id]
 	if !ok {
 		return ErrUserNotFound
 	}
 	delete(r.users, id)
+
+	// Token của người dùng bị xoá không còn dùng được
+	for tokenID, token := range r.tokens {
+		if token.UserID == id {
+			delete(r.tokenHashes, token.TokenHash)
+			delete(r.tokens, tokenID)
+		}
+	}
 	return nil
 }
 
 // List returns a list of users
 func (r *InMemoryUserRepository) List(ctx context.Context, limit, offset int) ([]*models.User, error) {
+	r.mu.RLock()
 	users := make([]*models.User, 0, len(r.users))
 	for _, user := range r.users {
-		users = append(users, user)
+		copied := *user
+		users = append(users, &copied)
 	}
+	r.mu.RUnlock()
 
 	// Apply pagination
 	if offset >= len(users) {
@@ -133,15 +170,26 @@ func (r *InMemoryUserRepository) List(ctx context.Context, limit, offset int) ([
 }
 
 // FindByEmail tìm người dùng theo email
-func (r *InMemoryUserRepository) FindByEmail(email string) (*models.User, error) {
+func (r *InMemoryUserRepository) FindByEmail(ctx context.Context, email string) (*models.User, error) {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 
 	for _, user := range r.users {
 		if user.Email == email {
-			return user, nil
+			copied := *user
+			return &copied, nil
 		}
 	}
 
-	return nil, fmt.Errorf("user not found with email: %s", email)
+	return nil, ErrUserNotFound
+}
+
+// Ping always succeeds for the in-memory repository
+func (r *InMemoryUserRepository) Ping(ctx context.Context) error {
+	return nil
+}
+
+// Close is a no-op for the in-memory repository
+func (r *InMemoryUserRepository) Close() error {
+	return nil
 }
@@ -0,0 +1,227 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/cloud-drive/proto-definitions/user"
+	"github.com/cloud-drive/shared/identity"
+	"github.com/cloud-drive/user-service/internal/models"
+	"github.com/cloud-drive/user-service/internal/repository"
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// AccessTokenPrefix starts every personal access token, so the gateway can
+// tell them from JWTs and leaked tokens are easy to scan for
+const AccessTokenPrefix = "cdp_"
+
+// Scopes of personal access tokens
+const (
+	ScopeRead  = "read"
+	ScopeWrite = "write"
+)
+
+const (
+	// defaultTokenDays applies when CreateAccessToken has no expiry
+	defaultTokenDays = 30
+	// maxTokenDays is the longest lifetime of a token
+	maxTokenDays = 365
+	// maxTokensPerUser caps how many tokens a user may hold
+	maxTokensPerUser = 50
+	// tokenDisplayLength is how much of the secret is kept to identify a token
+	tokenDisplayLength = len(AccessTokenPrefix) + 8
+	// touchInterval limits how often last-used is written for a busy token
+	touchInterval = time.Minute
+)
+
+// CreateAccessToken tạo personal access token cho người dùng đang đăng nhập.
+// Secret chỉ được trả về một lần; repository chỉ lưu hash.
+func (s *UserService) CreateAccessToken(ctx context.Context, req *user.CreateAccessTokenRequest) (*user.CreateAccessTokenResponse, error) {
+	caller, ok := identity.FromContext(ctx)
+	if !ok {
+		return nil, status.Errorf(codes.Unauthenticated, "user identity required")
+	}
+
+	existing, err := s.repo.ListAccessTokens(ctx, caller.UserID)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to list access tokens: %v", err)
+	}
+	if len(existing) >= maxTokensPerUser {
+		return nil, status.Errorf(codes.ResourceExhausted, "at most %d access tokens per user", maxTokensPerUser)
+	}
+
+	secret, err := newAccessTokenSecret()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to generate access token: %v", err)
+	}
+
+	days := int(req.ExpiresInDays)
+	if days == 0 {
+		days = defaultTokenDays
+	}
+	scopes := req.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{ScopeRead}
+	}
+
+	now := time.Now()
+	token := &models.AccessToken{
+		ID:        uuid.New().String(),
+		UserID:    caller.UserID,
+		Name:      req.Name,
+		TokenHash: hashAccessToken(secret),
+		Prefix:    secret[:tokenDisplayLength],
+		Scopes:    scopes,
+		CreatedAt: now,
+		ExpiresAt: now.AddDate(0, 0, days),
+	}
+	if err := s.repo.CreateAccessToken(ctx, token); err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to create access token: %v", err)
+	}
+
+	return &user.CreateAccessTokenResponse{
+		AccessToken: convertAccessTokenToProto(token),
+		Token:       secret,
+	}, nil
+}
+
+// ListAccessTokens liệt kê token của người dùng đang đăng nhập
+func (s *UserService) ListAccessTokens(ctx context.Context, req *user.ListAccessTokensRequest) (*user.ListAccessTokensResponse, error) {
+	caller, ok := identity.FromContext(ctx)
+	if !ok {
+		return nil, status.Errorf(codes.Unauthenticated, "user identity required")
+	}
+
+	tokens, err := s.repo.ListAccessTokens(ctx, caller.UserID)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to list access tokens: %v", err)
+	}
+
+	protoTokens := make([]*user.AccessToken, 0, len(tokens))
+	for _, t := range tokens {
+		protoTokens = append(protoTokens, convertAccessTokenToProto(t))
+	}
+
+	return &user.ListAccessTokensResponse{
+		AccessTokens: protoTokens,
+	}, nil
+}
+
+// RevokeAccessToken thu hồi token. Token của người khác được báo là không tồn
+// tại để không lộ ID, trừ khi người gọi là admin.
+func (s *UserService) RevokeAccessToken(ctx context.Context, req *user.RevokeAccessTokenRequest) (*user.RevokeAccessTokenResponse, error) {
+	caller, ok := identity.FromContext(ctx)
+	if !ok {
+		return nil, status.Errorf(codes.Unauthenticated, "user identity required")
+	}
+
+	token, err := s.repo.GetAccessToken(ctx, req.Id)
+	if err != nil {
+		if errors.Is(err, repository.ErrAccessTokenNotFound) {
+			return nil, status.Errorf(codes.NotFound, "access token not found")
+		}
+		return nil, status.Errorf(codes.Internal, "failed to get access token: %v", err)
+	}
+	if token.UserID != caller.UserID && !caller.IsAdmin() {
+		return nil, status.Errorf(codes.NotFound, "access token not found")
+	}
+
+	if err := s.repo.DeleteAccessToken(ctx, token.ID); err != nil {
+		if errors.Is(err, repository.ErrAccessTokenNotFound) {
+			return nil, status.Errorf(codes.NotFound, "access token not found")
+		}
+		return nil, status.Errorf(codes.Internal, "failed to revoke access token: %v", err)
+	}
+
+	return &user.RevokeAccessTokenResponse{
+		Success: true,
+	}, nil
+}
+
+// VerifyAccessToken kiểm tra secret do gateway gửi tới và trả về token cùng
+// người dùng sở hữu nó. Mọi lỗi xác thực đều là Unauthenticated để không
+// phân biệt token sai, hết hạn hay đã thu hồi.
+func (s *UserService) VerifyAccessToken(ctx context.Context, req *user.VerifyAccessTokenRequest) (*user.VerifyAccessTokenResponse, error) {
+	if !strings.HasPrefix(req.Token, AccessTokenPrefix) {
+		s.metrics.TokenVerifications.WithLabelValues("invalid").Inc()
+		return nil, status.Errorf(codes.Unauthenticated, "invalid access token")
+	}
+
+	token, err := s.repo.GetAccessTokenByHash(ctx, hashAccessToken(req.Token))
+	if err != nil {
+		if errors.Is(err, repository.ErrAccessTokenNotFound) {
+			s.metrics.TokenVerifications.WithLabelValues("invalid").Inc()
+			return nil, status.Errorf(codes.Unauthenticated, "invalid access token")
+		}
+		return nil, status.Errorf(codes.Internal, "failed to get access token: %v", err)
+	}
+
+	now := time.Now()
+	if token.Expired(now) {
+		s.metrics.TokenVerifications.WithLabelValues("expired").Inc()
+		return nil, status.Errorf(codes.Unauthenticated, "invalid access token")
+	}
+
+	userModel, err := s.repo.GetByID(ctx, token.UserID)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			s.metrics.TokenVerifications.WithLabelValues("unknown_user").Inc()
+			return nil, status.Errorf(codes.Unauthenticated, "invalid access token")
+		}
+		return nil, status.Errorf(codes.Internal, "failed to get user: %v", err)
+	}
+
+	// Chỉ ghi last-used khi đã cũ để token dùng liên tục không ghi mỗi request
+	if now.Sub(token.LastUsedAt) >= touchInterval {
+		if err := s.repo.TouchAccessToken(ctx, token.ID, now); err == nil {
+			token.LastUsedAt = now
+		}
+	}
+	s.metrics.TokenVerifications.WithLabelValues("success").Inc()
+
+	return &user.VerifyAccessTokenResponse{
+		AccessToken: convertAccessTokenToProto(token),
+		User:        convertUserToProto(userModel),
+	}, nil
+}
+
+// newAccessTokenSecret returns a new secret with 256 bits of randomness
+func newAccessTokenSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return AccessTokenPrefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashAccessToken returns the stored form of a secret. Secrets are random, so
+// an unsalted SHA-256 is enough and keeps lookups by hash possible.
+func hashAccessToken(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// convertAccessTokenToProto converts an access token model to a proto token
+func convertAccessTokenToProto(t *models.AccessToken) *user.AccessToken {
+	token := &user.AccessToken{
+		Id:        t.ID,
+		UserId:    t.UserID,
+		Name:      t.Name,
+		Scopes:    t.Scopes,
+		Prefix:    t.Prefix,
+		CreatedAt: t.CreatedAt.Format(time.RFC3339),
+		ExpiresAt: t.ExpiresAt.Format(time.RFC3339),
+	}
+	if !t.LastUsedAt.IsZero() {
+		token.LastUsedAt = t.LastUsedAt.Format(time.RFC3339)
+	}
+	return token
+}
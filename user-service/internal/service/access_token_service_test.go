@@ -0,0 +1,183 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloud-drive/proto-definitions/user"
+	"github.com/cloud-drive/shared/identity"
+	"github.com/cloud-drive/user-service/internal/metrics"
+	"github.com/cloud-drive/user-service/internal/models"
+	"github.com/cloud-drive/user-service/internal/repository"
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// newTestService returns a service over an in-memory repository holding one
+// user, and a context acting as that user
+func newTestService(t *testing.T) (*UserService, *repository.InMemoryUserRepository, context.Context) {
+	t.Helper()
+	repo := repository.NewInMemoryUserRepository()
+	u := &models.User{Username: "alice", Email: "alice@example.com", Role: "user"}
+	if err := repo.Create(context.Background(), u); err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	s := NewUserService(repo, metrics.New(prometheus.NewRegistry()), 0)
+	ctx := identity.NewContext(context.Background(), identity.Identity{UserID: u.ID, Role: "user"})
+	return s, repo, ctx
+}
+
+// createToken creates a token for the user of ctx and returns its secret
+func createToken(t *testing.T, s *UserService, ctx context.Context, scopes ...string) (*user.AccessToken, string) {
+	t.Helper()
+	resp, err := s.CreateAccessToken(ctx, &user.CreateAccessTokenRequest{Name: "ci", Scopes: scopes})
+	if err != nil {
+		t.Fatalf("CreateAccessToken: %v", err)
+	}
+	return resp.AccessToken, resp.Token
+}
+
+func sha256Hex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestAccessTokenIsStoredAsHash(t *testing.T) {
+	s, repo, ctx := newTestService(t)
+	created, secret := createToken(t, s, ctx, ScopeRead, ScopeWrite)
+
+	if !strings.HasPrefix(secret, AccessTokenPrefix) {
+		t.Fatalf("secret %q does not start with %q", secret, AccessTokenPrefix)
+	}
+	stored, err := repo.GetAccessToken(context.Background(), created.Id)
+	if err != nil {
+		t.Fatalf("GetAccessToken: %v", err)
+	}
+	if stored.TokenHash != sha256Hex(secret) {
+		t.Errorf("stored hash = %q, want the SHA-256 of the secret", stored.TokenHash)
+	}
+	if dump := fmt.Sprintf("%+v", *stored); strings.Contains(dump, secret) {
+		t.Errorf("stored token contains the secret: %s", dump)
+	}
+	if !strings.HasPrefix(secret, stored.Prefix) || len(stored.Prefix) >= len(secret) {
+		t.Errorf("stored prefix %q is not a strict prefix of the secret", stored.Prefix)
+	}
+
+	// The secret is only returned on creation
+	list, err := s.ListAccessTokens(ctx, &user.ListAccessTokensRequest{})
+	if err != nil {
+		t.Fatalf("ListAccessTokens: %v", err)
+	}
+	if len(list.AccessTokens) != 1 || strings.Contains(list.AccessTokens[0].String(), secret) {
+		t.Fatalf("ListAccessTokens = %v, want the token without its secret", list.AccessTokens)
+	}
+
+	verified, err := s.VerifyAccessToken(context.Background(), &user.VerifyAccessTokenRequest{Token: secret})
+	if err != nil {
+		t.Fatalf("VerifyAccessToken: %v", err)
+	}
+	if verified.User.Id != stored.UserID || verified.AccessToken.Id != created.Id {
+		t.Errorf("VerifyAccessToken = user %s token %s, want %s and %s", verified.User.Id, verified.AccessToken.Id, stored.UserID, created.Id)
+	}
+	if got := verified.AccessToken.Scopes; len(got) != 2 || got[0] != ScopeRead || got[1] != ScopeWrite {
+		t.Errorf("scopes = %v, want read and write", got)
+	}
+	if verified.AccessToken.LastUsedAt == "" {
+		t.Error("last used time not recorded")
+	}
+}
+
+func TestAccessTokenDefaultsToReadScope(t *testing.T) {
+	s, _, ctx := newTestService(t)
+	created, _ := createToken(t, s, ctx)
+	if len(created.Scopes) != 1 || created.Scopes[0] != ScopeRead {
+		t.Fatalf("scopes = %v, want only read", created.Scopes)
+	}
+}
+
+func TestVerifyAccessTokenRejects(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		// token returns the secret to verify
+		token func(t *testing.T, s *UserService, repo *repository.InMemoryUserRepository, ctx context.Context) string
+	}{
+		{"unknown secret", func(t *testing.T, s *UserService, repo *repository.InMemoryUserRepository, ctx context.Context) string {
+			createToken(t, s, ctx)
+			return AccessTokenPrefix + "unknown"
+		}},
+		{"secret without prefix", func(t *testing.T, s *UserService, repo *repository.InMemoryUserRepository, ctx context.Context) string {
+			_, secret := createToken(t, s, ctx)
+			return strings.TrimPrefix(secret, AccessTokenPrefix)
+		}},
+		{"stored hash used as secret", func(t *testing.T, s *UserService, repo *repository.InMemoryUserRepository, ctx context.Context) string {
+			_, secret := createToken(t, s, ctx)
+			return AccessTokenPrefix + sha256Hex(secret)
+		}},
+		{"expired", func(t *testing.T, s *UserService, repo *repository.InMemoryUserRepository, ctx context.Context) string {
+			caller, _ := identity.FromContext(ctx)
+			secret := AccessTokenPrefix + "expired-secret"
+			now := time.Now()
+			err := repo.CreateAccessToken(ctx, &models.AccessToken{
+				ID:        "expired",
+				UserID:    caller.UserID,
+				TokenHash: hashAccessToken(secret),
+				Scopes:    []string{ScopeRead},
+				CreatedAt: now.Add(-48 * time.Hour),
+				ExpiresAt: now.Add(-time.Second),
+			})
+			if err != nil {
+				t.Fatalf("CreateAccessToken: %v", err)
+			}
+			return secret
+		}},
+		{"revoked", func(t *testing.T, s *UserService, repo *repository.InMemoryUserRepository, ctx context.Context) string {
+			created, secret := createToken(t, s, ctx)
+			if _, err := s.RevokeAccessToken(ctx, &user.RevokeAccessTokenRequest{Id: created.Id}); err != nil {
+				t.Fatalf("RevokeAccessToken: %v", err)
+			}
+			return secret
+		}},
+		{"deleted user", func(t *testing.T, s *UserService, repo *repository.InMemoryUserRepository, ctx context.Context) string {
+			_, secret := createToken(t, s, ctx)
+			caller, _ := identity.FromContext(ctx)
+			if err := repo.Delete(ctx, caller.UserID); err != nil {
+				t.Fatalf("Delete: %v", err)
+			}
+			return secret
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s, repo, ctx := newTestService(t)
+			token := tc.token(t, s, repo, ctx)
+
+			_, err := s.VerifyAccessToken(context.Background(), &user.VerifyAccessTokenRequest{Token: token})
+			if status.Code(err) != codes.Unauthenticated {
+				t.Fatalf("VerifyAccessToken = %v, want Unauthenticated", err)
+			}
+		})
+	}
+}
+
+func TestRevokeAccessTokenOfAnotherUser(t *testing.T) {
+	s, _, ctx := newTestService(t)
+	created, secret := createToken(t, s, ctx)
+
+	other := identity.NewContext(context.Background(), identity.Identity{UserID: "someone-else", Role: "user"})
+	if _, err := s.RevokeAccessToken(other, &user.RevokeAccessTokenRequest{Id: created.Id}); status.Code(err) != codes.NotFound {
+		t.Fatalf("RevokeAccessToken by another user = %v, want NotFound", err)
+	}
+	if _, err := s.VerifyAccessToken(context.Background(), &user.VerifyAccessTokenRequest{Token: secret}); err != nil {
+		t.Fatalf("token revoked by another user: %v", err)
+	}
+
+	admin := identity.NewContext(context.Background(), identity.Identity{UserID: "admin", Role: identity.RoleAdmin})
+	if _, err := s.RevokeAccessToken(admin, &user.RevokeAccessTokenRequest{Id: created.Id}); err != nil {
+		t.Fatalf("RevokeAccessToken by an admin: %v", err)
+	}
+}
@@ -0,0 +1,44 @@
+package service
+
+import (
+	"github.com/cloud-drive/proto-definitions/user"
+	"github.com/cloud-drive/shared/interceptor"
+)
+
+// AuthorizationRules returns who may call each RPC on behalf of an end user.
+// They mirror the gateway's access table so a caller that reaches the service
+// directly gets no more than through the gateway. RPCs without a rule are
+// admin only.
+func AuthorizationRules() map[string]interceptor.Rule {
+	return map[string]interceptor.Rule{
+		// Đăng nhập và đăng ký không có người dùng; role admin được kiểm tra trong CreateUser
+		"/user.UserService/Authenticate": {Anonymous: true},
+		"/user.UserService/CreateUser":   {Anonymous: true},
+		// Người dùng chỉ xem và cập nhật được thông tin của chính mình
+		"/user.UserService/GetUser": {
+			Roles: []string{"admin"},
+			Owner: func(req any) string { return req.(*user.GetUserRequest).Id },
+		},
+		"/user.UserService/UpdateUser": {
+			Roles: []string{"admin"},
+			Owner: func(req any) string { return req.(*user.UpdateUserRequest).Id },
+		},
+		"/user.UserService/ListUsers":  interceptor.AdminOnly,
+		"/user.UserService/DeleteUser": interceptor.AdminOnly,
+		// Token luôn thuộc về người gọi nên mọi người dùng đã đăng nhập đều được gọi
+		"/user.UserService/CreateAccessToken": {},
+		"/user.UserService/ListAccessTokens":  {},
+		"/user.UserService/RevokeAccessToken": {},
+		// Gateway xác thực token trước khi biết người dùng là ai
+		"/user.UserService/VerifyAccessToken": {Anonymous: true},
+		// Hạn mức lưu trữ: người dùng xem của mình, chỉ admin đổi được hạn mức
+		"/user.UserService/GetStorageUsage": {},
+		"/user.UserService/SetStorageLimit": interceptor.AdminOnly,
+		// file-service tính dung lượng khi lưu và xoá file, không nhân danh người dùng nào
+		"/user.UserService/ReserveStorage":        {Anonymous: true, Callers: []string{"file-service"}},
+		"/user.UserService/ReleaseStorage":        {Anonymous: true, Callers: []string{"file-service"}},
+		"/user.UserService/ReconcileStorageUsage": {Anonymous: true, Callers: []string{"file-service"}},
+		// file-service tìm người được chia sẻ theo email thay cho chủ sở hữu
+		"/user.UserService/GetUserByEmail": {Anonymous: true, Callers: []string{"file-service"}},
+	}
+}
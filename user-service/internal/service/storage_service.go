@@ -0,0 +1,107 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	"github.com/cloud-drive/proto-definitions/user"
+	"github.com/cloud-drive/shared/identity"
+	"github.com/cloud-drive/user-service/internal/models"
+	"github.com/cloud-drive/user-service/internal/repository"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// GetStorageUsage trả về hạn mức lưu trữ và dung lượng đã dùng của người
+// dùng đang đăng nhập
+func (s *UserService) GetStorageUsage(ctx context.Context, req *user.GetStorageUsageRequest) (*user.StorageUsage, error) {
+	caller, ok := identity.FromContext(ctx)
+	if !ok {
+		return nil, status.Errorf(codes.Unauthenticated, "user identity required")
+	}
+
+	userModel, err := s.repo.GetByID(ctx, caller.UserID)
+	if err != nil {
+		return nil, storageError(err, "get storage usage")
+	}
+	return convertUsageToProto(userModel), nil
+}
+
+// SetStorageLimit đổi hạn mức lưu trữ của người dùng, chỉ admin được gọi.
+// Hạn mức thấp hơn dung lượng đang dùng không xoá gì, chỉ chặn upload mới.
+func (s *UserService) SetStorageLimit(ctx context.Context, req *user.SetStorageLimitRequest) (*user.UserResponse, error) {
+	userModel, err := s.repo.SetStorageLimit(ctx, req.Id, req.LimitBytes)
+	if err != nil {
+		return nil, storageError(err, "set storage limit")
+	}
+	slog.InfoContext(ctx, "Storage limit changed", "user_id", userModel.ID, "limit_bytes", userModel.StorageLimit)
+
+	return &user.UserResponse{
+		User: convertUserToProto(userModel),
+	}, nil
+}
+
+// ReserveStorage được file-service gọi trước khi lưu metadata của file mới
+// hoặc bản sao; vượt hạn mức trả về ResourceExhausted và không thay đổi gì
+func (s *UserService) ReserveStorage(ctx context.Context, req *user.StorageRequest) (*user.StorageUsage, error) {
+	userModel, err := s.repo.ReserveStorage(ctx, req.UserId, req.Bytes)
+	if errors.Is(err, repository.ErrQuotaExceeded) {
+		s.metrics.QuotaExceeded.Inc()
+		current, getErr := s.repo.GetByID(ctx, req.UserId)
+		if getErr != nil {
+			return nil, status.Errorf(codes.ResourceExhausted, "storage quota exceeded")
+		}
+		return nil, status.Errorf(codes.ResourceExhausted, "storage quota exceeded: %d of %d bytes used, %d more requested",
+			current.StorageUsed, current.StorageLimit, req.Bytes)
+	}
+	if err != nil {
+		return nil, storageError(err, "reserve storage")
+	}
+	return convertUsageToProto(userModel), nil
+}
+
+// ReleaseStorage được file-service gọi khi file bị xoá hoặc bị ghi đè
+func (s *UserService) ReleaseStorage(ctx context.Context, req *user.StorageRequest) (*user.StorageUsage, error) {
+	userModel, err := s.repo.ReleaseStorage(ctx, req.UserId, req.Bytes)
+	if err != nil {
+		return nil, storageError(err, "release storage")
+	}
+	return convertUsageToProto(userModel), nil
+}
+
+// ReconcileStorageUsage ghi đè dung lượng đã dùng của mọi người dùng bằng tổng
+// do file-service tính từ các file đang lưu, sửa sai lệch do release thất bại
+// hoặc service dừng giữa chừng
+func (s *UserService) ReconcileStorageUsage(ctx context.Context, req *user.ReconcileStorageUsageRequest) (*user.ReconcileStorageUsageResponse, error) {
+	corrected, err := s.repo.ReconcileStorageUsage(ctx, req.UsedBytes)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to reconcile storage usage: %v", err)
+	}
+	for id, previous := range corrected {
+		slog.InfoContext(ctx, "Corrected storage usage", "user_id", id, "from_bytes", previous, "to_bytes", req.UsedBytes[id])
+	}
+	s.metrics.UsageCorrections.Add(float64(len(corrected)))
+
+	return &user.ReconcileStorageUsageResponse{
+		Corrected: int32(len(corrected)),
+	}, nil
+}
+
+// storageError converts a repository error of a quota operation to a gRPC status
+func storageError(err error, operation string) error {
+	if errors.Is(err, repository.ErrUserNotFound) {
+		return status.Errorf(codes.NotFound, "user not found")
+	}
+	return status.Errorf(codes.Internal, "failed to %s: %v", operation, err)
+}
+
+// convertUsageToProto describes the storage quota of a user
+func convertUsageToProto(u *models.User) *user.StorageUsage {
+	return &user.StorageUsage{
+		UserId:         u.ID,
+		LimitBytes:     u.StorageLimit,
+		UsedBytes:      u.StorageUsed,
+		AvailableBytes: u.StorageAvailable(),
+	}
+}
@@ -3,6 +3,8 @@ package service
 import (
 	"context"
 	"github.com/cloud-drive/proto-definitions/user"
+	"github.com/cloud-drive/shared/identity"
+	"github.com/cloud-drive/user-service/internal/metrics"
 	"github.com/cloud-drive/user-service/internal/models"
 	"github.com/cloud-drive/user-service/internal/repository"
 	"github.com/google/uuid"
@@ -15,18 +17,29 @@ import (
 // UserService implements the gRPC UserService
 type UserService struct {
 	user.UnimplementedUserServiceServer
-	repo repository.UserRepository
+	repo    repository.UserRepository
+	metrics *metrics.Metrics
+	// defaultStorageLimit is the storage quota of new users, 0 for unlimited
+	defaultStorageLimit int64
 }
 
-// NewUserService creates a new UserService
-func NewUserService(repo repository.UserRepository) *UserService {
+// NewUserService creates a new UserService giving new users a storage quota
+// of defaultStorageLimit bytes
+func NewUserService(repo repository.UserRepository, m *metrics.Metrics, defaultStorageLimit int64) *UserService {
 	return &UserService{
-		repo: repo,
+		repo:                repo,
+		metrics:             m,
+		defaultStorageLimit: defaultStorageLimit,
 	}
 }
 
 // CreateUser creates a new user
 func (s *UserService) CreateUser(ctx context.Context, req *user.CreateUserRequest) (*user.UserResponse, error) {
+	// Đăng ký (không có người dùng) và người dùng thường chỉ tạo được tài khoản role "user"
+	if caller, _ := identity.FromContext(ctx); req.Role != "" && req.Role != "user" && !caller.IsAdmin() {
+		return nil, status.Errorf(codes.PermissionDenied, "only admins can create users with role %q", req.Role)
+	}
+
 	// Hash password
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
 	if err != nil {
@@ -36,14 +49,15 @@ func (s *UserService) CreateUser(ctx context.Context, req *user.CreateUserReques
 	// Create user model
 	now := time.Now()
 	userModel := &models.User{
-		ID:        uuid.New().String(),
-		Email:     req.Email,
-		FirstName: req.FirstName,
-		LastName:  req.LastName,
-		Password:  string(hashedPassword),
-		Role:      req.Role,
-		CreatedAt: now,
-		UpdatedAt: now,
+		ID:           uuid.New().String(),
+		Email:        req.Email,
+		FirstName:    req.FirstName,
+		LastName:     req.LastName,
+		Password:     string(hashedPassword),
+		Role:         req.Role,
+		StorageLimit: s.defaultStorageLimit,
+		CreatedAt:    now,
+		UpdatedAt:    now,
 	}
 
 	// Save user
@@ -74,6 +88,21 @@ func (s *UserService) GetUser(ctx context.Context, req *user.GetUserRequest) (*u
 	}, nil
 }
 
+// GetUserByEmail gets a user by email
+func (s *UserService) GetUserByEmail(ctx context.Context, req *user.GetUserByEmailRequest) (*user.UserResponse, error) {
+	userModel, err := s.repo.GetByEmail(ctx, req.Email)
+	if err != nil {
+		if err == repository.ErrUserNotFound {
+			return nil, status.Errorf(codes.NotFound, "user not found")
+		}
+		return nil, status.Errorf(codes.Internal, "failed to get user: %v", err)
+	}
+
+	return &user.UserResponse{
+		User: convertUserToProto(userModel),
+	}, nil
+}
+
 // UpdateUser updates a user
 func (s *UserService) UpdateUser(ctx context.Context, req *user.UpdateUserRequest) (*user.UserResponse, error) {
 	// Get existing user
@@ -149,15 +178,18 @@ func (s *UserService) ListUsers(ctx context.Context, req *user.ListUsersRequest)
 // Authenticate xác thực người dùng bằng email và password
 func (s *UserService) Authenticate(ctx context.Context, req *user.AuthRequest) (*user.UserResponse, error) {
 	// Tìm người dùng theo email
-	userModel, err := s.repo.FindByEmail(req.Email)
+	userModel, err := s.repo.FindByEmail(ctx, req.Email)
 	if err != nil {
+		s.metrics.AuthAttempts.WithLabelValues("unknown_user").Inc()
 		return nil, status.Errorf(codes.NotFound, "user not found")
 	}
 
 	// Kiểm tra mật khẩu
 	if !s.verifyPassword(userModel.Password, req.Password) {
+		s.metrics.AuthAttempts.WithLabelValues("bad_password").Inc()
 		return nil, status.Errorf(codes.Unauthenticated, "invalid credentials")
 	}
+	s.metrics.AuthAttempts.WithLabelValues("success").Inc()
 
 	// Chuyển đổi model thành proto message
 	pbUser := convertUserToProto(userModel)
@@ -183,12 +215,14 @@ func (s *UserService) hashPassword(password string) (string, error) {
 // convertUserToProto converts a user model to a proto user
 func convertUserToProto(userModel *models.User) *user.User {
 	return &user.User{
-		Id:        userModel.ID,
-		Email:     userModel.Email,
-		FirstName: userModel.FirstName,
-		LastName:  userModel.LastName,
-		Role:      userModel.Role,
-		CreatedAt: userModel.CreatedAt.Format(time.RFC3339),
-		UpdatedAt: userModel.UpdatedAt.Format(time.RFC3339),
+		Id:           userModel.ID,
+		Email:        userModel.Email,
+		FirstName:    userModel.FirstName,
+		LastName:     userModel.LastName,
+		Role:         userModel.Role,
+		StorageLimit: userModel.StorageLimit,
+		StorageUsed:  userModel.StorageUsed,
+		CreatedAt:    userModel.CreatedAt.Format(time.RFC3339),
+		UpdatedAt:    userModel.UpdatedAt.Format(time.RFC3339),
 	}
 }
@@ -0,0 +1,167 @@
+package service
+
+import (
+	"errors"
+	"net/mail"
+
+	"github.com/cloud-drive/proto-definitions/user"
+	"github.com/cloud-drive/shared/interceptor"
+)
+
+// maxPasswordLength is the longest password bcrypt hashes without truncation
+const maxPasswordLength = 72
+
+// maxListLimit caps the page size of ListUsers
+const maxListLimit = 1000
+
+// maxTokenNameLength caps the name of an access token
+const maxTokenNameLength = 100
+
+// Validators returns the request validation hooks of the user service by
+// full method name, run by the interceptor chain before the handlers
+func Validators() map[string]interceptor.ValidateFunc {
+	return map[string]interceptor.ValidateFunc{
+		"/user.UserService/CreateUser": func(req any) error {
+			r := req.(*user.CreateUserRequest)
+			if err := validateEmail(r.Email); err != nil {
+				return err
+			}
+			if err := validatePassword(r.Password); err != nil {
+				return err
+			}
+			if r.Role != "" && r.Role != "user" && r.Role != "admin" {
+				return errors.New("role must be user or admin")
+			}
+			return nil
+		},
+		"/user.UserService/GetUser": func(req any) error {
+			return validateID(req.(*user.GetUserRequest).Id)
+		},
+		"/user.UserService/GetUserByEmail": func(req any) error {
+			if req.(*user.GetUserByEmailRequest).Email == "" {
+				return errors.New("email is required")
+			}
+			return nil
+		},
+		"/user.UserService/UpdateUser": func(req any) error {
+			r := req.(*user.UpdateUserRequest)
+			if err := validateID(r.Id); err != nil {
+				return err
+			}
+			if r.Email != "" {
+				if err := validateEmail(r.Email); err != nil {
+					return err
+				}
+			}
+			if r.Password != "" {
+				return validatePassword(r.Password)
+			}
+			return nil
+		},
+		"/user.UserService/DeleteUser": func(req any) error {
+			return validateID(req.(*user.DeleteUserRequest).Id)
+		},
+		"/user.UserService/ListUsers": func(req any) error {
+			r := req.(*user.ListUsersRequest)
+			if r.Limit < 0 || r.Limit > maxListLimit {
+				return errors.New("limit must be between 0 and 1000")
+			}
+			if r.Offset < 0 {
+				return errors.New("offset must not be negative")
+			}
+			return nil
+		},
+		"/user.UserService/Authenticate": func(req any) error {
+			r := req.(*user.AuthRequest)
+			if r.Email == "" || r.Password == "" {
+				return errors.New("email and password are required")
+			}
+			return nil
+		},
+		"/user.UserService/CreateAccessToken": func(req any) error {
+			r := req.(*user.CreateAccessTokenRequest)
+			if r.Name == "" {
+				return errors.New("name is required")
+			}
+			if len(r.Name) > maxTokenNameLength {
+				return errors.New("name must be at most 100 bytes")
+			}
+			for _, scope := range r.Scopes {
+				if scope != ScopeRead && scope != ScopeWrite {
+					return errors.New("scopes must be read or write")
+				}
+			}
+			if r.ExpiresInDays < 0 || r.ExpiresInDays > maxTokenDays {
+				return errors.New("expires_in_days must be between 0 and 365")
+			}
+			return nil
+		},
+		"/user.UserService/RevokeAccessToken": func(req any) error {
+			return validateID(req.(*user.RevokeAccessTokenRequest).Id)
+		},
+		"/user.UserService/VerifyAccessToken": func(req any) error {
+			if req.(*user.VerifyAccessTokenRequest).Token == "" {
+				return errors.New("token is required")
+			}
+			return nil
+		},
+		"/user.UserService/SetStorageLimit": func(req any) error {
+			r := req.(*user.SetStorageLimitRequest)
+			if err := validateID(r.Id); err != nil {
+				return err
+			}
+			if r.LimitBytes < 0 {
+				return errors.New("limit_bytes must not be negative")
+			}
+			return nil
+		},
+		"/user.UserService/ReserveStorage": func(req any) error {
+			return validateStorageRequest(req.(*user.StorageRequest))
+		},
+		"/user.UserService/ReleaseStorage": func(req any) error {
+			return validateStorageRequest(req.(*user.StorageRequest))
+		},
+		"/user.UserService/ReconcileStorageUsage": func(req any) error {
+			for id, used := range req.(*user.ReconcileStorageUsageRequest).UsedBytes {
+				if id == "" || used < 0 {
+					return errors.New("used_bytes must map user IDs to non-negative sizes")
+				}
+			}
+			return nil
+		},
+	}
+}
+
+func validateID(id string) error {
+	if id == "" {
+		return errors.New("id is required")
+	}
+	return nil
+}
+
+func validateStorageRequest(r *user.StorageRequest) error {
+	if err := validateID(r.UserId); err != nil {
+		return err
+	}
+	if r.Bytes < 0 {
+		return errors.New("bytes must not be negative")
+	}
+	return nil
+}
+
+func validateEmail(email string) error {
+	if addr, err := mail.ParseAddress(email); err != nil || addr.Address != email {
+		return errors.New("email is invalid")
+	}
+	return nil
+}
+
+func validatePassword(password string) error {
+	if password == "" {
+		return errors.New("password is required")
+	}
+	if len(password) > maxPasswordLength {
+		return errors.New("password must be at most 72 bytes")
+	}
+	return nil
+}